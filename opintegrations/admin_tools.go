@@ -80,8 +80,8 @@ func startAdminProcessHandler(c *gin.Context) {
 	}
 
 	switch processName {
-	case "runReliasFeeds":
-		go runAllReliasFeeds()
+	case "runExportFeeds", "runReliasFeeds":
+		go runAllExportFeeds()
 	case "runUserProvisioningChanges":
 		go runUserProvisioningChanges()
 	}
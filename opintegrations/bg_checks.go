@@ -1,13 +1,12 @@
 package main
 
 import (
-	"bytes"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +17,7 @@ import (
 type BackgroundCheck struct {
 	ID            int64  `db:"id, primarykey, autoincrement" json:"id"`
 	CompanyID     int64  `db:"company_id" json:"company_id"`
+	Provider      string `db:"provider,size:20" json:"provider"`
 	OPApplicantID string `db:"op_applicant_id" json:"op_applicant_id"`
 	ClientEmail   string `db:"client_email" json:"client_email"`
 	OPJobID       string `db:"op_job_id" json:"op_job_id"`
@@ -30,6 +30,25 @@ type BackgroundCheck struct {
 	FinishedURL   string `db:"finished_url" json:"finished_url"`
 	Initiated     int64  `db:"initiated" json:"initiated"`
 	LastUpdated   *int64 `db:"last_updated" json:"last_updated"`
+
+	OPJobApplicationID string `db:"op_job_application_id,size:50" json:"op_job_application_id"`
+	ProviderReportID   string `db:"provider_report_id,size:100" json:"provider_report_id"`
+	Completed          bool   `db:"completed" json:"completed"`
+	WrittenBack        int64  `db:"written_back" json:"written_back"`
+	WritebackAttempts  int    `db:"writeback_attempts" json:"writeback_attempts"`
+	WritebackError     string `db:"writeback_error,size:1000" json:"writeback_error"`
+
+	// when each write back step went through, a retry skips the ones that did
+	WritebackStageMoved     int64 `db:"writeback_stage_moved" json:"writeback_stage_moved"`
+	WritebackFieldSet       int64 `db:"writeback_field_set" json:"writeback_field_set"`
+	WritebackReportAttached int64 `db:"writeback_report_attached" json:"writeback_report_attached"`
+
+	// FCRA adverse action, the deadline is when the waiting period after the pre-adverse notice runs out
+	Adjudication      string `db:"adjudication,size:30" json:"adjudication"`
+	AdverseDeliveryID int64  `db:"adverse_delivery_id" json:"adverse_delivery_id"`
+	AdverseNoticeSent int64  `db:"adverse_notice_sent" json:"adverse_notice_sent"`
+	AdverseDeadline   int64  `db:"adverse_deadline" json:"adverse_deadline"`
+	AdverseWaitOver   bool   `db:"adverse_wait_over" json:"adverse_wait_over"`
 }
 
 type BGCHECKReport struct {
@@ -47,88 +66,234 @@ type BGCHECKReport struct {
 	RequisitionNumber       string `csv:"Requisition #"`
 	ContactEmail            string `csv:"AssureHire User Email to Use"`
 	BackgroundCheckLevel    string `csv:"Background Check Level"`
+	// needed to move the hiring stage when results come back
+	JobApplicationID string `csv:"Job Application Id"`
+}
+
+// How one company runs background checks: which OnePoint report lists applicants, which hiring stage
+// starts a check, which provider package each OnePoint check level maps to, and the company's own provider account
+type BackgroundCheckConfig struct {
+	ID           int64                      `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID    int64                      `db:"company_id" json:"company_id"`
+	Provider     string                     `db:"provider,size:20" json:"provider"`
+	Enabled      bool                       `db:"enabled" json:"enabled"`
+	TestMode     bool                       `db:"test_mode" json:"test_mode"`
+	ReportID     string                     `db:"report_id,size:50" json:"report_id"`
+	TriggerStage string                     `db:"trigger_stage,size:255" json:"trigger_stage"`
+	PackageMap   PropertyMap                `db:"package_map,size:5000" json:"package_map"`
+	NotifyEmail  string                     `db:"notify_email,size:255" json:"notify_email"`
+	Credentials  BackgroundCheckCredentials `db:"credentials,size:2000" json:"-"`
+	Updated      int64                      `db:"updated" json:"updated"`
+
+	// What happens in OnePoint once a check finishes: ResultStages maps a result (clear, consider, "*" for any other)
+	// to the hiring stage to move the application to, StatusField is the applicant custom field that gets the result
+	// and the report PDF is attached under ReportDocType
+	WritebackEnabled bool        `db:"writeback_enabled" json:"writeback_enabled"`
+	ResultStages     PropertyMap `db:"result_stages,size:2000" json:"result_stages"`
+	StatusField      string      `db:"status_field,size:255" json:"status_field"`
+	ReportDocType    string      `db:"report_doc_type,size:255" json:"report_doc_type"`
+
+	// Adverse action: business days between the pre-adverse notice and the final one, whether the cron sends the
+	// final one by itself, the provider's address and phone for the notices, and an override for the rights summary
+	AdverseWaitDays    int    `db:"adverse_wait_days" json:"adverse_wait_days"`
+	AutoFinalAdverse   bool   `db:"auto_final_adverse" json:"auto_final_adverse"`
+	CRAContact         string `db:"cra_contact,size:1000" json:"cra_contact"`
+	SummaryOfRightsURL string `db:"summary_of_rights_url,size:1000" json:"summary_of_rights_url"`
+
+	HasCredentials bool `db:"-" json:"has_credentials"`
+	// AssureHire only, what to give them as the callback url, only shown to admins
+	WebhookURL string `db:"-" json:"webhook_url,omitempty"`
+}
+
+// AssureHire uses ContactEmail plus APIKey as its bearer token, Checkr only the APIKey
+type BackgroundCheckCredentials struct {
+	APIKey       string `json:"api_key"`
+	ContactEmail string `json:"contact_email"`
+	Subdomain    string `json:"subdomain"`
+	// AssureHire only, the token on the callback url we give them
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+type BackgroundCheckConfigInput struct {
+	Provider     string                      `json:"provider"`
+	Enabled      bool                        `json:"enabled"`
+	TestMode     bool                        `json:"test_mode"`
+	ReportID     string                      `json:"report_id"`
+	TriggerStage string                      `json:"trigger_stage"`
+	PackageMap   PropertyMap                 `json:"package_map"`
+	NotifyEmail  string                      `json:"notify_email"`
+	Credentials  *BackgroundCheckCredentials `json:"credentials"`
+
+	WritebackEnabled bool        `json:"writeback_enabled"`
+	ResultStages     PropertyMap `json:"result_stages"`
+	StatusField      string      `json:"status_field"`
+	ReportDocType    string      `json:"report_doc_type"`
+
+	AdverseWaitDays    int    `json:"adverse_wait_days"`
+	AutoFinalAdverse   bool   `json:"auto_final_adverse"`
+	CRAContact         string `json:"cra_contact"`
+	SummaryOfRightsURL string `json:"summary_of_rights_url"`
+}
+
+type BackgroundCheckProvider interface {
+	Name() string
+	CreateCheck(config BackgroundCheckConfig, applicant BGCHECKReport, packageID string) (BackgroundCheckProviderResult, error)
+	// pulls the provider's id and new status out of a webhook body
+	ParseWebhook(body []byte) (BackgroundCheckWebhookUpdate, error)
+	// checks the webhook came from the provider using the company's credentials
+	VerifyWebhook(config BackgroundCheckConfig, body []byte, req *http.Request) error
+	// the finished report as a PDF, for attaching in OnePoint
+	FetchReportPDF(config BackgroundCheckConfig, check BackgroundCheck) ([]byte, error)
+}
+
+type BackgroundCheckProviderResult struct {
+	ProviderID  string
+	Status      string
+	ReportURL   string
+	ClientEmail string
+}
+
+type BackgroundCheckWebhookUpdate struct {
+	ProviderID string
+	Status     string
+	ReportURL  string
+	ReportID   string
+	Completed  bool
+	// the provider's id for this delivery and when it was sent, for dropping replays
+	EventID string
+	SentAt  time.Time
 }
 
-type AssureHireNewBGCPost struct {
-	Email       string `json:"email"`
-	PackageName string `json:"package_id"`
-	Address     string `json:"address"`
-	SS          string `json:"ssn"`
-	HomePhone   string `json:"home_phone"`
-	MobilePhone string `json:"mobile_phone"`
-	LastName    string `json:"last_name"`
-	FirstName   string `json:"first_name"`
+// What verifyBackgroundCheckWebhook found, handed on to the handler
+type BackgroundCheckWebhook struct {
+	Provider BackgroundCheckProvider
+	Update   BackgroundCheckWebhookUpdate
+	Check    BackgroundCheck
+	Config   BackgroundCheckConfig
 }
 
 func registerBgCheckRoutes(router *gin.Engine) {
-	router.POST("/api/background_checks/providers/:provider", bgCheckWebhookHandler)
+	router.POST("/api/background_checks/providers/:provider", verifyInboundWebhook(WEBHOOK_SOURCE_BGC, verifyBackgroundCheckWebhook), bgCheckWebhookHandler)
+	router.GET("/api/background_checks", getBackgroundChecksHandler)
+	router.GET("/api/background_checks/config", getBackgroundCheckConfigHandler)
+	router.POST("/api/background_checks/config", updateBackgroundCheckConfigHandler)
 }
 
 const (
-	BGC_PROD_COMPANY_SHORT    = "MARIANI"
-	BGC_TEST_COMPANY_SHORT    = "ZJARED"
-	BGC_PROD_REPORT_ID        = "37617485"
-	BGC_TEST_REPORT_ID        = "37617483"
-	USE_ZJARED                = false
-	SEND_TO_AH                = true
-	USE_TEST_EMAIL            = false
-	USE_TEST_SSN              = false
-	ASSURE_HIRE_API_SUBDOMAIN = ""
-	TEST_SSN                  = "773111571"
+	BGC_PROVIDER_ASSUREHIRE = "assurehire"
+	BGC_PROVIDER_CHECKR     = "checkr"
+
+	BGC_WEBHOOK_CONTEXT_KEY = "bgc_webhook"
+	BGC_ASSUREHIRE_WEBHOOK  = "https://connect.onehcm.com/api/background_checks/providers/assurehire?token=%s"
+
+	BGC_REPORT_MAX_TRIES = 3
+	BGC_LIST_LIMIT       = 200
+
+	// only used to seed Mariani's config from how checks ran before they were configurable
+	BGC_LEGACY_COMPANY_SHORT = "MARIANI"
+	BGC_LEGACY_REPORT_ID     = "37617485"
+	BGC_LEGACY_SKIP_LEVEL    = "DO NOT PERFORM BC"
 )
 
-// For now, we just do Mariani x AssureHire
+var backgroundCheckProviders = map[string]BackgroundCheckProvider{
+	BGC_PROVIDER_ASSUREHIRE: &AssureHireProvider{},
+	BGC_PROVIDER_CHECKR:     &CheckrProvider{},
+}
+
+func (bc BackgroundCheckCredentials) Value() (driver.Value, error) {
+	j, err := json.Marshal(bc)
+	return j, err
+}
+
+func (bc *BackgroundCheckCredentials) Scan(src interface{}) error {
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("Type assertion .([]byte) failed.")
+	}
+
+	return json.Unmarshal(source, bc)
+}
+
 func runBgChecks() {
-	comp, err := lookupCompanyByShortname("MARIANI")
+	seedLegacyBackgroundCheckConfig()
+	ensureAssureHireWebhookSecrets()
+
+	configs := []BackgroundCheckConfig{}
+	_, err := dbmap.Select(&configs, "SELECT * FROM background_check_configs WHERE enabled = 1")
 	if err != nil {
-		ErrorLog.Println("could not lookup mariani in bgCheckWebhookHandler")
+		ErrorLog.Println("runBgChecks config lookup err: " + err.Error())
 		return
 	}
 
-	applicants, err := getBGCApplicants()
+	for _, config := range configs {
+		company, err := lookupCompanyByID(config.CompanyID)
+		if err != nil {
+			ErrorLog.Printf("runBgChecks could not lookup company id: %d\n", config.CompanyID)
+			continue
+		}
+
+		err = runCompanyBgChecks(company, config)
+		if err != nil {
+			ErrorLog.Printf("runBgChecks company: %s, err: %v\n", company.ShortName, err)
+		}
+
+		if config.WritebackEnabled {
+			retryBackgroundCheckWritebacks(config)
+		}
+	}
+}
+
+func runCompanyBgChecks(company Company, config BackgroundCheckConfig) error {
+	provider, exists := backgroundCheckProviders[config.Provider]
+	if !exists {
+		return errors.New("unknown background check provider: " + config.Provider)
+	}
+
+	applicants, err := getBGCApplicants(company, config)
 	if err != nil {
-		ErrorLog.Println("getBGCApplicants err: " + err.Error())
-		return
+		return errors.New("getBGCApplicants err: " + err.Error())
 	}
 
-	InfoLog.Printf("runBgChecks report has %d applications in the BC stage\n", len(applicants))
+	InfoLog.Printf("runBgChecks %s report has %d applications\n", company.ShortName, len(applicants))
 
 	alreadyCreatedCount := 0
 	missingInfoCount := 0
 	triedToCreateCount := 0
 	for _, applicant := range applicants {
-		if applicant.BackgroundCheckLevel == "DO NOT PERFORM BC" || applicant.BackgroundCheckLevel == "" {
-			ErrorLog.Printf("Mariani BGC applicant MISSING INFO - applicantID: %s, but BC Level Custom Field is: %s\n", applicant.ApplicantID, applicant.BackgroundCheckLevel)
-			missingInfoCount++
+		if config.TriggerStage != "" && !strings.EqualFold(strings.TrimSpace(applicant.ApplicantionHiringStage), config.TriggerStage) {
 			continue
 		}
 
-		if applicant.ContactEmail == "" {
-			ErrorLog.Printf("Mariani BGC applicant MISSING INFO - applicantID: %s, but AssureHire Contact email is blank\n", applicant.ApplicantID)
+		packageID, perform := config.packageFor(applicant.BackgroundCheckLevel)
+		if !perform {
+			ErrorLog.Printf("%s BGC applicant MISSING INFO - applicantID: %s, but BC Level Custom Field is: %s\n", company.ShortName, applicant.ApplicantID, applicant.BackgroundCheckLevel)
 			missingInfoCount++
 			continue
 		}
 
 		// - Need either email or SSN + F Name L Name or will be ignored
 		if !((applicant.Email != "") || (applicant.SS != "" && applicant.FirstName != "" && applicant.LastName != "")) {
-			ErrorLog.Printf("Mariani BGC applicant MISSING INFO - applicantID: %s, Email: %s, SS: %s, FN: %s, ln: %s\n", applicant.ApplicantID, applicant.Email, applicant.SS, applicant.FirstName, applicant.LastName)
+			ErrorLog.Printf("%s BGC applicant MISSING INFO - applicantID: %s, Email: %s, FN: %s, ln: %s\n", company.ShortName, applicant.ApplicantID, applicant.Email, applicant.FirstName, applicant.LastName)
 			missingInfoCount++
 			continue
 		}
 
-		existingBGCs := []BackgroundCheck{}
-		_, err = dbmap.Select(&existingBGCs, "SELECT * FROM background_checks WHERE op_applicant_id = ? OR email = ?", applicant.ApplicantID, applicant.Email)
-		if len(existingBGCs) > 0 {
+		existingCount, err := dbmap.SelectInt("SELECT COUNT(*) FROM background_checks WHERE company_id = ? AND (op_applicant_id = ? OR email = ?)", company.ID, applicant.ApplicantID, applicant.Email)
+		if err != nil {
+			ErrorLog.Println("runBgChecks existing lookup err: ", err)
+			continue
+		}
+		if existingCount > 0 {
 			alreadyCreatedCount++
 			continue
 		}
 
-		InfoLog.Printf("Mariani BGC - new BackgroundCheck to create, email: %s, level: %s\n", applicant.ContactEmail, applicant.BackgroundCheckLevel)
+		InfoLog.Printf("%s BGC - new BackgroundCheck to create, applicant: %s, level: %s\n", company.ShortName, applicant.ApplicantID, applicant.BackgroundCheckLevel)
 		triedToCreateCount++
 
-		newBGC, err := sendNewBackgroundCheck(comp, applicant)
+		newBGC, err := sendNewBackgroundCheck(company, config, provider, applicant, packageID)
 		if err != nil {
-			ErrorLog.Println("sendNewBackgroundCheck Assure hire err: ", err)
+			ErrorLog.Printf("sendNewBackgroundCheck %s err: %v\n", provider.Name(), err)
 			continue
 		}
 
@@ -136,112 +301,87 @@ func runBgChecks() {
 
 		err = dbmap.Insert(&newBGC)
 		if err != nil {
-			ErrorLog.Println("sendNewBackgroundCheck Assure hire Insert err: ", err)
+			ErrorLog.Printf("sendNewBackgroundCheck %s Insert err: %v\n", provider.Name(), err)
 			continue
 		}
 	}
 
-	InfoLog.Printf("runBgChecks done, missing info: %d, already started: %d, sent to AH to start: %d", missingInfoCount, alreadyCreatedCount, triedToCreateCount)
-}
+	InfoLog.Printf("runBgChecks %s done, missing info: %d, already started: %d, sent to %s to start: %d", company.ShortName, missingInfoCount, alreadyCreatedCount, provider.Name(), triedToCreateCount)
 
-func sendNewBackgroundCheck(company Company, bgcReportApplicant BGCHECKReport) (BackgroundCheck, error) {
-	newBGC := BackgroundCheck{}
+	return nil
+}
 
-	ssn := bgcReportApplicant.SS
-	if USE_TEST_SSN {
-		ssn = TEST_SSN
+// A level mapped to "" means don't run a check, levels not in the map go to the provider as is
+func (config BackgroundCheckConfig) packageFor(level string) (string, bool) {
+	level = strings.TrimSpace(level)
+	if level == "" {
+		return "", false
 	}
 
-	if SEND_TO_AH {
-		sendingBody := AssureHireNewBGCPost{
-			Email:       bgcReportApplicant.Email,
-			PackageName: bgcReportApplicant.BackgroundCheckLevel,
-			Address:     bgcReportApplicant.FullAddress,
-			SS:          ssn,
-			HomePhone:   bgcReportApplicant.HomePhone,
-			MobilePhone: bgcReportApplicant.CellPhone,
-			FirstName:   bgcReportApplicant.FirstName,
-			LastName:    bgcReportApplicant.LastName,
-		}
-
-		url := fmt.Sprintf("https://%sassurehire.com/api/v1/backgroundchecks", ASSURE_HIRE_API_SUBDOMAIN)
-
-		b := new(bytes.Buffer)
-		json.NewEncoder(b).Encode(sendingBody)
-
-		req, err := http.NewRequest("POST", url, b)
-		if err != nil {
-			return newBGC, errors.New("sendNewBackgroundCheck NewRequest err: " + err.Error())
-		}
-		req.Header.Set("Accept", "application/json")
-		req.Header.Set("Content-Type", "application/json")
-
-		authUser := bgcReportApplicant.ContactEmail
-		if USE_TEST_EMAIL {
-			authUser = "robin@marianinut.com"
-		}
-
-		// TODO: what if missing? will error
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s:%s", authUser, passwords.ASSURE_HIRE_TOKEN))
-
-		InfoLog.Printf("sending to AH - body: %+v, url: %s, w authUser: %s\n", sendingBody, url, authUser)
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			return newBGC, errors.New("sendNewBackgroundCheck Do err: " + err.Error())
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode >= 300 {
-			bodyBytes, _ := ioutil.ReadAll(resp.Body)
-			bodyString := string(bodyBytes)
-
-			return newBGC, errors.New(fmt.Sprintf("sendNewBackgroundCheck bad request- status: %d, body: %s", resp.StatusCode, bodyString))
-		}
+	mapped, exists := config.PackageMap[level]
+	if !exists {
+		return level, true
+	}
 
-		assurehireResp := AssureHireBGC{}
-		err = json.NewDecoder(resp.Body).Decode(&assurehireResp)
-		if err != nil {
-			bodyBytes, _ := ioutil.ReadAll(resp.Body)
-			bodyString := string(bodyBytes)
+	packageID, _ := mapped.(string)
+	return packageID, packageID != ""
+}
 
-			ErrorLog.Println("AssureHire sent body: ", bodyString)
-			return newBGC, errors.New("sendNewBackgroundCheck NewDecoder err: " + err.Error())
-		}
+func sendNewBackgroundCheck(company Company, config BackgroundCheckConfig, provider BackgroundCheckProvider, bgcReportApplicant BGCHECKReport, packageID string) (BackgroundCheck, error) {
+	newBGC := BackgroundCheck{
+		CompanyID:          company.ID,
+		Provider:           provider.Name(),
+		Email:              bgcReportApplicant.Email,
+		FirstName:          bgcReportApplicant.FirstName,
+		LastName:           bgcReportApplicant.LastName,
+		OPApplicantID:      bgcReportApplicant.ApplicantID,
+		OPJobID:            bgcReportApplicant.RequisitionNumber,
+		OPJobApplicationID: bgcReportApplicant.JobApplicationID,
+		Type:               bgcReportApplicant.BackgroundCheckLevel,
+		Initiated:          time.Now().Unix(),
+		Adjudication:       BGC_ADJ_PENDING,
+	}
 
-		newBGC.ClientEmail = authUser
-
-		newBGC.CompanyID = company.ID
-		newBGC.Email = bgcReportApplicant.Email
-		newBGC.FirstName = bgcReportApplicant.FirstName
-		newBGC.Initiated = time.Now().Unix()
-		newBGC.LastName = bgcReportApplicant.LastName
-		newBGC.OPApplicantID = bgcReportApplicant.ApplicantID
-		newBGC.OPJobID = bgcReportApplicant.RequisitionNumber
-		newBGC.ProviderID = assurehireResp.ID
-		newBGC.Status = assurehireResp.Status
-		newBGC.Type = bgcReportApplicant.BackgroundCheckLevel
-		newBGC.FinishedURL = assurehireResp.ReportURL
-	} else {
-		newBGC.ClientEmail = bgcReportApplicant.ContactEmail
-		newBGC.CompanyID = company.ID
-		newBGC.Email = bgcReportApplicant.Email
-		newBGC.FirstName = bgcReportApplicant.FirstName
-		newBGC.Initiated = time.Now().Unix()
-		newBGC.LastName = bgcReportApplicant.LastName
-		newBGC.OPApplicantID = bgcReportApplicant.ApplicantID
-		newBGC.OPJobID = bgcReportApplicant.RequisitionNumber
-		newBGC.ProviderID = strconv.Itoa(int(time.Now().Unix()))
+	if config.TestMode {
+		newBGC.ClientEmail = config.contactEmail(bgcReportApplicant)
+		newBGC.ProviderID = fmt.Sprintf("test-%d-%s", time.Now().Unix(), bgcReportApplicant.ApplicantID)
 		newBGC.Status = "test bgc"
-		newBGC.Type = bgcReportApplicant.BackgroundCheckLevel
 		newBGC.FinishedURL = "test.com"
+		return newBGC, nil
+	}
+
+	result, err := provider.CreateCheck(config, bgcReportApplicant, packageID)
+	if err != nil {
+		return newBGC, err
+	}
+
+	newBGC.ProviderID = result.ProviderID
+	newBGC.Status = result.Status
+	newBGC.FinishedURL = result.ReportURL
+	newBGC.ClientEmail = result.ClientEmail
+	if newBGC.ClientEmail == "" {
+		newBGC.ClientEmail = config.contactEmail(bgcReportApplicant)
 	}
 
 	return newBGC, nil
 }
 
+// Who at the company hears about this check, the report column wins over the config
+func (config BackgroundCheckConfig) contactEmail(applicant BGCHECKReport) string {
+	if applicant.ContactEmail != "" {
+		return applicant.ContactEmail
+	}
+	if config.NotifyEmail != "" {
+		return config.NotifyEmail
+	}
+	return config.Credentials.ContactEmail
+}
+
 func sendBGCNotificationEmail(newBGC BackgroundCheck) {
+	if newBGC.ClientEmail == "" {
+		return
+	}
+
 	emailHeaderInfo := sgEmailFields{
 		Subject: fmt.Sprintf("New Background Check initiated for %s %s", newBGC.FirstName, newBGC.LastName),
 		From:    &sgmail.Email{Name: "OnePoint HCM", Address: passwords.NO_REPLY_EMAILER_ADDRESS},
@@ -252,44 +392,37 @@ func sendBGCNotificationEmail(newBGC BackgroundCheck) {
 		ApplicantName: newBGC.FirstName + " " + newBGC.LastName,
 	}
 
-	err := sendTemplatedEmailSendGrid(emailHeaderInfo, BGC_NOTIFICATION_TEMPLATE, emailBody)
+	err := sendNotification(Notification{CompanyID: newBGC.CompanyID, Kind: NOTIFICATION_KIND_BGC, Email: emailHeaderInfo, Template: BGC_NOTIFICATION_TEMPLATE, Data: emailBody})
 	if err != nil {
 		ErrorLog.Printf("sendBGCNotificationEmail emailing err: %v\n", err)
 		return
 	}
 
-	InfoLog.Println("New AssureHire BGC email sent successfully")
+	InfoLog.Printf("New %s BGC email sent successfully\n", newBGC.Provider)
 }
 
-func getBGCApplicants() ([]BGCHECKReport, error) {
-	shortname := BGC_TEST_COMPANY_SHORT
-	reportID := BGC_TEST_REPORT_ID
-	if !USE_ZJARED {
-		shortname = BGC_PROD_COMPANY_SHORT
-		reportID = BGC_PROD_REPORT_ID
-	}
-
+func getBGCApplicants(company Company, config BackgroundCheckConfig) ([]BGCHECKReport, error) {
 	bgcRows := []BGCHECKReport{}
 
-	comp, err := lookupCompanyByShortname(shortname)
-	if err != nil {
-		return bgcRows, errors.New("could not find MARIANI: " + err.Error())
+	if config.ReportID == "" {
+		return bgcRows, errors.New("no report configured")
 	}
 
-	cxn := chooseOPAPICxn(comp.OPID)
+	cxn := chooseOPAPICxn(company.OPID)
 
-	maxTries := 3
 	success := false
-	reportURL := fmt.Sprintf("https://secure.onehcm.com/ta/rest/v1/report/%s/%s?company:shortname=%s", "saved", reportID, shortname)
+	reportURL := fmt.Sprintf("https://secure.onehcm.com/ta/rest/v1/report/%s/%s?company:shortname=%s", "saved", config.ReportID, company.ShortName)
 	tries := 0
 
+	var err error
+
 	// retries bc reports fail
 	for {
 		if success {
 			break
 		}
 
-		if tries == maxTries {
+		if tries == BGC_REPORT_MAX_TRIES {
 			return bgcRows, errors.New("runBgChecks err! " + err.Error())
 		}
 
@@ -306,160 +439,300 @@ func getBGCApplicants() ([]BGCHECKReport, error) {
 	return bgcRows, nil
 }
 
-func bgCheckWebhookHandler(c *gin.Context) {
-	envParam := c.Query("env")
+// Mariani ran on constants and the global AssureHire token before checks were per company,
+// this carries that over the first time so their checks keep running
+func seedLegacyBackgroundCheckConfig() {
+	count, err := dbmap.SelectInt("SELECT COUNT(*) FROM background_check_configs")
+	if err != nil || count > 0 || passwords.ASSURE_HIRE_TOKEN == "" {
+		return
+	}
 
-	input := make(map[string]interface{})
-	if err := c.ShouldBindWith(&input, binding.JSON); err != nil {
-		ErrorLog.Println("err binding bgCheckWebhookHandler json: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "An error occured on our side"})
+	company, err := lookupCompanyByShortname(BGC_LEGACY_COMPANY_SHORT)
+	if err != nil {
 		return
 	}
 
-	InfoLog.Printf("new assurehire webhook, env: %s, data: %+v\n", envParam, input)
+	config := BackgroundCheckConfig{
+		CompanyID:    company.ID,
+		Provider:     BGC_PROVIDER_ASSUREHIRE,
+		Enabled:      true,
+		ReportID:     BGC_LEGACY_REPORT_ID,
+		PackageMap:   PropertyMap{BGC_LEGACY_SKIP_LEVEL: ""},
+		ResultStages: PropertyMap{},
+		Credentials:  BackgroundCheckCredentials{APIKey: passwords.ASSURE_HIRE_TOKEN},
+		Updated:      time.Now().Unix(),
+	}
+	config.ensureWebhookSecret()
 
-	inputData, ok := input["data"].(map[string]interface{})
-	if !ok {
-		ErrorLog.Println("bgCheckWebhookHandler err input[data] cannot type cast to map[string]interface{}")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "An error occured on our side"})
+	err = dbmap.Insert(&config)
+	if err != nil {
+		ErrorLog.Println("seedLegacyBackgroundCheckConfig insert err: ", err)
 		return
 	}
 
-	inputObject, ok := inputData["object"].(map[string]interface{})
-	if !ok {
-		ErrorLog.Println("bgCheckWebhookHandler err input[data] cannot type cast to map[string]interface{}")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "An error occured on our side"})
+	InfoLog.Println("seeded background check config for ", company.ShortName)
+}
+
+// AssureHire configs saved before callbacks needed a token get one, an admin then gives AssureHire the new url
+func ensureAssureHireWebhookSecrets() {
+	configs := []BackgroundCheckConfig{}
+	_, err := dbmap.Select(&configs, "SELECT * FROM background_check_configs WHERE provider = ?", BGC_PROVIDER_ASSUREHIRE)
+	if err != nil {
+		ErrorLog.Println("ensureAssureHireWebhookSecrets select err: ", err)
 		return
 	}
 
-	bgcID, ok := inputObject["id"].(string)
-	if !ok {
-		ErrorLog.Println("bgCheckWebhookHandler cannot get ID")
-		c.JSON(http.StatusNotFound, gin.H{"error": "We do not have that background check in our records"})
+	for index := range configs {
+		config := &configs[index]
+		if !config.ensureWebhookSecret() {
+			continue
+		}
+
+		_, err = dbmap.Update(config)
+		if err != nil {
+			ErrorLog.Printf("ensureAssureHireWebhookSecrets company: %d, err: %v\n", config.CompanyID, err)
+			continue
+		}
+		InfoLog.Printf("generated AssureHire webhook secret for company %d\n", config.CompanyID)
+	}
+}
+
+// Returns whether it had to make one
+func (config *BackgroundCheckConfig) ensureWebhookSecret() bool {
+	if config.Provider != BGC_PROVIDER_ASSUREHIRE || config.Credentials.WebhookSecret != "" {
+		return false
+	}
+
+	secret, err := generateNewToken()
+	if err != nil {
+		ErrorLog.Println("ensureWebhookSecret generateNewToken err: ", err)
+		return false
+	}
+
+	config.Credentials.WebhookSecret = secret
+	return true
+}
+
+func (config *BackgroundCheckConfig) setWebhookURL(user *User) {
+	if config.Provider == BGC_PROVIDER_ASSUREHIRE && config.Credentials.WebhookSecret != "" && (user.IsCompanyAdmin || user.IsSystemAdmin) {
+		config.WebhookURL = fmt.Sprintf(BGC_ASSUREHIRE_WEBHOOK, config.Credentials.WebhookSecret)
+	}
+}
+
+func getBackgroundChecksHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
 		return
 	}
 
-	thisBGC := BackgroundCheck{}
-	err := dbmap.SelectOne(&thisBGC, "SELECT * FROM background_checks WHERE provider_id = ?", bgcID)
+	checks := []BackgroundCheck{}
+	_, err = dbmap.Select(&checks, "SELECT * FROM background_checks WHERE company_id = ? ORDER BY initiated DESC LIMIT ?", thisCompany.ID, BGC_LIST_LIMIT)
 	if err != nil {
-		ErrorLog.Printf("unable to lookup bgc in webhook: id - %s\n", bgcID)
-		c.JSON(http.StatusNotFound, gin.H{"error": "We do not have that background check in our records"})
+		ErrorLog.Println("getBackgroundChecksHandler select err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
 		return
 	}
 
-	shouldUpdate := false
+	c.JSON(http.StatusOK, checks)
+}
 
-	status := thisBGC.Status
-	bgcStatus, ok := inputObject["status"].(string)
-	if !ok {
-		ErrorLog.Println("bgCheckWebhookHandler cannot get bgcStatus")
-	} else {
-		status = bgcStatus
-		shouldUpdate = true
+func getBackgroundCheckConfigHandler(c *gin.Context) {
+	user, thisCompany, err := lookupUserAndCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
 	}
 
-	url := thisBGC.FinishedURL
-	bgcReportURL, ok := inputObject["report_url"].(string)
-	if !ok {
-		ErrorLog.Println("bgCheckWebhookHandler cannot get bgcReportURL")
+	config, err := lookupBackgroundCheckConfig(thisCompany.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	config.setWebhookURL(user)
+	c.JSON(http.StatusOK, config)
+}
+
+// Credentials are write only, leaving them out of the input keeps the saved ones
+func updateBackgroundCheckConfigHandler(c *gin.Context) {
+	user, company, err := lookupUserAndCompany(c)
+	if err != nil || (!user.IsCompanyAdmin && !user.IsSystemAdmin) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	input := BackgroundCheckConfigInput{}
+	err = c.ShouldBindWith(&input, binding.JSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	if _, exists := backgroundCheckProviders[input.Provider]; !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("provider must be %s or %s", BGC_PROVIDER_ASSUREHIRE, BGC_PROVIDER_CHECKR)})
+		return
+	}
+
+	config, err := lookupBackgroundCheckConfig(company.ID)
+	exists := err == nil
+
+	config.CompanyID = company.ID
+	config.Provider = input.Provider
+	config.Enabled = input.Enabled
+	config.TestMode = input.TestMode
+	config.ReportID = strings.TrimSpace(input.ReportID)
+	config.TriggerStage = strings.TrimSpace(input.TriggerStage)
+	config.PackageMap = input.PackageMap
+	config.NotifyEmail = strings.TrimSpace(input.NotifyEmail)
+	config.WritebackEnabled = input.WritebackEnabled
+	config.ResultStages = input.ResultStages
+	config.StatusField = strings.TrimSpace(input.StatusField)
+	config.ReportDocType = strings.TrimSpace(input.ReportDocType)
+	config.AdverseWaitDays = input.AdverseWaitDays
+	config.AutoFinalAdverse = input.AutoFinalAdverse
+	config.CRAContact = strings.TrimSpace(input.CRAContact)
+	config.SummaryOfRightsURL = strings.TrimSpace(input.SummaryOfRightsURL)
+	config.Updated = time.Now().Unix()
+	if input.Credentials != nil {
+		// the secret is ours, new login details shouldn't change the url AssureHire was given
+		secret := config.Credentials.WebhookSecret
+		config.Credentials = *input.Credentials
+		if config.Credentials.WebhookSecret == "" {
+			config.Credentials.WebhookSecret = secret
+		}
+	}
+	config.ensureWebhookSecret()
+
+	if config.PackageMap == nil {
+		config.PackageMap = PropertyMap{}
+	}
+	if config.ResultStages == nil {
+		config.ResultStages = PropertyMap{}
+	}
+
+	if config.AdverseWaitDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Waiting period can't be negative"})
+		return
+	}
+
+	if config.Enabled && config.ReportID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A OnePoint report is required"})
+		return
+	}
+
+	if config.Enabled && !config.TestMode && config.Credentials.APIKey == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider credentials are required"})
+		return
+	}
+
+	if exists {
+		_, err = dbmap.Update(&config)
 	} else {
-		url = bgcReportURL
-		shouldUpdate = true
+		err = dbmap.Insert(&config)
+	}
+	if err != nil {
+		ErrorLog.Println("updateBackgroundCheckConfigHandler save err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	config.HasCredentials = config.Credentials.APIKey != ""
+	config.setWebhookURL(user)
+	c.JSON(http.StatusOK, config)
+}
+
+func lookupBackgroundCheckConfig(companyID int64) (BackgroundCheckConfig, error) {
+	config := BackgroundCheckConfig{}
+	err := dbmap.SelectOne(&config, "SELECT * FROM background_check_configs WHERE company_id = ?", companyID)
+	config.HasCredentials = config.Credentials.APIKey != ""
+	return config, err
+}
+
+// Providers post status changes here, the path says which provider so we know how to read and verify it.
+// Only the company whose check it is can vouch for the webhook, so finding the check comes before verifying.
+func verifyBackgroundCheckWebhook(c *gin.Context, body []byte) (InboundWebhookMessage, error) {
+	message := InboundWebhookMessage{}
+
+	provider, exists := backgroundCheckProviders[strings.ToLower(c.Param("provider"))]
+	if !exists {
+		// AssureHire's webhook was set up before the provider in the path meant anything
+		provider = backgroundCheckProviders[BGC_PROVIDER_ASSUREHIRE]
+	}
+
+	update, err := provider.ParseWebhook(body)
+	if err != nil {
+		return message, errors.New(provider.Name() + " parse err: " + err.Error())
+	}
+
+	thisBGC := BackgroundCheck{}
+	err = dbmap.SelectOne(&thisBGC, "SELECT * FROM background_checks WHERE provider = ? AND provider_id = ?", provider.Name(), update.ProviderID)
+	if err != nil {
+		return message, errors.New("unknown background check: " + update.ProviderID)
 	}
 
-	if !shouldUpdate {
+	config, err := lookupBackgroundCheckConfig(thisBGC.CompanyID)
+	if err != nil {
+		return message, errors.New(fmt.Sprintf("no config for company: %d", thisBGC.CompanyID))
+	}
+
+	err = provider.VerifyWebhook(config, body, c.Request)
+	if err != nil {
+		return message, errors.New(provider.Name() + " verify err: " + err.Error())
+	}
+
+	c.Set(BGC_WEBHOOK_CONTEXT_KEY, BackgroundCheckWebhook{Provider: provider, Update: update, Check: thisBGC, Config: config})
+
+	message.ID = provider.Name() + ":" + update.EventID
+	if update.EventID == "" {
+		message.ID = ""
+	}
+	message.SentAt = update.SentAt
+
+	return message, nil
+}
+
+func bgCheckWebhookHandler(c *gin.Context) {
+	webhook := c.MustGet(BGC_WEBHOOK_CONTEXT_KEY).(BackgroundCheckWebhook)
+	update, thisBGC := webhook.Update, webhook.Check
+
+	InfoLog.Printf("new %s webhook, env: %s, update: %+v\n", webhook.Provider.Name(), c.Query("env"), update)
+
+	if update.Status == "" && update.ReportURL == "" && !update.Completed {
 		ErrorLog.Println("bgCheckWebhookHandler no need to update")
 		c.JSON(http.StatusOK, gin.H{"msg": "OK"})
 		return
 	}
 
 	nowSecs := time.Now().Unix()
-	thisBGC.Status = status
-	thisBGC.FinishedURL = url
+	if update.Status != "" {
+		thisBGC.Status = update.Status
+	}
+	if update.ReportURL != "" {
+		thisBGC.FinishedURL = update.ReportURL
+	}
+	if update.ReportID != "" {
+		thisBGC.ProviderReportID = update.ReportID
+	}
+	if update.Completed {
+		thisBGC.Completed = true
+	}
 	thisBGC.LastUpdated = &nowSecs
 
-	_, err = dbmap.Update(&thisBGC)
+	_, err := dbmap.Update(&thisBGC)
 	if err != nil {
-		ErrorLog.Printf("unable to Update bgc in webhook: id - %s\n", bgcID)
+		ErrorLog.Printf("unable to Update bgc in webhook: id - %s\n", update.ProviderID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "An error occured on our side"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Thanks"})
-}
+	if thisBGC.Completed {
+		adjudicateBackgroundCheckResult(&thisBGC)
+	}
 
-type AssureHireBGC struct {
-	ID                  string      `json:"id"`
-	CreatedAt           string      `json:"created_at"`
-	SubmittedAt         string      `json:"submitted_at"`
-	UpdatedAt           string      `json:"updated_at"`
-	CompletedAt         string      `json:"completed_at"`
-	DueAt               string      `json:"due_at"`
-	Turnaround          int         `json:"turnaround"`
-	Status              string      `json:"status"`
-	StatusMsg           string      `json:"status_msg"`
-	Score               string      `json:"score"`
-	CopyRequested       bool        `json:"copy_requested"`
-	Purpose             string      `json:"purpose"`
-	BillCode            string      `json:"bill_code"`
-	JobCode             string      `json:"job_code"`
-	PackageID           string      `json:"package_id"`
-	ReportURL           string      `json:"report_url"`
-	ConsentURL          string      `json:"consent_url"`
-	ApplicantURL        string      `json:"applicant_url"`
-	LastName            string      `json:"last_name"`
-	FirstName           string      `json:"first_name"`
-	MiddleName          interface{} `json:"middle_name"`
-	NameSuffix          interface{} `json:"name_suffix"`
-	Ssn                 string      `json:"ssn"`
-	Dob                 string      `json:"dob"`
-	DriverLicenseNumber string      `json:"driver_license_number"`
-	DriverLicenseState  string      `json:"driver_license_state"`
-	Gender              interface{} `json:"gender"`
-	Title               interface{} `json:"title"`
-	Email               string      `json:"email"`
-	MobilePhone         string      `json:"mobile_phone"`
-	HomePhone           string      `json:"home_phone"`
-	WorkPhone           interface{} `json:"work_phone"`
-	AddressStreet       string      `json:"address_street"`
-	AddressCity         string      `json:"address_city"`
-	AddressState        string      `json:"address_state"`
-	AddressZip          string      `json:"address_zip"`
-	AccessFee           interface{} `json:"access_fee"`
-	Price               string      `json:"price"`
-	Meta                struct {
-	} `json:"meta"`
-	AddressHistory []struct {
-		Source        string      `json:"source"`
-		FromDate      string      `json:"from_date"`
-		ToDate        string      `json:"to_date"`
-		FirstName     string      `json:"first_name"`
-		MiddleName    string      `json:"middle_name"`
-		LastName      string      `json:"last_name"`
-		NameSuffix    string      `json:"name_suffix"`
-		AddressCounty interface{} `json:"address_county"`
-		AddressStreet string      `json:"address_street"`
-		AddressCity   string      `json:"address_city"`
-		AddressState  string      `json:"address_state"`
-		AddressZip    string      `json:"address_zip"`
-	} `json:"address_history"`
-	Products []struct {
-		ID                 string      `json:"id"`
-		SubmittedAt        string      `json:"submitted_at"`
-		UpdatedAt          string      `json:"updated_at"`
-		CompletedAt        string      `json:"completed_at"`
-		DueAt              string      `json:"due_at"`
-		ProductID          string      `json:"product_id"`
-		ProductDescription string      `json:"product_description"`
-		Status             string      `json:"status"`
-		PackageID          string      `json:"package_id"`
-		AccessFee          interface{} `json:"access_fee"`
-		Price              interface{} `json:"price"`
-		Request            struct {
-			LicenseNum    string `json:"license_num"`
-			IssuingAgency string `json:"issuing_agency"`
-			Issued        string `json:"issued"`
-			Expires       string `json:"expires"`
-		} `json:"request"`
-	} `json:"products"`
+	if thisBGC.Completed && thisBGC.WrittenBack == 0 && webhook.Config.WritebackEnabled {
+		go writeBackBackgroundCheck(webhook.Config, webhook.Provider, thisBGC)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Thanks"})
 }
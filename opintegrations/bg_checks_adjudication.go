@@ -0,0 +1,568 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// Every change to a check's adjudication, UserID 0 is the system (a result coming in, the cron)
+type BackgroundCheckAction struct {
+	ID        int64  `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID int64  `db:"company_id" json:"company_id"`
+	CheckID   int64  `db:"check_id" json:"check_id"`
+	UserID    int64  `db:"user_id" json:"user_id"`
+	UserEmail string `db:"user_email,size:255" json:"user_email"`
+	Action    string `db:"action,size:30" json:"action"`
+	FromState string `db:"from_state,size:30" json:"from_state"`
+	ToState   string `db:"to_state,size:30" json:"to_state"`
+	Note      string `db:"note,size:2000" json:"note"`
+	Created   int64  `db:"created" json:"created"`
+}
+
+type BackgroundCheckActionInput struct {
+	Action string `json:"action"`
+	Note   string `json:"note"`
+}
+
+type BackgroundCheckAdjudicationResponse struct {
+	Check   BackgroundCheck         `json:"check"`
+	Actions []BackgroundCheckAction `json:"actions"`
+}
+
+type BGCAdverseNoticeBody struct {
+	ApplicantName   string
+	CompanyName     string
+	CompanyContact  string
+	ProviderName    string
+	CRAContact      string
+	WaitDays        int
+	Deadline        string
+	SummaryOfRights string
+}
+
+type BGCAdverseWaitOverBody struct {
+	ApplicantName string
+	CheckID       int64
+	NoticeSent    string
+}
+
+const (
+	BGC_ADJ_PENDING            = "pending"
+	BGC_ADJ_CLEAR              = "clear"
+	BGC_ADJ_CONSIDER           = "consider"
+	BGC_ADJ_PRE_ADVERSE_SENT   = "pre_adverse_sent"
+	BGC_ADJ_WAITING            = "waiting_period"
+	BGC_ADJ_FINAL_ADVERSE_SENT = "final_adverse_sent"
+	BGC_ADJ_FINAL_ADVERSE      = "final_adverse"
+	BGC_ADJ_ENGAGED            = "engaged"
+
+	BGC_ACTION_RESULT        = "result"
+	BGC_ACTION_CLEAR         = "clear"
+	BGC_ACTION_CONSIDER      = "consider"
+	BGC_ACTION_PRE_ADVERSE   = "pre_adverse"
+	BGC_ACTION_NOTICE_SENT   = "notice_delivered"
+	BGC_ACTION_NOTICE_FAILED = "notice_failed"
+	BGC_ACTION_WAIT_OVER     = "waiting_period_over"
+	BGC_ACTION_FINAL_ADVERSE = "final_adverse"
+	BGC_ACTION_ENGAGE        = "engage"
+
+	BGC_DEFAULT_ADVERSE_WAIT_DAYS = 5
+	BGC_ACTIONS_LIMIT             = 200
+	BGC_DATE_FORMAT               = "January 2, 2006"
+
+	// CFPB's model "A Summary of Your Rights Under the Fair Credit Reporting Act"
+	FCRA_SUMMARY_OF_RIGHTS_URL = "https://files.consumerfinance.gov/f/documents/bcfp_consumer-rights-summary_2018-09.pdf"
+
+	// never public, the copies are only read back to attach to the notices
+	BGC_REPORTS_BUCKETNAME = "opint-bgc-reports"
+)
+
+// The adjudication states each action can be taken from
+var backgroundCheckActionFrom = map[string][]string{
+	BGC_ACTION_CLEAR:         {BGC_ADJ_PENDING, BGC_ADJ_CONSIDER},
+	BGC_ACTION_CONSIDER:      {BGC_ADJ_PENDING, BGC_ADJ_CLEAR},
+	BGC_ACTION_PRE_ADVERSE:   {BGC_ADJ_CONSIDER},
+	BGC_ACTION_FINAL_ADVERSE: {BGC_ADJ_WAITING},
+	BGC_ACTION_ENGAGE:        {BGC_ADJ_CLEAR, BGC_ADJ_CONSIDER, BGC_ADJ_PRE_ADVERSE_SENT, BGC_ADJ_WAITING},
+}
+
+func registerBgCheckAdjudicationRoutes(router *gin.Engine) {
+	router.GET("/api/background_checks/adjudication/:id", getBackgroundCheckAdjudicationHandler)
+	router.POST("/api/background_checks/adjudication/:id", backgroundCheckActionHandler)
+}
+
+func getBackgroundCheckAdjudicationHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	check, err := lookupCompanyBackgroundCheck(thisCompany.ID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	resp := BackgroundCheckAdjudicationResponse{Check: check, Actions: []BackgroundCheckAction{}}
+	_, err = dbmap.Select(&resp.Actions, "SELECT * FROM background_check_actions WHERE company_id = ? AND check_id = ? ORDER BY id DESC LIMIT ?", thisCompany.ID, check.ID, BGC_ACTIONS_LIMIT)
+	if err != nil {
+		ErrorLog.Println("getBackgroundCheckAdjudicationHandler actions err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func backgroundCheckActionHandler(c *gin.Context) {
+	user, company, err := lookupUserAndCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	input := BackgroundCheckActionInput{}
+	err = c.ShouldBindWith(&input, binding.JSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	if _, exists := backgroundCheckActionFrom[input.Action]; !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown action"})
+		return
+	}
+
+	check, err := lookupCompanyBackgroundCheck(company.ID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	err = adjudicateBackgroundCheck(&check, user, input.Action, strings.TrimSpace(input.Note))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, check)
+}
+
+func lookupCompanyBackgroundCheck(companyID int64, idParam string) (BackgroundCheck, error) {
+	check := BackgroundCheck{}
+
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		return check, err
+	}
+
+	err = dbmap.SelectOne(&check, "SELECT * FROM background_checks WHERE id = ? AND company_id = ?", id, companyID)
+	return check, err
+}
+
+// Takes a recruiter's action on a check. Adverse action has to go in order: a pre-adverse notice,
+// the waiting period running out, then the final notice, so the applicant has time to dispute the report.
+func adjudicateBackgroundCheck(check *BackgroundCheck, user *User, action, note string) error {
+	if !backgroundCheckStateIn(check.Adjudication, backgroundCheckActionFrom[action]) {
+		return errors.New(fmt.Sprintf("Cannot %s a check that is %s", action, check.Adjudication))
+	}
+
+	config, err := lookupBackgroundCheckConfig(check.CompanyID)
+	if err != nil {
+		return errors.New("Background checks are not set up for this company")
+	}
+
+	fromState := check.Adjudication
+
+	switch action {
+	case BGC_ACTION_CLEAR:
+		check.Adjudication = BGC_ADJ_CLEAR
+	case BGC_ACTION_CONSIDER:
+		check.Adjudication = BGC_ADJ_CONSIDER
+	case BGC_ACTION_ENGAGE:
+		check.Adjudication = BGC_ADJ_ENGAGED
+	case BGC_ACTION_PRE_ADVERSE:
+		err = sendPreAdverseNotice(check, config)
+		if err != nil {
+			ErrorLog.Printf("adjudicateBackgroundCheck %d pre adverse err: %v\n", check.ID, err)
+			return errors.New("The pre-adverse notice could not be sent")
+		}
+	case BGC_ACTION_FINAL_ADVERSE:
+		if time.Now().Unix() < check.AdverseDeadline {
+			return errors.New("The waiting period ends " + time.Unix(check.AdverseDeadline, 0).Format(BGC_DATE_FORMAT))
+		}
+
+		err = sendFinalAdverseNotice(check, config)
+		if err != nil {
+			ErrorLog.Printf("adjudicateBackgroundCheck %d final adverse err: %v\n", check.ID, err)
+			return errors.New("The final adverse action notice could not be sent")
+		}
+	}
+
+	_, err = dbmap.Update(check)
+	if err != nil {
+		ErrorLog.Printf("adjudicateBackgroundCheck %d update err: %v\n", check.ID, err)
+		return errors.New("An error occured")
+	}
+
+	logBackgroundCheckAction(*check, user, action, fromState, note)
+
+	return nil
+}
+
+func backgroundCheckStateIn(state string, states []string) bool {
+	for _, allowed := range states {
+		if state == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func logBackgroundCheckAction(check BackgroundCheck, user *User, action, fromState, note string) {
+	entry := BackgroundCheckAction{
+		CompanyID: check.CompanyID,
+		CheckID:   check.ID,
+		Action:    action,
+		FromState: fromState,
+		ToState:   check.Adjudication,
+		Note:      truncateString(note, 2000),
+		Created:   time.Now().Unix(),
+	}
+	if user != nil {
+		entry.UserID = user.ID
+		entry.UserEmail = user.Email
+	}
+
+	err := dbmap.Insert(&entry)
+	if err != nil {
+		ErrorLog.Printf("logBackgroundCheckAction check: %d, action: %s, err: %v\n", check.ID, action, err)
+	}
+}
+
+// A finished report starts adjudication, only a clear result skips review
+func adjudicateBackgroundCheckResult(check *BackgroundCheck) {
+	if check.Adjudication != BGC_ADJ_PENDING {
+		return
+	}
+
+	check.Adjudication = BGC_ADJ_CONSIDER
+	if strings.EqualFold(strings.TrimSpace(check.Status), BGC_ADJ_CLEAR) {
+		check.Adjudication = BGC_ADJ_CLEAR
+	}
+
+	_, err := dbmap.Update(check)
+	if err != nil {
+		ErrorLog.Printf("adjudicateBackgroundCheckResult check %d update err: %v\n", check.ID, err)
+		return
+	}
+
+	logBackgroundCheckAction(*check, nil, BGC_ACTION_RESULT, BGC_ADJ_PENDING, "report result: "+check.Status)
+}
+
+// The waiting period only starts once the notice is out, one held for a retry leaves the check at pre_adverse_sent
+func sendPreAdverseNotice(check *BackgroundCheck, config BackgroundCheckConfig) error {
+	delivery, err := sendAdverseNotice(*check, config, BGC_PRE_ADVERSE_TEMPLATE, "Pre-Adverse Action Notice")
+	if err != nil {
+		return err
+	}
+
+	// without the delivery row the cron could never tell when the notice went out
+	if delivery.ID == 0 {
+		return errors.New("pre-adverse notice was not recorded, send it again")
+	}
+
+	check.AdverseDeliveryID = delivery.ID
+	check.AdverseNoticeSent = 0
+	check.AdverseDeadline = 0
+	check.Adjudication = BGC_ADJ_PRE_ADVERSE_SENT
+
+	if delivery.Status == NOTIFICATION_STATUS_SENT {
+		startAdverseWaitingPeriod(check, config, delivery.Sent)
+	}
+
+	return nil
+}
+
+func startAdverseWaitingPeriod(check *BackgroundCheck, config BackgroundCheckConfig, sent int64) {
+	check.AdverseNoticeSent = sent
+	check.AdverseDeadline = addBusinessDays(time.Unix(sent, 0), config.adverseWaitDays()).Unix()
+	check.Adjudication = BGC_ADJ_WAITING
+}
+
+// Same as the pre-adverse notice, the check is only final_adverse once the notice is out
+func sendFinalAdverseNotice(check *BackgroundCheck, config BackgroundCheckConfig) error {
+	delivery, err := sendAdverseNotice(*check, config, BGC_FINAL_ADVERSE_TEMPLATE, "Final Adverse Action Notice")
+	if err != nil {
+		return err
+	}
+
+	if delivery.ID == 0 {
+		return errors.New("final adverse notice was not recorded, send it again")
+	}
+
+	check.AdverseDeliveryID = delivery.ID
+	check.Adjudication = BGC_ADJ_FINAL_ADVERSE_SENT
+
+	if delivery.Status == NOTIFICATION_STATUS_SENT {
+		check.Adjudication = BGC_ADJ_FINAL_ADVERSE
+	}
+
+	return nil
+}
+
+// Puts the check back where someone can send the notice again. A failed final notice goes back
+// to waiting with the wait marked over, so it isn't sent again on its own and the company decides.
+func adverseNoticeFailed(check *BackgroundCheck) {
+	check.AdverseDeliveryID = 0
+
+	if check.Adjudication == BGC_ADJ_FINAL_ADVERSE_SENT {
+		check.Adjudication = BGC_ADJ_WAITING
+		check.AdverseWaitOver = true
+		return
+	}
+
+	check.Adjudication = BGC_ADJ_CONSIDER
+}
+
+func sendAdverseNotice(check BackgroundCheck, config BackgroundCheckConfig, template, subject string) (NotificationDelivery, error) {
+	if check.Email == "" {
+		return NotificationDelivery{}, errors.New("applicant has no email")
+	}
+
+	company, err := lookupCompanyByID(check.CompanyID)
+	if err != nil {
+		return NotificationDelivery{}, err
+	}
+
+	summaryOfRights := config.SummaryOfRightsURL
+	if summaryOfRights == "" {
+		summaryOfRights = FCRA_SUMMARY_OF_RIGHTS_URL
+	}
+
+	// the provider's report link needs the employer's login, so the applicant gets the report itself
+	report, err := storeAdverseNoticeReport(check, config)
+	if err != nil {
+		return NotificationDelivery{}, errors.New("report copy err: " + err.Error())
+	}
+
+	deadline := ""
+	if check.AdverseDeadline != 0 {
+		deadline = time.Unix(check.AdverseDeadline, 0).Format(BGC_DATE_FORMAT)
+	}
+
+	emailHeaderInfo := sgEmailFields{
+		Subject: fmt.Sprintf("%s from %s", subject, company.Name),
+		From:    &sgmail.Email{Name: company.Name, Address: passwords.NO_REPLY_EMAILER_ADDRESS},
+		To:      []*sgmail.Email{&sgmail.Email{Name: check.FirstName + " " + check.LastName, Address: check.Email}},
+		Attachments: []NotificationAttachment{
+			{FileName: "Background Check Report.pdf", ContentType: "application/pdf", Bucket: BGC_REPORTS_BUCKETNAME, Object: report},
+			{FileName: "Summary of Your Rights Under the FCRA.pdf", ContentType: "application/pdf", URL: summaryOfRights},
+		},
+	}
+
+	contact := config.NotifyEmail
+	if contact == "" {
+		contact = check.ClientEmail
+	}
+
+	emailBody := BGCAdverseNoticeBody{
+		ApplicantName:   check.FirstName + " " + check.LastName,
+		CompanyName:     company.Name,
+		CompanyContact:  contact,
+		ProviderName:    backgroundCheckProviderDisplayName(check.Provider),
+		CRAContact:      config.CRAContact,
+		WaitDays:        config.adverseWaitDays(),
+		Deadline:        deadline,
+		SummaryOfRights: summaryOfRights,
+	}
+
+	delivery, err := sendNotificationDelivery(Notification{CompanyID: check.CompanyID, Kind: NOTIFICATION_KIND_BGC_ADVERSE, Email: emailHeaderInfo, Template: template, Data: emailBody})
+	if err != nil {
+		return delivery, err
+	}
+
+	InfoLog.Printf("%s sent for background check %d, delivery: %d, status: %s\n", subject, check.ID, delivery.ID, delivery.Status)
+
+	return delivery, nil
+}
+
+// Keeps a copy of the report where the notice can be built from on a retry, returns the object name
+func storeAdverseNoticeReport(check BackgroundCheck, config BackgroundCheckConfig) (string, error) {
+	provider, exists := backgroundCheckProviders[check.Provider]
+	if !exists {
+		return "", errors.New("unknown provider: " + check.Provider)
+	}
+
+	report, err := provider.FetchReportPDF(config, check)
+	if err != nil {
+		return "", err
+	}
+
+	object := fmt.Sprintf("%d/%d/report.pdf", check.CompanyID, check.ID)
+	err = bytesToGCP(BGC_REPORTS_BUCKETNAME, object, report, false)
+	if err != nil {
+		return "", err
+	}
+
+	return object, nil
+}
+
+func backgroundCheckProviderDisplayName(provider string) string {
+	switch provider {
+	case BGC_PROVIDER_ASSUREHIRE:
+		return "AssureHire"
+	case BGC_PROVIDER_CHECKR:
+		return "Checkr"
+	}
+	return provider
+}
+
+func (config BackgroundCheckConfig) adverseWaitDays() int {
+	if config.AdverseWaitDays <= 0 {
+		return BGC_DEFAULT_ADVERSE_WAIT_DAYS
+	}
+	return config.AdverseWaitDays
+}
+
+// Weekends don't count toward the waiting period
+func addBusinessDays(start time.Time, days int) time.Time {
+	end := start
+	for added := 0; added < days; {
+		end = end.AddDate(0, 0, 1)
+		if end.Weekday() != time.Saturday && end.Weekday() != time.Sunday {
+			added++
+		}
+	}
+	return end
+}
+
+// Moves checks on once held notices go out: a pre-adverse one starts the waiting period, a final one
+// makes the check final_adverse. Then handles waiting periods that have run out: sends the final
+// notice when the company has that automated, otherwise lets them know it's their call
+func runBackgroundCheckAdverseActions() {
+	pending := []BackgroundCheck{}
+	_, err := dbmap.Select(&pending, "SELECT * FROM background_checks WHERE adjudication IN (?, ?)", BGC_ADJ_PRE_ADVERSE_SENT, BGC_ADJ_FINAL_ADVERSE_SENT)
+	if err != nil {
+		ErrorLog.Println("runBackgroundCheckAdverseActions pending select err: ", err)
+		return
+	}
+
+	for index := range pending {
+		check := &pending[index]
+		fromState := check.Adjudication
+
+		if check.AdverseDeliveryID == 0 {
+			// nothing to wait on, back to where someone sends it again
+			adverseNoticeFailed(check)
+			_, err = dbmap.Update(check)
+			if err != nil {
+				ErrorLog.Printf("runBackgroundCheckAdverseActions check %d update err: %v\n", check.ID, err)
+				continue
+			}
+			logBackgroundCheckAction(*check, nil, BGC_ACTION_NOTICE_FAILED, fromState, "notice was never recorded")
+			continue
+		}
+
+		delivery := NotificationDelivery{}
+		err = dbmap.SelectOne(&delivery, "SELECT * FROM notification_deliveries WHERE id = ?", check.AdverseDeliveryID)
+		if err != nil {
+			ErrorLog.Printf("runBackgroundCheckAdverseActions check %d delivery lookup err: %v\n", check.ID, err)
+			continue
+		}
+
+		config, err := lookupBackgroundCheckConfig(check.CompanyID)
+		if err != nil {
+			continue
+		}
+
+		switch delivery.Status {
+		case NOTIFICATION_STATUS_SENT:
+			if fromState == BGC_ADJ_FINAL_ADVERSE_SENT {
+				check.Adjudication = BGC_ADJ_FINAL_ADVERSE
+			} else {
+				startAdverseWaitingPeriod(check, config, delivery.Sent)
+			}
+			_, err = dbmap.Update(check)
+			if err == nil {
+				logBackgroundCheckAction(*check, nil, BGC_ACTION_NOTICE_SENT, fromState, "")
+			}
+		case NOTIFICATION_STATUS_FAILED, NOTIFICATION_STATUS_SUPPRESSED:
+			adverseNoticeFailed(check)
+			_, err = dbmap.Update(check)
+			if err == nil {
+				logBackgroundCheckAction(*check, nil, BGC_ACTION_NOTICE_FAILED, fromState, delivery.Error)
+			}
+		}
+		if err != nil {
+			ErrorLog.Printf("runBackgroundCheckAdverseActions check %d update err: %v\n", check.ID, err)
+		}
+	}
+
+	waiting := []BackgroundCheck{}
+	_, err = dbmap.Select(&waiting, "SELECT * FROM background_checks WHERE adjudication = ? AND adverse_deadline <= ? AND adverse_wait_over = 0", BGC_ADJ_WAITING, time.Now().Unix())
+	if err != nil {
+		ErrorLog.Println("runBackgroundCheckAdverseActions waiting select err: ", err)
+		return
+	}
+
+	for index := range waiting {
+		check := &waiting[index]
+
+		config, err := lookupBackgroundCheckConfig(check.CompanyID)
+		if err != nil {
+			continue
+		}
+
+		if config.AutoFinalAdverse {
+			err = adjudicateBackgroundCheck(check, nil, BGC_ACTION_FINAL_ADVERSE, "sent automatically after the waiting period")
+			if err != nil {
+				ErrorLog.Printf("runBackgroundCheckAdverseActions check %d auto final adverse err: %v\n", check.ID, err)
+			}
+			continue
+		}
+
+		sendAdverseWaitOverEmail(*check, config)
+
+		check.AdverseWaitOver = true
+		_, err = dbmap.Update(check)
+		if err != nil {
+			ErrorLog.Printf("runBackgroundCheckAdverseActions check %d update err: %v\n", check.ID, err)
+			continue
+		}
+		logBackgroundCheckAction(*check, nil, BGC_ACTION_WAIT_OVER, BGC_ADJ_WAITING, "")
+	}
+}
+
+func sendAdverseWaitOverEmail(check BackgroundCheck, config BackgroundCheckConfig) {
+	to := config.contactEmail(BGCHECKReport{ContactEmail: check.ClientEmail})
+	if to == "" {
+		return
+	}
+
+	emailHeaderInfo := sgEmailFields{
+		Subject: fmt.Sprintf("Background check waiting period over for %s %s", check.FirstName, check.LastName),
+		From:    &sgmail.Email{Name: "OnePoint HCM", Address: passwords.NO_REPLY_EMAILER_ADDRESS},
+		To:      []*sgmail.Email{&sgmail.Email{Address: to}},
+	}
+
+	emailBody := BGCAdverseWaitOverBody{
+		ApplicantName: check.FirstName + " " + check.LastName,
+		CheckID:       check.ID,
+		NoticeSent:    time.Unix(check.AdverseNoticeSent, 0).Format(BGC_DATE_FORMAT),
+	}
+
+	err := sendNotification(Notification{CompanyID: check.CompanyID, Kind: NOTIFICATION_KIND_BGC, Email: emailHeaderInfo, Template: BGC_ADVERSE_WAIT_OVER_TEMPLATE, Data: emailBody})
+	if err != nil {
+		ErrorLog.Printf("sendAdverseWaitOverEmail check %d err: %v\n", check.ID, err)
+	}
+}
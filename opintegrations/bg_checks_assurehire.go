@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+type AssureHireProvider struct{}
+
+var assureHireCompleteStatuses = map[string]bool{
+	"complete":  true,
+	"completed": true,
+}
+
+type AssureHireNewBGCPost struct {
+	Email       string `json:"email"`
+	PackageName string `json:"package_id"`
+	Address     string `json:"address"`
+	SS          string `json:"ssn"`
+	HomePhone   string `json:"home_phone"`
+	MobilePhone string `json:"mobile_phone"`
+	LastName    string `json:"last_name"`
+	FirstName   string `json:"first_name"`
+}
+
+type AssureHireWebhook struct {
+	Data struct {
+		Object struct {
+			ID        string `json:"id"`
+			UpdatedAt string `json:"updated_at"`
+			Status    string `json:"status"`
+			ReportURL string `json:"report_url"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+func (p *AssureHireProvider) Name() string {
+	return BGC_PROVIDER_ASSUREHIRE
+}
+
+// AssureHire authenticates as a user on the company's account, so the contact email has to be one of their users
+func (p *AssureHireProvider) CreateCheck(config BackgroundCheckConfig, bgcReportApplicant BGCHECKReport, packageID string) (BackgroundCheckProviderResult, error) {
+	result := BackgroundCheckProviderResult{}
+
+	authUser := config.contactEmail(bgcReportApplicant)
+	if authUser == "" {
+		return result, errors.New("AssureHire CreateCheck no contact email for applicant: " + bgcReportApplicant.ApplicantID)
+	}
+
+	sendingBody := AssureHireNewBGCPost{
+		Email:       bgcReportApplicant.Email,
+		PackageName: packageID,
+		Address:     bgcReportApplicant.FullAddress,
+		SS:          bgcReportApplicant.SS,
+		HomePhone:   bgcReportApplicant.HomePhone,
+		MobilePhone: bgcReportApplicant.CellPhone,
+		FirstName:   bgcReportApplicant.FirstName,
+		LastName:    bgcReportApplicant.LastName,
+	}
+
+	subdomain := ""
+	if config.Credentials.Subdomain != "" {
+		subdomain = config.Credentials.Subdomain + "."
+	}
+	url := fmt.Sprintf("https://%sassurehire.com/api/v1/backgroundchecks", subdomain)
+
+	b := new(bytes.Buffer)
+	json.NewEncoder(b).Encode(sendingBody)
+
+	req, err := http.NewRequest("POST", url, b)
+	if err != nil {
+		return result, errors.New("AssureHire CreateCheck NewRequest err: " + err.Error())
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s:%s", authUser, config.Credentials.APIKey))
+
+	InfoLog.Printf("sending to AH - applicant: %s, package: %s, url: %s, w authUser: %s\n", bgcReportApplicant.ApplicantID, packageID, url, authUser)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return result, errors.New("AssureHire CreateCheck Do err: " + err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		bodyString := string(bodyBytes)
+
+		return result, errors.New(fmt.Sprintf("AssureHire CreateCheck bad request- status: %d, body: %s", resp.StatusCode, bodyString))
+	}
+
+	assurehireResp := AssureHireBGC{}
+	err = json.NewDecoder(resp.Body).Decode(&assurehireResp)
+	if err != nil {
+		return result, errors.New("AssureHire CreateCheck NewDecoder err: " + err.Error())
+	}
+
+	result.ProviderID = assurehireResp.ID
+	result.Status = assurehireResp.Status
+	result.ReportURL = assurehireResp.ReportURL
+	result.ClientEmail = authUser
+
+	return result, nil
+}
+
+func (p *AssureHireProvider) ParseWebhook(body []byte) (BackgroundCheckWebhookUpdate, error) {
+	update := BackgroundCheckWebhookUpdate{}
+
+	webhook := AssureHireWebhook{}
+	err := json.Unmarshal(body, &webhook)
+	if err != nil {
+		return update, err
+	}
+
+	if webhook.Data.Object.ID == "" {
+		return update, errors.New("AssureHire webhook missing data.object.id")
+	}
+
+	update.ProviderID = webhook.Data.Object.ID
+	update.Status = webhook.Data.Object.Status
+	update.ReportURL = webhook.Data.Object.ReportURL
+	update.Completed = assureHireCompleteStatuses[strings.ToLower(update.Status)]
+	// AssureHire has no event id, the same check at the same update and status is the same message
+	update.EventID = fmt.Sprintf("%s:%s:%s", update.ProviderID, update.Status, webhook.Data.Object.UpdatedAt)
+
+	return update, nil
+}
+
+// The report url serves the PDF when asked for one, authenticated as the account's API user. The check's
+// client email can be a notify address that isn't an AssureHire user.
+func (p *AssureHireProvider) FetchReportPDF(config BackgroundCheckConfig, check BackgroundCheck) ([]byte, error) {
+	if check.FinishedURL == "" {
+		return nil, errors.New("AssureHire check has no report url")
+	}
+
+	authUser := config.Credentials.ContactEmail
+	if authUser == "" {
+		authUser = check.ClientEmail
+	}
+
+	req, err := http.NewRequest("GET", check.FinishedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/pdf")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s:%s", authUser, config.Credentials.APIKey))
+
+	return fetchBackgroundCheckPDF(req)
+}
+
+// AssureHire doesn't sign its webhooks, so the callback url we give them carries the company's webhook secret
+func (p *AssureHireProvider) VerifyWebhook(config BackgroundCheckConfig, body []byte, req *http.Request) error {
+	if config.Provider != BGC_PROVIDER_ASSUREHIRE {
+		return errors.New("company does not use AssureHire")
+	}
+
+	return verifySharedSecret(config.Credentials.WebhookSecret, req.URL.Query().Get("token"), "AssureHire webhook_secret")
+}
+
+type AssureHireBGC struct {
+	ID                  string      `json:"id"`
+	CreatedAt           string      `json:"created_at"`
+	SubmittedAt         string      `json:"submitted_at"`
+	UpdatedAt           string      `json:"updated_at"`
+	CompletedAt         string      `json:"completed_at"`
+	DueAt               string      `json:"due_at"`
+	Turnaround          int         `json:"turnaround"`
+	Status              string      `json:"status"`
+	StatusMsg           string      `json:"status_msg"`
+	Score               string      `json:"score"`
+	CopyRequested       bool        `json:"copy_requested"`
+	Purpose             string      `json:"purpose"`
+	BillCode            string      `json:"bill_code"`
+	JobCode             string      `json:"job_code"`
+	PackageID           string      `json:"package_id"`
+	ReportURL           string      `json:"report_url"`
+	ConsentURL          string      `json:"consent_url"`
+	ApplicantURL        string      `json:"applicant_url"`
+	LastName            string      `json:"last_name"`
+	FirstName           string      `json:"first_name"`
+	MiddleName          interface{} `json:"middle_name"`
+	NameSuffix          interface{} `json:"name_suffix"`
+	Ssn                 string      `json:"ssn"`
+	Dob                 string      `json:"dob"`
+	DriverLicenseNumber string      `json:"driver_license_number"`
+	DriverLicenseState  string      `json:"driver_license_state"`
+	Gender              interface{} `json:"gender"`
+	Title               interface{} `json:"title"`
+	Email               string      `json:"email"`
+	MobilePhone         string      `json:"mobile_phone"`
+	HomePhone           string      `json:"home_phone"`
+	WorkPhone           interface{} `json:"work_phone"`
+	AddressStreet       string      `json:"address_street"`
+	AddressCity         string      `json:"address_city"`
+	AddressState        string      `json:"address_state"`
+	AddressZip          string      `json:"address_zip"`
+	AccessFee           interface{} `json:"access_fee"`
+	Price               string      `json:"price"`
+	Meta                struct {
+	} `json:"meta"`
+	AddressHistory []struct {
+		Source        string      `json:"source"`
+		FromDate      string      `json:"from_date"`
+		ToDate        string      `json:"to_date"`
+		FirstName     string      `json:"first_name"`
+		MiddleName    string      `json:"middle_name"`
+		LastName      string      `json:"last_name"`
+		NameSuffix    string      `json:"name_suffix"`
+		AddressCounty interface{} `json:"address_county"`
+		AddressStreet string      `json:"address_street"`
+		AddressCity   string      `json:"address_city"`
+		AddressState  string      `json:"address_state"`
+		AddressZip    string      `json:"address_zip"`
+	} `json:"address_history"`
+	Products []struct {
+		ID                 string      `json:"id"`
+		SubmittedAt        string      `json:"submitted_at"`
+		UpdatedAt          string      `json:"updated_at"`
+		CompletedAt        string      `json:"completed_at"`
+		DueAt              string      `json:"due_at"`
+		ProductID          string      `json:"product_id"`
+		ProductDescription string      `json:"product_description"`
+		Status             string      `json:"status"`
+		PackageID          string      `json:"package_id"`
+		AccessFee          interface{} `json:"access_fee"`
+		Price              interface{} `json:"price"`
+		Request            struct {
+			LicenseNum    string `json:"license_num"`
+			IssuingAgency string `json:"issuing_agency"`
+			Issued        string `json:"issued"`
+			Expires       string `json:"expires"`
+		} `json:"request"`
+	} `json:"products"`
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type CheckrProvider struct{}
+
+type CheckrCandidatePost struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone,omitempty"`
+	SSN       string `json:"ssn,omitempty"`
+	// our OnePoint applicant id so checks can be found in the Checkr dashboard
+	CustomID string `json:"custom_id,omitempty"`
+}
+
+type CheckrInvitationPost struct {
+	CandidateID   string               `json:"candidate_id"`
+	Package       string               `json:"package"`
+	WorkLocations []CheckrWorkLocation `json:"work_locations"`
+}
+
+type CheckrWorkLocation struct {
+	Country string `json:"country"`
+}
+
+type CheckrObject struct {
+	ID            string   `json:"id"`
+	Object        string   `json:"object"`
+	Status        string   `json:"status"`
+	Result        string   `json:"result"`
+	CandidateID   string   `json:"candidate_id"`
+	InvitationURL string   `json:"invitation_url"`
+	DocumentIDs   []string `json:"document_ids"`
+}
+
+type CheckrDocument struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	DownloadURI string `json:"download_uri"`
+}
+
+type CheckrWebhook struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      struct {
+		Object CheckrObject `json:"object"`
+	} `json:"data"`
+}
+
+const (
+	CHECKR_API_URL          = "https://api.checkr.com/v1"
+	CHECKR_SIGNATURE_HEADER = "X-Checkr-Signature"
+	CHECKR_REPORT_URL       = "https://dashboard.checkr.com/candidates/%s"
+	CHECKR_PDF_DOCUMENT     = "pdf_report"
+)
+
+func (p *CheckrProvider) Name() string {
+	return BGC_PROVIDER_CHECKR
+}
+
+// Checkr needs a candidate first, then an invitation sends them the consent form for the package.
+// The candidate id is what comes back on every webhook, so that's what we keep.
+func (p *CheckrProvider) CreateCheck(config BackgroundCheckConfig, bgcReportApplicant BGCHECKReport, packageID string) (BackgroundCheckProviderResult, error) {
+	result := BackgroundCheckProviderResult{}
+
+	if bgcReportApplicant.Email == "" {
+		return result, errors.New("Checkr CreateCheck needs an email for applicant: " + bgcReportApplicant.ApplicantID)
+	}
+
+	phone := bgcReportApplicant.CellPhone
+	if phone == "" {
+		phone = bgcReportApplicant.HomePhone
+	}
+
+	candidate := CheckrObject{}
+	err := checkrPost(config, "/candidates", CheckrCandidatePost{
+		FirstName: bgcReportApplicant.FirstName,
+		LastName:  bgcReportApplicant.LastName,
+		Email:     bgcReportApplicant.Email,
+		Phone:     phone,
+		SSN:       bgcReportApplicant.SS,
+		CustomID:  bgcReportApplicant.ApplicantID,
+	}, &candidate)
+	if err != nil {
+		return result, errors.New("Checkr CreateCheck candidate err: " + err.Error())
+	}
+
+	invitation := CheckrObject{}
+	err = checkrPost(config, "/invitations", CheckrInvitationPost{
+		CandidateID:   candidate.ID,
+		Package:       packageID,
+		WorkLocations: []CheckrWorkLocation{{Country: "US"}},
+	}, &invitation)
+	if err != nil {
+		return result, errors.New("Checkr CreateCheck invitation err: " + err.Error())
+	}
+
+	result.ProviderID = candidate.ID
+	result.Status = "invitation " + invitation.Status
+	result.ReportURL = fmt.Sprintf(CHECKR_REPORT_URL, candidate.ID)
+
+	return result, nil
+}
+
+// The report lists its documents, the pdf_report one has a short lived download link
+func (p *CheckrProvider) FetchReportPDF(config BackgroundCheckConfig, check BackgroundCheck) ([]byte, error) {
+	if check.ProviderReportID == "" {
+		return nil, errors.New("Checkr check has no report id")
+	}
+
+	report := CheckrObject{}
+	err := checkrGet(config, "/reports/"+check.ProviderReportID, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, documentID := range report.DocumentIDs {
+		document := CheckrDocument{}
+		err = checkrGet(config, "/documents/"+documentID, &document)
+		if err != nil {
+			return nil, err
+		}
+		if document.Type != CHECKR_PDF_DOCUMENT || document.DownloadURI == "" {
+			continue
+		}
+
+		req, err := http.NewRequest("GET", document.DownloadURI, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return fetchBackgroundCheckPDF(req)
+	}
+
+	return nil, errors.New("Checkr report has no pdf yet: " + check.ProviderReportID)
+}
+
+func checkrGet(config BackgroundCheckConfig, path string, into interface{}) error {
+	req, err := http.NewRequest("GET", CHECKR_API_URL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(config.Credentials.APIKey, "")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(fmt.Sprintf("bad request- path: %s, status: %d, body: %s", path, resp.StatusCode, string(bodyBytes)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(into)
+}
+
+func checkrPost(config BackgroundCheckConfig, path string, sendingBody interface{}, into interface{}) error {
+	b := new(bytes.Buffer)
+	json.NewEncoder(b).Encode(sendingBody)
+
+	req, err := http.NewRequest("POST", CHECKR_API_URL+path, b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(config.Credentials.APIKey, "")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(fmt.Sprintf("bad request- path: %s, status: %d, body: %s", path, resp.StatusCode, string(bodyBytes)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(into)
+}
+
+// Reports and invitations both carry the candidate id, a finished report's result (clear, consider) becomes the status
+func (p *CheckrProvider) ParseWebhook(body []byte) (BackgroundCheckWebhookUpdate, error) {
+	update := BackgroundCheckWebhookUpdate{}
+
+	webhook := CheckrWebhook{}
+	err := json.Unmarshal(body, &webhook)
+	if err != nil {
+		return update, err
+	}
+
+	update.EventID = webhook.ID
+	update.SentAt = webhook.CreatedAt
+
+	object := webhook.Data.Object
+	update.ProviderID = object.CandidateID
+	if object.Object == "candidate" {
+		update.ProviderID = object.ID
+	}
+	if update.ProviderID == "" {
+		return update, errors.New("Checkr webhook missing candidate id, type: " + webhook.Type)
+	}
+
+	switch object.Object {
+	case "report":
+		update.ReportID = object.ID
+		update.Status = object.Status
+		if object.Status == "complete" {
+			update.Completed = true
+			if object.Result != "" {
+				update.Status = object.Result
+			}
+		}
+	case "invitation":
+		update.Status = "invitation " + object.Status
+	}
+
+	return update, nil
+}
+
+// Checkr signs the raw body with the account's API key
+func (p *CheckrProvider) VerifyWebhook(config BackgroundCheckConfig, body []byte, req *http.Request) error {
+	if config.Provider != BGC_PROVIDER_CHECKR {
+		return errors.New("company does not use Checkr")
+	}
+
+	signature := strings.TrimSpace(req.Header.Get(CHECKR_SIGNATURE_HEADER))
+	if signature == "" {
+		return errors.New("missing " + CHECKR_SIGNATURE_HEADER)
+	}
+
+	mac := hmac.New(sha256.New, []byte(config.Credentials.APIKey))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return errors.New("invalid " + CHECKR_SIGNATURE_HEADER)
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"opapi"
+	"strings"
+	"time"
+)
+
+const (
+	BGC_WRITEBACK_MAX_ATTEMPTS = 5
+	BGC_OP_DOCUMENT_TYPE       = "HR_APPLICANT_DOCUMENT"
+	BGC_RESULT_STAGE_DEFAULT   = "*"
+)
+
+// Puts a finished check's result into OnePoint so recruiters see it on the applicant: moves the hiring stage,
+// sets the status custom field and attaches the report. Each step is recorded as it goes through, so a retry
+// only redoes the ones that failed.
+func writeBackBackgroundCheck(config BackgroundCheckConfig, provider BackgroundCheckProvider, check BackgroundCheck) {
+	result, err := dbmap.Exec("UPDATE background_checks SET writeback_attempts = writeback_attempts + 1 WHERE id = ? AND written_back = 0 AND writeback_attempts = ?", check.ID, check.WritebackAttempts)
+	if err != nil {
+		ErrorLog.Println("writeBackBackgroundCheck claim err: ", err)
+		return
+	}
+	if claimed, _ := result.RowsAffected(); claimed == 0 {
+		return
+	}
+	check.WritebackAttempts++
+
+	err = writeBackgroundCheckToOnePoint(config, provider, &check)
+	if err != nil {
+		ErrorLog.Printf("writeBackBackgroundCheck bgc: %d, attempt: %d, err: %v\n", check.ID, check.WritebackAttempts, err)
+		check.WritebackError = truncateString(err.Error(), 1000)
+	} else {
+		InfoLog.Printf("background check %d written back to OnePoint applicant %s\n", check.ID, check.OPApplicantID)
+		check.WrittenBack = time.Now().Unix()
+		check.WritebackError = ""
+	}
+
+	_, err = dbmap.Exec("UPDATE background_checks SET written_back = ?, writeback_error = ? WHERE id = ?", check.WrittenBack, check.WritebackError, check.ID)
+	if err != nil {
+		ErrorLog.Println("writeBackBackgroundCheck update err: ", err)
+	}
+}
+
+func writeBackgroundCheckToOnePoint(config BackgroundCheckConfig, provider BackgroundCheckProvider, check *BackgroundCheck) error {
+	company, err := lookupCompanyByID(check.CompanyID)
+	if err != nil {
+		return errors.New("company lookup err: " + err.Error())
+	}
+
+	if check.OPApplicantID == "" {
+		return errors.New("check has no OnePoint applicant")
+	}
+
+	cxn := chooseOPAPICxn(company.OPID)
+
+	if stage := config.stageForResult(check.Status); stage != "" && check.WritebackStageMoved == 0 {
+		if check.OPJobApplicationID == "" {
+			return errors.New("check has no OnePoint job application, add Job Application Id to the report to move stages")
+		}
+
+		err = moveOPJobApplicationStage(cxn, company.OPID, check.OPJobApplicationID, stage)
+		if err != nil {
+			return errors.New("moving hiring stage err: " + err.Error())
+		}
+		check.WritebackStageMoved = recordBackgroundCheckWritebackStep(check.ID, "writeback_stage_moved")
+	}
+
+	if config.StatusField != "" && check.WritebackFieldSet == 0 {
+		err = setOPApplicantCustomField(cxn, company.OPID, check.OPApplicantID, config.StatusField, check.Status)
+		if err != nil {
+			return errors.New("setting status field err: " + err.Error())
+		}
+		check.WritebackFieldSet = recordBackgroundCheckWritebackStep(check.ID, "writeback_field_set")
+	}
+
+	if config.ReportDocType != "" && check.WritebackReportAttached == 0 {
+		err = attachBackgroundCheckReport(cxn, company, config, provider, *check)
+		if err != nil {
+			return errors.New("attaching report err: " + err.Error())
+		}
+		check.WritebackReportAttached = recordBackgroundCheckWritebackStep(check.ID, "writeback_report_attached")
+	}
+
+	return nil
+}
+
+// Saved right away rather than with the rest of the check, so a step isn't repeated even if what comes after it fails
+func recordBackgroundCheckWritebackStep(checkID int64, column string) int64 {
+	now := time.Now().Unix()
+	_, err := dbmap.Exec("UPDATE background_checks SET "+column+" = ? WHERE id = ?", now, checkID)
+	if err != nil {
+		ErrorLog.Printf("recordBackgroundCheckWritebackStep check: %d, step: %s, err: %v\n", checkID, column, err)
+	}
+	return now
+}
+
+// Results are matched case insensitively, "*" catches any result without its own stage
+func (config BackgroundCheckConfig) stageForResult(status string) string {
+	status = strings.ToLower(strings.TrimSpace(status))
+	for result, stage := range config.ResultStages {
+		if strings.ToLower(result) == status {
+			stageName, _ := stage.(string)
+			return stageName
+		}
+	}
+
+	stageName, _ := config.ResultStages[BGC_RESULT_STAGE_DEFAULT].(string)
+	return stageName
+}
+
+func moveOPJobApplicationStage(cxn *opapi.OPConnection, opCompanyID int64, jobApplicationID, stage string) error {
+	url := fmt.Sprintf("https://secure.onehcm.com/ta/rest/v2/companies/%d/job-applications/%s", opCompanyID, jobApplicationID)
+
+	appMap := make(map[string]interface{})
+	err := cxn.BasicQuery(url, &appMap, false)
+	if err != nil {
+		return err
+	}
+
+	appMap["hiring_stage"] = stage
+
+	return cxn.OPGenericRequest(url, "PUT", appMap)
+}
+
+func setOPApplicantCustomField(cxn *opapi.OPConnection, opCompanyID int64, applicantID, fieldName, value string) error {
+	url := fmt.Sprintf("https://secure.onehcm.com/ta/rest/v2/companies/%d/applicants/%s", opCompanyID, applicantID)
+
+	applicantMap := make(map[string]interface{})
+	err := cxn.BasicQuery(url, &applicantMap, false)
+	if err != nil {
+		return err
+	}
+
+	customFields, _ := applicantMap["custom_fields"].([]interface{})
+
+	found := false
+	for _, field := range customFields {
+		fieldMap, ok := field.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, _ := fieldMap["name"].(string); strings.EqualFold(name, fieldName) {
+			fieldMap["value"] = value
+			found = true
+		}
+	}
+	if !found {
+		customFields = append(customFields, map[string]interface{}{"name": fieldName, "value": value})
+	}
+
+	applicantMap["custom_fields"] = customFields
+
+	return cxn.OPGenericRequest(url, "PUT", applicantMap)
+}
+
+func attachBackgroundCheckReport(cxn *opapi.OPConnection, company Company, config BackgroundCheckConfig, provider BackgroundCheckProvider, check BackgroundCheck) error {
+	docType := cxn.FindDocTypeByName(company.OPID, config.ReportDocType)
+	if docType == nil {
+		return errors.New("company did not have doc type named " + config.ReportDocType)
+	}
+
+	report, err := provider.FetchReportPDF(config, check)
+	if err != nil {
+		return err
+	}
+
+	newDocRequest := opapi.NewDocumentRequest{
+		Type:        BGC_OP_DOCUMENT_TYPE,
+		FileName:    fmt.Sprintf("background_check_%d.pdf", check.ID),
+		DisplayName: fmt.Sprintf("%s %s Background Check (from %s)", check.FirstName, check.LastName, provider.Name()),
+		DocumentType: opapi.DocType{
+			ID:          docType.ID,
+			DisplayName: docType.DisplayName,
+		},
+		LinkedID: check.OPApplicantID,
+	}
+
+	err, opErr := cxn.UploadDocument(company.OPID, &newDocRequest, report)
+	if err != nil {
+		if opErr != nil {
+			return errors.New(opErr.String())
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Catches checks whose write back failed, or finished while OnePoint was down
+func retryBackgroundCheckWritebacks(config BackgroundCheckConfig) {
+	provider, exists := backgroundCheckProviders[config.Provider]
+	if !exists {
+		return
+	}
+
+	checks := []BackgroundCheck{}
+	_, err := dbmap.Select(&checks, "SELECT * FROM background_checks WHERE company_id = ? AND provider = ? AND completed = 1 AND written_back = 0 AND writeback_attempts < ?", config.CompanyID, config.Provider, BGC_WRITEBACK_MAX_ATTEMPTS)
+	if err != nil {
+		ErrorLog.Println("retryBackgroundCheckWritebacks select err: ", err)
+		return
+	}
+
+	for _, check := range checks {
+		writeBackBackgroundCheck(config, provider, check)
+	}
+}
+
+func fetchBackgroundCheckPDF(req *http.Request) ([]byte, error) {
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		return nil, errors.New(fmt.Sprintf("report download status: %d, body: %s", resp.StatusCode, string(body)))
+	}
+
+	if !strings.HasPrefix(string(body), "%PDF") {
+		return nil, errors.New("report download was not a PDF, content type: " + resp.Header.Get("Content-Type"))
+	}
+
+	return body, nil
+}
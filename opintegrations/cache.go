@@ -12,6 +12,8 @@ const (
 	CACHENAME_COMPANY_EMPLOYEES    = "employees"
 	CACHENAME_EMPLOYEE_DETAIL      = "empdetail"
 	CACHENAME_COMPANY_COST_CENTERS = "costcenters"
+	CACHENAME_COMPANY_CAREER_JOBS  = "careerjobs"
+	CACHENAME_EMAIL_ATTACHMENT     = "emailattachment"
 
 	DEFAULT_CACHE_EXPIRATION = 20 * time.Minute
 )
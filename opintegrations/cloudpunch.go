@@ -26,6 +26,10 @@ type CPInstallation struct {
 	DisplayName       string       `db:"display_name" json:"display_name"`
 	IP                string       `db:"ip" json:"ip"`
 	LastSynced        string       `db:"last_synced" json:"last_synced"`
+	LastSyncedUnix    int64        `db:"last_synced_unix" json:"last_synced_unix"`
+	SyncMarker        int64        `db:"sync_marker" json:"sync_marker"`
+	StaleAlertSent    int64        `db:"stale_alert_sent" json:"stale_alert_sent"`
+	Created           int64        `db:"created" json:"created"`
 	EmployeeFiltersPM *PropertyMap `db:"employee_filters,size:10000" json:"employee_filters"`
 	ClientSettingsPM  *PropertyMap `db:"client_settings,size:10000" json:"client_settings"`
 
@@ -42,6 +46,8 @@ type CPEnrollment struct {
 	InstallationID    int64   `db:"installation_id" json:"installation_id"`
 	Data              *string `db:"data" json:"data,omitempty"`
 	Active            bool    `db:"active" json:"active"`
+	DeactivatedAt     int64   `db:"deactivated_at" json:"deactivated_at"`
+	PurgedAt          int64   `db:"purged_at" json:"purged_at"`
 }
 
 type CPEmployee struct {
@@ -60,6 +66,14 @@ type CPEmployee struct {
 	CostCenter2 int64 `db:"cost_center_2" json:"cost_center_2"`
 	CostCenter3 int64 `db:"cost_center_3" json:"cost_center_3"`
 	CostCenter4 int64 `db:"cost_center_4" json:"cost_center_4"`
+
+	EmployeeType string `db:"employee_type" json:"employee_type"`
+	PayType      string `db:"pay_type" json:"pay_type"`
+	JobTitle     string `db:"job_title" json:"job_title"`
+	HireDate     string `db:"hire_date" json:"hire_date"`
+
+	TerminatedDate string `db:"terminated_date" json:"terminated_date"`
+	DeactivatedAt  int64  `db:"deactivated_at" json:"deactivated_at"`
 }
 
 type NewEnrollmentRequest struct {
@@ -68,6 +82,8 @@ type NewEnrollmentRequest struct {
 	Data              string `json:"data"`
 	Position          int8   `json:"position"`
 	CreatedDate       string `json:"created_date"`
+
+	Consent *CPBiometricConsentRequest `json:"consent"`
 }
 
 type NewEnrollmentResponse struct {
@@ -84,6 +100,13 @@ type CPClientSettings struct {
 
 type CPEmployeeFilters struct {
 	CostCenters CPEmployeeCostCenterFilter `json:"cost_centers"`
+
+	// how Groups (and CostCenters, when set) combine, "all" or "any"
+	Match  string                  `json:"match"`
+	Groups []CPEmployeeFilterGroup `json:"groups"`
+
+	IncludeAccountIDs []int64 `json:"include_account_ids"`
+	ExcludeAccountIDs []int64 `json:"exclude_account_ids"`
 }
 
 type CPEmployeeCostCenterFilter struct {
@@ -122,6 +145,7 @@ func registerCloudPunchRoutes(router *gin.Engine) {
 	router.POST("/api/tlm/webclock", webClockPostHandler)
 	router.POST("/api/tlm/webclock/getname", webClockNamePostHandler)
 	router.POST("/api/tlm/webclock/attestation", webClockAttestationPostHandler)
+	router.POST("/api/tlm/webclock/attestation/simulate", webClockAttestationSimulateHandler)
 	router.POST("/api/tlm/punches", timeClockPunchHandler)
 	router.GET("/api/tlm/cp/companyinfo", getAllCPDataHandler)
 	router.GET("/api/tlm/cp/companyinfo/installations", getCPInstallationsHandler)
@@ -129,44 +153,55 @@ func registerCloudPunchRoutes(router *gin.Engine) {
 	router.GET("/api/tlm/cp/companyinfo/employees", getCPEmployeesHandler)
 	router.GET("/api/tlm/cp/companyinfo/employees/search", searchCloudPunchEmployeesHandler)
 	router.GET("/api/tlm/cp/installations", getAllCPInstallationsHandler)
+	router.GET("/api/tlm/cp/installations/health", getCPInstallationsHealthHandler)
+	router.GET("/api/tlm/cp/biometrics/audit", getCPBiometricAuditHandler)
 	router.POST("/api/tlm/cp/installations", newCPInstallationHandler)
 	router.POST("/api/tlm/cp/installations/:installationToken/update", updateCPInstallationHandler)
 	router.POST("/api/tlm/cp/enrollments", newCPEnrollmentHandler)
 	router.GET("/api/tlm/cp/sync", getCPSyncHandler)
 	router.POST("/api/tlm/cp/sync/deleteenrollment", deleteCPEnrollmentHandler)
+	router.GET("/api/tlm/cp/v2/sync", getCPSyncV2Handler)
+	router.GET("/api/tlm/cp/v2/sync/snapshot", getCPSyncSnapshotHandler)
 }
 
 func toggleCPEmployeeActiveHandler(c *gin.Context) {
+	locale := negotiateLocale(c, c.Query("locale"))
+
 	thisCompany, err := lookupCompany(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
 		return
 	}
 
 	accountIDStr := c.Param("accountID")
 	if accountIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_INPUT_WRONG_FORMAT)})
 		return
 	}
 
 	accountID, err := strconv.ParseInt(accountIDStr, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Employee not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_EMPLOYEE_NOT_FOUND)})
 		return
 	}
 
 	cpEmp, err := getCPEmployeeByAccountID(accountID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Employee not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_EMPLOYEE_NOT_FOUND)})
 		return
 	}
 
 	if thisCompany.ID != cpEmp.CompanyID {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
 		return
 	}
 
 	cpEmp.Active = !cpEmp.Active
+	cpEmp.DeactivatedAt = 0
+	if !cpEmp.Active {
+		// starts the biometric retention clock
+		cpEmp.DeactivatedAt = time.Now().Unix()
+	}
 	dbmap.Update(cpEmp)
 
 	if cpEmp.Active {
@@ -179,9 +214,11 @@ func toggleCPEmployeeActiveHandler(c *gin.Context) {
 }
 
 func getAllCPDataHandler(c *gin.Context) {
+	locale := negotiateLocale(c, c.Query("locale"))
+
 	thisCompany, err := lookupCompany(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
 		return
 	}
 
@@ -190,7 +227,7 @@ func getAllCPDataHandler(c *gin.Context) {
 	instlns, err := getAllCompanyCPInstallations(thisCompany)
 	if err != nil {
 		ErrorLog.Println("getAllCompanyInstallations err:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 		return
 	}
 
@@ -201,7 +238,7 @@ func getAllCPDataHandler(c *gin.Context) {
 	emps, err := getAllCompanyCPEmployees(thisCompany, true, false)
 	if err != nil {
 		ErrorLog.Println("getAllCompanyCPEmployees err:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 		return
 	}
 
@@ -211,7 +248,7 @@ func getAllCPDataHandler(c *gin.Context) {
 		enrs, err := getCPEnrollmentsByEmployee(emp.AccountID, false, false)
 		if err != nil {
 			ErrorLog.Println("getCPEnrollmentsByEmployee err:", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 			return
 		}
 
@@ -226,16 +263,18 @@ func getAllCPDataHandler(c *gin.Context) {
 }
 
 func getCPInstallationsHandler(c *gin.Context) {
+	locale := negotiateLocale(c, c.Query("locale"))
+
 	thisCompany, err := lookupCompany(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
 		return
 	}
 
 	instlns, err := getAllCompanyCPInstallations(thisCompany)
 	if err != nil {
 		ErrorLog.Println("getCPInstallationsHandler getAllCompanyInstallations err:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 		return
 	}
 
@@ -243,16 +282,18 @@ func getCPInstallationsHandler(c *gin.Context) {
 }
 
 func getCPEmployeesHandler(c *gin.Context) {
+	locale := negotiateLocale(c, c.Query("locale"))
+
 	thisCompany, err := lookupCompany(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
 		return
 	}
 
 	emps, err := getAllCompanyCPEmployees(thisCompany, true, false)
 	if err != nil {
 		ErrorLog.Println("getAllCompanyCPEmployees err:", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 		return
 	}
 
@@ -264,7 +305,7 @@ func getCPEmployeesHandler(c *gin.Context) {
 		enrs, err := getCPEnrollmentsByEmployee(emp.AccountID, false, false)
 		if err != nil {
 			ErrorLog.Println("getCPEnrollmentsByEmployee err:", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 			return
 		}
 
@@ -277,33 +318,35 @@ func getCPEmployeesHandler(c *gin.Context) {
 }
 
 func deleteCPEnrollmentHandler(c *gin.Context) {
+	locale := negotiateLocale(c, c.Query("locale"))
+
 	thisCompany, err := lookupCompany(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
 		return
 	}
 
 	input := &DeleteEnrollmentRequest{}
 	if err := c.ShouldBindWith(input, binding.JSON); err != nil {
 		ErrorLog.Println("err binding deleteCPEnrollmentHandler json: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_INPUT_WRONG_FORMAT)})
 		return
 	}
 
 	enr, err := getCPEnrollmentByID(input.GlobalID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Enrollment not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ENROLLMENT_NOT_FOUND)})
 		return
 	}
 
 	if enr.CompanyID != thisCompany.ID {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
 		return
 	}
 
 	err = enr.ToggleActive()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occurred"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 		return
 	}
 
@@ -313,49 +356,65 @@ func deleteCPEnrollmentHandler(c *gin.Context) {
 }
 
 func newCPEnrollmentHandler(c *gin.Context) {
+	locale := negotiateLocale(c, c.Query("locale"))
+
 	thisCompany, err := lookupCompany(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
 		return
 	}
 
 	input := &NewEnrollmentRequest{}
 	if err := c.ShouldBindWith(input, binding.JSON); err != nil {
 		ErrorLog.Println("err binding newCPEnrollmentHandler json: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_INPUT_WRONG_FORMAT)})
+		return
+	}
+
+	if getCPBiometricSettings(thisCompany.ID).RequireConsent && (input.Consent == nil || input.Consent.SignedName == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_BIOMETRIC_CONSENT_NEEDED)})
 		return
 	}
 
 	_, err = insertCPEmployeeIfNotExists(input.EmployeeAccountID, &thisCompany)
 	if err != nil {
 		ErrorLog.Println("err insertCPEmployeeIfNotExists: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 		return
 	}
 
 	err = deactivateExistingEnrollments(input.Position, input.EmployeeAccountID)
 	if err != nil {
 		ErrorLog.Println("err deactivateExistingEnrollments: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 		return
 	}
 
 	enr, err := createCPEnrollment(input, &thisCompany)
 	if err != nil {
 		ErrorLog.Println("err createCPEnrollment: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 		return
 	}
 
+	if input.Consent != nil {
+		err = createCPBiometricConsent(input.Consent, enr)
+		if err != nil {
+			ErrorLog.Println("err createCPBiometricConsent: ", err)
+		}
+	}
+
 	c.JSON(http.StatusCreated, gin.H{"global_id": enr.ID})
 
 	go cpCreateNewAddEnrollmentChange(enr)
 }
 
 func getAllCPInstallationsHandler(c *gin.Context) {
+	locale := negotiateLocale(c, c.Query("locale"))
+
 	thisCompany, err := lookupCompany(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
 		return
 	}
 
@@ -365,9 +424,11 @@ func getAllCPInstallationsHandler(c *gin.Context) {
 }
 
 func searchCloudPunchEmployeesHandler(c *gin.Context) {
+	locale := negotiateLocale(c, c.Query("locale"))
+
 	thisCompany, err := lookupCompany(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
 		return
 	}
 
@@ -377,7 +438,7 @@ func searchCloudPunchEmployeesHandler(c *gin.Context) {
 	records, err := getAllCompanyEmployeesWithCache(&thisCompany, false, true)
 	if err != nil {
 		ErrorLog.Println("searchCloudPunchEmployeesHandler err looking up companyID: ", thisCompany.OPID, " getAllCompanyEmployeesWithCache err: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Employee Not Found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_EMPLOYEE_NOT_FOUND)})
 		return
 	}
 
@@ -421,21 +482,23 @@ func searchCloudPunchEmployeesHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusBadRequest, gin.H{"error": "Employee Not Found"})
+	c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_EMPLOYEE_NOT_FOUND)})
 	return
 }
 
 func newCPInstallationHandler(c *gin.Context) {
+	locale := negotiateLocale(c, c.Query("locale"))
+
 	thisCompany, err := lookupCompany(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
 		return
 	}
 
 	input := &NewCPInstallationRequest{}
 	if err := c.ShouldBindWith(input, binding.JSON); err != nil {
 		ErrorLog.Println("err binding newCPInstallationHandler json: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_INPUT_WRONG_FORMAT)})
 		return
 	}
 
@@ -444,7 +507,7 @@ func newCPInstallationHandler(c *gin.Context) {
 	newIns, err := newCPInstallation(thisCompany, clientIP, input.Name, input.EmployeeFilters)
 	if err != nil {
 		ErrorLog.Println("newCPInstallation err: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 		return
 	}
 
@@ -452,15 +515,17 @@ func newCPInstallationHandler(c *gin.Context) {
 }
 
 func updateCPInstallationHandler(c *gin.Context) {
+	locale := negotiateLocale(c, c.Query("locale"))
+
 	thisCompany, err := lookupCompany(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
 		return
 	}
 
 	token := c.Param("installationToken")
 	if token == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_INPUT_WRONG_FORMAT)})
 		return
 	}
 
@@ -472,20 +537,20 @@ func updateCPInstallationHandler(c *gin.Context) {
 	}{}
 	if err := c.ShouldBindWith(&input, binding.JSON); err != nil {
 		ErrorLog.Println("err binding newCPInstallationHandler json: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_INPUT_WRONG_FORMAT)})
 		return
 	}
 
 	install, err := getInstallationByToken(token)
 	if err != nil {
 		ErrorLog.Println("getInstallationByToken err: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Installation does not exist"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_INSTALLATION_NOT_FOUND)})
 		return
 	}
 
 	if install.CompanyID != thisCompany.ID {
 		ErrorLog.Println("getInstallationByToken install.CompanyID != thisCompany.ID ")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
 		return
 	}
 
@@ -493,10 +558,15 @@ func updateCPInstallationHandler(c *gin.Context) {
 		install.DisplayName = *input.NewName
 	}
 
+	oldFilters := install.EmployeeFilters
 	employeeFilterUpdated := false
 	if input.EmployeeFilters != nil {
 		cef := input.EmployeeFilters.ToCPEmployeeFilters()
-		if cef != nil && cef.CostCenters.Indexes != nil {
+		if cef != nil && cef.IsSet() {
+			if err := cef.Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			install.EmployeeFiltersPM = cef.ToPropertyMap()
 			employeeFilterUpdated = true
 		}
@@ -508,36 +578,10 @@ func updateCPInstallationHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, install)
 
 	if employeeFilterUpdated {
-		go install.HandleEmployeeFiltersUpdate()
+		go install.HandleEmployeeFiltersUpdate(oldFilters)
 	}
 }
 
-func (i *CPInstallation) HandleEmployeeFiltersUpdate() {
-	data := CPUpdateFiltersDB{
-		InstallationID: i.ID,
-	}
-
-	var dataPM PropertyMap
-	datab, err := json.Marshal(data)
-	if err != nil {
-		return
-	}
-	err = json.Unmarshal(datab, &dataPM)
-	if err != nil {
-		return
-	}
-
-	newChange := &CPChange{
-		CompanyID: i.CompanyID,
-		Type:      CPCHANGETYPE_UPDATE_INSTALL_FILTER,
-		Data:      &dataPM,
-	}
-
-	err = dbmap.Insert(newChange)
-
-	return
-}
-
 func newCPInstallation(company Company, ipAddress, name string, employeeFilters *PropertyMap) (*CPInstallation, error) {
 	newToken, err := generateNewToken()
 	if err != nil {
@@ -555,7 +599,7 @@ func newCPInstallation(company Company, ipAddress, name string, employeeFilters
 	}
 
 	cef := employeeFilters.ToCPEmployeeFilters()
-	if cef == nil || cef.CostCenters.Indexes == nil {
+	if cef == nil || !cef.IsSet() {
 		defaultFilters := CPEmployeeFilters{}
 		x := CPEmployeeCostCenterFilter{}
 		x.Indexes = []CPEmployeeCostCenterFilterIndex{}
@@ -563,14 +607,26 @@ func newCPInstallation(company Company, ipAddress, name string, employeeFilters
 
 		employeeFilters = defaultFilters.ToPropertyMap()
 	} else {
+		if err := cef.Validate(); err != nil {
+			return nil, err
+		}
 		employeeFilters = cef.ToPropertyMap()
 	}
 
+	// new installations bootstrap from a snapshot, so they start at the current marker
+	marker, err := cpCurrentMaxChangeID(company.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	cpi := &CPInstallation{
 		Token:             newToken,
 		CompanyID:         company.ID,
 		DisplayName:       nameToUse,
 		IP:                ipAddress,
+		LastSyncedUnix:    time.Now().Unix(),
+		SyncMarker:        marker,
+		Created:           time.Now().Unix(),
 		EmployeeFiltersPM: employeeFilters,
 		ClientSettingsPM:  &PropertyMap{},
 		CompanyName:       company.Name,
@@ -589,15 +645,17 @@ func newCPInstallation(company Company, ipAddress, name string, employeeFilters
 // Even if 200, could still have errors per punch
 // If server error, will return {error: "error statement"}
 func timeClockPunchHandler(c *gin.Context) {
+	locale := negotiateLocale(c, c.Query("locale"))
+
 	thisCompany, err := lookupCompany(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
 		return
 	}
 
 	input := opapi.TimePunchRequest{}
 	if err := c.ShouldBindWith(&input, binding.JSON); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_INPUT_WRONG_FORMAT)})
 		return
 	}
 
@@ -615,7 +673,7 @@ func timeClockPunchHandler(c *gin.Context) {
 			return
 		} else {
 			ErrorLog.Printf("PUNCH ERR %s | %v / %v calls after | INTERNAL err: %s\n", time.Now().Format(logTimeFmt), cxn.CallLimit.CurrentCalls, cxn.CallLimit.Threshold, err.Error())
-			c.JSON(http.StatusBadRequest, gin.H{"error": "An error occurred"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 			return
 		}
 	}
@@ -658,6 +716,11 @@ func refreshTimeClockProductCaches() {
 			ErrorLog.Println(company.ShortName, " getAllCompanyEmployeesWithCache err: ", err.Error())
 		}
 
+		err = refreshCPEmployeeAttributes(company)
+		if err != nil {
+			ErrorLog.Println(company.ShortName, " refreshCPEmployeeAttributes err: ", err.Error())
+		}
+
 		alreadyRefreshedCompanies[cp.CompanyID] = true
 
 		// sleep for rate limits
@@ -750,6 +813,7 @@ func createCPEmployee(accID int64, company *Company) (*CPEmployee, error) {
 		MiddleInitial: opMiddleNameToMiddleInitial(empRecord.MiddleName),
 		LastName:      empRecord.LastName,
 		EmployeeID:    empRecord.EmployeeID,
+		HireDate:      normalizeOPDate(empRecord.Dates.Hired),
 		Active:        true,
 	}
 
@@ -809,6 +873,7 @@ func deactivateExistingEnrollments(fingerPostion int8, accID int64) error {
 
 func deactivateEnrollment(enr *CPEnrollment) error {
 	enr.Active = false
+	enr.DeactivatedAt = time.Now().Unix()
 	_, err := dbmap.Update(enr)
 	return err
 }
@@ -821,6 +886,10 @@ func getCPEnrollmentByID(enrID int64) (*CPEnrollment, error) {
 
 func (enr *CPEnrollment) ToggleActive() error {
 	enr.Active = !enr.Active
+	enr.DeactivatedAt = 0
+	if !enr.Active {
+		enr.DeactivatedAt = time.Now().Unix()
+	}
 	_, err := dbmap.Update(enr)
 	return err
 }
@@ -831,8 +900,12 @@ func (i *CPInstallation) UpdateLastSyncedAndIP(t time.Time, newIP string) {
 		t = t.In(loc)
 	}
 
+	i.recordIPChange(newIP, t)
+
 	i.IP = newIP
 	i.LastSynced = t.Format("15:04:05 MST Jan 2, 2006")
+	i.LastSyncedUnix = t.Unix()
+	i.StaleAlertSent = 0
 	dbmap.Update(i)
 }
 
@@ -840,7 +913,7 @@ func getCPEnrollmentsByEmployee(empAccountID int64, includeData, activeOnly bool
 	enrs := []CPEnrollment{}
 	qry := "SELECT * FROM cp_enrollments WHERE employee_account_id = ?"
 	if !includeData {
-		qry = "SELECT id, company_id, employee_account_id, position, created_date, installation_id, active FROM cp_enrollments WHERE employee_account_id = ?"
+		qry = "SELECT id, company_id, employee_account_id, position, created_date, installation_id, active, deactivated_at, purged_at FROM cp_enrollments WHERE employee_account_id = ?"
 	}
 
 	if activeOnly {
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Written consent the employee gave at the time clock before their fingerprint was enrolled
+type CPBiometricConsent struct {
+	ID                int64  `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID         int64  `db:"company_id" json:"company_id"`
+	EnrollmentID      int64  `db:"enrollment_id" json:"enrollment_id"`
+	EmployeeAccountID int64  `db:"employee_account_id" json:"employee_account_id"`
+	InstallationID    int64  `db:"installation_id" json:"installation_id"`
+	SignedName        string `db:"signed_name" json:"signed_name"`
+	PolicyVersion     string `db:"policy_version" json:"policy_version"`
+	ConsentedAt       string `db:"consented_at" json:"consented_at"`
+	Created           int64  `db:"created" json:"created"`
+}
+
+type CPBiometricConsentRequest struct {
+	SignedName    string `json:"signed_name"`
+	PolicyVersion string `json:"policy_version"`
+	ConsentedAt   string `json:"consented_at"`
+}
+
+// Audit trail of every template we destroyed and why
+type CPBiometricPurge struct {
+	ID                int64  `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID         int64  `db:"company_id" json:"company_id"`
+	EnrollmentID      int64  `db:"enrollment_id" json:"enrollment_id"`
+	EmployeeAccountID int64  `db:"employee_account_id" json:"employee_account_id"`
+	Reason            string `db:"reason" json:"reason"`
+	TriggeredAt       int64  `db:"triggered_at" json:"triggered_at"`
+	PurgedAt          int64  `db:"purged_at" json:"purged_at"`
+}
+
+// Lives under "biometrics" in the cloudpunch company product settings
+type CPBiometricSettings struct {
+	RetentionDays  int  `json:"retention_days"`
+	RequireConsent bool `json:"require_consent"`
+}
+
+type CPBiometricAuditResponse struct {
+	RetentionDays        int                  `json:"retention_days"`
+	RequireConsent       bool                 `json:"require_consent"`
+	ActiveEnrollments    int64                `json:"active_enrollments"`
+	EnrollmentsNoConsent int64                `json:"enrollments_without_consent"`
+	Consents             []CPBiometricConsent `json:"consents"`
+	Purges               []CPBiometricPurge   `json:"purges"`
+}
+
+const (
+	CP_DEFAULT_BIOMETRIC_RETENTION_DAYS = 30
+
+	CPPURGEREASON_TERMINATED             = "TERMINATED"
+	CPPURGEREASON_EMPLOYEE_DEACTIVATED   = "EMPLOYEE_DEACTIVATED"
+	CPPURGEREASON_ENROLLMENT_DEACTIVATED = "ENROLLMENT_DEACTIVATED"
+)
+
+func getCPBiometricAuditHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	settings := getCPBiometricSettings(thisCompany.ID)
+
+	resp := CPBiometricAuditResponse{
+		RetentionDays:  settings.Retention(),
+		RequireConsent: settings.RequireConsent,
+		Consents:       []CPBiometricConsent{},
+		Purges:         []CPBiometricPurge{},
+	}
+
+	_, err = dbmap.Select(&resp.Consents, "SELECT * FROM cp_biometric_consents WHERE company_id = ? ORDER BY id DESC", thisCompany.ID)
+	if err != nil {
+		ErrorLog.Println("getCPBiometricAuditHandler consents err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	_, err = dbmap.Select(&resp.Purges, "SELECT * FROM cp_biometric_purges WHERE company_id = ? ORDER BY id DESC", thisCompany.ID)
+	if err != nil {
+		ErrorLog.Println("getCPBiometricAuditHandler purges err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	resp.ActiveEnrollments, _ = dbmap.SelectInt("SELECT COUNT(*) FROM cp_enrollments WHERE company_id = ? AND active = 1", thisCompany.ID)
+	resp.EnrollmentsNoConsent, _ = dbmap.SelectInt("SELECT COUNT(*) FROM cp_enrollments e WHERE e.company_id = ? AND e.active = 1 AND NOT EXISTS (SELECT 1 FROM cp_biometric_consents bc WHERE bc.enrollment_id = e.id)", thisCompany.ID)
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func createCPBiometricConsent(consentReq *CPBiometricConsentRequest, enr *CPEnrollment) error {
+	consent := &CPBiometricConsent{
+		CompanyID:         enr.CompanyID,
+		EnrollmentID:      enr.ID,
+		EmployeeAccountID: enr.EmployeeAccountID,
+		InstallationID:    enr.InstallationID,
+		SignedName:        consentReq.SignedName,
+		PolicyVersion:     consentReq.PolicyVersion,
+		ConsentedAt:       consentReq.ConsentedAt,
+		Created:           time.Now().Unix(),
+	}
+
+	return dbmap.Insert(consent)
+}
+
+// Stamps terminations from the same OP report the HF pipeline pulls, then purges
+// every template whose retention window has passed
+func runCPBiometricRetention() {
+	InfoLog.Println("starting runCPBiometricRetention")
+
+	fireRows, err := pullNewFiresReport()
+	if err != nil {
+		ErrorLog.Println("runCPBiometricRetention pullNewFiresReport err: ", err)
+	} else {
+		recordCPTerminations(fireRows)
+	}
+
+	cpCompanies, err := findAllCompaniesWithProduct(PRODUCT_CLOUDPUNCH_URL)
+	if err != nil {
+		ErrorLog.Println("runCPBiometricRetention findAllCompaniesWithProduct err: ", err)
+		return
+	}
+
+	now := time.Now()
+	for _, coProd := range cpCompanies {
+		settings := coProd.Settings.ToCPBiometricSettings()
+
+		purged, err := purgeExpiredCPBiometrics(coProd.CompanyID, settings.Retention(), now)
+		if err != nil {
+			ErrorLog.Println("purgeExpiredCPBiometrics companyID: ", coProd.CompanyID, " err: ", err)
+		}
+		if purged > 0 {
+			InfoLog.Printf("runCPBiometricRetention purged %d enrollments for companyID %d\n", purged, coProd.CompanyID)
+		}
+	}
+
+	InfoLog.Println("finished runCPBiometricRetention")
+}
+
+func recordCPTerminations(fireRows []NewFiresReport) {
+	for _, fireRow := range fireRows {
+		terminated := normalizeOPDate(fireRow.DateTerminated)
+		if terminated == "" {
+			continue
+		}
+
+		_, err := dbmap.Exec("UPDATE cp_employees SET terminated_date = ? WHERE account_id = ? AND (terminated_date IS NULL OR terminated_date = '' OR terminated_date <> ?)", terminated, fireRow.AccountID, terminated)
+		if err != nil {
+			ErrorLog.Println("recordCPTerminations update err: ", err)
+		}
+	}
+}
+
+func purgeExpiredCPBiometrics(companyID int64, retentionDays int, now time.Time) (int, error) {
+	enrs := []CPEnrollment{}
+	_, err := dbmap.Select(&enrs, "SELECT id, company_id, employee_account_id, position, created_date, installation_id, active, deactivated_at, purged_at FROM cp_enrollments WHERE company_id = ? AND purged_at = 0 AND data IS NOT NULL", companyID)
+	if err != nil {
+		return 0, err
+	}
+
+	employees := make(map[int64]*CPEmployee)
+	retention := time.Duration(retentionDays) * 24 * time.Hour
+
+	purged := 0
+	for _, enr := range enrs {
+		emp, found := employees[enr.EmployeeAccountID]
+		if !found {
+			emp, err = getCPEmployeeByAccountID(enr.EmployeeAccountID)
+			if err != nil {
+				ErrorLog.Println("purgeExpiredCPBiometrics getCPEmployeeByAccountID err: ", err)
+				continue
+			}
+			employees[enr.EmployeeAccountID] = emp
+		}
+
+		reason, triggeredAt := cpBiometricPurgeTrigger(&enr, emp)
+		if reason == "" || now.Before(triggeredAt.Add(retention)) {
+			continue
+		}
+
+		err = purgeCPEnrollmentData(&enr, reason, triggeredAt, now)
+		if err != nil {
+			ErrorLog.Println("purgeCPEnrollmentData err: ", err)
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// The earliest of termination, employee deactivation or enrollment deactivation starts the retention clock
+func cpBiometricPurgeTrigger(enr *CPEnrollment, emp *CPEmployee) (string, time.Time) {
+	reason := ""
+	var triggeredAt time.Time
+
+	consider := func(r string, t time.Time) {
+		if reason == "" || t.Before(triggeredAt) {
+			reason, triggeredAt = r, t
+		}
+	}
+
+	// a rehired employee keeps their old termination date, it only counts if they're still gone or it came after they enrolled
+	if emp.TerminatedDate != "" {
+		if t, err := time.Parse(CP_FILTER_DATE_FORMAT, emp.TerminatedDate); err == nil {
+			created, known := cpEnrollmentCreated(enr)
+			if !emp.Active || (known && t.After(created)) {
+				consider(CPPURGEREASON_TERMINATED, t)
+			}
+		}
+	}
+
+	if !emp.Active && emp.DeactivatedAt > 0 {
+		consider(CPPURGEREASON_EMPLOYEE_DEACTIVATED, time.Unix(emp.DeactivatedAt, 0))
+	}
+
+	if !enr.Active && enr.DeactivatedAt > 0 {
+		consider(CPPURGEREASON_ENROLLMENT_DEACTIVATED, time.Unix(enr.DeactivatedAt, 0))
+	}
+
+	return reason, triggeredAt
+}
+
+// The created date comes from the device, either as a timestamp or a plain date
+func cpEnrollmentCreated(enr *CPEnrollment) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, enr.CreatedDate); err == nil {
+		return t, true
+	}
+
+	if len(enr.CreatedDate) >= len(CP_FILTER_DATE_FORMAT) {
+		if t, err := time.Parse(CP_FILTER_DATE_FORMAT, enr.CreatedDate[:len(CP_FILTER_DATE_FORMAT)]); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func purgeCPEnrollmentData(enr *CPEnrollment, reason string, triggeredAt, now time.Time) error {
+	wasActive := enr.Active
+
+	enr.Data = nil
+	enr.Active = false
+	enr.PurgedAt = now.Unix()
+	if enr.DeactivatedAt == 0 {
+		enr.DeactivatedAt = now.Unix()
+	}
+
+	_, err := dbmap.Update(enr)
+	if err != nil {
+		return err
+	}
+
+	audit := &CPBiometricPurge{
+		CompanyID:         enr.CompanyID,
+		EnrollmentID:      enr.ID,
+		EmployeeAccountID: enr.EmployeeAccountID,
+		Reason:            reason,
+		TriggeredAt:       triggeredAt.Unix(),
+		PurgedAt:          now.Unix(),
+	}
+	err = dbmap.Insert(audit)
+	if err != nil {
+		ErrorLog.Println("purgeCPEnrollmentData audit insert err: ", err)
+	}
+
+	// every installation drops its copy, even ones that were already told when it was deactivated
+	err = cpCreateEnrollmentDeletionChange(enr)
+	if err != nil {
+		return errors.New(fmt.Sprintf("purged enrollment %d (active: %v) but could not queue deletion: %s", enr.ID, wasActive, err.Error()))
+	}
+
+	return nil
+}
+
+func getCPBiometricSettings(companyID int64) *CPBiometricSettings {
+	coProd, err := getCompanyProductByURL(companyID, PRODUCT_CLOUDPUNCH_URL)
+	if err != nil {
+		return &CPBiometricSettings{}
+	}
+
+	return coProd.Settings.ToCPBiometricSettings()
+}
+
+func (s *CPBiometricSettings) Retention() int {
+	if s.RetentionDays <= 0 {
+		return CP_DEFAULT_BIOMETRIC_RETENTION_DAYS
+	}
+	return s.RetentionDays
+}
+
+func (pm *PropertyMap) ToCPBiometricSettings() *CPBiometricSettings {
+	settings := struct {
+		Biometrics CPBiometricSettings `json:"biometrics"`
+	}{}
+
+	datab, err := json.Marshal(pm)
+	if err != nil {
+		return &settings.Biometrics
+	}
+	err = json.Unmarshal(datab, &settings)
+	if err != nil {
+		ErrorLog.Println("ToCPBiometricSettings err: ", err)
+	}
+
+	return &settings.Biometrics
+}
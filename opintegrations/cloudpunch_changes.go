@@ -27,6 +27,8 @@ type CPDeleteEnrollmentDB struct {
 
 type CPEmployeeChangeDB struct {
 	AccountID int64 `json:"account_id"`
+	// set when only one installation should apply the change
+	InstallationID int64 `json:"installation_id,omitempty"`
 }
 
 type CPUpdateFiltersDB struct {
@@ -114,13 +116,50 @@ func getCPSyncHandler(c *gin.Context) {
 		return
 	}
 
-	changes, err := cpGetSyncChanges(int64(syncMarker), &thisCompany)
+	syncState, err := getCPSyncState(thisCompany.ID)
 	if err != nil {
-		ErrorLog.Println("cpGetSyncChanges err: ", err)
+		ErrorLog.Println("getCPSyncState err: ", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
 		return
 	}
 
+	var returnedChanges []CPChangeResponse
+	if int64(syncMarker) < syncState.CompactedThrough {
+		// the changes this device needs were compacted, v1 devices don't know about snapshots
+		// so hand them one through the filter update change they already know how to apply
+		snapshot, err := cpBuildInstallationSnapshot(&installation, thisCompany)
+		if err != nil {
+			ErrorLog.Println("cpBuildInstallationSnapshot err: ", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+			return
+		}
+
+		respData := CPAddEmployeeSync{snapshot.Employees}
+		returnedChanges = []CPChangeResponse{{
+			ID:   snapshot.Marker,
+			Type: CPCHANGETYPE_UPDATE_INSTALL_FILTER,
+			Data: respData.ToPropertyMap(),
+		}}
+	} else {
+		changes, err := cpGetSyncChanges(int64(syncMarker), &thisCompany)
+		if err != nil {
+			ErrorLog.Println("cpGetSyncChanges err: ", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+			return
+		}
+
+		returnedChanges = cpBuildChangeResponses(changes, &installation, thisCompany)
+	}
+
+	c.JSON(http.StatusOK, returnedChanges)
+
+	// the marker sent is the last change this device applied, compaction keeps everything after it
+	installation.SyncMarker = int64(syncMarker)
+	go installation.UpdateLastSyncedAndIP(time.Now(), c.GetHeader("X-Real-IP"))
+}
+
+// Turns stored changes into what this installation should apply, skipping the ones filtered away from it
+func cpBuildChangeResponses(changes []CPChange, installation *CPInstallation, company Company) []CPChangeResponse {
 	skipAllFutureAddAndDeletes := false
 
 	returnedChanges := []CPChangeResponse{}
@@ -140,7 +179,7 @@ func getCPSyncHandler(c *gin.Context) {
 			}
 
 			changeInfoFromDB := dbChange.Data.ToCPEmployeeChangeDB()
-			if changeInfoFromDB == nil {
+			if changeInfoFromDB == nil || (changeInfoFromDB.InstallationID != 0 && changeInfoFromDB.InstallationID != installation.ID) {
 				resp.Type = CPCHANGETYPE_SKIP
 				resp.Data = nil
 				returnedChanges = append(returnedChanges, resp)
@@ -173,7 +212,7 @@ func getCPSyncHandler(c *gin.Context) {
 			}
 
 			changeInfoFromDB := dbChange.Data.ToCPEmployeeChangeDB()
-			if changeInfoFromDB == nil {
+			if changeInfoFromDB == nil || (changeInfoFromDB.InstallationID != 0 && changeInfoFromDB.InstallationID != installation.ID) {
 				resp.Type = CPCHANGETYPE_SKIP
 				resp.Data = nil
 				returnedChanges = append(returnedChanges, resp)
@@ -246,25 +285,12 @@ func getCPSyncHandler(c *gin.Context) {
 				continue
 			}
 
-			allEmps, err := getAllCompanyCPEmployees(thisCompany, true, true)
+			filteredEmployees, err := cpFilteredEmployeesWithEnrollments(installation, company)
 			if err != nil {
-				ErrorLog.Println("getAllCompanyCPEmployees err: ", err)
+				ErrorLog.Println("cpFilteredEmployeesWithEnrollments err: ", err)
 				break
 			}
 
-			filteredEmployees := []CPEmployee{}
-			for _, emp := range allEmps {
-				if emp.MeetsEmployeeFilter(installation.EmployeeFiltersPM.ToCPEmployeeFilters()) {
-					enrs, err := getCPEnrollmentsByEmployee(emp.AccountID, true, true)
-					if err != nil {
-						ErrorLog.Println("getCPEnrollmentsByEmployee err: ", err)
-						continue
-					}
-					emp.Enrollments = &enrs
-					filteredEmployees = append(filteredEmployees, emp)
-				}
-			}
-
 			respData := CPAddEmployeeSync{filteredEmployees}
 			data := respData.ToPropertyMap()
 			resp.Data = data
@@ -273,32 +299,7 @@ func getCPSyncHandler(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, returnedChanges)
-
-	go installation.UpdateLastSyncedAndIP(time.Now(), c.GetHeader("X-Real-IP"))
-}
-
-func (e *CPEmployee) MeetsEmployeeFilter(filter *CPEmployeeFilters) bool {
-	if !e.Active {
-		return false
-	}
-
-	indexToDefaultCCMap := make(map[int]int64)
-	indexToDefaultCCMap[0] = e.CostCenter0
-	indexToDefaultCCMap[1] = e.CostCenter1
-	indexToDefaultCCMap[2] = e.CostCenter2
-	indexToDefaultCCMap[3] = e.CostCenter3
-	indexToDefaultCCMap[4] = e.CostCenter4
-
-	for _, ccFilter := range filter.CostCenters.Indexes {
-		defaultCCID := indexToDefaultCCMap[ccFilter.Index]
-		for _, cc := range ccFilter.Values {
-			if cc.CostCenterID == defaultCCID {
-				return true
-			}
-		}
-	}
-	return false
+	return returnedChanges
 }
 
 func cpGetSyncChanges(currentMarker int64, company *Company) ([]CPChange, error) {
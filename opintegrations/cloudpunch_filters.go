@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// One condition group, its conditions are combined by Match
+type CPEmployeeFilterGroup struct {
+	Match      string                      `json:"match"`
+	Conditions []CPEmployeeFilterCondition `json:"conditions"`
+}
+
+type CPEmployeeFilterCondition struct {
+	Field string `json:"field"`
+
+	// employee_type, pay_type and job_title match any of these, case insensitive
+	Values []string `json:"values"`
+
+	// hire_date range, YYYY-MM-DD and inclusive, either end can be left blank
+	HiredOnOrAfter  string `json:"hired_on_or_after"`
+	HiredOnOrBefore string `json:"hired_on_or_before"`
+
+	// cost_center
+	CostCenterIndex int     `json:"cost_center_index"`
+	CostCenterIDs   []int64 `json:"cost_center_ids"`
+}
+
+// Columns of the OP saved report set as employee_attributes_report_id in the cloudpunch settings
+type CPEmployeeAttributesReport struct {
+	EmployeeID   string `csv:"Employee Id"`
+	EmployeeType string `csv:"Employee Type"`
+	PayType      string `csv:"Pay Type"`
+	JobTitle     string `csv:"Default Jobs (HR)"`
+	DateHired    string `csv:"Date Hired"`
+}
+
+const (
+	CPFILTERMATCH_ALL = "all"
+	CPFILTERMATCH_ANY = "any"
+
+	CPFILTERFIELD_EMPLOYEE_TYPE = "employee_type"
+	CPFILTERFIELD_PAY_TYPE      = "pay_type"
+	CPFILTERFIELD_JOB_TITLE     = "job_title"
+	CPFILTERFIELD_HIRE_DATE     = "hire_date"
+	CPFILTERFIELD_COST_CENTER   = "cost_center"
+
+	CP_FILTER_DATE_FORMAT = "2006-01-02"
+)
+
+// Excludes win over includes, includes win over everything else.
+// The legacy cost center filter counts as one more group, and no groups at all matches nobody.
+func (e *CPEmployee) MeetsEmployeeFilter(filter *CPEmployeeFilters) bool {
+	if !e.Active || filter == nil {
+		return false
+	}
+
+	for _, accountID := range filter.ExcludeAccountIDs {
+		if accountID == e.AccountID {
+			return false
+		}
+	}
+
+	for _, accountID := range filter.IncludeAccountIDs {
+		if accountID == e.AccountID {
+			return true
+		}
+	}
+
+	results := []bool{}
+	if len(filter.CostCenters.Indexes) > 0 {
+		results = append(results, e.meetsCostCenterFilter(filter.CostCenters))
+	}
+
+	for _, group := range filter.Groups {
+		groupResults := []bool{}
+		for _, condition := range group.Conditions {
+			groupResults = append(groupResults, e.meetsFilterCondition(condition))
+		}
+		results = append(results, combineFilterResults(group.Match, groupResults))
+	}
+
+	return combineFilterResults(filter.Match, results)
+}
+
+func (e *CPEmployee) meetsCostCenterFilter(ccFilter CPEmployeeCostCenterFilter) bool {
+	for _, indexFilter := range ccFilter.Indexes {
+		defaultCCID := e.defaultCostCenterID(indexFilter.Index)
+		for _, cc := range indexFilter.Values {
+			if cc.CostCenterID == defaultCCID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *CPEmployee) meetsFilterCondition(condition CPEmployeeFilterCondition) bool {
+	switch condition.Field {
+	case CPFILTERFIELD_EMPLOYEE_TYPE:
+		return matchesAnyFold(e.EmployeeType, condition.Values)
+	case CPFILTERFIELD_PAY_TYPE:
+		return matchesAnyFold(e.PayType, condition.Values)
+	case CPFILTERFIELD_JOB_TITLE:
+		return matchesAnyFold(e.JobTitle, condition.Values)
+	case CPFILTERFIELD_HIRE_DATE:
+		if e.HireDate == "" {
+			return false
+		}
+		// dates are all YYYY-MM-DD so they compare as strings
+		if condition.HiredOnOrAfter != "" && e.HireDate < condition.HiredOnOrAfter {
+			return false
+		}
+		if condition.HiredOnOrBefore != "" && e.HireDate > condition.HiredOnOrBefore {
+			return false
+		}
+		return true
+	case CPFILTERFIELD_COST_CENTER:
+		defaultCCID := e.defaultCostCenterID(condition.CostCenterIndex)
+		for _, ccID := range condition.CostCenterIDs {
+			if ccID == defaultCCID {
+				return true
+			}
+		}
+		return false
+	}
+
+	return false
+}
+
+func (e *CPEmployee) defaultCostCenterID(index int) int64 {
+	switch index {
+	case 0:
+		return e.CostCenter0
+	case 1:
+		return e.CostCenter1
+	case 2:
+		return e.CostCenter2
+	case 3:
+		return e.CostCenter3
+	case 4:
+		return e.CostCenter4
+	}
+	return 0
+}
+
+// An empty match means all, an empty set of results never matches
+func combineFilterResults(match string, results []bool) bool {
+	if len(results) == 0 {
+		return false
+	}
+
+	if match == CPFILTERMATCH_ANY {
+		for _, result := range results {
+			if result {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, result := range results {
+		if !result {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAnyFold(value string, options []string) bool {
+	value = strings.TrimSpace(value)
+	for _, option := range options {
+		if strings.EqualFold(value, strings.TrimSpace(option)) {
+			return true
+		}
+	}
+	return false
+}
+
+// True if the filters say anything at all, an unset filter is replaced by the default
+func (cf *CPEmployeeFilters) IsSet() bool {
+	return cf.CostCenters.Indexes != nil || cf.Groups != nil || cf.IncludeAccountIDs != nil || cf.ExcludeAccountIDs != nil
+}
+
+func (cf *CPEmployeeFilters) Validate() error {
+	if cf.Match != "" && cf.Match != CPFILTERMATCH_ALL && cf.Match != CPFILTERMATCH_ANY {
+		return errors.New(fmt.Sprintf("unknown match %s", cf.Match))
+	}
+
+	for i, group := range cf.Groups {
+		if group.Match != "" && group.Match != CPFILTERMATCH_ALL && group.Match != CPFILTERMATCH_ANY {
+			return errors.New(fmt.Sprintf("group %d has unknown match %s", i, group.Match))
+		}
+
+		for _, condition := range group.Conditions {
+			switch condition.Field {
+			case CPFILTERFIELD_EMPLOYEE_TYPE, CPFILTERFIELD_PAY_TYPE, CPFILTERFIELD_JOB_TITLE:
+				if len(condition.Values) == 0 {
+					return errors.New(fmt.Sprintf("group %d %s condition has no values", i, condition.Field))
+				}
+			case CPFILTERFIELD_HIRE_DATE:
+				if condition.HiredOnOrAfter == "" && condition.HiredOnOrBefore == "" {
+					return errors.New(fmt.Sprintf("group %d hire_date condition has no range", i))
+				}
+				for _, date := range []string{condition.HiredOnOrAfter, condition.HiredOnOrBefore} {
+					if date == "" {
+						continue
+					}
+					if _, err := time.Parse(CP_FILTER_DATE_FORMAT, date); err != nil {
+						return errors.New(fmt.Sprintf("group %d hire_date %s is not YYYY-MM-DD", i, date))
+					}
+				}
+			case CPFILTERFIELD_COST_CENTER:
+				if condition.CostCenterIndex < 0 || condition.CostCenterIndex > 4 {
+					return errors.New(fmt.Sprintf("group %d cost_center index %d is out of range", i, condition.CostCenterIndex))
+				}
+			default:
+				return errors.New(fmt.Sprintf("group %d has unknown field %s", i, condition.Field))
+			}
+		}
+	}
+
+	return nil
+}
+
+// Compares who the installation had under the old filters to who it has now,
+// and queues only the adds and deletes for that installation
+func (i *CPInstallation) HandleEmployeeFiltersUpdate(oldFilters *CPEmployeeFilters) {
+	company, err := lookupCompanyByID(i.CompanyID)
+	if err != nil {
+		ErrorLog.Println("HandleEmployeeFiltersUpdate lookupCompanyByID err: ", err)
+		return
+	}
+
+	allEmps, err := getAllCompanyCPEmployees(company, false, true)
+	if err != nil {
+		ErrorLog.Println("HandleEmployeeFiltersUpdate getAllCompanyCPEmployees err: ", err)
+		return
+	}
+
+	newFilters := i.EmployeeFiltersPM.ToCPEmployeeFilters()
+
+	for _, emp := range allEmps {
+		cpQueueInstallationMembershipChange(i, &emp, emp.MeetsEmployeeFilter(oldFilters), emp.MeetsEmployeeFilter(newFilters))
+	}
+}
+
+func cpQueueInstallationMembershipChange(installation *CPInstallation, emp *CPEmployee, wasMember, isMember bool) {
+	if wasMember == isMember {
+		return
+	}
+
+	data := &CPEmployeeChangeDB{
+		AccountID:      emp.AccountID,
+		InstallationID: installation.ID,
+	}
+
+	newChange := &CPChange{
+		CompanyID: installation.CompanyID,
+		Type:      CPCHANGETYPE_ADD_EMPLOYEE,
+		Data:      data.ToPropertyMap(),
+	}
+	if !isMember {
+		newChange.Type = CPCHANGETYPE_DELETE_EMPLOYEE
+	}
+
+	err := dbmap.Insert(newChange)
+	if err != nil {
+		ErrorLog.Println("cpQueueInstallationMembershipChange insert err: ", err)
+	}
+}
+
+// Pulls employee type, pay type, job title and hire date from the company's saved report
+// and queues adds/deletes for installations whose filters now see the employee differently
+func refreshCPEmployeeAttributes(company Company) error {
+	coProd, err := getCompanyProductByURL(company.ID, PRODUCT_CLOUDPUNCH_URL)
+	if err != nil {
+		return nil
+	}
+
+	settings := struct {
+		EmployeeAttributesReportID int64 `json:"employee_attributes_report_id"`
+	}{}
+	datab, err := json.Marshal(coProd.Settings)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(datab, &settings)
+	if err != nil || settings.EmployeeAttributesReportID == 0 {
+		return err
+	}
+
+	cxn := chooseOPAPICxn(company.OPID)
+
+	rows := []CPEmployeeAttributesReport{}
+	reportURL := fmt.Sprintf("https://secure.onehcm.com/ta/rest/v1/report/%s/%v?company:shortname=%s", "saved", settings.EmployeeAttributesReportID, company.ShortName)
+	err = cxn.GenricReport(reportURL, &rows)
+	if err != nil {
+		return errors.New("error getting employee attributes report: " + err.Error())
+	}
+
+	rowsByEmployeeID := make(map[string]CPEmployeeAttributesReport)
+	for _, row := range rows {
+		rowsByEmployeeID[removeLeadingZeroes(row.EmployeeID)] = row
+	}
+
+	installs, err := getAllCompanyCPInstallations(company)
+	if err != nil {
+		return err
+	}
+	for idx := range installs {
+		installs[idx].ConvertPropMaps()
+	}
+
+	emps, err := getAllCompanyCPEmployees(company, false, false)
+	if err != nil {
+		return err
+	}
+
+	for _, emp := range emps {
+		row, found := rowsByEmployeeID[removeLeadingZeroes(emp.EmployeeID)]
+		if !found {
+			continue
+		}
+
+		updated := emp
+		updated.EmployeeType = row.EmployeeType
+		updated.PayType = row.PayType
+		updated.JobTitle = row.JobTitle
+		updated.HireDate = normalizeOPDate(row.DateHired)
+
+		if updated.EmployeeType == emp.EmployeeType && updated.PayType == emp.PayType && updated.JobTitle == emp.JobTitle && updated.HireDate == emp.HireDate {
+			continue
+		}
+
+		_, err = dbmap.Update(&updated)
+		if err != nil {
+			ErrorLog.Println("refreshCPEmployeeAttributes update err: ", err)
+			continue
+		}
+
+		for idx := range installs {
+			cpQueueInstallationMembershipChange(&installs[idx], &updated, emp.MeetsEmployeeFilter(installs[idx].EmployeeFilters), updated.MeetsEmployeeFilter(installs[idx].EmployeeFilters))
+		}
+	}
+
+	return nil
+}
+
+// OP reports use MM/DD/YYYY and the API uses YYYY-MM-DD, filters compare YYYY-MM-DD
+func normalizeOPDate(date string) string {
+	date = strings.TrimSpace(date)
+	if date == "" {
+		return ""
+	}
+
+	for _, layout := range []string{CP_FILTER_DATE_FORMAT, "01/02/2006", "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t.Format(CP_FILTER_DATE_FORMAT)
+		}
+	}
+
+	return ""
+}
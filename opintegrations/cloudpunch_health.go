@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+type CPInstallationIPChange struct {
+	ID             int64  `db:"id, primarykey, autoincrement" json:"id"`
+	InstallationID int64  `db:"installation_id" json:"installation_id"`
+	OldIP          string `db:"old_ip" json:"old_ip"`
+	NewIP          string `db:"new_ip" json:"new_ip"`
+	Changed        int64  `db:"changed" json:"changed"`
+}
+
+// Lives under "stale_alerts" in the cloudpunch company product settings
+type CPStaleAlertSettings struct {
+	Active           bool   `json:"active"`
+	ThresholdMinutes int    `json:"threshold_minutes"`
+	Timezone         string `json:"timezone"`
+	BusinessHours    struct {
+		StartHour int   `json:"start_hour"`
+		EndHour   int   `json:"end_hour"`
+		Weekdays  []int `json:"weekdays"`
+	} `json:"business_hours"`
+}
+
+type CPInstallationHealth struct {
+	Installation      CPInstallation           `json:"installation"`
+	MinutesSinceSync  int64                    `json:"minutes_since_sync"`
+	Stale             bool                     `json:"stale"`
+	PendingChanges    int64                    `json:"pending_changes"`
+	ActiveEnrollments int64                    `json:"active_enrollments"`
+	RecentIPChanges   []CPInstallationIPChange `json:"recent_ip_changes"`
+}
+
+type CPStaleInstallationEmailBody struct {
+	CompanyName   string
+	Installations []CPStaleInstallationEmailRow
+}
+
+type CPStaleInstallationEmailRow struct {
+	DisplayName string
+	LastSynced  string
+	IP          string
+}
+
+const (
+	CP_DEFAULT_STALE_THRESHOLD_MINUTES = 60
+	CP_DEFAULT_STALE_TIMEZONE          = "America/Los_Angeles"
+	CP_HEALTH_RECENT_IP_CHANGES        = 10
+)
+
+func getCPInstallationsHealthHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	settings := &CPStaleAlertSettings{}
+	coProd, err := getCompanyProductByURL(thisCompany.ID, PRODUCT_CLOUDPUNCH_URL)
+	if err == nil {
+		settings = coProd.Settings.ToCPStaleAlertSettings()
+	}
+
+	instlns, err := getAllCompanyCPInstallations(thisCompany)
+	if err != nil {
+		ErrorLog.Println("getCPInstallationsHealthHandler getAllCompanyCPInstallations err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	now := time.Now()
+	healths := []CPInstallationHealth{}
+	for _, install := range instlns {
+		health := CPInstallationHealth{
+			Installation:     install,
+			MinutesSinceSync: -1,
+			Stale:            install.IsStale(now, settings.Threshold()),
+		}
+
+		if install.LastSyncedUnix > 0 {
+			health.MinutesSinceSync = int64(now.Sub(time.Unix(install.LastSyncedUnix, 0)).Minutes())
+		}
+
+		health.PendingChanges, err = cpCountPendingChanges(install.SyncMarker, thisCompany.ID)
+		if err != nil {
+			ErrorLog.Println("getCPInstallationsHealthHandler cpCountPendingChanges err: ", err)
+		}
+
+		health.ActiveEnrollments, err = dbmap.SelectInt("SELECT COUNT(*) FROM cp_enrollments WHERE installation_id = ? AND active = 1", install.ID)
+		if err != nil {
+			ErrorLog.Println("getCPInstallationsHealthHandler enrollment count err: ", err)
+		}
+
+		health.RecentIPChanges, err = getCPInstallationIPChanges(install.ID, CP_HEALTH_RECENT_IP_CHANGES)
+		if err != nil {
+			ErrorLog.Println("getCPInstallationsHealthHandler getCPInstallationIPChanges err: ", err)
+		}
+
+		healths = append(healths, health)
+	}
+
+	c.JSON(http.StatusOK, healths)
+}
+
+// Emails company admins about installations that stopped syncing, once per outage
+func runCPStaleInstallationAlerts() {
+	InfoLog.Println("starting runCPStaleInstallationAlerts")
+
+	cpCompanies, err := findAllCompaniesWithProduct(PRODUCT_CLOUDPUNCH_URL)
+	if err != nil {
+		ErrorLog.Println("runCPStaleInstallationAlerts findAllCompaniesWithProduct err: ", err)
+		return
+	}
+
+	now := time.Now()
+	for _, coProd := range cpCompanies {
+		settings := coProd.Settings.ToCPStaleAlertSettings()
+		if !settings.Active || !settings.InBusinessHours(now) {
+			continue
+		}
+
+		company, err := lookupCompanyByID(coProd.CompanyID)
+		if err != nil {
+			ErrorLog.Println("runCPStaleInstallationAlerts lookupCompanyByID err: ", err)
+			continue
+		}
+
+		instlns, err := getAllCompanyCPInstallations(company)
+		if err != nil {
+			ErrorLog.Println("runCPStaleInstallationAlerts getAllCompanyCPInstallations err: ", err)
+			continue
+		}
+
+		staleInstalls := []CPInstallation{}
+		for _, install := range instlns {
+			if install.StaleAlertSent == 0 && install.IsStale(now, settings.Threshold()) {
+				staleInstalls = append(staleInstalls, install)
+			}
+		}
+
+		if len(staleInstalls) == 0 {
+			continue
+		}
+
+		err = sendCPStaleInstallationEmail(company, staleInstalls)
+		if err != nil {
+			ErrorLog.Println("runCPStaleInstallationAlerts sendCPStaleInstallationEmail err: ", err)
+			continue
+		}
+
+		for _, install := range staleInstalls {
+			install.StaleAlertSent = now.Unix()
+			dbmap.Update(&install)
+		}
+	}
+
+	InfoLog.Println("finished runCPStaleInstallationAlerts")
+}
+
+func sendCPStaleInstallationEmail(company Company, staleInstalls []CPInstallation) error {
+	admins := []User{}
+	_, err := dbmap.Select(&admins, "SELECT * FROM users WHERE company_id = ? AND is_company_admin = 1 AND email <> ''", company.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(admins) == 0 {
+		return errors.New(fmt.Sprintf("no company admins with an email for company %d", company.ID))
+	}
+
+	toAddresses := []*sgmail.Email{}
+	for _, admin := range admins {
+		toAddresses = append(toAddresses, &sgmail.Email{Name: admin.FirstName + " " + admin.LastName, Address: admin.Email})
+	}
+
+	emailBody := CPStaleInstallationEmailBody{CompanyName: company.Name}
+	for _, install := range staleInstalls {
+		lastSynced := install.LastSynced
+		if lastSynced == "" {
+			lastSynced = "Never"
+		}
+		emailBody.Installations = append(emailBody.Installations, CPStaleInstallationEmailRow{
+			DisplayName: install.DisplayName,
+			LastSynced:  lastSynced,
+			IP:          install.IP,
+		})
+	}
+
+	emailHeaderInfo := sgEmailFields{
+		Subject: fmt.Sprintf("%d CloudPunch time clock(s) stopped syncing", len(staleInstalls)),
+		From:    &sgmail.Email{Name: "OnePoint Connect", Address: passwords.NO_REPLY_EMAILER_ADDRESS},
+		To:      toAddresses,
+	}
+
+	return sendNotification(Notification{CompanyID: company.ID, Kind: NOTIFICATION_KIND_CP_STALE, Email: emailHeaderInfo, Template: CP_STALE_INSTALLATION_ALERT_TEMPLATE, Data: emailBody})
+}
+
+// One that never synced counts from when it was installed
+func (i *CPInstallation) IsStale(now time.Time, threshold time.Duration) bool {
+	since := i.LastSyncedUnix
+	if since == 0 {
+		since = i.Created
+	}
+	if since == 0 {
+		return false
+	}
+
+	return now.Sub(time.Unix(since, 0)) > threshold
+}
+
+func (i *CPInstallation) recordIPChange(newIP string, t time.Time) {
+	if i.IP == "" || newIP == "" || i.IP == newIP {
+		return
+	}
+
+	change := &CPInstallationIPChange{
+		InstallationID: i.ID,
+		OldIP:          i.IP,
+		NewIP:          newIP,
+		Changed:        t.Unix(),
+	}
+
+	err := dbmap.Insert(change)
+	if err != nil {
+		ErrorLog.Println("recordIPChange insert err: ", err)
+	}
+}
+
+func getCPInstallationIPChanges(installationID int64, limit int) ([]CPInstallationIPChange, error) {
+	changes := []CPInstallationIPChange{}
+	_, err := dbmap.Select(&changes, "SELECT * FROM cp_installation_ip_changes WHERE installation_id = ? ORDER BY id DESC LIMIT ?", installationID, limit)
+	return changes, err
+}
+
+func (s *CPStaleAlertSettings) Threshold() time.Duration {
+	if s.ThresholdMinutes <= 0 {
+		return CP_DEFAULT_STALE_THRESHOLD_MINUTES * time.Minute
+	}
+
+	return time.Duration(s.ThresholdMinutes) * time.Minute
+}
+
+// No business hours configured means weekdays 8am to 6pm in the company's timezone
+func (s *CPStaleAlertSettings) InBusinessHours(now time.Time) bool {
+	tz := s.Timezone
+	if tz == "" {
+		tz = CP_DEFAULT_STALE_TIMEZONE
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		ErrorLog.Println("InBusinessHours bad timezone: ", tz)
+		loc, _ = time.LoadLocation(CP_DEFAULT_STALE_TIMEZONE)
+	}
+	now = now.In(loc)
+
+	startHour, endHour := s.BusinessHours.StartHour, s.BusinessHours.EndHour
+	if startHour == 0 && endHour == 0 {
+		startHour, endHour = 8, 18
+	}
+
+	weekdays := s.BusinessHours.Weekdays
+	if len(weekdays) == 0 {
+		weekdays = []int{int(time.Monday), int(time.Tuesday), int(time.Wednesday), int(time.Thursday), int(time.Friday)}
+	}
+
+	dayMatches := false
+	for _, day := range weekdays {
+		if int(now.Weekday()) == day {
+			dayMatches = true
+			break
+		}
+	}
+
+	return dayMatches && now.Hour() >= startHour && now.Hour() < endHour
+}
+
+func (pm *PropertyMap) ToCPStaleAlertSettings() *CPStaleAlertSettings {
+	settings := struct {
+		StaleAlerts CPStaleAlertSettings `json:"stale_alerts"`
+	}{}
+
+	datab, err := json.Marshal(pm)
+	if err != nil {
+		return &settings.StaleAlerts
+	}
+	err = json.Unmarshal(datab, &settings)
+	if err != nil {
+		ErrorLog.Println("ToCPStaleAlertSettings err: ", err)
+	}
+
+	return &settings.StaleAlerts
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tracks how far a company's cp_changes have been compacted, markers below CompactedThrough can no longer be replayed
+type CPSyncState struct {
+	ID               int64 `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID        int64 `db:"company_id" json:"company_id"`
+	CompactedThrough int64 `db:"compacted_through" json:"compacted_through"`
+	LastCompacted    int64 `db:"last_compacted" json:"last_compacted"`
+}
+
+type CPSyncSnapshot struct {
+	Marker    int64        `json:"marker"`
+	Employees []CPEmployee `json:"employees"`
+}
+
+type CPSyncV2Response struct {
+	Marker             int64              `json:"marker"`
+	ResnapshotRequired bool               `json:"resnapshot_required"`
+	Changes            []CPChangeResponse `json:"changes"`
+}
+
+const (
+	// installations that have not synced in this long no longer hold back compaction
+	CP_INSTALLATION_ACTIVE_DAYS = 30
+	// past this many pending changes a snapshot is cheaper than replaying
+	CP_SYNC_MAX_PENDING_CHANGES = 5000
+)
+
+func getCPSyncV2Handler(c *gin.Context) {
+	thisCompany, installation, ok := cpSyncLookupInstallation(c)
+	if !ok {
+		return
+	}
+
+	syncMarker, err := strconv.ParseInt(c.Query("marker"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Marker is a required parameter"})
+		return
+	}
+
+	syncState, err := getCPSyncState(thisCompany.ID)
+	if err != nil {
+		ErrorLog.Println("getCPSyncState err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	resp := CPSyncV2Response{
+		Marker:  syncMarker,
+		Changes: []CPChangeResponse{},
+	}
+
+	if syncMarker < syncState.CompactedThrough {
+		resp.ResnapshotRequired = true
+	} else {
+		pending, err := cpCountPendingChanges(syncMarker, thisCompany.ID)
+		if err != nil {
+			ErrorLog.Println("cpCountPendingChanges err: ", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+			return
+		}
+
+		if pending > CP_SYNC_MAX_PENDING_CHANGES {
+			resp.ResnapshotRequired = true
+		}
+	}
+
+	if !resp.ResnapshotRequired {
+		changes, err := cpGetSyncChanges(syncMarker, &thisCompany)
+		if err != nil {
+			ErrorLog.Println("cpGetSyncChanges err: ", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+			return
+		}
+
+		resp.Changes = cpBuildChangeResponses(changes, &installation, thisCompany)
+		if len(changes) > 0 {
+			resp.Marker = changes[len(changes)-1].ID
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+
+	installation.SyncMarker = syncMarker
+	go installation.UpdateLastSyncedAndIP(time.Now(), c.GetHeader("X-Real-IP"))
+}
+
+// Everything a new or far behind installation needs, apply it then sync from the returned marker
+func getCPSyncSnapshotHandler(c *gin.Context) {
+	thisCompany, installation, ok := cpSyncLookupInstallation(c)
+	if !ok {
+		return
+	}
+
+	snapshot, err := cpBuildInstallationSnapshot(&installation, thisCompany)
+	if err != nil {
+		ErrorLog.Println("cpBuildInstallationSnapshot err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshot)
+}
+
+func cpSyncLookupInstallation(c *gin.Context) (Company, CPInstallation, bool) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return thisCompany, CPInstallation{}, false
+	}
+
+	installTokenParam := c.Query("installToken")
+	if installTokenParam == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Install token is a required parameter"})
+		return thisCompany, CPInstallation{}, false
+	}
+
+	installation, err := getInstallationByToken(installTokenParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Installation not found"})
+		return thisCompany, installation, false
+	}
+
+	if installation.CompanyID != thisCompany.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return thisCompany, installation, false
+	}
+
+	return thisCompany, installation, true
+}
+
+func cpBuildInstallationSnapshot(installation *CPInstallation, company Company) (*CPSyncSnapshot, error) {
+	// take the marker first, anything that changes while we gather is replayed on the next sync
+	marker, err := cpCurrentMaxChangeID(company.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	employees, err := cpFilteredEmployeesWithEnrollments(installation, company)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CPSyncSnapshot{Marker: marker, Employees: employees}, nil
+}
+
+// Active employees that meet the installation's filter, with their active enrollments
+func cpFilteredEmployeesWithEnrollments(installation *CPInstallation, company Company) ([]CPEmployee, error) {
+	allEmps, err := getAllCompanyCPEmployees(company, true, true)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := installation.EmployeeFiltersPM.ToCPEmployeeFilters()
+
+	filteredEmployees := []CPEmployee{}
+	for _, emp := range allEmps {
+		if filters == nil || !emp.MeetsEmployeeFilter(filters) {
+			continue
+		}
+
+		enrs, err := getCPEnrollmentsByEmployee(emp.AccountID, true, true)
+		if err != nil {
+			ErrorLog.Println("getCPEnrollmentsByEmployee err: ", err)
+			continue
+		}
+		emp.Enrollments = &enrs
+		filteredEmployees = append(filteredEmployees, emp)
+	}
+
+	return filteredEmployees, nil
+}
+
+func getCPSyncState(companyID int64) (*CPSyncState, error) {
+	state := &CPSyncState{}
+	err := dbmap.SelectOne(state, "SELECT * FROM cp_sync_states WHERE company_id = ?", companyID)
+	if err != nil {
+		state = &CPSyncState{CompanyID: companyID}
+		err = dbmap.Insert(state)
+	}
+
+	return state, err
+}
+
+func cpCurrentMaxChangeID(companyID int64) (int64, error) {
+	return dbmap.SelectInt("SELECT COALESCE(MAX(id), 0) FROM cp_changes WHERE company_id = ?", companyID)
+}
+
+func cpCountPendingChanges(currentMarker, companyID int64) (int64, error) {
+	return dbmap.SelectInt("SELECT COUNT(*) FROM cp_changes WHERE company_id = ? AND id > ?", companyID, currentMarker)
+}
+
+func compactAllCloudPunchChanges() {
+	InfoLog.Println("starting compactAllCloudPunchChanges")
+
+	companyIDs := []int64{}
+	_, err := dbmap.Select(&companyIDs, "SELECT DISTINCT company_id FROM cp_installations")
+	if err != nil {
+		ErrorLog.Println("compactAllCloudPunchChanges select err: ", err)
+		return
+	}
+
+	for _, companyID := range companyIDs {
+		err = compactCompanyCPChanges(companyID)
+		if err != nil {
+			ErrorLog.Println("compactCompanyCPChanges companyID: ", companyID, " err: ", err)
+		}
+	}
+
+	InfoLog.Println("finished compactAllCloudPunchChanges")
+}
+
+// Deletes changes every active installation has already applied
+func compactCompanyCPChanges(companyID int64) error {
+	installs := []CPInstallation{}
+	_, err := dbmap.Select(&installs, "SELECT * FROM cp_installations WHERE company_id = ?", companyID)
+	if err != nil {
+		return err
+	}
+
+	activeSince := time.Now().AddDate(0, 0, -CP_INSTALLATION_ACTIVE_DAYS).Unix()
+
+	oldestMarker := int64(-1)
+	for _, install := range installs {
+		if install.LastSyncedUnix < activeSince {
+			continue
+		}
+		if oldestMarker == -1 || install.SyncMarker < oldestMarker {
+			oldestMarker = install.SyncMarker
+		}
+	}
+
+	// nothing active means nothing to measure against, leave the history alone
+	if oldestMarker <= 0 {
+		return nil
+	}
+
+	state, err := getCPSyncState(companyID)
+	if err != nil {
+		return err
+	}
+
+	if oldestMarker <= state.CompactedThrough {
+		return nil
+	}
+
+	_, err = dbmap.Exec("DELETE FROM cp_changes WHERE company_id = ? AND id <= ?", companyID, oldestMarker)
+	if err != nil {
+		return err
+	}
+
+	state.CompactedThrough = oldestMarker
+	state.LastCompacted = time.Now().Unix()
+	_, err = dbmap.Update(state)
+
+	return err
+}
@@ -48,9 +48,11 @@ type CompanyProductsPostRequest struct {
 	Integrations []string     `json:"integrations"`
 }
 
+// Integrations are the job boards to start with when adding the jobs product, Indeed and ZipRecruiter when left out
 type CompanyProductListUpdateRequest struct {
-	ChangeType string `json:"change_type"`
-	ProductURL string `json:"product_url"`
+	ChangeType   string   `json:"change_type"`
+	ProductURL   string   `json:"product_url"`
+	Integrations []string `json:"integrations"`
 }
 
 func registerCompanyProductRoutes(router *gin.Engine) {
@@ -140,7 +142,17 @@ func updateCompanysProductListHandler(c *gin.Context) {
 			case PRODUCT_USERPROVISIONING_URL:
 				integrations = []string{gSuiteIntegrationsURL, m365IntegrationsURL, sfIntegrationsURL, boxIntegrationsURL, dropboxIntegrationsURL}
 			case JOBS_PRODUCT_URL:
+				// the other boards are opted into from the job boards page
 				integrations = []string{INDEED_INTEGRATION_URL, ZIPRECRUITER_INTEGRATION_URL}
+				if len(input.Integrations) > 0 {
+					for _, board := range input.Integrations {
+						if _, err := getJobFeedFormatter(board); err != nil {
+							c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown job board " + board})
+							return
+						}
+					}
+					integrations = input.Integrations
+				}
 			}
 
 			_, err = addCompanyProduct(thisCompany.ID, product, nil, true, integrations)
@@ -336,6 +348,23 @@ func updateCompanyProductHandler(c *gin.Context) {
 		return
 	}
 
+	webclockProduct, err := lookupProductByURL(PRODUCT_WEBCLOCK_URL)
+	if err == nil && thisCompanyProduct.ProductID == webclockProduct.ID {
+		webclockSetting := input.ToWebclockSetting()
+		if webclockSetting == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+			return
+		}
+
+		if webclockSetting.Attestation.Active {
+			flowErrs := webclockSetting.Attestation.Validate()
+			if len(flowErrs) > 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "The attestation flow is invalid", "attestation_errors": flowErrs})
+				return
+			}
+		}
+	}
+
 	thisCompanyProduct.Settings = input
 
 	_, err = dbmap.Update(&thisCompanyProduct)
@@ -7,7 +7,7 @@ import (
 func doNow() {
 	// hiredFiredPull()
 	runBgChecks()
-	runIndeedFeed()
+	runJobFeeds()
 	// runUserProvisioningChanges()
 	refreshTimeClockProductCaches()
 }
@@ -17,26 +17,47 @@ func startCrons() {
 		go doNow()
 	}
 
+	// export feeds each run on their own schedule
+	startExportFeedSchedules()
+
 	c := cron.New()
 
-	c.AddFunc("TZ=America/Los_Angeles 0 09 * * *", func() {
+	// nurture steps are set in hours, so they go out within the hour they're due
+	c.AddFunc("@every 1h", func() {
 		runApplyFollowUps()
 	})
 
-	c.AddFunc("TZ=America/Los_Angeles 30 18 * * *", func() {
-		runAllReliasFeeds()
+	c.AddFunc("@every 25m", func() {
+		runJobFeeds()
 	})
 
-	c.AddFunc("TZ=America/Los_Angeles 0 19 * * *", func() {
-		runApplyFollowUps()
+	c.AddFunc("@every 10m", func() {
+		runBgChecks()
 	})
 
-	c.AddFunc("@every 25m", func() {
-		runIndeedFeed()
+	c.AddFunc("@every 1h", func() {
+		runSponsorshipLifecycle()
 	})
 
-	c.AddFunc("@every 10m", func() {
-		runBgChecks()
+	c.AddFunc("@every 5m", func() {
+		runSMSOutbox()
+	})
+
+	c.AddFunc("@every 5m", func() {
+		runNotificationRetries()
+	})
+
+	c.AddFunc("@every 1h", func() {
+		purgeWebhookMessages()
+	})
+
+	// until CHS has its Relias feed, a seed that failed at startup is tried again
+	c.AddFunc("@every 1h", func() {
+		seedReliasExportFeed()
+	})
+
+	c.AddFunc("@every 15m", func() {
+		runBackgroundCheckAdverseActions()
 	})
 
 	// c.AddFunc("@every 1m", func() {
@@ -55,6 +76,18 @@ func startCrons() {
 		refreshTimeClockProductCaches()
 	})
 
+	c.AddFunc("@every 1h", func() {
+		compactAllCloudPunchChanges()
+	})
+
+	c.AddFunc("@every 15m", func() {
+		runCPStaleInstallationAlerts()
+	})
+
+	c.AddFunc("TZ=America/Los_Angeles 0 02 * * *", func() {
+		runCPBiometricRetention()
+	})
+
 	c.AddFunc("TZ=America/Los_Angeles 0 19 * * *", func() {
 		renewGoogleHireRegistrations()
 	})
@@ -55,19 +55,44 @@ func initDB() {
 	dbmap.AddTableWithName(CompanyProductAssignment{}, "company_product_assignments")
 	dbmap.AddTableWithName(User{}, "users")
 	dbmap.AddTableWithName(JobApplication{}, "job_applications")
+	dbmap.AddTableWithName(NurtureSequence{}, "nurture_sequences")
+	dbmap.AddTableWithName(NurtureStepSend{}, "nurture_step_sends")
+	dbmap.AddTableWithName(NurtureUnsubscribe{}, "nurture_unsubscribes")
+	dbmap.AddTableWithName(CompanySMSSettings{}, "company_sms_settings")
+	dbmap.AddTableWithName(SMSMessage{}, "sms_messages")
+	dbmap.AddTableWithName(SMSOptOut{}, "sms_opt_outs")
+	dbmap.AddTableWithName(NotificationDelivery{}, "notification_deliveries")
+	dbmap.AddTableWithName(NotificationPreference{}, "notification_preferences")
 	dbmap.AddTableWithName(IndeedSponsorship{}, "indeed_sponsorships")
 	dbmap.AddTableWithName(CurrentJobReq{}, "current_job_reqs")
 	dbmap.AddTableWithName(ZipRecruiterSponsorship{}, "ziprecruiter_sponsorships")
 	dbmap.AddTableWithName(BackgroundCheck{}, "background_checks")
+	dbmap.AddTableWithName(BackgroundCheckConfig{}, "background_check_configs")
+	dbmap.AddTableWithName(WebhookMessage{}, "webhook_messages")
+	dbmap.AddTableWithName(BackgroundCheckAction{}, "background_check_actions")
+	dbmap.AddTableWithName(ExportFeed{}, "export_feeds")
+	dbmap.AddTableWithName(ExportFeedRun{}, "export_feed_runs")
 	dbmap.AddTableWithName(HFLastTimeFetchedChanges{}, "hf_last_fetched_changes")
 	dbmap.AddTableWithName(AccessControl{}, "access_controls")
 	dbmap.AddTableWithName(CPInstallation{}, "cp_installations")
 	dbmap.AddTableWithName(CPEnrollment{}, "cp_enrollments")
 	dbmap.AddTableWithName(CPEmployee{}, "cp_employees")
 	dbmap.AddTableWithName(CPChange{}, "cp_changes")
+	dbmap.AddTableWithName(CPSyncState{}, "cp_sync_states")
+	dbmap.AddTableWithName(CPInstallationIPChange{}, "cp_installation_ip_changes")
+	dbmap.AddTableWithName(CPBiometricConsent{}, "cp_biometric_consents")
+	dbmap.AddTableWithName(CPBiometricPurge{}, "cp_biometric_purges")
+	dbmap.AddTableWithName(JobReqSnapshot{}, "job_req_snapshots")
+	dbmap.AddTableWithName(JobFeedDiffEntry{}, "job_feed_diffs")
+	dbmap.AddTableWithName(JobFeedUpload{}, "job_feed_uploads")
+	dbmap.AddTableWithName(JobFeedExclusion{}, "job_feed_exclusions")
+	dbmap.AddTableWithName(JobSponsorshipSpend{}, "job_sponsorship_spends")
+	dbmap.AddTableWithName(JobCandidate{}, "job_candidates")
 	dbmap.AddTableWithName(GoogleHireAuthInfo{}, "google_hire_auth")
 	dbmap.AddTableWithName(GoogleHireCreatedApplicants{}, "google_hire_created_applicants")
 	dbmap.AddTableWithName(WebClockPunch{}, "webclock_punches")
+	dbmap.AddTableWithName(WebClockKioskDevice{}, "webclock_kiosk_devices")
+	dbmap.AddTableWithName(WebClockKioskCredential{}, "webclock_kiosk_credentials")
 
 	err = dbmap.CreateTablesIfNotExists()
 	if err != nil {
@@ -153,4 +178,147 @@ func runExecs() {
 	dbmap.Exec("ALTER TABLE products MODIFY default_settings TEXT")
 
 	dbmap.Exec("ALTER TABLE job_applications ADD COLUMN op_applicant_id BIGINT(20) DEFAULT NULL")
+
+	dbmap.Exec("CREATE UNIQUE INDEX kioskTokenUnique ON webclock_kiosk_devices (token)")
+	dbmap.Exec("CREATE UNIQUE INDEX kiosk_employee ON webclock_kiosk_credentials (company_id, employee_account_id)")
+
+	dbmap.Exec("ALTER TABLE cp_installations ADD COLUMN last_synced_unix BIGINT(20) DEFAULT 0")
+	dbmap.Exec("ALTER TABLE cp_installations ADD COLUMN sync_marker BIGINT(20) DEFAULT 0")
+	dbmap.Exec("CREATE UNIQUE INDEX cp_sync_state_company ON cp_sync_states (company_id)")
+
+	dbmap.Exec("ALTER TABLE cp_installations ADD COLUMN stale_alert_sent BIGINT(20) DEFAULT 0")
+	dbmap.Exec("CREATE INDEX cp_ip_changes_install ON cp_installation_ip_changes (installation_id, id)")
+
+	dbmap.Exec("ALTER TABLE cp_employees ADD COLUMN employee_type VARCHAR(255) DEFAULT ''")
+	dbmap.Exec("ALTER TABLE cp_employees ADD COLUMN pay_type VARCHAR(255) DEFAULT ''")
+	dbmap.Exec("ALTER TABLE cp_employees ADD COLUMN job_title VARCHAR(255) DEFAULT ''")
+	dbmap.Exec("ALTER TABLE cp_employees ADD COLUMN hire_date VARCHAR(10) DEFAULT ''")
+
+	dbmap.Exec("ALTER TABLE cp_employees ADD COLUMN terminated_date VARCHAR(10) DEFAULT ''")
+	dbmap.Exec("ALTER TABLE cp_employees ADD COLUMN deactivated_at BIGINT(20) DEFAULT 0")
+	dbmap.Exec("ALTER TABLE cp_enrollments ADD COLUMN deactivated_at BIGINT(20) DEFAULT 0")
+	dbmap.Exec("ALTER TABLE cp_enrollments ADD COLUMN purged_at BIGINT(20) DEFAULT 0")
+	dbmap.Exec("CREATE INDEX cp_biometric_consent_enrollment ON cp_biometric_consents (enrollment_id)")
+
+	dbmap.Exec("ALTER TABLE job_req_snapshots MODIFY detail MEDIUMTEXT")
+	dbmap.Exec("CREATE UNIQUE INDEX job_req_snapshot_job ON job_req_snapshots (company_id, op_id)")
+	dbmap.Exec("CREATE INDEX job_feed_diff_run ON job_feed_diffs (run_started)")
+	dbmap.Exec("CREATE UNIQUE INDEX job_feed_upload_file ON job_feed_uploads (file_name)")
+
+	dbmap.Exec("CREATE INDEX job_feed_exclusion_company ON job_feed_exclusions (company_id)")
+
+	dbmap.Exec("ALTER TABLE indeed_sponsorships ADD COLUMN status VARCHAR(20) DEFAULT ''")
+	dbmap.Exec("ALTER TABLE indeed_sponsorships ADD COLUMN ending_soon_email_sent BIGINT(20) DEFAULT 0")
+	dbmap.Exec("ALTER TABLE indeed_sponsorships ADD COLUMN ended_email_sent BIGINT(20) DEFAULT 0")
+	dbmap.Exec("ALTER TABLE ziprecruiter_sponsorships ADD COLUMN status VARCHAR(20) DEFAULT ''")
+	dbmap.Exec("ALTER TABLE ziprecruiter_sponsorships ADD COLUMN ending_soon_email_sent BIGINT(20) DEFAULT 0")
+	dbmap.Exec("ALTER TABLE ziprecruiter_sponsorships ADD COLUMN ended_email_sent BIGINT(20) DEFAULT 0")
+	dbmap.Exec("CREATE INDEX job_sponsorship_spend_sponsorship ON job_sponsorship_spends (integration_url, sponsorship_id)")
+	dbmap.Exec("CREATE INDEX job_sponsorship_spend_day ON job_sponsorship_spends (integration_url, op_job_id, spend_date)")
+
+	dbmap.Exec("ALTER TABLE job_applications ADD COLUMN candidate_id BIGINT(20) NULL")
+	dbmap.Exec("CREATE INDEX job_applications_candidate ON job_applications (candidate_id, op_job_id)")
+	dbmap.Exec("CREATE INDEX job_candidates_email ON job_candidates (company_id, normalized_email)")
+	dbmap.Exec("CREATE INDEX job_candidates_phone ON job_candidates (company_id, normalized_phone, normalized_name)")
+
+	dbmap.Exec("ALTER TABLE job_applications ADD COLUMN parsed_resume MEDIUMTEXT NULL")
+	dbmap.Exec("ALTER TABLE job_applications ADD COLUMN resume_skills VARCHAR(2000) DEFAULT ''")
+	dbmap.Exec("ALTER TABLE job_applications ADD COLUMN resume_keywords VARCHAR(5000) DEFAULT ''")
+
+	dbmap.Exec("CREATE INDEX job_applications_search_applied ON job_applications (company_id, applied_on_millis, id)")
+	dbmap.Exec("CREATE INDEX job_applications_search_name ON job_applications (company_id, applicant_name, id)")
+	dbmap.Exec("CREATE INDEX job_applications_search_email ON job_applications (company_id, applicant_email)")
+	dbmap.Exec("CREATE INDEX job_applications_search_source ON job_applications (company_id, source, applied_on_millis)")
+	dbmap.Exec("CREATE FULLTEXT INDEX job_applications_fulltext ON job_applications (applicant_name, applicant_email, resume_skills, resume_keywords)")
+	dbmap.Exec("CREATE FULLTEXT INDEX job_applications_resume_fulltext ON job_applications (resume_skills, resume_keywords)")
+
+	dbmap.Exec("ALTER TABLE job_applications ADD COLUMN nurture_state VARCHAR(20) DEFAULT ''")
+	dbmap.Exec("ALTER TABLE job_applications ADD COLUMN nurture_step INT(11) DEFAULT 0")
+	dbmap.Exec("ALTER TABLE job_applications ADD COLUMN nurture_next_at BIGINT(20) DEFAULT 0")
+	dbmap.Exec("ALTER TABLE job_applications ADD COLUMN nurture_token VARCHAR(40) DEFAULT ''")
+	dbmap.Exec("CREATE INDEX job_applications_nurture ON job_applications (company_id, nurture_state)")
+	dbmap.Exec("CREATE INDEX job_applications_nurture_token ON job_applications (nurture_token)")
+	dbmap.Exec("CREATE INDEX nurture_sequences_company ON nurture_sequences (company_id)")
+	dbmap.Exec("CREATE INDEX nurture_step_sends_company ON nurture_step_sends (company_id, application_id)")
+	dbmap.Exec("CREATE INDEX nurture_unsubscribes_email ON nurture_unsubscribes (company_id, email)")
+	// apps from before sequences: carry over the old follow up flags, recent unreminded ones get the default reminder
+	dbmap.Exec("UPDATE job_applications SET nurture_token = MD5(CONCAT(id, RAND())) WHERE nurture_token IS NULL OR nurture_token = ''")
+	dbmap.Exec("UPDATE job_applications SET nurture_state = 'converted' WHERE nurture_state = '' AND applied_on_op = 1")
+	dbmap.Exec("UPDATE job_applications SET nurture_state = 'completed', nurture_step = 1 WHERE nurture_state = '' AND followup_email_sent = 1")
+	dbmap.Exec("UPDATE job_applications SET nurture_state = 'active', nurture_next_at = FLOOR(applied_on_millis / 1000) + 86400 WHERE nurture_state = '' AND applied_on_millis > (UNIX_TIMESTAMP() - 604800) * 1000")
+	dbmap.Exec("UPDATE job_applications SET nurture_state = 'completed' WHERE nurture_state = ''")
+
+	dbmap.Exec("CREATE INDEX company_sms_settings_company ON company_sms_settings (company_id)")
+	dbmap.Exec("CREATE INDEX sms_messages_outbox ON sms_messages (status, send_after)")
+	dbmap.Exec("CREATE INDEX sms_messages_company ON sms_messages (company_id, id)")
+	dbmap.Exec("CREATE INDEX sms_messages_to ON sms_messages (to_number, status)")
+	dbmap.Exec("CREATE INDEX sms_opt_outs_phone ON sms_opt_outs (phone)")
+
+	dbmap.Exec("ALTER TABLE notification_deliveries MODIFY body MEDIUMTEXT")
+	dbmap.Exec("CREATE INDEX notification_deliveries_retry ON notification_deliveries (status, next_attempt)")
+	dbmap.Exec("CREATE INDEX notification_deliveries_company ON notification_deliveries (company_id, id)")
+	dbmap.Exec("CREATE INDEX notification_preferences_lookup ON notification_preferences (company_id, kind, user_id)")
+
+	// every check before configs went to AssureHire
+	dbmap.Exec("ALTER TABLE background_checks ADD COLUMN provider VARCHAR(20) NOT NULL DEFAULT 'assurehire'")
+	dbmap.Exec("CREATE INDEX background_checks_provider ON background_checks (provider, provider_id)")
+	dbmap.Exec("CREATE INDEX background_checks_company ON background_checks (company_id, op_applicant_id)")
+	dbmap.Exec("CREATE UNIQUE INDEX background_check_configs_company ON background_check_configs (company_id)")
+	dbmap.Exec("ALTER TABLE background_checks ADD COLUMN op_job_application_id VARCHAR(50) NOT NULL DEFAULT ''")
+	dbmap.Exec("ALTER TABLE background_checks ADD COLUMN provider_report_id VARCHAR(100) NOT NULL DEFAULT ''")
+	dbmap.Exec("ALTER TABLE background_checks ADD COLUMN completed TINYINT(1) NOT NULL DEFAULT 0")
+	dbmap.Exec("ALTER TABLE background_checks ADD COLUMN written_back BIGINT(20) NOT NULL DEFAULT 0")
+	dbmap.Exec("ALTER TABLE background_checks ADD COLUMN writeback_attempts INT NOT NULL DEFAULT 0")
+	dbmap.Exec("ALTER TABLE background_checks ADD COLUMN writeback_error VARCHAR(1000) NOT NULL DEFAULT ''")
+	dbmap.Exec("ALTER TABLE background_check_configs ADD COLUMN writeback_enabled TINYINT(1) NOT NULL DEFAULT 0")
+	dbmap.Exec("ALTER TABLE background_check_configs ADD COLUMN result_stages VARCHAR(2000)")
+	dbmap.Exec("ALTER TABLE background_check_configs ADD COLUMN status_field VARCHAR(255) NOT NULL DEFAULT ''")
+	dbmap.Exec("ALTER TABLE background_check_configs ADD COLUMN report_doc_type VARCHAR(255) NOT NULL DEFAULT ''")
+	dbmap.Exec("CREATE INDEX background_checks_writeback ON background_checks (company_id, completed, written_back)")
+	dbmap.Exec("UPDATE background_check_configs SET result_stages = '{}' WHERE result_stages IS NULL")
+
+	dbmap.Exec("CREATE UNIQUE INDEX webhook_messages_source ON webhook_messages (source, message_id)")
+	dbmap.Exec("CREATE INDEX webhook_messages_received ON webhook_messages (received)")
+
+	dbmap.Exec("ALTER TABLE background_checks ADD COLUMN adjudication VARCHAR(30) NOT NULL DEFAULT 'pending'")
+	dbmap.Exec("ALTER TABLE background_checks ADD COLUMN adverse_delivery_id BIGINT(20) NOT NULL DEFAULT 0")
+	dbmap.Exec("ALTER TABLE background_checks ADD COLUMN adverse_notice_sent BIGINT(20) NOT NULL DEFAULT 0")
+	dbmap.Exec("ALTER TABLE background_checks ADD COLUMN adverse_deadline BIGINT(20) NOT NULL DEFAULT 0")
+	dbmap.Exec("ALTER TABLE background_checks ADD COLUMN adverse_wait_over TINYINT(1) NOT NULL DEFAULT 0")
+	dbmap.Exec("ALTER TABLE background_check_configs ADD COLUMN adverse_wait_days INT NOT NULL DEFAULT 5")
+	dbmap.Exec("ALTER TABLE background_check_configs ADD COLUMN auto_final_adverse TINYINT(1) NOT NULL DEFAULT 0")
+	dbmap.Exec("ALTER TABLE background_check_configs ADD COLUMN cra_contact VARCHAR(1000) NOT NULL DEFAULT ''")
+	dbmap.Exec("ALTER TABLE background_check_configs ADD COLUMN summary_of_rights_url VARCHAR(1000) NOT NULL DEFAULT ''")
+	dbmap.Exec("CREATE INDEX background_checks_adjudication ON background_checks (adjudication, adverse_deadline)")
+	dbmap.Exec("CREATE INDEX background_check_actions_check ON background_check_actions (company_id, check_id)")
+
+	dbmap.Exec("ALTER TABLE export_feeds MODIFY columns MEDIUMTEXT")
+	dbmap.Exec("CREATE INDEX export_feeds_company ON export_feeds (company_id)")
+	dbmap.Exec("ALTER TABLE export_feeds ADD COLUMN delta_only TINYINT(1) NOT NULL DEFAULT 0")
+	dbmap.Exec("CREATE INDEX export_feed_runs_feed ON export_feed_runs (feed_id, status, id)")
+	dbmap.Exec("CREATE INDEX export_feed_runs_company ON export_feed_runs (company_id, id)")
+	dbmap.Exec("ALTER TABLE export_feeds ADD COLUMN host_key VARCHAR(2000) NOT NULL DEFAULT ''")
+	dbmap.Exec("ALTER TABLE export_feeds ADD COLUMN host_key_fingerprint VARCHAR(100) NOT NULL DEFAULT ''")
+	dbmap.Exec("ALTER TABLE export_feeds ADD COLUMN host_key_pinned BIGINT(20) NOT NULL DEFAULT 0")
+	dbmap.Exec("ALTER TABLE export_feeds ADD COLUMN pending_host_key VARCHAR(2000) NOT NULL DEFAULT ''")
+	dbmap.Exec("ALTER TABLE export_feeds ADD COLUMN pending_host_key_fingerprint VARCHAR(100) NOT NULL DEFAULT ''")
+	dbmap.Exec("ALTER TABLE export_feeds ADD COLUMN pending_host_key_seen BIGINT(20) NOT NULL DEFAULT 0")
+
+	// installs from before this start counting now
+	dbmap.Exec("ALTER TABLE cp_installations ADD COLUMN created BIGINT(20) NOT NULL DEFAULT 0")
+	dbmap.Exec("UPDATE cp_installations SET created = UNIX_TIMESTAMP() WHERE created = 0")
+
+	dbmap.Exec("ALTER TABLE background_checks ADD COLUMN writeback_stage_moved BIGINT(20) NOT NULL DEFAULT 0")
+	dbmap.Exec("ALTER TABLE background_checks ADD COLUMN writeback_field_set BIGINT(20) NOT NULL DEFAULT 0")
+	dbmap.Exec("ALTER TABLE background_checks ADD COLUMN writeback_report_attached BIGINT(20) NOT NULL DEFAULT 0")
+
+	// rows from before warnings were all exclusions
+	dbmap.Exec("ALTER TABLE job_feed_exclusions ADD COLUMN excluded TINYINT(1) NOT NULL DEFAULT 1")
+	dbmap.Exec("ALTER TABLE job_feed_exclusions ADD COLUMN warnings VARCHAR(2000) NOT NULL DEFAULT ''")
+
+	// one badge per company, employees with only a PIN have a NULL badge so they don't collide
+	dbmap.Exec("ALTER TABLE webclock_kiosk_credentials MODIFY badge_number VARCHAR(255)")
+	dbmap.Exec("UPDATE webclock_kiosk_credentials SET badge_number = NULL WHERE badge_number = ''")
+	dbmap.Exec("DROP INDEX kiosk_badge ON webclock_kiosk_credentials")
+	dbmap.Exec("CREATE UNIQUE INDEX kiosk_badge_unique ON webclock_kiosk_credentials (company_id, badge_number)")
 }
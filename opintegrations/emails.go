@@ -1,12 +1,9 @@
 package main
 
 import (
-	"bytes"
-	"errors"
 	"html/template"
 	"path/filepath"
 
-	sendgrid "github.com/sendgrid/sendgrid-go"
 	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
@@ -26,6 +23,8 @@ type sgEmailFields struct {
 	Cc      []*sgmail.Email
 	Bcc     []*sgmail.Email
 	Subject string
+	// fetched when the email goes out, so retries don't have to keep the file
+	Attachments []NotificationAttachment
 }
 
 const (
@@ -35,11 +34,17 @@ const (
 	JOB_FINISH_APP_EMAIL_TEMPLATE          = "finish_job_application.html"
 	JOB_FINISH_APP_REMINDER_EMAIL_TEMPLATE = "reminder_job_application.html"
 	JOB_SPONSORSHIP_NOTIFICATION_TEMPLATE  = "new_job_sponsorship.html"
+	JOB_SPONSORSHIP_ENDING_SOON_TEMPLATE   = "job_sponsorship_ending_soon.html"
+	JOB_SPONSORSHIP_ENDED_TEMPLATE         = "job_sponsorship_ended.html"
 	BGC_NOTIFICATION_TEMPLATE              = "new_bgc_notification.html"
+	BGC_PRE_ADVERSE_TEMPLATE               = "bgc_pre_adverse_notice.html"
+	BGC_FINAL_ADVERSE_TEMPLATE             = "bgc_final_adverse_notice.html"
+	BGC_ADVERSE_WAIT_OVER_TEMPLATE         = "bgc_adverse_wait_over.html"
 	SERVICE_DISCONNECTION_ALERT_TEMPLATE   = "service_disconnected_alert.html"
 	AD_HF_SUMMARY_TEMPLATE                 = "active_directory_summary.html"
 	GH_ADMIN_ALERT_TEMPLATE                = "google_hire_admin_alert.html"
 	GH_APPLICANT_EMAIL_TEMPLATE            = "google_hire_applicant_email.html"
+	CP_STALE_INSTALLATION_ALERT_TEMPLATE   = "cloudpunch_stale_alert.html"
 )
 
 func initEmailTemplates() {
@@ -80,10 +85,11 @@ type ApplicationNotificationEmailBody struct {
 }
 
 type FinishApplicationEmailBody struct {
-	ApplicantName string
-	CompanyName   string
-	JobTitle      string
-	ApplyURL      string
+	ApplicantName  string
+	CompanyName    string
+	JobTitle       string
+	ApplyURL       string
+	UnsubscribeURL string
 }
 
 type NewSponsoredJobNotificationBody struct {
@@ -105,39 +111,3 @@ type GHApplicantAlertBody struct {
 	Password  string
 	LoginLink string
 }
-
-func sendTemplatedEmailSendGrid(emailInfo sgEmailFields, templateToUse string, templateData interface{}, categories ...string) error {
-	temp := templates.Lookup(templateToUse)
-	var tpl bytes.Buffer
-	if err := temp.Execute(&tpl, templateData); err != nil {
-		return errors.New("template execute err: " + err.Error())
-	}
-	htmlContent := tpl.String()
-
-	m := sgmail.NewV3Mail()
-
-	m.SetFrom(emailInfo.From)
-
-	content := sgmail.NewContent("text/html", htmlContent)
-	m.AddContent(content)
-
-	personalization := sgmail.NewPersonalization()
-	personalization.AddTos(emailInfo.To...)
-	personalization.AddCCs(emailInfo.Cc...)
-	personalization.AddBCCs(emailInfo.Bcc...)
-	personalization.Subject = emailInfo.Subject
-
-	m.AddPersonalizations(personalization)
-
-	m.AddCategories(categories...)
-
-	request := sendgrid.GetRequest(passwords.SG_EMAILER_PASSWORD, "/v3/mail/send", "https://api.sendgrid.com")
-	request.Method = "POST"
-	request.Body = sgmail.GetRequestBody(m)
-	_, err := sendgrid.API(request)
-	if err != nil {
-		return errors.New("err SENDGRID API request: " + err.Error())
-	}
-
-	return nil
-}
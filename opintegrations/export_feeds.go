@@ -0,0 +1,601 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"golang.org/x/crypto/ssh"
+	cron "gopkg.in/robfig/cron.v2"
+)
+
+// An outbound file one company sends somewhere on a schedule: rows come from a saved OnePoint report,
+// Columns says what goes in each field of the file, Exclude drops rows, and the destination is an SFTP
+// server or one of our GCS buckets
+type ExportFeed struct {
+	ID            int64                `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID     int64                `db:"company_id" json:"company_id"`
+	Name          string               `db:"name,size:255" json:"name"`
+	Enabled       bool                 `db:"enabled" json:"enabled"`
+	ReportID      string               `db:"report_id,size:50" json:"report_id"`
+	Columns       ExportFeedColumns    `db:"columns,size:20000" json:"columns"`
+	Exclude       ExportFeedConditions `db:"exclude,size:2000" json:"exclude"`
+	Format        string               `db:"format,size:20" json:"format"`
+	IncludeHeader bool                 `db:"include_header" json:"include_header"`
+	// only rows that changed since the last successful run
+	DeltaOnly       bool                  `db:"delta_only" json:"delta_only"`
+	LineEnding      string                `db:"line_ending,size:10" json:"line_ending"`
+	FilenamePattern string                `db:"filename_pattern,size:255" json:"filename_pattern"`
+	Timezone        string                `db:"timezone,size:50" json:"timezone"`
+	Schedule        string                `db:"schedule,size:100" json:"schedule"`
+	Destination     string                `db:"destination,size:20" json:"destination"`
+	SFTPHost        string                `db:"sftp_host,size:255" json:"sftp_host"`
+	SFTPPort        int                   `db:"sftp_port" json:"sftp_port"`
+	SFTPUsername    string                `db:"sftp_username,size:255" json:"sftp_username"`
+	Directory       string                `db:"directory,size:255" json:"directory"`
+	GCSBucket       string                `db:"gcs_bucket,size:255" json:"gcs_bucket"`
+	Credentials     ExportFeedCredentials `db:"credentials,size:5000" json:"-"`
+	// SFTP only: the server's key pinned the first time we connected, and a different key it
+	// presented since that's waiting for an admin to approve it
+	HostKey                   string `db:"host_key,size:2000" json:"host_key"`
+	HostKeyFingerprint        string `db:"host_key_fingerprint,size:100" json:"host_key_fingerprint"`
+	HostKeyPinned             int64  `db:"host_key_pinned" json:"host_key_pinned"`
+	PendingHostKey            string `db:"pending_host_key,size:2000" json:"pending_host_key"`
+	PendingHostKeyFingerprint string `db:"pending_host_key_fingerprint,size:100" json:"pending_host_key_fingerprint"`
+	PendingHostKeySeen        int64  `db:"pending_host_key_seen" json:"pending_host_key_seen"`
+	LastRun                   int64  `db:"last_run" json:"last_run"`
+	LastStatus                string `db:"last_status,size:20" json:"last_status"`
+	LastError                 string `db:"last_error,size:1000" json:"last_error"`
+	LastRowCount              int    `db:"last_row_count" json:"last_row_count"`
+	Updated                   int64  `db:"updated" json:"updated"`
+
+	HasCredentials bool `db:"-" json:"has_credentials"`
+}
+
+// SFTP only, a private key is preferred over a password when the server takes both
+type ExportFeedCredentials struct {
+	Password   string `json:"password"`
+	PrivateKey string `json:"private_key"`
+	Passphrase string `json:"passphrase"`
+}
+
+type ExportFeedInput struct {
+	ID              int64                  `json:"id"`
+	Name            string                 `json:"name"`
+	Enabled         bool                   `json:"enabled"`
+	ReportID        string                 `json:"report_id"`
+	Columns         ExportFeedColumns      `json:"columns"`
+	Exclude         ExportFeedConditions   `json:"exclude"`
+	Format          string                 `json:"format"`
+	IncludeHeader   bool                   `json:"include_header"`
+	DeltaOnly       bool                   `json:"delta_only"`
+	LineEnding      string                 `json:"line_ending"`
+	FilenamePattern string                 `json:"filename_pattern"`
+	Timezone        string                 `json:"timezone"`
+	Schedule        string                 `json:"schedule"`
+	Destination     string                 `json:"destination"`
+	SFTPHost        string                 `json:"sftp_host"`
+	SFTPPort        int                    `json:"sftp_port"`
+	SFTPUsername    string                 `json:"sftp_username"`
+	Directory       string                 `json:"directory"`
+	GCSBucket       string                 `json:"gcs_bucket"`
+	Credentials     *ExportFeedCredentials `json:"credentials"`
+	// pins a key up front instead of trusting the first one, blank clears the pin
+	HostKey *string `json:"host_key"`
+}
+
+type ExportFeedHostKeyApproval struct {
+	Fingerprint string `json:"fingerprint"`
+}
+
+const (
+	EXPORT_FEED_STATUS_SUCCESS = "success"
+	EXPORT_FEED_STATUS_FAILED  = "failed"
+
+	EXPORT_FEED_PREVIEW_ROWS = 20
+)
+
+// feeds scheduled on their own cron so they can be moved when a company edits the schedule
+var exportFeedCron *cron.Cron
+var exportFeedEntries = map[int64]cron.EntryID{}
+var exportFeedRunning = map[int64]bool{}
+var exportFeedMutex sync.Mutex
+
+func registerExportFeedRoutes(router *gin.Engine) {
+	router.GET("/api/export_feeds", getExportFeedsHandler)
+	router.POST("/api/export_feeds", saveExportFeedHandler)
+	router.GET("/api/export_feeds/preview/:id", previewExportFeedHandler)
+	router.POST("/api/export_feeds/run/:id", runExportFeedHandler)
+	router.GET("/api/export_feeds/runs/:id", getExportFeedRunsHandler)
+	router.POST("/api/export_feeds/resend/:id", resendExportFeedRunHandler)
+	router.POST("/api/export_feeds/host_key/:id", approveExportFeedHostKeyHandler)
+}
+
+func (ec ExportFeedCredentials) Value() (driver.Value, error) {
+	j, err := json.Marshal(ec)
+	return j, err
+}
+
+func (ec *ExportFeedCredentials) Scan(src interface{}) error {
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("Type assertion .([]byte) failed.")
+	}
+
+	return json.Unmarshal(source, ec)
+}
+
+func startExportFeedSchedules() {
+	seedReliasExportFeed()
+
+	exportFeedCron = cron.New()
+
+	feeds := []ExportFeed{}
+	_, err := dbmap.Select(&feeds, "SELECT * FROM export_feeds WHERE enabled = 1")
+	if err != nil {
+		ErrorLog.Println("startExportFeedSchedules select err: ", err)
+	}
+
+	for _, feed := range feeds {
+		scheduleExportFeed(feed)
+	}
+
+	exportFeedCron.Start()
+}
+
+// Replaces whatever was scheduled for the feed, a disabled feed or one without a schedule only runs by hand
+func scheduleExportFeed(feed ExportFeed) {
+	if exportFeedCron == nil {
+		return
+	}
+
+	exportFeedMutex.Lock()
+	defer exportFeedMutex.Unlock()
+
+	if entryID, exists := exportFeedEntries[feed.ID]; exists {
+		exportFeedCron.Remove(entryID)
+		delete(exportFeedEntries, feed.ID)
+	}
+
+	if !feed.Enabled || feed.Schedule == "" {
+		return
+	}
+
+	feedID := feed.ID
+	entryID, err := exportFeedCron.AddFunc(feed.Schedule, func() {
+		runExportFeedByID(feedID, EXPORT_FEED_TRIGGER_SCHEDULE)
+	})
+	if err != nil {
+		ErrorLog.Printf("scheduleExportFeed feed: %d, schedule: %s, err: %v\n", feed.ID, feed.Schedule, err)
+		return
+	}
+
+	exportFeedEntries[feed.ID] = entryID
+}
+
+func runAllExportFeeds() {
+	feeds := []ExportFeed{}
+	_, err := dbmap.Select(&feeds, "SELECT * FROM export_feeds WHERE enabled = 1")
+	if err != nil {
+		ErrorLog.Println("runAllExportFeeds select err: ", err)
+		return
+	}
+
+	for _, feed := range feeds {
+		runExportFeedByID(feed.ID, EXPORT_FEED_TRIGGER_MANUAL)
+	}
+}
+
+// Reloads the feed so a scheduled run always uses the latest saved config
+func runExportFeedByID(feedID int64, trigger string) {
+	feed := ExportFeed{}
+	err := dbmap.SelectOne(&feed, "SELECT * FROM export_feeds WHERE id = ?", feedID)
+	if err != nil {
+		ErrorLog.Printf("runExportFeedByID feed: %d, err: %v\n", feedID, err)
+		return
+	}
+
+	company, err := lookupCompanyByID(feed.CompanyID)
+	if err != nil {
+		ErrorLog.Printf("runExportFeedByID feed: %d, company lookup err: %v\n", feedID, err)
+		return
+	}
+
+	runExportFeed(company, feed, trigger, 0, produceExportFeedFile(company, feed))
+}
+
+// Runs the feed and keeps the outcome on the feed as well as in its run history. A feed still running
+// from its last schedule is skipped rather than sending two files at once.
+func runExportFeed(company Company, feed ExportFeed, trigger string, userID int64, produce exportFeedRunProducer) error {
+	exportFeedMutex.Lock()
+	if exportFeedRunning[feed.ID] {
+		exportFeedMutex.Unlock()
+		InfoLog.Printf("export feed %d is already running, skipping\n", feed.ID)
+		return errors.New("feed is already running")
+	}
+	exportFeedRunning[feed.ID] = true
+	exportFeedMutex.Unlock()
+
+	defer func() {
+		exportFeedMutex.Lock()
+		delete(exportFeedRunning, feed.ID)
+		exportFeedMutex.Unlock()
+	}()
+
+	InfoLog.Printf("Starting export feed %d (%s) for %s, %s\n", feed.ID, feed.Name, company.ShortName, trigger)
+
+	run, err := executeExportFeedRun(company, feed, trigger, userID, produce)
+
+	feed.LastRun = time.Now().Unix()
+	feed.LastRowCount = run.RowCount
+	if err != nil {
+		ErrorLog.Printf("EXPORT FEED FAILED feed: %d (%s), company: %s, run: %d, err: %v\n", feed.ID, feed.Name, company.ShortName, run.ID, err)
+		feed.LastStatus = EXPORT_FEED_STATUS_FAILED
+		feed.LastError = truncateString(err.Error(), 1000)
+	} else {
+		InfoLog.Printf("export feed %d (%s) successful, run: %d, %d rows to %s\n", feed.ID, feed.Name, run.ID, run.RowCount, run.DestinationPath)
+		feed.LastStatus = EXPORT_FEED_STATUS_SUCCESS
+		feed.LastError = ""
+	}
+
+	_, updateErr := dbmap.Exec("UPDATE export_feeds SET last_run = ?, last_status = ?, last_error = ?, last_row_count = ? WHERE id = ?", feed.LastRun, feed.LastStatus, feed.LastError, feed.LastRowCount, feed.ID)
+	if updateErr != nil {
+		ErrorLog.Println("runExportFeed update err: ", updateErr)
+	}
+
+	return err
+}
+
+func getExportFeedsHandler(c *gin.Context) {
+	user, thisCompany, err := lookupUserAndCompany(c)
+	if err != nil || (!user.IsCompanyAdmin && !user.IsSystemAdmin) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	feeds := []ExportFeed{}
+	_, err = dbmap.Select(&feeds, "SELECT * FROM export_feeds WHERE company_id = ? ORDER BY id", thisCompany.ID)
+	if err != nil {
+		ErrorLog.Println("getExportFeedsHandler select err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	for i := range feeds {
+		feeds[i].HasCredentials = feeds[i].Credentials.hasAny()
+	}
+
+	c.JSON(http.StatusOK, feeds)
+}
+
+// A feed without an id is created. Credentials are write only, leaving them out of the input keeps the saved ones.
+func saveExportFeedHandler(c *gin.Context) {
+	user, company, err := lookupUserAndCompany(c)
+	if err != nil || (!user.IsCompanyAdmin && !user.IsSystemAdmin) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	input := ExportFeedInput{}
+	err = c.ShouldBindWith(&input, binding.JSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	feed := ExportFeed{}
+	if input.ID != 0 {
+		feed, err = lookupExportFeed(company.ID, input.ID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+	}
+
+	// our service account can write to any of our buckets, so only we pick which one
+	if strings.TrimSpace(input.GCSBucket) != feed.GCSBucket && !user.IsSystemAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only system admins can set the GCS bucket"})
+		return
+	}
+
+	// a different server has to earn its own trust
+	if strings.TrimSpace(input.SFTPHost) != feed.SFTPHost || input.SFTPPort != feed.SFTPPort {
+		feed.clearHostKeys()
+	}
+
+	// and never gets the saved login, or anyone who can edit the feed could point it at their own server to read it
+	if strings.TrimSpace(input.SFTPHost) != feed.SFTPHost || input.SFTPPort != feed.SFTPPort || strings.TrimSpace(input.SFTPUsername) != feed.SFTPUsername {
+		feed.Credentials = ExportFeedCredentials{}
+	}
+
+	if input.HostKey != nil {
+		feed.clearHostKeys()
+		if hostKey := strings.TrimSpace(*input.HostKey); hostKey != "" {
+			key, err := parseHostKey(hostKey)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Host key must be in authorized_keys format"})
+				return
+			}
+			feed.pinHostKey(key)
+		}
+	}
+
+	feed.CompanyID = company.ID
+	feed.Name = strings.TrimSpace(input.Name)
+	feed.Enabled = input.Enabled
+	feed.ReportID = strings.TrimSpace(input.ReportID)
+	feed.Columns = input.Columns
+	feed.Exclude = input.Exclude
+	feed.Format = input.Format
+	feed.IncludeHeader = input.IncludeHeader
+	feed.DeltaOnly = input.DeltaOnly
+	feed.LineEnding = input.LineEnding
+	feed.FilenamePattern = strings.TrimSpace(input.FilenamePattern)
+	feed.Timezone = strings.TrimSpace(input.Timezone)
+	feed.Schedule = strings.TrimSpace(input.Schedule)
+	feed.Destination = input.Destination
+	feed.SFTPHost = strings.TrimSpace(input.SFTPHost)
+	feed.SFTPPort = input.SFTPPort
+	feed.SFTPUsername = strings.TrimSpace(input.SFTPUsername)
+	feed.Directory = strings.TrimSpace(input.Directory)
+	feed.GCSBucket = strings.TrimSpace(input.GCSBucket)
+	feed.Updated = time.Now().Unix()
+	if input.Credentials != nil {
+		feed.Credentials = *input.Credentials
+	}
+
+	if feed.Columns == nil {
+		feed.Columns = ExportFeedColumns{}
+	}
+	if feed.Exclude == nil {
+		feed.Exclude = ExportFeedConditions{}
+	}
+
+	err = feed.validate()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if feed.ID != 0 {
+		_, err = dbmap.Update(&feed)
+	} else {
+		err = dbmap.Insert(&feed)
+	}
+	if err != nil {
+		ErrorLog.Println("saveExportFeedHandler save err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	scheduleExportFeed(feed)
+
+	feed.HasCredentials = feed.Credentials.hasAny()
+	c.JSON(http.StatusOK, feed)
+}
+
+// The first rows of the file the feed would send right now, without sending it
+func previewExportFeedHandler(c *gin.Context) {
+	user, thisCompany, err := lookupUserAndCompany(c)
+	if err != nil || (!user.IsCompanyAdmin && !user.IsSystemAdmin) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	feedID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	feed, err := lookupExportFeed(thisCompany.ID, feedID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	file, err := buildExportFeedFile(*thisCompany, feed)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lines := strings.SplitAfter(string(file.Data), "\n")
+	if len(lines) > EXPORT_FEED_PREVIEW_ROWS {
+		lines = lines[:EXPORT_FEED_PREVIEW_ROWS]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"filename":  file.Name,
+		"row_count": file.RowCount,
+		"preview":   strings.Join(lines, ""),
+	})
+}
+
+func runExportFeedHandler(c *gin.Context) {
+	user, company, err := lookupUserAndCompany(c)
+	if err != nil || (!user.IsCompanyAdmin && !user.IsSystemAdmin) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	feedID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	feed, err := lookupExportFeed(company.ID, feedID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	go runExportFeed(*company, feed, EXPORT_FEED_TRIGGER_MANUAL, user.ID, produceExportFeedFile(*company, feed))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Feed started"})
+}
+
+// Trusts the key a server started presenting. The fingerprint has to be the one the admin was shown,
+// so a key that changed again since can't be approved by accident.
+func approveExportFeedHostKeyHandler(c *gin.Context) {
+	user, company, err := lookupUserAndCompany(c)
+	if err != nil || (!user.IsCompanyAdmin && !user.IsSystemAdmin) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	feedID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	input := ExportFeedHostKeyApproval{}
+	err = c.ShouldBindWith(&input, binding.JSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	feed, err := lookupExportFeed(company.ID, feedID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	if feed.PendingHostKey == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "There is no host key waiting for approval"})
+		return
+	}
+
+	if input.Fingerprint != feed.PendingHostKeyFingerprint {
+		c.JSON(http.StatusConflict, gin.H{"error": "The host key has changed again, check the new fingerprint before approving"})
+		return
+	}
+
+	key, err := parseHostKey(feed.PendingHostKey)
+	if err != nil {
+		ErrorLog.Println("approveExportFeedHostKeyHandler parse err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	previous := feed.HostKeyFingerprint
+	feed.clearHostKeys()
+	feed.pinHostKey(key)
+
+	result, err := dbmap.Exec("UPDATE export_feeds SET host_key = ?, host_key_fingerprint = ?, host_key_pinned = ?, pending_host_key = '', pending_host_key_fingerprint = '', pending_host_key_seen = 0 WHERE id = ? AND pending_host_key_fingerprint = ?", feed.HostKey, feed.HostKeyFingerprint, feed.HostKeyPinned, feed.ID, input.Fingerprint)
+	if err != nil {
+		ErrorLog.Println("approveExportFeedHostKeyHandler update err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	// a run held a different key or someone else approved it since we looked
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The host key has changed again, check the new fingerprint before approving"})
+		return
+	}
+
+	InfoLog.Printf("export feed %d host key for %s changed from %s to %s, approved by user %d\n", feed.ID, feed.SFTPHost, previous, feed.HostKeyFingerprint, user.ID)
+
+	c.JSON(http.StatusOK, feed)
+}
+
+func (feed *ExportFeed) pinHostKey(key ssh.PublicKey) {
+	feed.HostKey = formatHostKey(key)
+	feed.HostKeyFingerprint = ssh.FingerprintSHA256(key)
+	feed.HostKeyPinned = time.Now().Unix()
+}
+
+func (feed *ExportFeed) clearHostKeys() {
+	feed.HostKey = ""
+	feed.HostKeyFingerprint = ""
+	feed.HostKeyPinned = 0
+	feed.PendingHostKey = ""
+	feed.PendingHostKeyFingerprint = ""
+	feed.PendingHostKeySeen = 0
+}
+
+func lookupExportFeed(companyID, feedID int64) (ExportFeed, error) {
+	feed := ExportFeed{}
+	err := dbmap.SelectOne(&feed, "SELECT * FROM export_feeds WHERE company_id = ? AND id = ?", companyID, feedID)
+	feed.HasCredentials = feed.Credentials.hasAny()
+	return feed, err
+}
+
+func (ec ExportFeedCredentials) hasAny() bool {
+	return ec.Password != "" || ec.PrivateKey != ""
+}
+
+func (feed ExportFeed) validate() error {
+	if feed.Name == "" {
+		return errors.New("A name is required")
+	}
+
+	if feed.ReportID == "" {
+		return errors.New("A OnePoint report is required")
+	}
+
+	if len(feed.Columns) == 0 {
+		return errors.New("At least one column is required")
+	}
+
+	encoder, exists := exportFeedEncoders[feed.Format]
+	if !exists {
+		return errors.New("format must be one of " + strings.Join(exportFeedFormats(), ", "))
+	}
+
+	err := encoder.Validate(feed)
+	if err != nil {
+		return err
+	}
+
+	for i, column := range feed.Columns {
+		err = column.validate()
+		if err != nil {
+			return errors.New(fmt.Sprintf("column %d: %s", i+1, err.Error()))
+		}
+	}
+
+	for _, condition := range feed.Exclude {
+		err = condition.validate()
+		if err != nil {
+			return errors.New("exclude: " + err.Error())
+		}
+	}
+
+	if feed.LineEnding != EXPORT_FEED_LINE_ENDING_LF && feed.LineEnding != EXPORT_FEED_LINE_ENDING_CRLF {
+		return errors.New(fmt.Sprintf("line ending must be %s or %s", EXPORT_FEED_LINE_ENDING_LF, EXPORT_FEED_LINE_ENDING_CRLF))
+	}
+
+	if feed.FilenamePattern == "" {
+		return errors.New("A filename pattern is required")
+	}
+
+	if _, err = time.LoadLocation(feed.Timezone); err != nil {
+		return errors.New("unknown timezone: " + feed.Timezone)
+	}
+
+	if feed.Schedule != "" {
+		if _, err = cron.Parse(feed.Schedule); err != nil {
+			return errors.New("schedule is not a valid cron spec: " + err.Error())
+		}
+	}
+
+	destination, exists := exportFeedDestinations[feed.Destination]
+	if !exists {
+		return errors.New(fmt.Sprintf("destination must be %s or %s", EXPORT_FEED_DESTINATION_SFTP, EXPORT_FEED_DESTINATION_GCS))
+	}
+
+	return destination.Validate(feed)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type ExportFeedDestination interface {
+	Name() string
+	Validate(feed ExportFeed) error
+	// returns where the file ended up, for the run history
+	Send(feed ExportFeed, filename string, data []byte) (string, error)
+}
+
+const (
+	EXPORT_FEED_DESTINATION_SFTP = "sftp"
+	EXPORT_FEED_DESTINATION_GCS  = "gcs"
+)
+
+var exportFeedDestinations = map[string]ExportFeedDestination{
+	EXPORT_FEED_DESTINATION_SFTP: &SFTPDestination{HostKeys: dbExportFeedHostKeys{}},
+	EXPORT_FEED_DESTINATION_GCS:  &GCSDestination{},
+}
+
+type SFTPDestination struct {
+	HostKeys ExportFeedHostKeyStore
+}
+
+// Where Send records the keys servers present, kept apart so it can be run without the database
+type ExportFeedHostKeyStore interface {
+	Pin(feed ExportFeed, key ssh.PublicKey)
+	Hold(feed ExportFeed, key ssh.PublicKey)
+}
+
+func (d *SFTPDestination) Name() string {
+	return "SFTP"
+}
+
+func (d *SFTPDestination) Validate(feed ExportFeed) error {
+	if feed.SFTPHost == "" || feed.SFTPUsername == "" {
+		return errors.New("SFTP needs a host and username")
+	}
+
+	if feed.SFTPPort < 0 || feed.SFTPPort > 65535 {
+		return errors.New("SFTP port is not valid")
+	}
+
+	if feed.Enabled && !feed.Credentials.hasAny() {
+		return errors.New("SFTP needs a password or private key")
+	}
+
+	if feed.Credentials.PrivateKey != "" {
+		_, err := sftpAuthMethods(feed.sftpCredentials())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *SFTPDestination) Send(feed ExportFeed, filename string, data []byte) (string, error) {
+	hostKeyCheck := SFTPHostKeyCheck{Pinned: feed.HostKey}
+	sshClient, sftpClient, err := connectSFTP(feed.sftpCredentials(), hostKeyCheck.Callback())
+	if hostKeyCheck.Mismatch {
+		d.HostKeys.Hold(feed, hostKeyCheck.Presented)
+		return "", errors.New(err.Error() + ", an admin has to approve the new key before the feed will send")
+	}
+	if err != nil {
+		return "", errors.New("connectSFTP err: " + err.Error())
+	}
+	defer sshClient.Close()
+	defer sftpClient.Close()
+
+	d.HostKeys.Pin(feed, hostKeyCheck.Presented)
+
+	filePath := path.Join("/", feed.Directory, filename)
+	file, err := sftpClient.Create(filePath)
+	if err != nil {
+		return "", errors.New("sftpClient.Create err: " + err.Error())
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, bytes.NewReader(data))
+	if err != nil {
+		return "", errors.New("sftpClient ioCopy err: " + err.Error())
+	}
+
+	return fmt.Sprintf("sftp://%s@%s%s", feed.SFTPUsername, feed.SFTPHost, filePath), nil
+}
+
+func (feed ExportFeed) sftpCredentials() SFTPCredentials {
+	return SFTPCredentials{
+		Username:    feed.SFTPUsername,
+		Password:    feed.Credentials.Password,
+		HostAddress: feed.SFTPHost,
+		Port:        feed.SFTPPort,
+		PrivateKey:  feed.Credentials.PrivateKey,
+		Passphrase:  feed.Credentials.Passphrase,
+	}
+}
+
+type dbExportFeedHostKeys struct{}
+
+// The first key a server presents is pinned, until then the feed is trusting whoever answers
+func (dbExportFeedHostKeys) Pin(feed ExportFeed, key ssh.PublicKey) {
+	if key == nil {
+		return
+	}
+
+	if feed.HostKey != "" {
+		// the pinned key answered, so whatever was waiting for approval was a blip
+		if feed.PendingHostKey != "" {
+			dbmap.Exec("UPDATE export_feeds SET pending_host_key = '', pending_host_key_fingerprint = '', pending_host_key_seen = 0 WHERE id = ?", feed.ID)
+		}
+		return
+	}
+
+	// only if nothing got pinned or approved while we were connected
+	_, err := dbmap.Exec("UPDATE export_feeds SET host_key = ?, host_key_fingerprint = ?, host_key_pinned = ? WHERE id = ? AND host_key = ''", formatHostKey(key), ssh.FingerprintSHA256(key), time.Now().Unix(), feed.ID)
+	if err != nil {
+		ErrorLog.Println("dbExportFeedHostKeys Pin err: ", err)
+		return
+	}
+
+	InfoLog.Printf("export feed %d pinned host key %s for %s\n", feed.ID, ssh.FingerprintSHA256(key), feed.SFTPHost)
+}
+
+// A changed key is never trusted on its own, it waits on the feed until an admin approves it
+func (dbExportFeedHostKeys) Hold(feed ExportFeed, key ssh.PublicKey) {
+	ErrorLog.Printf("export feed %d HOST KEY CHANGED for %s, pinned: %s, presented: %s\n", feed.ID, feed.SFTPHost, feed.HostKeyFingerprint, ssh.FingerprintSHA256(key))
+
+	_, err := dbmap.Exec("UPDATE export_feeds SET pending_host_key = ?, pending_host_key_fingerprint = ?, pending_host_key_seen = ? WHERE id = ?", formatHostKey(key), ssh.FingerprintSHA256(key), time.Now().Unix(), feed.ID)
+	if err != nil {
+		ErrorLog.Println("dbExportFeedHostKeys Hold err: ", err)
+	}
+}
+
+// Files land under Directory in the bucket and are never made public
+type GCSDestination struct{}
+
+func (d *GCSDestination) Name() string {
+	return "GCS"
+}
+
+func (d *GCSDestination) Validate(feed ExportFeed) error {
+	if feed.GCSBucket == "" {
+		return errors.New("GCS needs a bucket")
+	}
+	return nil
+}
+
+func (d *GCSDestination) Send(feed ExportFeed, filename string, data []byte) (string, error) {
+	objectName := strings.TrimPrefix(path.Join(feed.Directory, filename), "/")
+	err := bytesToGCP(feed.GCSBucket, objectName, data, false)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("gs://%s/%s", feed.GCSBucket, objectName), nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Keeps what Send pinned and held instead of writing it to export_feeds
+type memoryExportFeedHostKeys struct {
+	pinned ssh.PublicKey
+	held   ssh.PublicKey
+}
+
+func (m *memoryExportFeedHostKeys) Pin(feed ExportFeed, key ssh.PublicKey) {
+	if feed.HostKey == "" {
+		m.pinned = key
+	}
+}
+
+func (m *memoryExportFeedHostKeys) Hold(feed ExportFeed, key ssh.PublicKey) {
+	m.held = key
+}
+
+// An SFTP server on 127.0.0.1 that only lets in authorizedKey, its host key can be swapped between connections
+type testSFTPServer struct {
+	listener      net.Listener
+	authorizedKey ssh.PublicKey
+
+	mu      sync.Mutex
+	hostKey ssh.Signer
+}
+
+func startTestSFTPServer(t *testing.T, authorizedKey ssh.PublicKey) *testSFTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen err: ", err)
+	}
+
+	server := &testSFTPServer{listener: listener, authorizedKey: authorizedKey, hostKey: newTestHostKey(t)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+func (s *testSFTPServer) setHostKey(hostKey ssh.Signer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hostKey = hostKey
+}
+
+func (s *testSFTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *testSFTPServer) serve(conn net.Conn) {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(s.authorizedKey.Marshal()) {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+	}
+	s.mu.Lock()
+	config.AddHostKey(s.hostKey)
+	s.mu.Unlock()
+
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		go func(in <-chan *ssh.Request) {
+			for req := range in {
+				req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil)
+			}
+		}(channelRequests)
+
+		server, err := sftp.NewServer(channel)
+		if err != nil {
+			channel.Close()
+			continue
+		}
+		// closing the channel once the client hangs up is what lets its Close return
+		go func() {
+			server.Serve()
+			server.Close()
+		}()
+	}
+}
+
+func newTestHostKey(t *testing.T) ssh.Signer {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("host key err: ", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal("host key signer err: ", err)
+	}
+
+	return signer
+}
+
+// A client key in the PEM form admins paste into the feed, along with its public half
+func newTestClientKey(t *testing.T) (string, ssh.PublicKey) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("client key err: ", err)
+	}
+
+	public, err := ssh.NewPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatal("client public key err: ", err)
+	}
+
+	block := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+
+	return string(block), public
+}
+
+func TestSFTPDestinationHostKeys(t *testing.T) {
+	initEnv()
+	initLogger()
+
+	clientKey, clientPublicKey := newTestClientKey(t)
+	server := startTestSFTPServer(t, clientPublicKey)
+	directory := t.TempDir()
+
+	hostKeys := &memoryExportFeedHostKeys{}
+	destination := &SFTPDestination{HostKeys: hostKeys}
+
+	feed := ExportFeed{
+		ID:           1,
+		SFTPHost:     "127.0.0.1",
+		SFTPPort:     server.port(),
+		SFTPUsername: "feed",
+		Directory:    directory,
+		Credentials:  ExportFeedCredentials{PrivateKey: clientKey},
+	}
+
+	send := func(filename string) (string, error) {
+		return destination.Send(feed, filename, []byte("a|b|c\r\n"))
+	}
+
+	// first use: any key is accepted and pinned
+	location, err := send("first.txt")
+	if err != nil {
+		t.Fatal("first send err: ", err)
+	}
+	if hostKeys.pinned == nil {
+		t.Fatal("first send did not pin the host key")
+	}
+	if !strings.HasSuffix(location, filepath.Join(directory, "first.txt")) {
+		t.Error("unexpected location: ", location)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(directory, "first.txt"))
+	if err != nil || string(data) != "a|b|c\r\n" {
+		t.Errorf("first file not written as sent: %q, %v", data, err)
+	}
+	feed.pinHostKey(hostKeys.pinned)
+
+	// the pinned key still answering is fine
+	_, err = send("second.txt")
+	if err != nil {
+		t.Fatal("send with pinned key err: ", err)
+	}
+	if hostKeys.held != nil {
+		t.Error("the pinned key was held for approval")
+	}
+
+	// a changed key is refused and held, nothing gets written
+	changedKey := newTestHostKey(t)
+	server.setHostKey(changedKey)
+
+	_, err = send("changed.txt")
+	if err == nil {
+		t.Fatal("send to a changed host key was not refused")
+	}
+	if hostKeys.held == nil || ssh.FingerprintSHA256(hostKeys.held) != ssh.FingerprintSHA256(changedKey.PublicKey()) {
+		t.Fatal("changed host key was not held")
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(directory, "changed.txt")); err == nil {
+		t.Error("file was written to a server with a changed host key")
+	}
+
+	// once an admin approves the held key, the same as approveExportFeedHostKeyHandler, it sends again
+	feed.clearHostKeys()
+	feed.pinHostKey(hostKeys.held)
+	hostKeys.held = nil
+
+	_, err = send("approved.txt")
+	if err != nil {
+		t.Fatal("send after approval err: ", err)
+	}
+	if hostKeys.held != nil {
+		t.Error("the approved key was held again")
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(directory, "approved.txt")); err != nil {
+		t.Error("file not written after approval: ", err)
+	}
+}
+
+func TestSFTPDestinationPrivateKeyAuth(t *testing.T) {
+	initEnv()
+	initLogger()
+
+	_, authorizedKey := newTestClientKey(t)
+	otherKey, _ := newTestClientKey(t)
+	server := startTestSFTPServer(t, authorizedKey)
+
+	hostKeys := &memoryExportFeedHostKeys{}
+	destination := &SFTPDestination{HostKeys: hostKeys}
+
+	feed := ExportFeed{
+		ID:           2,
+		SFTPHost:     "127.0.0.1",
+		SFTPPort:     server.port(),
+		SFTPUsername: "feed",
+		Directory:    t.TempDir(),
+		Credentials:  ExportFeedCredentials{PrivateKey: otherKey},
+	}
+
+	_, err := destination.Send(feed, "refused.txt", []byte("data"))
+	if err == nil {
+		t.Fatal("send with a key the server doesn't know was not refused")
+	}
+	if hostKeys.pinned != nil || hostKeys.held != nil {
+		t.Error("a host key was kept from a connection that never logged in")
+	}
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// One field of the file. The value comes from the report column Source, or is Constant when there's no Source,
+// then goes through Rules (first match wins), Map, the date reformat and Case in that order
+type ExportFeedColumn struct {
+	Name     string                 `json:"name"`
+	Source   string                 `json:"source"`
+	Constant string                 `json:"constant"`
+	Rules    []ExportFeedColumnRule `json:"rules"`
+	Map      map[string]string      `json:"map"`
+	// used for anything not in Map, leaving it blank keeps the value as is
+	Default      string `json:"default"`
+	InputFormat  string `json:"input_format"`
+	OutputFormat string `json:"output_format"`
+	Case         string `json:"case"`
+	// fixed width only
+	Width int    `json:"width"`
+	Align string `json:"align"`
+}
+
+type ExportFeedColumnRule struct {
+	When  ExportFeedCondition `json:"when"`
+	Value string              `json:"value"`
+}
+
+// A test on one report column, dates are read with DateFormat (OnePoint's format when blank)
+// and so is Value when comparing dates
+type ExportFeedCondition struct {
+	Column     string `json:"column"`
+	Op         string `json:"op"`
+	Value      string `json:"value"`
+	DateFormat string `json:"date_format"`
+}
+
+type ExportFeedColumns []ExportFeedColumn
+type ExportFeedConditions []ExportFeedCondition
+
+// What a feed run produced, ready for a destination
+type ExportFeedFile struct {
+	Name     string
+	Data     []byte
+	RowCount int
+}
+
+type ExportFeedEncoder interface {
+	Validate(feed ExportFeed) error
+	Encode(feed ExportFeed, rows [][]string) ([]byte, error)
+}
+
+const (
+	EXPORT_FEED_FORMAT_PIPE       = "pipe"
+	EXPORT_FEED_FORMAT_CSV        = "csv"
+	EXPORT_FEED_FORMAT_FIXED      = "fixed_width"
+	EXPORT_FEED_FORMAT_JSON_LINES = "json_lines"
+
+	EXPORT_FEED_LINE_ENDING_LF   = "lf"
+	EXPORT_FEED_LINE_ENDING_CRLF = "crlf"
+
+	EXPORT_FEED_OP_EQUALS      = "equals"
+	EXPORT_FEED_OP_NOT_EQUALS  = "not_equals"
+	EXPORT_FEED_OP_EMPTY       = "empty"
+	EXPORT_FEED_OP_NOT_EMPTY   = "not_empty"
+	EXPORT_FEED_OP_DATE_BEFORE = "date_before"
+	EXPORT_FEED_OP_DATE_AFTER  = "date_after"
+
+	EXPORT_FEED_CASE_UPPER = "upper"
+	EXPORT_FEED_CASE_LOWER = "lower"
+
+	EXPORT_FEED_ALIGN_RIGHT = "right"
+
+	OP_REPORT_DATE_FORMAT = "01/02/2006"
+)
+
+var exportFeedEncoders = map[string]ExportFeedEncoder{
+	EXPORT_FEED_FORMAT_PIPE:       &DelimitedEncoder{Delimiter: "|"},
+	EXPORT_FEED_FORMAT_CSV:        &CSVEncoder{},
+	EXPORT_FEED_FORMAT_FIXED:      &FixedWidthEncoder{},
+	EXPORT_FEED_FORMAT_JSON_LINES: &JSONLinesEncoder{},
+}
+
+var exportFeedConditionOps = []string{EXPORT_FEED_OP_EQUALS, EXPORT_FEED_OP_NOT_EQUALS, EXPORT_FEED_OP_EMPTY, EXPORT_FEED_OP_NOT_EMPTY, EXPORT_FEED_OP_DATE_BEFORE, EXPORT_FEED_OP_DATE_AFTER}
+
+var exportFeedFilenameToken = regexp.MustCompile(`\{([^{}]+)\}`)
+
+func (ec ExportFeedColumns) Value() (driver.Value, error) {
+	j, err := json.Marshal(ec)
+	return j, err
+}
+
+func (ec *ExportFeedColumns) Scan(src interface{}) error {
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("Type assertion .([]byte) failed.")
+	}
+
+	return json.Unmarshal(source, ec)
+}
+
+func (ec ExportFeedConditions) Value() (driver.Value, error) {
+	j, err := json.Marshal(ec)
+	return j, err
+}
+
+func (ec *ExportFeedConditions) Scan(src interface{}) error {
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("Type assertion .([]byte) failed.")
+	}
+
+	return json.Unmarshal(source, ec)
+}
+
+func exportFeedFormats() []string {
+	formats := []string{}
+	for format := range exportFeedEncoders {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Pulls the report, drops excluded rows and encodes the rest
+func buildExportFeedFile(company Company, feed ExportFeed) (ExportFeedFile, error) {
+	rows, err := buildExportFeedRows(company, feed)
+	if err != nil {
+		return ExportFeedFile{}, err
+	}
+
+	return encodeExportFeedFile(company, feed, rows, time.Now())
+}
+
+func buildExportFeedRows(company Company, feed ExportFeed) ([][]string, error) {
+	reportRows, err := fetchExportFeedReport(company, feed)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := [][]string{}
+	for _, reportRow := range reportRows {
+		if feed.Exclude.anyMatch(reportRow) {
+			continue
+		}
+
+		row := make([]string, len(feed.Columns))
+		for i, column := range feed.Columns {
+			row[i] = column.valueFor(reportRow)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func encodeExportFeedFile(company Company, feed ExportFeed, rows [][]string, now time.Time) (ExportFeedFile, error) {
+	file := ExportFeedFile{}
+
+	encoder, exists := exportFeedEncoders[feed.Format]
+	if !exists {
+		return file, errors.New("unknown format: " + feed.Format)
+	}
+
+	loc, err := time.LoadLocation(feed.Timezone)
+	if err != nil {
+		return file, errors.New("could not load location " + feed.Timezone)
+	}
+
+	file.Data, err = encoder.Encode(feed, rows)
+	if err != nil {
+		return file, errors.New("encoding " + feed.Format + " err: " + err.Error())
+	}
+
+	file.Name = exportFeedFilename(feed.FilenamePattern, company, feed, now.In(loc))
+	file.RowCount = len(rows)
+
+	return file, nil
+}
+
+// GenricReport only reads into tagged structs, so build one on the fly with a field for every report column the feed reads
+func fetchExportFeedReport(company Company, feed ExportFeed) ([]map[string]string, error) {
+	columns := feed.reportColumns()
+
+	fields := []reflect.StructField{}
+	for i, column := range columns {
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("Column%d", i),
+			Type: reflect.TypeOf(""),
+			Tag:  reflect.StructTag(fmt.Sprintf(`csv:"%s"`, column)),
+		})
+	}
+	rowType := reflect.StructOf(fields)
+
+	reportRows := reflect.New(reflect.SliceOf(rowType))
+
+	cxn := chooseOPAPICxn(company.OPID)
+	reportURL := fmt.Sprintf("https://secure.onehcm.com/ta/rest/v1/report/%s/%v?company:shortname=%s", "saved", feed.ReportID, company.ShortName)
+	err := cxn.GenricReport(reportURL, reportRows.Interface())
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error getting report %s: %s", feed.ReportID, err.Error()))
+	}
+
+	rows := []map[string]string{}
+	slice := reportRows.Elem()
+	for i := 0; i < slice.Len(); i++ {
+		row := map[string]string{}
+		for j, column := range columns {
+			row[column] = slice.Index(i).Field(j).String()
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func (feed ExportFeed) reportColumns() []string {
+	seen := map[string]bool{}
+	columns := []string{}
+	add := func(column string) {
+		if column != "" && !seen[column] {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+
+	for _, column := range feed.Columns {
+		add(column.Source)
+		for _, rule := range column.Rules {
+			add(rule.When.Column)
+		}
+	}
+	for _, condition := range feed.Exclude {
+		add(condition.Column)
+	}
+
+	return columns
+}
+
+func (column ExportFeedColumn) valueFor(row map[string]string) string {
+	value := column.Constant
+	if column.Source != "" {
+		value = strings.TrimSpace(row[column.Source])
+	}
+
+	for _, rule := range column.Rules {
+		if rule.When.matches(row) {
+			return rule.Value
+		}
+	}
+
+	if column.Map != nil {
+		if mapped, exists := column.Map[value]; exists {
+			value = mapped
+		} else if column.Default != "" {
+			value = column.Default
+		}
+	}
+
+	if column.InputFormat != "" && column.OutputFormat != "" && value != "" {
+		// a date that won't parse goes out as it came in rather than as year one
+		if date, err := time.Parse(column.InputFormat, value); err == nil {
+			value = date.Format(column.OutputFormat)
+		}
+	}
+
+	switch column.Case {
+	case EXPORT_FEED_CASE_UPPER:
+		value = strings.ToUpper(value)
+	case EXPORT_FEED_CASE_LOWER:
+		value = strings.ToLower(value)
+	}
+
+	return value
+}
+
+func (column ExportFeedColumn) header() string {
+	if column.Name != "" {
+		return column.Name
+	}
+	return column.Source
+}
+
+func (column ExportFeedColumn) validate() error {
+	if (column.InputFormat == "") != (column.OutputFormat == "") {
+		return errors.New("dates need both an input and output format")
+	}
+
+	if column.Case != "" && column.Case != EXPORT_FEED_CASE_UPPER && column.Case != EXPORT_FEED_CASE_LOWER {
+		return errors.New("case must be upper or lower")
+	}
+
+	if column.Width < 0 {
+		return errors.New("width can't be negative")
+	}
+
+	for _, rule := range column.Rules {
+		err := rule.When.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (conditions ExportFeedConditions) anyMatch(row map[string]string) bool {
+	for _, condition := range conditions {
+		if condition.matches(row) {
+			return true
+		}
+	}
+	return false
+}
+
+// Date comparisons never match a blank or unreadable date
+func (condition ExportFeedCondition) matches(row map[string]string) bool {
+	value := strings.TrimSpace(row[condition.Column])
+
+	switch condition.Op {
+	case EXPORT_FEED_OP_EQUALS:
+		return strings.EqualFold(value, condition.Value)
+	case EXPORT_FEED_OP_NOT_EQUALS:
+		return !strings.EqualFold(value, condition.Value)
+	case EXPORT_FEED_OP_EMPTY:
+		return value == ""
+	case EXPORT_FEED_OP_NOT_EMPTY:
+		return value != ""
+	case EXPORT_FEED_OP_DATE_BEFORE, EXPORT_FEED_OP_DATE_AFTER:
+		date, err := time.Parse(condition.dateFormat(), value)
+		if err != nil {
+			return false
+		}
+		compareTo, err := time.Parse(condition.dateFormat(), condition.Value)
+		if err != nil {
+			return false
+		}
+		if condition.Op == EXPORT_FEED_OP_DATE_BEFORE {
+			return date.Before(compareTo)
+		}
+		return date.After(compareTo)
+	}
+
+	return false
+}
+
+func (condition ExportFeedCondition) dateFormat() string {
+	if condition.DateFormat != "" {
+		return condition.DateFormat
+	}
+	return OP_REPORT_DATE_FORMAT
+}
+
+func (condition ExportFeedCondition) validate() error {
+	if condition.Column == "" {
+		return errors.New("conditions need a column")
+	}
+
+	switch condition.Op {
+	case EXPORT_FEED_OP_DATE_BEFORE, EXPORT_FEED_OP_DATE_AFTER:
+		if _, err := time.Parse(condition.dateFormat(), condition.Value); err != nil {
+			return errors.New(fmt.Sprintf("%s is not a date in the format %s", condition.Value, condition.dateFormat()))
+		}
+		return nil
+	}
+
+	for _, op := range exportFeedConditionOps {
+		if condition.Op == op {
+			return nil
+		}
+	}
+
+	return errors.New("op must be one of " + strings.Join(exportFeedConditionOps, ", "))
+}
+
+// {company} and {feed} are the company shortname and feed id, anything else in braces is a Go time layout
+// for when the feed ran, e.g. relias_{20060102150405}.txt
+func exportFeedFilename(pattern string, company Company, feed ExportFeed, now time.Time) string {
+	return exportFeedFilenameToken.ReplaceAllStringFunc(pattern, func(token string) string {
+		switch name := token[1 : len(token)-1]; name {
+		case "company":
+			return company.ShortName
+		case "feed":
+			return fmt.Sprint(feed.ID)
+		default:
+			return now.Format(name)
+		}
+	})
+}
+
+func (feed ExportFeed) lineEnding() string {
+	if feed.LineEnding == EXPORT_FEED_LINE_ENDING_CRLF {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+func (feed ExportFeed) headers() []string {
+	headers := []string{}
+	for _, column := range feed.Columns {
+		headers = append(headers, column.header())
+	}
+	return headers
+}
+
+// No quoting in these formats, so a delimiter or line break inside a value would shift every field after it
+type DelimitedEncoder struct {
+	Delimiter string
+}
+
+func (e *DelimitedEncoder) Validate(feed ExportFeed) error {
+	return nil
+}
+
+func (e *DelimitedEncoder) Encode(feed ExportFeed, rows [][]string) ([]byte, error) {
+	replacer := strings.NewReplacer(e.Delimiter, " ", "\r", " ", "\n", " ")
+
+	buf := bytes.Buffer{}
+	writeLine := func(values []string) {
+		cleaned := make([]string, len(values))
+		for i, value := range values {
+			cleaned[i] = replacer.Replace(value)
+		}
+		buf.WriteString(strings.Join(cleaned, e.Delimiter))
+		buf.WriteString(feed.lineEnding())
+	}
+
+	if feed.IncludeHeader {
+		writeLine(feed.headers())
+	}
+	for _, row := range rows {
+		writeLine(row)
+	}
+
+	return buf.Bytes(), nil
+}
+
+type CSVEncoder struct{}
+
+func (e *CSVEncoder) Validate(feed ExportFeed) error {
+	return nil
+}
+
+func (e *CSVEncoder) Encode(feed ExportFeed, rows [][]string) ([]byte, error) {
+	buf := bytes.Buffer{}
+	w := csv.NewWriter(&buf)
+	w.UseCRLF = feed.LineEnding == EXPORT_FEED_LINE_ENDING_CRLF
+
+	if feed.IncludeHeader {
+		w.Write(feed.headers())
+	}
+	w.WriteAll(rows)
+
+	return buf.Bytes(), w.Error()
+}
+
+// Values longer than the column are cut off, shorter ones padded with spaces
+type FixedWidthEncoder struct{}
+
+func (e *FixedWidthEncoder) Validate(feed ExportFeed) error {
+	for i, column := range feed.Columns {
+		if column.Width < 1 {
+			return errors.New(fmt.Sprintf("column %d needs a width for fixed width files", i+1))
+		}
+	}
+	return nil
+}
+
+func (e *FixedWidthEncoder) Encode(feed ExportFeed, rows [][]string) ([]byte, error) {
+	buf := bytes.Buffer{}
+	writeLine := func(values []string) {
+		for i, column := range feed.Columns {
+			buf.WriteString(fixedWidthValue(values[i], column.Width, column.Align == EXPORT_FEED_ALIGN_RIGHT))
+		}
+		buf.WriteString(feed.lineEnding())
+	}
+
+	if feed.IncludeHeader {
+		writeLine(feed.headers())
+	}
+	for _, row := range rows {
+		writeLine(row)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func fixedWidthValue(value string, width int, alignRight bool) string {
+	value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+
+	if utf8.RuneCountInString(value) > width {
+		return string([]rune(value)[:width])
+	}
+
+	padding := strings.Repeat(" ", width-utf8.RuneCountInString(value))
+	if alignRight {
+		return padding + value
+	}
+	return value + padding
+}
+
+// One object per line keyed by column name, keys kept in column order
+type JSONLinesEncoder struct{}
+
+func (e *JSONLinesEncoder) Validate(feed ExportFeed) error {
+	seen := map[string]bool{}
+	for _, header := range feed.headers() {
+		if header == "" {
+			return errors.New("every column needs a name for json lines files")
+		}
+		if seen[header] {
+			return errors.New("column names must be unique for json lines files, " + header + " is used twice")
+		}
+		seen[header] = true
+	}
+	return nil
+}
+
+func (e *JSONLinesEncoder) Encode(feed ExportFeed, rows [][]string) ([]byte, error) {
+	headers := feed.headers()
+
+	buf := bytes.Buffer{}
+	for _, row := range rows {
+		buf.WriteString("{")
+		for i, header := range headers {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			key, _ := json.Marshal(header)
+			value, _ := json.Marshal(row[i])
+			buf.Write(key)
+			buf.WriteString(":")
+			buf.Write(value)
+		}
+		buf.WriteString("}")
+		buf.WriteString(feed.lineEnding())
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// One attempt at sending a feed. Every file we build is archived before it's sent, along with a snapshot of
+// all the feed's rows at the time, which is what the next delta run diffs against.
+type ExportFeedRun struct {
+	ID              int64  `db:"id, primarykey, autoincrement" json:"id"`
+	FeedID          int64  `db:"feed_id" json:"feed_id"`
+	CompanyID       int64  `db:"company_id" json:"company_id"`
+	Trigger         string `db:"trigger_type,size:20" json:"trigger"`
+	UserID          int64  `db:"user_id" json:"user_id"`
+	ResendOf        int64  `db:"resend_of" json:"resend_of"`
+	Started         int64  `db:"started" json:"started"`
+	Finished        int64  `db:"finished" json:"finished"`
+	Status          string `db:"status,size:20" json:"status"`
+	Delta           bool   `db:"delta" json:"delta"`
+	TotalRows       int    `db:"total_rows" json:"total_rows"`
+	RowCount        int    `db:"row_count" json:"row_count"`
+	FileName        string `db:"file_name,size:255" json:"file_name"`
+	DestinationPath string `db:"destination_path,size:1000" json:"destination_path"`
+	Checksum        string `db:"checksum,size:64" json:"checksum"`
+	ArchiveObject   string `db:"archive_object,size:500" json:"archive_object"`
+	SnapshotObject  string `db:"snapshot_object,size:500" json:"snapshot_object"`
+	Error           string `db:"error,size:1000" json:"error"`
+}
+
+const (
+	EXPORT_FEED_STATUS_RUNNING = "running"
+
+	EXPORT_FEED_TRIGGER_SCHEDULE = "schedule"
+	EXPORT_FEED_TRIGGER_MANUAL   = "manual"
+	EXPORT_FEED_TRIGGER_RESEND   = "resend"
+
+	EXPORT_FEED_ARCHIVE_BUCKETNAME = "opint-export-feed-archive"
+	EXPORT_FEED_RUNS_LIMIT         = 100
+)
+
+// Fills in the run's file and row counts and returns what to send
+type exportFeedRunProducer func(run *ExportFeedRun) (ExportFeedFile, error)
+
+// Builds today's file, cut down to the rows that changed since the last successful run when the feed is delta only
+func produceExportFeedFile(company Company, feed ExportFeed) exportFeedRunProducer {
+	return func(run *ExportFeedRun) (ExportFeedFile, error) {
+		rows, err := buildExportFeedRows(company, feed)
+		if err != nil {
+			return ExportFeedFile{}, err
+		}
+		run.TotalRows = len(rows)
+
+		snapshot, err := json.Marshal(rows)
+		if err != nil {
+			return ExportFeedFile{}, errors.New("snapshot err: " + err.Error())
+		}
+
+		if feed.DeltaOnly {
+			rows, run.Delta, err = exportFeedDeltaRows(feed, rows)
+			if err != nil {
+				return ExportFeedFile{}, err
+			}
+		}
+
+		file, err := encodeExportFeedFile(company, feed, rows, time.Unix(run.Started, 0))
+		if err != nil {
+			return file, err
+		}
+
+		run.SnapshotObject = exportFeedArchiveObject(*run, "rows.json")
+		err = bytesToGCP(EXPORT_FEED_ARCHIVE_BUCKETNAME, run.SnapshotObject, snapshot, false)
+		if err != nil {
+			run.SnapshotObject = ""
+			return file, errors.New("archiving snapshot err: " + err.Error())
+		}
+
+		return file, nil
+	}
+}
+
+// Sends exactly what an earlier run sent, under the same filename
+func produceExportFeedResend(original ExportFeedRun) exportFeedRunProducer {
+	return func(run *ExportFeedRun) (ExportFeedFile, error) {
+		run.ResendOf = original.ID
+		run.Delta = original.Delta
+		run.TotalRows = original.TotalRows
+
+		data, err := bytesFromGCP(EXPORT_FEED_ARCHIVE_BUCKETNAME, original.ArchiveObject)
+		if err != nil {
+			return ExportFeedFile{}, errors.New("reading archived file err: " + err.Error())
+		}
+
+		if exportFeedChecksum(data) != original.Checksum {
+			return ExportFeedFile{}, errors.New("archived file does not match the checksum of run " + fmt.Sprint(original.ID))
+		}
+
+		return ExportFeedFile{Name: original.FileName, Data: data, RowCount: original.RowCount}, nil
+	}
+}
+
+// Rows that are new or changed since the last successful snapshot. Rows that disappeared can't be said in
+// these formats so they're not sent, and with no earlier snapshot the whole file goes.
+func exportFeedDeltaRows(feed ExportFeed, rows [][]string) ([][]string, bool, error) {
+	previous := ExportFeedRun{}
+	err := dbmap.SelectOne(&previous, "SELECT * FROM export_feed_runs WHERE feed_id = ? AND status = ? AND snapshot_object != '' ORDER BY id DESC LIMIT 1", feed.ID, EXPORT_FEED_STATUS_SUCCESS)
+	if err != nil {
+		InfoLog.Printf("export feed %d has no earlier snapshot, sending every row\n", feed.ID)
+		return rows, false, nil
+	}
+
+	data, err := bytesFromGCP(EXPORT_FEED_ARCHIVE_BUCKETNAME, previous.SnapshotObject)
+	if err != nil {
+		return nil, false, errors.New(fmt.Sprintf("reading snapshot of run %d err: %s", previous.ID, err.Error()))
+	}
+
+	previousRows := [][]string{}
+	err = json.Unmarshal(data, &previousRows)
+	if err != nil {
+		return nil, false, errors.New(fmt.Sprintf("snapshot of run %d is not readable: %s", previous.ID, err.Error()))
+	}
+
+	sent := map[string]bool{}
+	for _, row := range previousRows {
+		key, _ := json.Marshal(row)
+		sent[string(key)] = true
+	}
+
+	changed := [][]string{}
+	for _, row := range rows {
+		key, _ := json.Marshal(row)
+		if !sent[string(key)] {
+			changed = append(changed, row)
+		}
+	}
+
+	return changed, true, nil
+}
+
+// Records the run from start to finish. The file is archived before it's sent so a failed send can be re-sent
+// as is, and archiving failing stops the send since that file could never be re-sent or diffed against.
+func executeExportFeedRun(company Company, feed ExportFeed, trigger string, userID int64, produce exportFeedRunProducer) (ExportFeedRun, error) {
+	run := ExportFeedRun{
+		FeedID:    feed.ID,
+		CompanyID: company.ID,
+		Trigger:   trigger,
+		UserID:    userID,
+		Started:   time.Now().Unix(),
+		Status:    EXPORT_FEED_STATUS_RUNNING,
+	}
+
+	err := dbmap.Insert(&run)
+	if err != nil {
+		return run, errors.New("recording run err: " + err.Error())
+	}
+
+	err = sendExportFeedRun(feed, &run, produce)
+
+	run.Finished = time.Now().Unix()
+	if err != nil {
+		run.Status = EXPORT_FEED_STATUS_FAILED
+		run.Error = truncateString(err.Error(), 1000)
+	} else {
+		run.Status = EXPORT_FEED_STATUS_SUCCESS
+	}
+
+	_, updateErr := dbmap.Update(&run)
+	if updateErr != nil {
+		ErrorLog.Println("executeExportFeedRun update err: ", updateErr)
+	}
+
+	return run, err
+}
+
+func sendExportFeedRun(feed ExportFeed, run *ExportFeedRun, produce exportFeedRunProducer) error {
+	file, err := produce(run)
+	if err != nil {
+		return err
+	}
+
+	run.FileName = file.Name
+	run.RowCount = file.RowCount
+	run.Checksum = exportFeedChecksum(file.Data)
+
+	run.ArchiveObject = exportFeedArchiveObject(*run, file.Name)
+	err = bytesToGCP(EXPORT_FEED_ARCHIVE_BUCKETNAME, run.ArchiveObject, file.Data, false)
+	if err != nil {
+		run.ArchiveObject = ""
+		return errors.New("archiving file err: " + err.Error())
+	}
+
+	destination, exists := exportFeedDestinations[feed.Destination]
+	if !exists {
+		return errors.New("unknown destination: " + feed.Destination)
+	}
+
+	run.DestinationPath, err = destination.Send(feed, file.Name, file.Data)
+	if err != nil {
+		return errors.New(destination.Name() + " err: " + err.Error())
+	}
+
+	return nil
+}
+
+func exportFeedArchiveObject(run ExportFeedRun, name string) string {
+	return fmt.Sprintf("%d/%d/%d/%s", run.CompanyID, run.FeedID, run.ID, name)
+}
+
+func exportFeedChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func getExportFeedRunsHandler(c *gin.Context) {
+	user, company, err := lookupUserAndCompany(c)
+	if err != nil || (!user.IsCompanyAdmin && !user.IsSystemAdmin) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	feedID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	runs := []ExportFeedRun{}
+	_, err = dbmap.Select(&runs, "SELECT * FROM export_feed_runs WHERE company_id = ? AND feed_id = ? ORDER BY id DESC LIMIT ?", company.ID, feedID, EXPORT_FEED_RUNS_LIMIT)
+	if err != nil {
+		ErrorLog.Println("getExportFeedRunsHandler select err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
+
+// Sends an archived file again to the feed's destination as it's set up now, e.g. after a vendor lost it
+func resendExportFeedRunHandler(c *gin.Context) {
+	user, company, err := lookupUserAndCompany(c)
+	if err != nil || (!user.IsCompanyAdmin && !user.IsSystemAdmin) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	runID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	original := ExportFeedRun{}
+	err = dbmap.SelectOne(&original, "SELECT * FROM export_feed_runs WHERE company_id = ? AND id = ?", company.ID, runID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	if original.ArchiveObject == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "That run has no archived file to re-send"})
+		return
+	}
+
+	feed, err := lookupExportFeed(company.ID, original.FeedID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	go runExportFeed(*company, feed, EXPORT_FEED_TRIGGER_RESEND, user.ID, produceExportFeedResend(original))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Re-send started"})
+}
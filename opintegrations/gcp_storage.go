@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"io/ioutil"
 	"os"
 
 	"cloud.google.com/go/storage"
@@ -96,3 +97,21 @@ func bytesToGCP(BUCKET_NAME, gcmFileName string, data []byte, setObjectPolicies
 
 	return nil
 }
+
+func bytesFromGCP(BUCKET_NAME, gcmFileName string) ([]byte, error) {
+	ctx := context.Background()
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	r, err := client.Bucket(BUCKET_NAME).Object(gcmFileName).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
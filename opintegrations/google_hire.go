@@ -56,7 +56,7 @@ const EXWIRE_GH_STAGE = "BACKGROUND IN PROGRESS"
 func registerGoogleHireRoutes(router *gin.Engine) {
 	router.GET("/api/googlehire/info", getGoogleHireInfoHandler)
 	router.POST("/api/googlehire/deauthenticate", deactivateGoogleHireHandler)
-	router.POST("/api/googlehire/pushNotifications", googleHirePushNotificationsHandler)
+	router.POST("/api/googlehire/pushNotifications", verifyInboundWebhook(WEBHOOK_SOURCE_GOOGLEHIRE, verifyPubSubPushJWT), googleHirePushNotificationsHandler)
 }
 
 // runs everyday using crons
@@ -306,7 +306,7 @@ func (createdLog *GoogleHireCreatedApplicants) SendApplicantNotifications(newPas
 		LoginLink: loginLink,
 	}
 
-	err := sendTemplatedEmailSendGrid(emailHeaderInfo, GH_APPLICANT_EMAIL_TEMPLATE, emailBody, "google_hire_applicant_email")
+	err := sendNotification(Notification{CompanyID: createdLog.CompanyID, Kind: NOTIFICATION_KIND_GH_APPLICANT, Email: emailHeaderInfo, Template: GH_APPLICANT_EMAIL_TEMPLATE, Data: emailBody})
 	if err != nil {
 		ErrorLog.Println("GOOGLE HIRE SendApplicantNotifications err: ", err)
 	}
@@ -331,7 +331,7 @@ func (createdLog *GoogleHireCreatedApplicants) SendCompanyNotifications() {
 
 	emailBody := GHAdminAlertBody{ApplicantName: createdLog.ApplicantName}
 
-	err := sendTemplatedEmailSendGrid(emailHeaderInfo, GH_ADMIN_ALERT_TEMPLATE, emailBody, "google_hire_admin_alerts")
+	err := sendNotification(Notification{CompanyID: createdLog.CompanyID, Kind: NOTIFICATION_KIND_GH_ADMIN, Email: emailHeaderInfo, Template: GH_ADMIN_ALERT_TEMPLATE, Data: emailBody})
 	if err != nil {
 		ErrorLog.Println("GOOGLE HIRE SendCompanyNotifications err: ", err)
 	}
@@ -392,6 +392,14 @@ func getNewHires() {
 	}
 }
 
+// Terminations across every company, CloudPunch biometric retention reads the same report
+func pullNewFiresReport() ([]NewFiresReport, error) {
+	fireRows := []NewFiresReport{}
+	reportURL := fmt.Sprintf("https://secure.onehcm.com/ta/rest/v1/report/%s/%v", "saved", FIRED_REPORT_ID)
+	err := hfReportsCxn.GenricReport(reportURL, &fireRows)
+	return fireRows, err
+}
+
 func getNewFires() {
 	product, err := lookupProductByURL(PRODUCT_USERPROVISIONING_URL)
 	if err != nil {
@@ -407,9 +415,7 @@ func getNewFires() {
 
 	InfoLog.Println("starting new FIRED pull")
 
-	fireRows := []NewFiresReport{}
-	reportURL := fmt.Sprintf("https://secure.onehcm.com/ta/rest/v1/report/%s/%v", "saved", FIRED_REPORT_ID)
-	err = hfReportsCxn.GenricReport(reportURL, &fireRows)
+	fireRows, err := pullNewFiresReport()
 	if err != nil {
 		ErrorLog.Println("err! ", err)
 		return
@@ -62,7 +62,7 @@ func sendHFSummaryEmail(productSettings map[string]interface{}, fullEmployeeReco
 	}
 
 	if alertableCounter > 0 {
-		err := sendTemplatedEmailSendGrid(emailHeaderInfo, HF_SUMMARY_EMAIL_TEMPLATE, emailBody, "user_provisioning_summary")
+		err := sendNotification(Notification{CompanyID: newHFEvent.CompanyID, Kind: NOTIFICATION_KIND_HF_SUMMARY, Email: emailHeaderInfo, Template: HF_SUMMARY_EMAIL_TEMPLATE, Data: emailBody})
 		if err != nil {
 			ErrorLog.Printf("emailing err: %v\n", err)
 		} else {
@@ -218,9 +218,9 @@ func sendActiveDirectoryUserProvisioningEmail(event HFEvent, result HFResult, co
 		To:      tos,
 	}
 
-	err = sendTemplatedEmailSendGrid(emailHeaderInfo, AD_HF_SUMMARY_TEMPLATE, emailBody, "active_directory_user_provisioning_summary")
+	err = sendNotification(Notification{CompanyID: event.CompanyID, Kind: NOTIFICATION_KIND_AD_HF_SUMMARY, Email: emailHeaderInfo, Template: AD_HF_SUMMARY_TEMPLATE, Data: emailBody})
 	if err != nil {
-		ErrorLog.Println("sendTemplatedEmailSendGrid err: " + err.Error())
+		ErrorLog.Println("sendNotification err: " + err.Error())
 		return err
 	}
 
@@ -270,9 +270,9 @@ func sendActiveDirectoryDisconnectedEmail(intURL, intName string, coInt CompanyI
 		To:      []*sgmail.Email{&sgmail.Email{Address: toEmailAddress}},
 	}
 
-	err := sendTemplatedEmailSendGrid(emailHeaderInfo, SERVICE_DISCONNECTION_ALERT_TEMPLATE, emailBody, "user_provisioning_disconnection_alerts")
+	err := sendNotification(Notification{CompanyID: coInt.CompanyID, Kind: NOTIFICATION_KIND_HF_DISCONNECTED, Email: emailHeaderInfo, Template: SERVICE_DISCONNECTION_ALERT_TEMPLATE, Data: emailBody})
 	if err != nil {
-		ErrorLog.Println("sendTemplatedEmailSendGrid err: " + err.Error())
+		ErrorLog.Println("sendNotification err: " + err.Error())
 		return err
 	}
 
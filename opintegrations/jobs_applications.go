@@ -27,13 +27,23 @@ type JobApplication struct {
 	ApplicantEmail       string      `db:"applicant_email" json:"applicant_email"`
 	ApplicantPhoneNumber string      `db:"applicant_phone_number" json:"applicant_phone_number"`
 	FinishEmailSent      *bool       `db:"finish_email_sent" json:"finish_email_sent"`
-	FollowUpEmailSent    *bool       `db:"followup_email_sent" json:"followup_email_sent"`
+	FollowUpEmailSent    *bool       `db:"followup_email_sent" json:"followup_email_sent"` // from before nurture sequences, only read by the migration to nurture_state
 	AppliedOnOP          *bool       `db:"applied_on_op" json:"applied_on_op"`
 	UserReviewed         *bool       `db:"user_reviewed" json:"user_reviewed"`
 	ResumeURL            *string     `db:"resume_url" json:"resume_url"`
 	Data                 PropertyMap `db:"data,size:10000" json:"data"`
 
 	OPApplicantID *int64 `db:"op_applicant_id" json:"op_applicant_id"`
+	CandidateID   *int64 `db:"candidate_id" json:"candidate_id"`
+
+	ParsedResume   *ParsedResume `db:"parsed_resume,size:65535" json:"-"`
+	ResumeSkills   string        `db:"resume_skills,size:2000" json:"resume_skills"`
+	ResumeKeywords string        `db:"resume_keywords,size:5000" json:"-"`
+
+	NurtureState  string `db:"nurture_state,size:20" json:"nurture_state"`
+	NurtureStep   int    `db:"nurture_step" json:"nurture_step"`
+	NurtureNextAt int64  `db:"nurture_next_at" json:"nurture_next_at"`
+	NurtureToken  string `db:"nurture_token,size:40" json:"-"`
 
 	ApplicantFirstName string `db:"-" json:"applicant_first_name"`
 	ApplicantLastName  string `db:"-" json:"applicant_last_name"`
@@ -42,6 +52,7 @@ type JobApplication struct {
 type JobSiteApplicationData interface {
 	ConvertToOPApplicant() *opapi.Applicant
 	GetResumeFileAndExtension() (*string, string)
+	ParseResume() (ParsedResume, error)
 }
 
 type JobReqPublic struct {
@@ -59,18 +70,38 @@ const (
 	JOB_APPS_COUNT         = 10
 	JOB_RESUMES_BUCKETNAME = "onepoint-resumes"
 	RESUMES_URL            = "https://storage.googleapis.com/onepoint-resumes/"
+	JOB_REQ_INACTIVE_ERROR = "Job Requisition is no longer active."
 )
 
 func registerJobsRoutes(router *gin.Engine) {
 	router.GET("/api/recruitment/applications", getJobApplicationsHandler)
+	router.GET("/api/recruitment/search/applications", searchJobApplicationsHandler)
 	router.GET("/api/recruitment/jobs/:opJobID/:appPage", getJobHandler)
 	router.POST("/api/recruitment/applications/:appID/sendFinishEmail", sendFinishEmailHandler)
 	router.POST("/api/recruitment/applications/:appID/markAsReviewed", markAsReviewedHandler)
-	router.POST("/api/recruitment/application", jobApplicationPostHandler)
+	router.GET("/api/recruitment/applications/:appID/resume", getApplicationResumeHandler)
+	router.POST("/api/recruitment/application", verifyInboundWebhook(WEBHOOK_SOURCE_JOB_APPS, verifyJobApplicationWebhook), jobApplicationPostHandler)
+	router.GET("/api/recruitment/nurture", getNurtureSequenceHandler)
+	router.POST("/api/recruitment/nurture", updateNurtureSequenceHandler)
+	router.GET("/api/recruitment/nurture/stats", getNurtureStatsHandler)
+	router.GET("/api/recruitment/nurture/unsubscribe/:token", nurtureUnsubscribePageHandler)
+	router.POST("/api/recruitment/nurture/unsubscribe/:token", nurtureUnsubscribeHandler)
+	router.GET("/api/recruitment/candidates/:candidateID", getCandidateHandler)
+	router.POST("/api/recruitment/candidates/:candidateID/merge/:duplicateID", mergeCandidatesHandler)
 	router.POST("/api/recruitment/zipsponsorship/:opJobID", zipSponsorshipPostHandler)
 	router.POST("/api/recruitment/indeedsponsorship/:opJobID", indeedSponsorshipPostHandler)
 	router.POST("/api/recruitment/indeedsponsorship/:opJobID/:sponsorshipID/update", indeedSponsorshipUpdateHandler)
+	router.GET("/api/recruitment/sponsorships/report", getSponsorshipReportHandler)
+	router.POST("/api/recruitment/sponsorships/spend/:integrationURL", importSponsorshipSpendHandler)
 	router.GET("/api/recruitment/startprocess/:processName", startRecruitmentProcessHandler)
+	router.GET("/api/recruitment/jobboards", getJobBoardsHandler)
+	router.POST("/api/recruitment/jobboards", updateJobBoardsHandler)
+	router.GET("/api/recruitment/jobfeeds/diffs", getJobFeedDiffsHandler)
+	router.GET("/api/recruitment/jobfeeds/excluded", getJobFeedExclusionsHandler)
+
+	router.GET("/careers/:shortname", careersIndexHandler)
+	router.GET("/careers/:shortname/sitemap.xml", careersSitemapHandler)
+	router.GET("/careers/:shortname/jobs/:opJobID", careersJobHandler)
 }
 
 func startRecruitmentProcessHandler(c *gin.Context) {
@@ -95,7 +126,11 @@ func startRecruitmentProcessHandler(c *gin.Context) {
 		getRecruitmentReportsHandler(c)
 		return
 	case "runJobFeeds":
-		go runIndeedFeed()
+		go runJobFeeds()
+		c.JSON(200, nil)
+		return
+	case "backfillCandidates":
+		go backfillJobCandidates()
 		c.JSON(200, nil)
 		return
 	}
@@ -320,6 +355,17 @@ func sendFinishEmailAndUpdateSent(thisApp *JobApplication, thisCompany Company)
 }
 
 func sendJobAppFinishEmail(jobApp *JobApplication, company Company, reminder bool) error {
+	template := JOB_FINISH_APP_EMAIL_TEMPLATE
+	if reminder {
+		template = JOB_FINISH_APP_REMINDER_EMAIL_TEMPLATE
+	}
+
+	return sendJobAppNurtureMessage(jobApp, company, template, "")
+}
+
+// Finish and reminder messages share a body, nurture steps pick the template and can override the subject.
+// The company's SMS settings decide whether it goes out by email, text or both.
+func sendJobAppNurtureMessage(jobApp *JobApplication, company Company, template, subject string) error {
 	cxn := chooseOPAPICxn(company.OPID)
 
 	maxTries := 2
@@ -342,8 +388,8 @@ func sendJobAppFinishEmail(jobApp *JobApplication, company Company, reminder boo
 		tries++
 
 		if err != nil {
-			if err.Error() == "Job Requisition is no longer active." {
-				return errors.New("Job Requisition is no longer active.")
+			if err.Error() == JOB_REQ_INACTIVE_ERROR {
+				return errors.New(JOB_REQ_INACTIVE_ERROR)
 			}
 
 			continue
@@ -352,14 +398,18 @@ func sendJobAppFinishEmail(jobApp *JobApplication, company Company, reminder boo
 		success = true
 	}
 
-	subject := fmt.Sprintf("ACTION REQUIRED: You have not completed your job application with %s", company.Name)
-	if reminder {
-		subject = "REMINDER: You have not completed your application with " + company.Name
+	reminder := template == JOB_FINISH_APP_REMINDER_EMAIL_TEMPLATE
+
+	if subject == "" {
+		subject = fmt.Sprintf("ACTION REQUIRED: You have not completed your job application with %s", company.Name)
+		if reminder {
+			subject = "REMINDER: You have not completed your application with " + company.Name
+		}
 	}
 
-	emailCat := "apply-invite"
+	emailCat := NOTIFICATION_KIND_APPLY_INVITE
 	if reminder {
-		emailCat = "apply-reminder"
+		emailCat = NOTIFICATION_KIND_APPLY_REMINDER
 	}
 
 	emailHeaderInfo := sgEmailFields{
@@ -374,13 +424,32 @@ func sendJobAppFinishEmail(jobApp *JobApplication, company Company, reminder boo
 		CompanyName:   company.Name,
 		ApplyURL:      fmt.Sprintf("https://secure.onehcm.com/ta/%s.jobs?ApplyToJob=%s&TrackId=%s", company.ShortName, jobApp.OPJobID, jobApp.Source),
 	}
+	if jobApp.NurtureToken != "" {
+		body.UnsubscribeURL = fmt.Sprintf("%s/%s", NURTURE_UNSUBSCRIBE_URL, jobApp.NurtureToken)
+	}
 
-	template := JOB_FINISH_APP_EMAIL_TEMPLATE
-	if reminder {
-		template = JOB_FINISH_APP_REMINDER_EMAIL_TEMPLATE
+	// texting falls back to email when the applicant has no usable number or opted out
+	smsSettings := lookupCompanySMSSettings(company.ID)
+	smsQueued := false
+	if smsSettings.usesSMS() {
+		smsKind := SMS_KIND_FINISH
+		if reminder {
+			smsKind = SMS_KIND_REMINDER
+		}
+
+		err = queueJobAppSMS(jobApp, company, smsSettings, smsKind, smsBodyForApplication(smsKind, company, body.JobTitle, body.ApplyURL))
+		if err != nil {
+			InfoLog.Printf("not texting app %d, sending email instead: %v\n", jobApp.ID, err)
+		} else {
+			smsQueued = true
+		}
+	}
+
+	if smsQueued && !smsSettings.usesEmail() {
+		return nil
 	}
 
-	err = sendTemplatedEmailSendGrid(emailHeaderInfo, template, body, emailCat)
+	err = sendNotification(Notification{CompanyID: company.ID, Kind: emailCat, Email: emailHeaderInfo, Template: template, Data: body})
 	if err != nil {
 		ErrorLog.Println("sendJobAppNotficationEmail email err: ", err)
 		return err
@@ -517,6 +586,12 @@ func (app *IndeedJobAppPost) ConvertToOPApplicant() *opapi.Applicant {
 	newOPApplicant.Summary = app.Applicant.Resume.JSON.Summary
 	newOPApplicant.OtherSkills = app.Applicant.Resume.JSON.Skills
 
+	// without the structured resume, fill in from the hr-xml or file
+	parsed, err := app.ParseResume()
+	if err == nil {
+		parsed.applyToOPApplicant(newOPApplicant)
+	}
+
 	return newOPApplicant
 }
 
@@ -546,6 +621,12 @@ func (app *ZRJobAppPost) ConvertToOPApplicant() *opapi.Applicant {
 		Address: appAddress,
 	}
 
+	// ZipRecruiter only sends contact info, the rest comes from the resume
+	parsed, err := app.ParseResume()
+	if err == nil {
+		parsed.applyToOPApplicant(newOPApplicant)
+	}
+
 	return newOPApplicant
 }
 
@@ -719,10 +800,26 @@ func jobApplicationPostHandler(c *gin.Context) {
 	newJobApp.AppliedOnOP = &fal
 	newJobApp.FollowUpEmailSent = &fal
 	newJobApp.UserReviewed = &fal
-	err := dbmap.Insert(&newJobApp)
+	newJobApp.enrollInNurture(lookupNurtureSequence(company.ID))
+
+	parsedResume, err := jobSiteData.ParseResume()
+	if err != nil {
+		ErrorLog.Printf("jobApplicationPostHandler %s ParseResume err: %v\n", newJobApp.Source, err)
+	} else {
+		newJobApp.setParsedResume(parsedResume)
+	}
+
+	_, err = newJobApp.resolveCandidate()
+	if err != nil {
+		// still take the application, backfillCandidates links it later
+		ErrorLog.Printf("jobApplicationPostHandler resolveCandidate err: %v\n", err)
+	}
+
+	err = dbmap.Insert(&newJobApp)
 	if err != nil {
 		ErrorLog.Printf("err inserting new job app: %+v\n", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		// 5xx so the board sends it again
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An error occured"})
 		return
 	}
 
@@ -744,9 +841,15 @@ func offlineProcessNewApplicantV2(company Company, newJobApp *JobApplication, jo
 	if alreadyCreatedApplicantID != nil {
 		newJobApp.OPApplicantID = alreadyCreatedApplicantID
 		dbmap.Update(newJobApp)
+		newJobApp.setCandidateOPApplicantID(*alreadyCreatedApplicantID)
 
 		InfoLog.Println(logPrefix, "Applicant already added to OnePoint by our integration, op_id = ", *alreadyCreatedApplicantID)
 
+		if newJobApp.candidateAlreadyAppliedToJob() {
+			InfoLog.Println(logPrefix, "applicant id:", *newJobApp.OPApplicantID, " already applied to job ", newJobApp.OPJobID, " from another application, skipping createOPApplication")
+			return
+		}
+
 		err := newJobApp.createOPApplication(company.OPID)
 		if err != nil {
 			ErrorLog.Println(logPrefix, "applicant id:", *newJobApp.OPApplicantID, " err createOPApplication: ", err)
@@ -793,6 +896,7 @@ func offlineProcessNewApplicantV2(company Company, newJobApp *JobApplication, jo
 
 		newJobApp.OPApplicantID = newAppplicantOPID
 		dbmap.Update(newJobApp)
+		newJobApp.setCandidateOPApplicantID(*newAppplicantOPID)
 
 		InfoLog.Println(logPrefix, "created applicant w OPID: ", *newAppplicantOPID)
 
@@ -819,6 +923,7 @@ func offlineProcessNewApplicantV2(company Company, newJobApp *JobApplication, jo
 		id64 := int64(foundApplicant.Account.AccountID)
 		newJobApp.OPApplicantID = &id64
 		dbmap.Update(newJobApp)
+		newJobApp.setCandidateOPApplicantID(id64)
 	}
 
 	err = newJobApp.createOPApplication(company.OPID)
@@ -931,8 +1036,16 @@ func mapToDocTypeSetting(pm map[string]interface{}) *DocTypeSetting {
 	return &dts
 }
 
-// Returns the OnePoint Applicant ID if we have already created this applicant, nil if not
+// Returns the OnePoint Applicant ID if we have already created this applicant, nil if not.
+// The candidate catches the same person applying with another email through a different board.
 func (app *JobApplication) applicantHasBeenAddedToOnePoint() *int64 {
+	if app.CandidateID != nil {
+		candidate, err := lookupCandidate(app.CompanyID, *app.CandidateID)
+		if err == nil && candidate.OPApplicantID != nil {
+			return candidate.OPApplicantID
+		}
+	}
+
 	apps := []JobApplication{}
 	dbmap.Select(&apps, "SELECT id, company_id, op_applicant_id FROM job_applications WHERE applicant_email = ? AND company_id = ? AND !ISNULL(op_applicant_id)", app.ApplicantEmail, app.CompanyID)
 	if len(apps) > 0 {
@@ -947,6 +1060,11 @@ func offlineProcessNewApplicant(company Company, newJobApp *JobApplication) {
 		return
 	}
 
+	if newJobApp.candidateAlreadyAppliedToJob() {
+		InfoLog.Printf("offlineProcessNewApplicant, candidate %d already applied to job %s, not sending another finish email\n", *newJobApp.CandidateID, newJobApp.OPJobID)
+		return
+	}
+
 	err := sendFinishEmailAndUpdateSent(newJobApp, company)
 	if err != nil {
 		ErrorLog.Printf("offlineProcessNewApplicant err: %+v\n", err)
@@ -976,7 +1094,7 @@ func uploadResumeFiles(fileExtension string, jobApp JobApplication, resumeBase64
 	return fileName, nil
 }
 
-func sendEmployerJobAppNotficationEmail(email, applicantName, jobTitle, sourceName string) {
+func sendEmployerJobAppNotficationEmail(companyID int64, email, applicantName, jobTitle, sourceName string) {
 	emailHeaderInfo := sgEmailFields{
 		From:    &mail.Email{Name: "OnePoint Connect", Address: passwords.NO_REPLY_EMAILER_ADDRESS},
 		To:      []*mail.Email{&mail.Email{Address: email}},
@@ -989,7 +1107,7 @@ func sendEmployerJobAppNotficationEmail(email, applicantName, jobTitle, sourceNa
 		Source:        sourceName,
 	}
 
-	err := sendTemplatedEmailSendGrid(emailHeaderInfo, JOB_APPLICATION_EMAIL_TEMPLATE, body)
+	err := sendNotification(Notification{CompanyID: companyID, Kind: NOTIFICATION_KIND_JOB_APPLICATION, Email: emailHeaderInfo, Template: JOB_APPLICATION_EMAIL_TEMPLATE, Data: body})
 	if err != nil {
 		ErrorLog.Println("sendJobAppNotficationEmail email err: ", err)
 	}
@@ -104,9 +104,9 @@ func runApplyStats() (CompanyWithApplyStats, []CompanyWithApplyStats, error) {
 func updateAppliedStatus(thisCompany Company) error {
 	cxn := chooseOPAPICxn(thisCompany.OPID)
 
-	// get all apps applied_on_op = 0
+	// get all apps not applied on OP yet, plus ones still in a sequence with steps that keep going after applying
 	allUnAppliedApps := []JobApplication{}
-	_, err := dbmap.Select(&allUnAppliedApps, "SELECT * FROM job_applications WHERE company_id = ? AND (applied_on_op IS NULL OR applied_on_op = 0)", thisCompany.ID)
+	_, err := dbmap.Select(&allUnAppliedApps, "SELECT * FROM job_applications WHERE company_id = ? AND (applied_on_op IS NULL OR applied_on_op = 0 OR nurture_state = ?)", thisCompany.ID, NURTURE_STATE_ACTIVE)
 	if err != nil {
 		return errors.New(fmt.Sprintf("Job apps lookup err: %v", err))
 	}
@@ -120,59 +120,50 @@ func updateAppliedStatus(thisCompany Company) error {
 	// make map[string][]string of applicant email to job req id that they have applied for
 	opApplicantToJobsAppliedFor := makeApplicantToJobAppsMap(allOPApps)
 
+	sequence := lookupNurtureSequence(thisCompany.ID)
+
+	unsubscribed, err := findNurtureUnsubscribes(thisCompany.ID)
+	if err != nil {
+		return errors.New(fmt.Sprintf("findNurtureUnsubscribes err: %v", err))
+	}
+
+	now := time.Now()
+
 	// go through OPC list of apps, looking up applicants in map
-	// 	if applied for job, mark true and update app
-	// 	if not applied, if applied time is > 24 hours ago (and < a week ago) AND we have not already follow up, send follow up email and update
+	// 	if applied for job, mark true
+	// 	then move the app's nurture sequence forward if its next step is due
 	for _, jobBoardApp := range allUnAppliedApps {
-		appliedOnOPForThisJob := false
-		jobsArr, exists := opApplicantToJobsAppliedFor[strings.ToLower(jobBoardApp.ApplicantEmail)]
-		if exists {
-			for _, job := range jobsArr {
-				if job == jobBoardApp.OPJobID {
-					appliedOnOPForThisJob = true
+		changed := false
+
+		if jobBoardApp.AppliedOnOP == nil || !*jobBoardApp.AppliedOnOP {
+			appliedOnOPForThisJob := false
+			jobsArr, exists := opApplicantToJobsAppliedFor[strings.ToLower(jobBoardApp.ApplicantEmail)]
+			if exists {
+				for _, job := range jobsArr {
+					if job == jobBoardApp.OPJobID {
+						appliedOnOPForThisJob = true
+					}
 				}
 			}
-		}
 
-		if appliedOnOPForThisJob {
-			// update to applied
-			InfoLog.Printf("APPLIED! email: %s, jobid: %s\n", jobBoardApp.ApplicantEmail, jobBoardApp.OPJobID)
-			if env.Production {
-				jobBoardApp.AppliedOnOP = &appliedOnOPForThisJob
-				_, err = dbmap.Update(&jobBoardApp)
-				if err != nil {
-					ErrorLog.Println("could not update job app to indicate applied: " + err.Error())
+			if appliedOnOPForThisJob {
+				// update to applied
+				InfoLog.Printf("APPLIED! email: %s, jobid: %s\n", jobBoardApp.ApplicantEmail, jobBoardApp.OPJobID)
+				if env.Production {
+					jobBoardApp.AppliedOnOP = &appliedOnOPForThisJob
+					changed = true
 				}
 			}
 		}
 
-		if !exists || !appliedOnOPForThisJob {
-			// never applied
-			timeNowMillis := time.Now().Unix() * 1000
-			millisecondsInDay := 86400000
-			epochTwentyFoursAgo := timeNowMillis - int64(millisecondsInDay)
-			epochAWeekAgo := timeNowMillis - int64(7*millisecondsInDay)
-
-			if epochAWeekAgo < jobBoardApp.AppliedOnMillis && jobBoardApp.AppliedOnMillis < epochTwentyFoursAgo {
-				if jobBoardApp.FollowUpEmailSent == nil || *jobBoardApp.FollowUpEmailSent == false {
-					if env.Production {
-						err = sendJobAppFinishEmail(&jobBoardApp, thisCompany, true)
-						if err != nil {
-							ErrorLog.Println("err sending reminder email: " + err.Error())
-						} else {
-							tru := true
-							jobBoardApp.FollowUpEmailSent = &tru
-							_, err = dbmap.Update(&jobBoardApp)
-							if err != nil {
-								ErrorLog.Println("err sending reminder email BUT EMAIL DID SEND !!!!: " + err.Error())
-							} else {
-								InfoLog.Println("sent follow up email and updated successfully, email: " + jobBoardApp.ApplicantEmail)
-							}
-						}
-					} else {
-						InfoLog.Printf("would be emailing: email: %s, jobid: %s, applied on %d\n", jobBoardApp.ApplicantEmail, jobBoardApp.OPJobID, jobBoardApp.AppliedOnMillis)
-					}
-				}
+		if jobBoardApp.advanceNurture(thisCompany, sequence, unsubscribed, now) {
+			changed = true
+		}
+
+		if changed {
+			_, err = dbmap.Update(&jobBoardApp)
+			if err != nil {
+				ErrorLog.Printf("could not update job app %d after applied and nurture checks: %v\n", jobBoardApp.ID, err)
 			}
 		}
 	}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// One person across every board and req they applied to at a company. Applications point at
+// their candidate, and the candidate holds the OnePoint applicant so only one is ever created.
+type JobCandidate struct {
+	ID              int64  `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID       int64  `db:"company_id" json:"company_id"`
+	Name            string `db:"name" json:"name"`
+	Email           string `db:"email" json:"email"`
+	Phone           string `db:"phone" json:"phone"`
+	NormalizedEmail string `db:"normalized_email" json:"-"`
+	NormalizedPhone string `db:"normalized_phone,size:20" json:"-"`
+	NormalizedName  string `db:"normalized_name" json:"-"`
+	OPApplicantID   *int64 `db:"op_applicant_id" json:"op_applicant_id"`
+	MergedIntoID    *int64 `db:"merged_into_id" json:"merged_into_id"`
+	Created         int64  `db:"created" json:"created"`
+	Updated         int64  `db:"updated" json:"updated"`
+}
+
+type JobCandidateHistory struct {
+	Candidate    JobCandidate     `json:"candidate"`
+	Applications []JobApplication `json:"applications"`
+	Sources      []string         `json:"sources"`
+	OPJobIDs     []string         `json:"op_job_ids"`
+}
+
+// Job boards hand out relay addresses that are unique per application, they can't identify a person
+var jobBoardRelayEmailDomains = []string{"indeedemail.com", "indeed.com", "ziprecruiter.com", "zrmail.com"}
+
+// Resolution reads then writes, two applications from the same person arriving together must not both create a candidate
+var candidateResolveLock sync.Mutex
+
+func getCandidateHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	candidateID, err := strconv.ParseInt(c.Param("candidateID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	history, err := getCandidateHistory(thisCompany.ID, candidateID)
+	if err != nil {
+		ErrorLog.Println("getCandidateHandler getCandidateHistory err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// For people we didn't match on our own, like someone who used a different email and phone on each board
+func mergeCandidatesHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	candidateID, err := strconv.ParseInt(c.Param("candidateID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	duplicateID, err := strconv.ParseInt(c.Param("duplicateID"), 10, 64)
+	if err != nil || duplicateID == candidateID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	candidateResolveLock.Lock()
+	err = mergeCandidates(thisCompany.ID, candidateID, duplicateID)
+	candidateResolveLock.Unlock()
+	if err != nil {
+		ErrorLog.Println("mergeCandidatesHandler mergeCandidates err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	history, err := getCandidateHistory(thisCompany.ID, candidateID)
+	if err != nil {
+		ErrorLog.Println("mergeCandidatesHandler getCandidateHistory err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+func getCandidateHistory(companyID, candidateID int64) (JobCandidateHistory, error) {
+	history := JobCandidateHistory{Applications: []JobApplication{}, Sources: []string{}, OPJobIDs: []string{}}
+
+	candidate, err := lookupCandidate(companyID, candidateID)
+	if err != nil {
+		return history, err
+	}
+	history.Candidate = candidate
+
+	_, err = dbmap.Select(&history.Applications, "SELECT * FROM job_applications WHERE company_id = ? AND candidate_id = ? ORDER BY applied_on_millis DESC", companyID, candidate.ID)
+	if err != nil {
+		return history, err
+	}
+
+	seenSources := make(map[string]bool)
+	seenJobs := make(map[string]bool)
+	for _, app := range history.Applications {
+		if !seenSources[app.Source] {
+			seenSources[app.Source] = true
+			history.Sources = append(history.Sources, app.Source)
+		}
+		if !seenJobs[app.OPJobID] {
+			seenJobs[app.OPJobID] = true
+			history.OPJobIDs = append(history.OPJobIDs, app.OPJobID)
+		}
+	}
+
+	return history, nil
+}
+
+// Follows merges, so an old candidate id still finds the person
+func lookupCandidate(companyID, candidateID int64) (JobCandidate, error) {
+	candidate := JobCandidate{}
+
+	for hops := 0; hops < 10; hops++ {
+		err := dbmap.SelectOne(&candidate, "SELECT * FROM job_candidates WHERE id = ? AND company_id = ?", candidateID, companyID)
+		if err != nil {
+			return candidate, err
+		}
+
+		if candidate.MergedIntoID == nil {
+			return candidate, nil
+		}
+		candidateID = *candidate.MergedIntoID
+	}
+
+	return candidate, errors.New(fmt.Sprintf("candidate %d merges loop", candidateID))
+}
+
+// Links the application to the candidate it belongs to, creating one when nobody matches.
+// An email match is enough, a phone only counts when the name matches too since families share phones.
+func (app *JobApplication) resolveCandidate() (JobCandidate, error) {
+	candidateResolveLock.Lock()
+	defer candidateResolveLock.Unlock()
+
+	email := normalizeCandidateEmail(app.ApplicantEmail)
+	phone := normalizeCandidatePhone(app.ApplicantPhoneNumber)
+	name := normalizeCandidateName(app.ApplicantName)
+	now := time.Now().Unix()
+
+	candidate := JobCandidate{}
+	found := false
+
+	if email != "" {
+		err := dbmap.SelectOne(&candidate, "SELECT * FROM job_candidates WHERE company_id = ? AND normalized_email = ? AND merged_into_id IS NULL ORDER BY id LIMIT 1", app.CompanyID, email)
+		found = err == nil
+	}
+
+	if !found && phone != "" && name != "" {
+		err := dbmap.SelectOne(&candidate, "SELECT * FROM job_candidates WHERE company_id = ? AND normalized_phone = ? AND normalized_name = ? AND merged_into_id IS NULL ORDER BY id LIMIT 1", app.CompanyID, phone, name)
+		found = err == nil
+	}
+
+	if !found {
+		candidate = JobCandidate{
+			CompanyID:       app.CompanyID,
+			Name:            app.ApplicantName,
+			Email:           app.ApplicantEmail,
+			Phone:           app.ApplicantPhoneNumber,
+			NormalizedEmail: email,
+			NormalizedPhone: phone,
+			NormalizedName:  name,
+			OPApplicantID:   app.OPApplicantID,
+			Created:         now,
+			Updated:         now,
+		}
+
+		err := dbmap.Insert(&candidate)
+		if err != nil {
+			return candidate, err
+		}
+	} else {
+		// fill in what the earlier boards didn't give us
+		changed := false
+		if candidate.NormalizedEmail == "" && email != "" {
+			candidate.Email, candidate.NormalizedEmail, changed = app.ApplicantEmail, email, true
+		}
+		if candidate.NormalizedPhone == "" && phone != "" {
+			candidate.Phone, candidate.NormalizedPhone, changed = app.ApplicantPhoneNumber, phone, true
+		}
+		if candidate.NormalizedName == "" && name != "" {
+			candidate.Name, candidate.NormalizedName, changed = app.ApplicantName, name, true
+		}
+		if candidate.OPApplicantID == nil && app.OPApplicantID != nil {
+			candidate.OPApplicantID, changed = app.OPApplicantID, true
+		}
+
+		if changed {
+			candidate.Updated = now
+			_, err := dbmap.Update(&candidate)
+			if err != nil {
+				return candidate, err
+			}
+		}
+	}
+
+	app.CandidateID = &candidate.ID
+
+	return candidate, nil
+}
+
+// Remembers the OnePoint applicant on the candidate so later applications reuse it
+func (app *JobApplication) setCandidateOPApplicantID(opApplicantID int64) {
+	if app.CandidateID == nil {
+		return
+	}
+
+	_, err := dbmap.Exec("UPDATE job_candidates SET op_applicant_id = ?, updated = ? WHERE id = ? AND op_applicant_id IS NULL", opApplicantID, time.Now().Unix(), *app.CandidateID)
+	if err != nil {
+		ErrorLog.Println("setCandidateOPApplicantID update err: ", err)
+	}
+}
+
+// True when the same person already applied to this req through another board or twice on one board
+func (app *JobApplication) candidateAlreadyAppliedToJob() bool {
+	if app.CandidateID == nil {
+		return false
+	}
+
+	count, err := dbmap.SelectInt("SELECT COUNT(*) FROM job_applications WHERE candidate_id = ? AND op_job_id = ? AND id <> ?", *app.CandidateID, app.OPJobID, app.ID)
+	if err != nil {
+		ErrorLog.Println("candidateAlreadyAppliedToJob count err: ", err)
+		return false
+	}
+
+	return count > 0
+}
+
+func mergeCandidates(companyID, candidateID, duplicateID int64) error {
+	candidate, err := lookupCandidate(companyID, candidateID)
+	if err != nil {
+		return errors.New("Candidate not found")
+	}
+
+	duplicate, err := lookupCandidate(companyID, duplicateID)
+	if err != nil {
+		return errors.New("Candidate not found")
+	}
+
+	if candidate.ID == duplicate.ID {
+		return errors.New("Candidates are already merged")
+	}
+
+	// two different OnePoint applicants have to be merged in OnePoint first
+	if candidate.OPApplicantID != nil && duplicate.OPApplicantID != nil && *candidate.OPApplicantID != *duplicate.OPApplicantID {
+		return errors.New("Both candidates are separate OnePoint applicants")
+	}
+
+	tx, err := dbmap.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE job_applications SET candidate_id = ? WHERE candidate_id = ?", candidate.ID, duplicate.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if candidate.OPApplicantID == nil && duplicate.OPApplicantID != nil {
+		candidate.OPApplicantID = duplicate.OPApplicantID
+		_, err = tx.Exec("UPDATE job_applications SET op_applicant_id = ? WHERE candidate_id = ? AND op_applicant_id IS NULL", *candidate.OPApplicantID, candidate.ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if candidate.NormalizedEmail == "" {
+		candidate.Email, candidate.NormalizedEmail = duplicate.Email, duplicate.NormalizedEmail
+	}
+	if candidate.NormalizedPhone == "" {
+		candidate.Phone, candidate.NormalizedPhone = duplicate.Phone, duplicate.NormalizedPhone
+	}
+
+	now := time.Now().Unix()
+	candidate.Updated = now
+	duplicate.MergedIntoID = &candidate.ID
+	duplicate.Updated = now
+
+	_, err = tx.Update(&candidate, &duplicate)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Links applications from before candidates existed, oldest first so the first application wins
+func backfillJobCandidates() {
+	InfoLog.Println("starting backfillJobCandidates")
+
+	apps := []JobApplication{}
+	_, err := dbmap.Select(&apps, "SELECT * FROM job_applications WHERE candidate_id IS NULL ORDER BY id")
+	if err != nil {
+		ErrorLog.Println("backfillJobCandidates select err: ", err)
+		return
+	}
+
+	linked := 0
+	for index := range apps {
+		app := &apps[index]
+
+		_, err = app.resolveCandidate()
+		if err != nil {
+			ErrorLog.Println("backfillJobCandidates resolveCandidate err: ", err)
+			continue
+		}
+
+		_, err = dbmap.Exec("UPDATE job_applications SET candidate_id = ? WHERE id = ?", *app.CandidateID, app.ID)
+		if err != nil {
+			ErrorLog.Println("backfillJobCandidates update err: ", err)
+			continue
+		}
+		linked++
+	}
+
+	InfoLog.Printf("finished backfillJobCandidates, linked %d of %d applications\n", linked, len(apps))
+}
+
+// Gmail ignores dots and everyone ignores +tags, relay addresses are dropped
+func normalizeCandidateEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	at := strings.LastIndex(email, "@")
+	if at < 1 || at == len(email)-1 {
+		return ""
+	}
+
+	local, domain := email[:at], email[at+1:]
+
+	for _, relayDomain := range jobBoardRelayEmailDomains {
+		if domain == relayDomain || strings.HasSuffix(domain, "."+relayDomain) {
+			return ""
+		}
+	}
+
+	if plus := strings.Index(local, "+"); plus > 0 {
+		local = local[:plus]
+	}
+
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if domain == "gmail.com" {
+		local = strings.Replace(local, ".", "", -1)
+	}
+
+	return local + "@" + domain
+}
+
+// Digits only, US numbers without the leading 1
+func normalizeCandidatePhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+
+	if len(digits) == 11 && strings.HasPrefix(digits, "1") {
+		digits = digits[1:]
+	}
+
+	if len(digits) < 10 {
+		return ""
+	}
+
+	return digits
+}
+
+func normalizeCandidateName(name string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsSpace(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+
+	return strings.Join(strings.Fields(cleaned), " ")
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CareersPage struct {
+	CompanyName string
+	CareersURL  string
+	Jobs        []CareersJobSummary
+}
+
+type CareersJobSummary struct {
+	Title      string
+	Location   string
+	DatePosted string
+	URL        string
+}
+
+type CareersJobPage struct {
+	CompanyName string
+	CareersURL  string
+	Title       string
+	Location    string
+	DatePosted  string
+	Pay         string
+	Description template.HTML
+	ApplyURL    string
+	JobPosting  GoogleJobPosting
+}
+
+const (
+	CAREERS_BASE_URL       = "https://connect.onehcm.com/careers"
+	CAREERS_SOURCE_TRACKID = "CareerSite"
+	CAREERS_INDEX_TEMPLATE = "careers_index.html"
+	CAREERS_JOB_TEMPLATE   = "careers_job.html"
+
+	CAREERS_CACHE_EXPIRATION = 30 * time.Minute
+	// short so a new job or OP coming back shows up soon, long enough that crawlers don't each hit OP
+	CAREERS_EMPTY_CACHE_EXPIRATION   = 2 * time.Minute
+	CAREERS_FAILURE_CACHE_EXPIRATION = 1 * time.Minute
+)
+
+// A pull from OP that visitors missing the cache at the same time wait on together
+type careerJobReqsFetch struct {
+	done    chan struct{}
+	jobReqs []JobReqJoin
+	err     error
+}
+
+var (
+	careerJobReqsFetches = make(map[string]*careerJobReqsFetch)
+	careerJobReqsMutex   sync.Mutex
+)
+
+func careersIndexHandler(c *gin.Context) {
+	company, err := lookupCareersCompany(c.Param("shortname"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Careers page not found")
+		return
+	}
+
+	jobReqs, err := getCareerJobReqsWithCache(company)
+	if err != nil {
+		ErrorLog.Println("careersIndexHandler getCareerJobReqsWithCache err: ", err)
+		c.String(http.StatusServiceUnavailable, "Jobs are unavailable right now, please try again later")
+		return
+	}
+
+	page := CareersPage{
+		CompanyName: company.Name,
+		CareersURL:  careersURL(company.ShortName),
+		Jobs:        []CareersJobSummary{},
+	}
+
+	for _, jobReq := range jobReqs {
+		page.Jobs = append(page.Jobs, CareersJobSummary{
+			Title:      jobReq.JobReqAPIDetail.JobTitle,
+			Location:   jobReq.CareersLocation(),
+			DatePosted: jobReq.FeedPublishDate().Format("January 2, 2006"),
+			URL:        careersJobURL(company.ShortName, jobReq.JobReqAPIDetail.ID),
+		})
+	}
+
+	renderCareersTemplate(c, CAREERS_INDEX_TEMPLATE, page)
+}
+
+func careersJobHandler(c *gin.Context) {
+	company, err := lookupCareersCompany(c.Param("shortname"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Careers page not found")
+		return
+	}
+
+	opJobID, err := strconv.Atoi(c.Param("opJobID"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Job not found")
+		return
+	}
+
+	jobReqs, err := getCareerJobReqsWithCache(company)
+	if err != nil {
+		ErrorLog.Println("careersJobHandler getCareerJobReqsWithCache err: ", err)
+		c.String(http.StatusServiceUnavailable, "Jobs are unavailable right now, please try again later")
+		return
+	}
+
+	for _, jobReq := range jobReqs {
+		if jobReq.JobReqAPIDetail.ID != opJobID {
+			continue
+		}
+
+		// the page is the posting as far as Google is concerned, applying still happens in OP
+		posting := jobReq.ToGoogleJobPosting(CAREERS_SOURCE_TRACKID)
+		posting.URL = careersJobURL(company.ShortName, opJobID)
+
+		page := CareersJobPage{
+			CompanyName: company.Name,
+			CareersURL:  careersURL(company.ShortName),
+			Title:       jobReq.JobReqAPIDetail.JobTitle,
+			Location:    jobReq.CareersLocation(),
+			DatePosted:  jobReq.FeedPublishDate().Format("January 2, 2006"),
+			Pay:         jobReq.FeedPayText(),
+			Description: template.HTML(addApplyLinkToDescription(jobReq.JobReqAPIDetail.JobDescription, company.ShortName, strconv.Itoa(opJobID), CAREERS_SOURCE_TRACKID)),
+			ApplyURL:    jobReq.FeedJobURL(CAREERS_SOURCE_TRACKID),
+			JobPosting:  posting,
+		}
+
+		renderCareersTemplate(c, CAREERS_JOB_TEMPLATE, page)
+		return
+	}
+
+	c.String(http.StatusNotFound, "Job not found")
+}
+
+func careersSitemapHandler(c *gin.Context) {
+	company, err := lookupCareersCompany(c.Param("shortname"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Careers page not found")
+		return
+	}
+
+	jobReqs, err := getCareerJobReqsWithCache(company)
+	if err != nil {
+		ErrorLog.Println("careersSitemapHandler getCareerJobReqsWithCache err: ", err)
+		c.String(http.StatusServiceUnavailable, "Jobs are unavailable right now, please try again later")
+		return
+	}
+
+	sitemap := GoogleJobsSitemap{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	sitemap.URLs = append(sitemap.URLs, GoogleJobsSitemapURL{Loc: careersURL(company.ShortName), LastMod: time.Now().Format("2006-01-02")})
+	for _, jobReq := range jobReqs {
+		sitemap.URLs = append(sitemap.URLs, GoogleJobsSitemapURL{
+			Loc:     careersJobURL(company.ShortName, jobReq.JobReqAPIDetail.ID),
+			LastMod: jobReq.FeedPublishDate().Format("2006-01-02"),
+		})
+	}
+
+	body, err := encodeJobFeedXML(&sitemap)
+	if err != nil {
+		ErrorLog.Println("careersSitemapHandler encodeJobFeedXML err: ", err)
+		c.String(http.StatusInternalServerError, "Could not build sitemap")
+		return
+	}
+
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", body)
+}
+
+func renderCareersTemplate(c *gin.Context, templateToUse string, data interface{}) {
+	temp := templates.Lookup(templateToUse)
+	if temp == nil {
+		ErrorLog.Println("renderCareersTemplate missing template: ", templateToUse)
+		c.String(http.StatusInternalServerError, "Could not render page")
+		return
+	}
+
+	var tpl bytes.Buffer
+	if err := temp.Execute(&tpl, data); err != nil {
+		ErrorLog.Println("renderCareersTemplate execute err: ", err)
+		c.String(http.StatusInternalServerError, "Could not render page")
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", tpl.Bytes())
+}
+
+// Only companies with the jobs product turned on get a public careers page
+func lookupCareersCompany(shortname string) (Company, error) {
+	company, err := lookupCompanyByShortname(shortname)
+	if err != nil {
+		return company, err
+	}
+
+	if checkCompanyBlockedJobsFeeds(company.ID) {
+		return company, errors.New(fmt.Sprintf("company %s is blocked from job feeds", shortname))
+	}
+
+	jobsProd, err := getCompanyProductByURL(company.ID, JOBS_PRODUCT_URL)
+	if err != nil {
+		return company, err
+	}
+	if jobsProd.Enabled == nil || !*jobsProd.Enabled {
+		return company, errors.New(fmt.Sprintf("company %s does not have the jobs product enabled", shortname))
+	}
+
+	return company, nil
+}
+
+// Job feed runs keep this warm, a miss pulls the company's jobs from OP once however many
+// visitors are waiting. A failure or no jobs is cached briefly so a public page can't hammer OP.
+func getCareerJobReqsWithCache(company Company) ([]JobReqJoin, error) {
+	cacheKey := fmt.Sprintf("%s%s", company.ShortName, CACHENAME_COMPANY_CAREER_JOBS)
+
+	careerJobReqsMutex.Lock()
+	cachedInterface, found := cash.Get(cacheKey)
+	if found {
+		switch cached := cachedInterface.(type) {
+		case []JobReqJoin:
+			careerJobReqsMutex.Unlock()
+			return cached, nil
+		case error:
+			careerJobReqsMutex.Unlock()
+			return nil, cached
+		}
+	}
+
+	fetch, inFlight := careerJobReqsFetches[cacheKey]
+	if !inFlight {
+		fetch = &careerJobReqsFetch{done: make(chan struct{})}
+		careerJobReqsFetches[cacheKey] = fetch
+	}
+	careerJobReqsMutex.Unlock()
+
+	if inFlight {
+		<-fetch.done
+		return fetch.jobReqs, fetch.err
+	}
+
+	defer func() {
+		careerJobReqsMutex.Lock()
+		delete(careerJobReqsFetches, cacheKey)
+		careerJobReqsMutex.Unlock()
+		close(fetch.done)
+	}()
+
+	fetch.jobReqs, fetch.err = fetchCompanyJobReqs(false, company, nil)
+	if fetch.err != nil {
+		cash.Set(cacheKey, fetch.err, CAREERS_FAILURE_CACHE_EXPIRATION)
+		return fetch.jobReqs, fetch.err
+	}
+
+	lookupJobsPublishDates(fetch.jobReqs)
+
+	expiration := CAREERS_CACHE_EXPIRATION
+	if len(fetch.jobReqs) == 0 {
+		expiration = CAREERS_EMPTY_CACHE_EXPIRATION
+	}
+	cash.Set(cacheKey, fetch.jobReqs, expiration)
+
+	return fetch.jobReqs, nil
+}
+
+func cacheCareerJobReqs(companyJobsMap map[int64][]JobReqJoin) {
+	for _, jobReqs := range companyJobsMap {
+		if len(jobReqs) == 0 {
+			continue
+		}
+
+		cacheKey := fmt.Sprintf("%s%s", jobReqs[0].CompanyShortName, CACHENAME_COMPANY_CAREER_JOBS)
+		cash.Set(cacheKey, jobReqs, CAREERS_CACHE_EXPIRATION)
+	}
+}
+
+// Same dates the feeds publish, without touching current_job_reqs which only the feed run rewrites
+func lookupJobsPublishDates(jobs []JobReqJoin) {
+	for index := 0; index < len(jobs); index++ {
+		existingJob := CurrentJobReq{}
+		err := dbmap.SelectOne(&existingJob, "SELECT * FROM current_job_reqs WHERE op_id = ?", jobs[index].JobReqAPIDetail.ID)
+		if err != nil {
+			existingJob.OPID = int64(jobs[index].JobReqAPIDetail.ID)
+			existingJob.PublishDate = time.Now().Format("01/02/2006")
+			existingJob.CompanyOPID = jobs[index].CompanyOPID
+		}
+
+		jobs[index].PublishDateInfo = existingJob
+	}
+}
+
+func (jobReq *JobReqJoin) CareersLocation() string {
+	parts := []string{}
+	if jobReq.JobReqAPIDetail.Location.City != "" {
+		parts = append(parts, jobReq.JobReqAPIDetail.Location.City)
+	}
+	if jobReq.JobReqAPIDetail.Location.State != "" {
+		parts = append(parts, jobReq.JobReqAPIDetail.Location.State)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func careersURL(shortname string) string {
+	return fmt.Sprintf("%s/%s", CAREERS_BASE_URL, shortname)
+}
+
+func careersJobURL(shortname string, opJobID int) string {
+	return fmt.Sprintf("%s/%s/jobs/%d", CAREERS_BASE_URL, shortname, opJobID)
+}
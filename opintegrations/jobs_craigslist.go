@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var htmlTagRegexp = regexp.MustCompile(`<[^>]*>`)
+
+var craigslistCSVHeader = []string{
+	"Reference Number",
+	"Title",
+	"Company",
+	"City",
+	"State",
+	"Postal Code",
+	"Compensation",
+	"Employment Type",
+	"Description",
+	"Apply URL",
+	"Posted Date",
+}
+
+// Boards that take a flat file, one row per job with plain text descriptions
+type CraigslistFeedFormatter struct{}
+
+func (f *CraigslistFeedFormatter) IntegrationURL() string {
+	return CRAIGSLIST_INTEGRATION_URL
+}
+
+func (f *CraigslistFeedFormatter) Format(companyInts []CompanyIntegration, companyJobsMap map[int64][]JobReqJoin, buildDate time.Time) ([]JobFeedFile, error) {
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+
+	err := w.Write(craigslistCSVHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, jobReq := range companyIntsJobReqs(companyInts, companyJobsMap) {
+		pubDate := jobReq.FeedPublishDate()
+
+		err = w.Write([]string{
+			jobReq.FeedReferenceID(pubDate),
+			jobReq.JobReqAPIDetail.JobTitle,
+			jobReq.CompanyName,
+			jobReq.JobReqAPIDetail.Location.City,
+			jobReq.JobReqAPIDetail.Location.State,
+			jobReq.JobReqAPIDetail.Location.Zip,
+			jobReq.FeedPayText(),
+			zipRecruiterJobTypeMap(jobReq.JobReqAPIDetail.EmployeeType.Name),
+			stripHTMLForFeed(jobReq.JobReqAPIDetail.JobDescription),
+			jobReq.FeedJobURL("Craigslist"),
+			pubDate.Format("2006-01-02"),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+
+	return []JobFeedFile{{FileName: "craigslist.csv", Body: buf.Bytes()}}, nil
+}
+
+// OP job descriptions are HTML, flat file boards show them as typed
+func stripHTMLForFeed(description string) string {
+	description = strings.NewReplacer("<br>", "\n", "<br/>", "\n", "<br />", "\n", "</p>", "\n\n", "</li>", "\n").Replace(description)
+	description = htmlTagRegexp.ReplaceAllString(description, "")
+	description = strings.NewReplacer("&nbsp;", " ", "&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", "\"", "&#39;", "'").Replace(description)
+	return strings.TrimSpace(description)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"opapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The last job detail we pulled from OP for a req, lives next to CurrentJobReq but is not
+// truncated every run so the next run can skip refetching jobs that have not changed
+type JobReqSnapshot struct {
+	ID            int64  `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID     int64  `db:"company_id" json:"company_id"`
+	OPID          int64  `db:"op_id" json:"op_id"`
+	Title         string `db:"title" json:"title"`
+	BasicHash     string `db:"basic_hash" json:"basic_hash"`
+	ContentHash   string `db:"content_hash" json:"content_hash"`
+	Detail        string `db:"detail,size:65535" json:"-"`
+	DetailFetched int64  `db:"detail_fetched" json:"detail_fetched"`
+}
+
+type JobFeedDiffEntry struct {
+	ID         int64  `db:"id, primarykey, autoincrement" json:"id"`
+	RunStarted int64  `db:"run_started" json:"run_started"`
+	CompanyID  int64  `db:"company_id" json:"company_id"`
+	OPJobID    int64  `db:"op_job_id" json:"op_job_id"`
+	ChangeType string `db:"change_type" json:"change_type"`
+	Title      string `db:"title" json:"title"`
+}
+
+// What was last uploaded for a feed file, so an unchanged feed is not uploaded again
+type JobFeedUpload struct {
+	ID             int64  `db:"id, primarykey, autoincrement" json:"id"`
+	FileName       string `db:"file_name" json:"file_name"`
+	IntegrationURL string `db:"integration_url" json:"integration_url"`
+	ContentHash    string `db:"content_hash" json:"content_hash"`
+	BuildDate      int64  `db:"build_date" json:"build_date"`
+	Uploaded       int64  `db:"uploaded" json:"uploaded"`
+}
+
+// Collects the adds, removes and changes of one feed run. A nil diff means the caller
+// only wants jobs and must not move the snapshots, like the careers pages.
+type JobFeedDiff struct {
+	RunStarted int64
+	Entries    []JobFeedDiffEntry
+}
+
+const (
+	JOBFEEDCHANGE_ADDED   = "ADDED"
+	JOBFEEDCHANGE_REMOVED = "REMOVED"
+	JOBFEEDCHANGE_CHANGED = "CHANGED"
+
+	// the job list from OP doesn't tell us about every edit to a job, so details are refetched at least this often
+	JOB_DETAIL_MAX_AGE = 6 * time.Hour
+
+	JOB_FEED_DIFF_RETENTION_DAYS = 30
+)
+
+func getJobFeedDiffsHandler(c *gin.Context) {
+	err := isAdminUser(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	runStarted, _ := strconv.ParseInt(c.Query("run"), 10, 64)
+	if runStarted == 0 {
+		runStarted, err = dbmap.SelectInt("SELECT COALESCE(MAX(run_started), 0) FROM job_feed_diffs")
+		if err != nil {
+			ErrorLog.Println("getJobFeedDiffsHandler max run err: ", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+			return
+		}
+	}
+
+	entries := []JobFeedDiffEntry{}
+	_, err = dbmap.Select(&entries, "SELECT * FROM job_feed_diffs WHERE run_started = ? ORDER BY company_id, op_job_id", runStarted)
+	if err != nil {
+		ErrorLog.Println("getJobFeedDiffsHandler select err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"run_started": runStarted, "changes": entries})
+}
+
+func newJobFeedDiff() *JobFeedDiff {
+	return &JobFeedDiff{RunStarted: time.Now().Unix(), Entries: []JobFeedDiffEntry{}}
+}
+
+func (d *JobFeedDiff) Add(companyID, opJobID int64, changeType, title string) {
+	if d == nil {
+		return
+	}
+
+	d.Entries = append(d.Entries, JobFeedDiffEntry{
+		RunStarted: d.RunStarted,
+		CompanyID:  companyID,
+		OPJobID:    opJobID,
+		ChangeType: changeType,
+		Title:      title,
+	})
+}
+
+func (d *JobFeedDiff) Save() {
+	added, removed, changed := 0, 0, 0
+	for index := range d.Entries {
+		switch d.Entries[index].ChangeType {
+		case JOBFEEDCHANGE_ADDED:
+			added++
+		case JOBFEEDCHANGE_REMOVED:
+			removed++
+		case JOBFEEDCHANGE_CHANGED:
+			changed++
+		}
+
+		err := dbmap.Insert(&d.Entries[index])
+		if err != nil {
+			ErrorLog.Println("JobFeedDiff insert err: ", err)
+		}
+	}
+
+	InfoLog.Printf("job feed diff - added: %d, removed: %d, changed: %d\n", added, removed, changed)
+
+	cutoff := time.Now().AddDate(0, 0, -JOB_FEED_DIFF_RETENTION_DAYS).Unix()
+	_, err := dbmap.Exec("DELETE FROM job_feed_diffs WHERE run_started < ?", cutoff)
+	if err != nil {
+		ErrorLog.Println("JobFeedDiff prune err: ", err)
+	}
+}
+
+func getCompanyJobReqSnapshots(companyID int64) (map[int64]JobReqSnapshot, error) {
+	snapshots := []JobReqSnapshot{}
+	_, err := dbmap.Select(&snapshots, "SELECT * FROM job_req_snapshots WHERE company_id = ?", companyID)
+
+	snapshotsByOPID := make(map[int64]JobReqSnapshot)
+	for _, snapshot := range snapshots {
+		snapshotsByOPID[snapshot.OPID] = snapshot
+	}
+
+	return snapshotsByOPID, err
+}
+
+// Stored detail for the job if the job list says it hasn't changed and it isn't too old
+func (s *JobReqSnapshot) ReusableDetail(basicHash string, now time.Time) (opapi.JobReqDetail, bool) {
+	detail := opapi.JobReqDetail{}
+	if s.BasicHash != basicHash || s.Detail == "" || now.Sub(time.Unix(s.DetailFetched, 0)) > JOB_DETAIL_MAX_AGE {
+		return detail, false
+	}
+
+	err := json.Unmarshal([]byte(s.Detail), &detail)
+	if err != nil {
+		ErrorLog.Println("ReusableDetail unmarshal err: ", err)
+		return detail, false
+	}
+
+	return detail, true
+}
+
+// Records what changed against the previous snapshot and saves the new one
+func saveJobReqSnapshot(existing *JobReqSnapshot, companyID int64, basicHash string, detail opapi.JobReqDetail, diff *JobFeedDiff) {
+	detailb, err := json.Marshal(detail)
+	if err != nil {
+		ErrorLog.Println("saveJobReqSnapshot marshal err: ", err)
+		return
+	}
+
+	contentHash := hashJobFeedContent(detailb)
+
+	if existing == nil {
+		diff.Add(companyID, int64(detail.ID), JOBFEEDCHANGE_ADDED, detail.JobTitle)
+		existing = &JobReqSnapshot{CompanyID: companyID, OPID: int64(detail.ID)}
+	} else if existing.ContentHash != contentHash {
+		diff.Add(companyID, int64(detail.ID), JOBFEEDCHANGE_CHANGED, detail.JobTitle)
+	}
+
+	existing.Title = detail.JobTitle
+	existing.BasicHash = basicHash
+	existing.ContentHash = contentHash
+	existing.Detail = string(detailb)
+	existing.DetailFetched = time.Now().Unix()
+
+	if existing.ID == 0 {
+		err = dbmap.Insert(existing)
+	} else {
+		_, err = dbmap.Update(existing)
+	}
+	if err != nil {
+		ErrorLog.Println("saveJobReqSnapshot save err: ", err)
+	}
+}
+
+func removeJobReqSnapshot(snapshot JobReqSnapshot, diff *JobFeedDiff) {
+	diff.Add(snapshot.CompanyID, snapshot.OPID, JOBFEEDCHANGE_REMOVED, snapshot.Title)
+
+	_, err := dbmap.Delete(&snapshot)
+	if err != nil {
+		ErrorLog.Println("removeJobReqSnapshot delete err: ", err)
+	}
+}
+
+func hashJobReqBasic(jobReq opapi.JobReqBasic) string {
+	basicb, err := json.Marshal(jobReq)
+	if err != nil {
+		return ""
+	}
+	return hashJobFeedContent(basicb)
+}
+
+func hashJobFeedContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func getJobFeedUploads(integrationURL string) (map[string]JobFeedUpload, error) {
+	uploads := []JobFeedUpload{}
+	_, err := dbmap.Select(&uploads, "SELECT * FROM job_feed_uploads WHERE integration_url = ?", integrationURL)
+
+	uploadsByFileName := make(map[string]JobFeedUpload)
+	for _, upload := range uploads {
+		uploadsByFileName[upload.FileName] = upload
+	}
+
+	return uploadsByFileName, err
+}
+
+// The build date of what is currently uploaded, so rendering unchanged jobs gives identical bytes
+func jobFeedPreviousBuildDate(uploads map[string]JobFeedUpload) (time.Time, bool) {
+	for _, upload := range uploads {
+		if upload.BuildDate > 0 {
+			return time.Unix(upload.BuildDate, 0), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func jobFeedFilesUnchanged(feedFiles []JobFeedFile, uploads map[string]JobFeedUpload) bool {
+	if len(feedFiles) != len(uploads) {
+		return false
+	}
+
+	for _, feedFile := range feedFiles {
+		upload, found := uploads[feedFile.FileName]
+		if !found || upload.ContentHash != hashJobFeedContent(feedFile.Body) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func recordJobFeedUpload(integrationURL string, feedFile JobFeedFile, buildDate time.Time, existing map[string]JobFeedUpload) {
+	upload, found := existing[feedFile.FileName]
+	if !found {
+		upload = JobFeedUpload{FileName: feedFile.FileName, IntegrationURL: integrationURL}
+	}
+
+	upload.ContentHash = hashJobFeedContent(feedFile.Body)
+	upload.BuildDate = buildDate.Unix()
+	upload.Uploaded = time.Now().Unix()
+
+	var err error
+	if upload.ID == 0 {
+		err = dbmap.Insert(&upload)
+	} else {
+		_, err = dbmap.Update(&upload)
+	}
+	if err != nil {
+		ErrorLog.Println("recordJobFeedUpload save err: ", err)
+	}
+}
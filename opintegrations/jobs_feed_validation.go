@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A job we left out of a board's feed on the last run and why, or one that went with warnings
+type JobFeedExclusion struct {
+	ID             int64  `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID      int64  `db:"company_id" json:"company_id"`
+	IntegrationURL string `db:"integration_url" json:"integration_url"`
+	OPJobID        int64  `db:"op_job_id" json:"op_job_id"`
+	Title          string `db:"title" json:"title"`
+	Excluded       bool   `db:"excluded" json:"excluded"`
+	Reasons        string `db:"reasons,size:2000" json:"reasons"`
+	Warnings       string `db:"warnings,size:2000" json:"warnings"`
+	Checked        int64  `db:"checked" json:"checked"`
+}
+
+// Collects every reason a job would be rejected instead of stopping at the first,
+// warnings are for what the board would like to have but doesn't need
+type jobFeedCheck struct {
+	reasons  []string
+	warnings []string
+}
+
+const (
+	JOB_FEED_MAX_TITLE_LENGTH       = 200
+	JOB_FEED_MIN_DESCRIPTION_LENGTH = 50
+
+	INDEED_MAX_DESCRIPTION_LENGTH       = 50000
+	ZIPRECRUITER_MAX_DESCRIPTION_LENGTH = 50000
+	GLASSDOOR_MAX_DESCRIPTION_LENGTH    = 50000
+	LINKEDIN_MAX_DESCRIPTION_LENGTH     = 25000
+	GOOGLEJOBS_MAX_DESCRIPTION_LENGTH   = 50000
+	CRAIGSLIST_MAX_DESCRIPTION_LENGTH   = 10000
+)
+
+var (
+	zipRecruiterJobTypes         = []string{"Full-Time", "Part-Time", "Contractor", "Temporary", "Other"}
+	zipRecruiterExperienceLevels = []string{"entry", "mid", "senior"}
+	linkedInJobTypes             = []string{"FULL_TIME", "PART_TIME", "CONTRACT", "TEMPORARY", "OTHER"}
+	linkedInExperienceLevels     = []string{"ENTRY_LEVEL", "ASSOCIATE", "MID_SENIOR_LEVEL"}
+	opPayFrequencies             = []string{"YEAR", "MONTH", "WEEK", "DAY", "HOUR"}
+)
+
+func getJobFeedExclusionsHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	exclusions := []JobFeedExclusion{}
+	_, err = dbmap.Select(&exclusions, "SELECT * FROM job_feed_exclusions WHERE company_id = ? ORDER BY integration_url, op_job_id", thisCompany.ID)
+	if err != nil {
+		ErrorLog.Println("getJobFeedExclusionsHandler select err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, exclusions)
+}
+
+// Drops jobs the board would reject and replaces the board's stored exclusions and warnings with this run's
+func validJobFeedJobs(formatter JobFeedFormatter, companyInts []CompanyIntegration, companyJobsMap map[int64][]JobReqJoin) map[int64][]JobReqJoin {
+	validJobsMap := make(map[int64][]JobReqJoin)
+	exclusions := []JobFeedExclusion{}
+	now := time.Now().Unix()
+
+	for _, companyInt := range companyInts {
+		jobReqs, found := companyJobsMap[companyInt.CompanyID]
+		if !found {
+			continue
+		}
+
+		validJobs := []JobReqJoin{}
+		for _, jobReq := range jobReqs {
+			reasons, warnings := formatter.Validate(&jobReq)
+			if len(reasons) == 0 {
+				validJobs = append(validJobs, jobReq)
+				if len(warnings) == 0 {
+					continue
+				}
+			}
+
+			exclusions = append(exclusions, JobFeedExclusion{
+				CompanyID:      jobReq.CompanyID,
+				IntegrationURL: formatter.IntegrationURL(),
+				OPJobID:        int64(jobReq.JobReqAPIDetail.ID),
+				Title:          jobReq.JobReqAPIDetail.JobTitle,
+				Excluded:       len(reasons) > 0,
+				Reasons:        strings.Join(reasons, "; "),
+				Warnings:       strings.Join(warnings, "; "),
+				Checked:        now,
+			})
+		}
+
+		validJobsMap[companyInt.CompanyID] = validJobs
+	}
+
+	_, err := dbmap.Exec("DELETE FROM job_feed_exclusions WHERE integration_url = ?", formatter.IntegrationURL())
+	if err != nil {
+		ErrorLog.Println("validJobFeedJobs delete err: ", err)
+	}
+
+	for index := range exclusions {
+		err = dbmap.Insert(&exclusions[index])
+		if err != nil {
+			ErrorLog.Println("validJobFeedJobs insert err: ", err)
+		}
+	}
+
+	excluded := 0
+	for _, exclusion := range exclusions {
+		if exclusion.Excluded {
+			excluded++
+		}
+	}
+	if excluded > 0 {
+		InfoLog.Printf("%s feed excluded %d invalid jobs\n", formatter.IntegrationURL(), excluded)
+	}
+
+	return validJobsMap
+}
+
+func (f *IndeedFeedFormatter) Validate(jobReq *JobReqJoin) ([]string, []string) {
+	check := jobReq.commonFeedCheck("Indeed", INDEED_MAX_DESCRIPTION_LENGTH)
+	check.recommended("postal code", jobReq.JobReqAPIDetail.Location.Zip)
+	return check.reasons, check.warnings
+}
+
+func (f *ZiprecruiterFeedFormatter) Validate(jobReq *JobReqJoin) ([]string, []string) {
+	check := jobReq.commonFeedCheck("ZipRecruiter", ZIPRECRUITER_MAX_DESCRIPTION_LENGTH)
+	check.recommended("postal code", jobReq.JobReqAPIDetail.Location.Zip)
+
+	// a type of the client's own that doesn't map is left out of the feed, the job still goes
+	check.jobType(jobReq.JobReqAPIDetail.EmployeeType.Name, zipRecruiterJobTypeMap(jobReq.JobReqAPIDetail.EmployeeType.Name), zipRecruiterJobTypes)
+	if jobReq.JobReqAPIDetail.MinExperience != 0 || jobReq.JobReqAPIDetail.MaxExperience != 0 {
+		check.oneOf("experience level", zipRecruiterExperienceLevel(jobReq.JobReqAPIDetail.MinExperience, jobReq.JobReqAPIDetail.MaxExperience), zipRecruiterExperienceLevels, "")
+	}
+
+	return check.reasons, check.warnings
+}
+
+func (f *GlassdoorFeedFormatter) Validate(jobReq *JobReqJoin) ([]string, []string) {
+	check := jobReq.commonFeedCheck("Glassdoor", GLASSDOOR_MAX_DESCRIPTION_LENGTH)
+	return check.reasons, check.warnings
+}
+
+func (f *LinkedInFeedFormatter) Validate(jobReq *JobReqJoin) ([]string, []string) {
+	check := jobReq.commonFeedCheck("LinkedIn", LINKEDIN_MAX_DESCRIPTION_LENGTH)
+	check.jobType(jobReq.JobReqAPIDetail.EmployeeType.Name, linkedInJobTypeMap(jobReq.JobReqAPIDetail.EmployeeType.Name), linkedInJobTypes)
+	if jobReq.JobReqAPIDetail.MinExperience != 0 || jobReq.JobReqAPIDetail.MaxExperience != 0 {
+		check.oneOf("experience level", linkedInExperienceLevel(jobReq.JobReqAPIDetail.MinExperience, jobReq.JobReqAPIDetail.MaxExperience), linkedInExperienceLevels, "")
+	}
+	return check.reasons, check.warnings
+}
+
+func (f *GoogleJobsFeedFormatter) Validate(jobReq *JobReqJoin) ([]string, []string) {
+	check := jobReq.commonFeedCheck("Google", GOOGLEJOBS_MAX_DESCRIPTION_LENGTH)
+	return check.reasons, check.warnings
+}
+
+func (f *CraigslistFeedFormatter) Validate(jobReq *JobReqJoin) ([]string, []string) {
+	check := &jobFeedCheck{}
+	check.required("title", jobReq.JobReqAPIDetail.JobTitle)
+	check.maxLength("title", jobReq.JobReqAPIDetail.JobTitle, JOB_FEED_MAX_TITLE_LENGTH)
+	check.required("city", jobReq.JobReqAPIDetail.Location.City)
+	check.validURL("apply url", jobReq.FeedJobURL("Craigslist"))
+
+	// the flat file gets the plain text description without the apply link
+	description := stripHTMLForFeed(jobReq.JobReqAPIDetail.JobDescription)
+	check.required("description", description)
+	check.minLength("description", description, JOB_FEED_MIN_DESCRIPTION_LENGTH)
+	check.maxLength("description", description, CRAIGSLIST_MAX_DESCRIPTION_LENGTH)
+
+	check.payRange(jobReq)
+	return check.reasons, check.warnings
+}
+
+// What every board needs, the description is checked as sent, with the apply link added.
+// State and a longer description only help the listing so they're warnings.
+func (jobReq *JobReqJoin) commonFeedCheck(sourceTrackID string, maxDescriptionLength int) *jobFeedCheck {
+	check := &jobFeedCheck{}
+
+	check.required("title", jobReq.JobReqAPIDetail.JobTitle)
+	check.maxLength("title", jobReq.JobReqAPIDetail.JobTitle, JOB_FEED_MAX_TITLE_LENGTH)
+	check.required("company", jobReq.CompanyName)
+	check.required("city", jobReq.JobReqAPIDetail.Location.City)
+	check.recommended("state", jobReq.JobReqAPIDetail.Location.State)
+	check.validURL("apply url", jobReq.FeedJobURL(sourceTrackID))
+
+	plainDescription := stripHTMLForFeed(jobReq.JobReqAPIDetail.JobDescription)
+	check.required("description", plainDescription)
+	check.minLength("description", plainDescription, JOB_FEED_MIN_DESCRIPTION_LENGTH)
+	description := addApplyLinkToDescription(jobReq.JobReqAPIDetail.JobDescription, jobReq.CompanyShortName, fmt.Sprintf("%d", jobReq.JobReqAPIDetail.ID), sourceTrackID)
+	check.maxLength("description", description, maxDescriptionLength)
+
+	check.payRange(jobReq)
+
+	return check
+}
+
+func (c *jobFeedCheck) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		c.reasons = append(c.reasons, field+" is missing")
+	}
+}
+
+// The board takes it without, the listing just does worse
+func (c *jobFeedCheck) recommended(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		c.warnings = append(c.warnings, field+" is missing")
+	}
+}
+
+// A warning, a missing value is left to required
+func (c *jobFeedCheck) minLength(field, value string, min int) {
+	if value != "" && len([]rune(value)) < min {
+		c.warnings = append(c.warnings, fmt.Sprintf("%s is shorter than %d characters", field, min))
+	}
+}
+
+func (c *jobFeedCheck) maxLength(field, value string, max int) {
+	if len([]rune(value)) > max {
+		c.reasons = append(c.reasons, fmt.Sprintf("%s is longer than %d characters", field, max))
+	}
+}
+
+// opValue is what OP had, for a reason the client can act on
+func (c *jobFeedCheck) oneOf(field, value string, allowed []string, opValue string) {
+	for _, option := range allowed {
+		if value == option {
+			return
+		}
+	}
+
+	if opValue != "" {
+		c.reasons = append(c.reasons, fmt.Sprintf("%s %q is not one of %s", field, opValue, strings.Join(allowed, ", ")))
+	} else {
+		c.reasons = append(c.reasons, fmt.Sprintf("%s %q is not one of %s", field, value, strings.Join(allowed, ", ")))
+	}
+}
+
+// mapped is "" when the client's own type has no match, the feed leaves the type out
+func (c *jobFeedCheck) jobType(opJobType, mapped string, allowed []string) {
+	if opJobType != "" && mapped == "" {
+		c.warnings = append(c.warnings, fmt.Sprintf("job type %q is not one of %s and is left out", opJobType, strings.Join(allowed, ", ")))
+	}
+}
+
+func (c *jobFeedCheck) validURL(field, value string) {
+	parsed, err := url.ParseRequestURI(value)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" || strings.ContainsAny(value, " \t\n") {
+		c.reasons = append(c.reasons, fmt.Sprintf("%s %q is not a valid url", field, value))
+	}
+}
+
+func (c *jobFeedCheck) payRange(jobReq *JobReqJoin) {
+	detail := jobReq.JobReqAPIDetail
+	if detail.BasePayFrom == 0 && detail.BasePayTo == 0 {
+		return
+	}
+
+	if detail.BasePayFrom < 0 || detail.BasePayTo < 0 {
+		c.reasons = append(c.reasons, "pay is negative")
+	}
+	if detail.BasePayFrom != 0 && detail.BasePayTo != 0 && detail.BasePayFrom > detail.BasePayTo {
+		c.reasons = append(c.reasons, fmt.Sprintf("pay from %.2f is more than pay to %.2f", detail.BasePayFrom, detail.BasePayTo))
+	}
+
+	// without a frequency FeedPayRange leaves the pay out, the job still goes
+}
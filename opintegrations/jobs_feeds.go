@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// A job board we syndicate to. Companies opt into a board by enabling its company integration,
+// every board formats the same JobReqJoin data pulled once per run.
+// Validate returns why the board would reject a job, those jobs are left out of its feed,
+// and warnings for what it would rather have, those jobs still go.
+type JobFeedFormatter interface {
+	IntegrationURL() string
+	Validate(jobReq *JobReqJoin) (reasons []string, warnings []string)
+	Format(companyInts []CompanyIntegration, companyJobsMap map[int64][]JobReqJoin, buildDate time.Time) ([]JobFeedFile, error)
+}
+
+// FileName is the production name, "-test" is added before the extension outside production
+type JobFeedFile struct {
+	FileName string
+	Body     []byte
+}
+
+type JobBoardsUpdateRequest struct {
+	Boards []string `json:"boards"`
+}
+
+type JobBoardStatus struct {
+	IntegrationURL string `json:"url"`
+	Enabled        bool   `json:"enabled"`
+}
+
+const (
+	GLASSDOOR_INTEGRATION_URL  = "glassdoor"
+	LINKEDIN_INTEGRATION_URL   = "linkedin"
+	GOOGLEJOBS_INTEGRATION_URL = "googlejobs"
+	CRAIGSLIST_INTEGRATION_URL = "craigslist"
+
+	JOB_FEED_DATE_FORMAT = "Mon, 2 Jan 2006 15:04:05 MST"
+)
+
+// Feeds run and upload in this order
+var jobFeedFormatters = []JobFeedFormatter{
+	&IndeedFeedFormatter{},
+	&ZiprecruiterFeedFormatter{},
+	&GlassdoorFeedFormatter{},
+	&LinkedInFeedFormatter{},
+	&GoogleJobsFeedFormatter{},
+	&CraigslistFeedFormatter{},
+}
+
+func getJobFeedFormatter(integrationURL string) (JobFeedFormatter, error) {
+	for _, formatter := range jobFeedFormatters {
+		if formatter.IntegrationURL() == integrationURL {
+			return formatter, nil
+		}
+	}
+
+	return nil, errors.New(fmt.Sprintf("no job feed formatter for %s", integrationURL))
+}
+
+func getJobBoardsHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	c.JSON(http.StatusOK, getCompanyJobBoards(thisCompany.ID))
+}
+
+// Boards left out of the request are turned off, boards the company never had are added
+func updateJobBoardsHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	input := &JobBoardsUpdateRequest{}
+	if err := c.ShouldBindWith(input, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	wanted := make(map[string]bool)
+	for _, board := range input.Boards {
+		if _, err := getJobFeedFormatter(board); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown job board " + board})
+			return
+		}
+		wanted[board] = true
+	}
+
+	jobsProd, err := getCompanyProductByURL(thisCompany.ID, JOBS_PRODUCT_URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	for _, formatter := range jobFeedFormatters {
+		integrationURL := formatter.IntegrationURL()
+
+		ci, err := getCompanyIntegrationByIntegrationString(integrationURL, thisCompany.ID)
+		if err != nil {
+			if !wanted[integrationURL] {
+				continue
+			}
+
+			created, err := createCompanyIntegrationIfNotExists(jobsProd.ID, integrationURL, thisCompany.ID, nil)
+			if err != nil {
+				ErrorLog.Println("updateJobBoardsHandler createCompanyIntegrationIfNotExists err: ", err)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Could not add " + integrationURL})
+				return
+			}
+			ci = *created
+		}
+
+		if ci.Settings == nil {
+			ci.Settings = PropertyMap{}
+		}
+		ci.Settings["enabled"] = wanted[integrationURL]
+
+		_, err = dbmap.Update(&ci)
+		if err != nil {
+			ErrorLog.Println("updateJobBoardsHandler update err: ", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not update"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, getCompanyJobBoards(thisCompany.ID))
+}
+
+func getCompanyJobBoards(companyID int64) []JobBoardStatus {
+	boards := []JobBoardStatus{}
+	for _, formatter := range jobFeedFormatters {
+		status := JobBoardStatus{IntegrationURL: formatter.IntegrationURL()}
+
+		ci, err := getCompanyIntegrationByIntegrationString(formatter.IntegrationURL(), companyID)
+		if err == nil {
+			status.Enabled = checkIntegrationEnabled(ci)
+		}
+
+		boards = append(boards, status)
+	}
+	return boards
+}
+
+func runJobFeeds() {
+	boardCompanyInts := make(map[string][]CompanyIntegration)
+	allCompanyInts := []CompanyIntegration{}
+
+	for _, formatter := range jobFeedFormatters {
+		companyInts, err := getCompanyIntegrationsUsingIntegrationURL(formatter.IntegrationURL())
+		if err != nil {
+			// a board nobody has been set up for yet should not stop the others
+			ErrorLog.Printf("err getting %s companyIntegrations: %v\n", formatter.IntegrationURL(), err)
+			continue
+		}
+
+		enabledCompanyInts := []CompanyIntegration{}
+		for _, ci := range companyInts {
+			if !checkCompanyBlockedJobsFeeds(ci.CompanyID) && checkIntegrationEnabled(ci) {
+				enabledCompanyInts = append(enabledCompanyInts, ci)
+			}
+		}
+
+		boardCompanyInts[formatter.IntegrationURL()] = enabledCompanyInts
+		allCompanyInts = append(allCompanyInts, enabledCompanyInts...)
+
+		InfoLog.Printf("job feed %s: %d companies\n", formatter.IntegrationURL(), len(enabledCompanyInts))
+	}
+
+	// NOTE: if this is initial run, we need to fetch date created which requires
+	//       pulling an extra report per company
+	fromScratch, err := isStartingFromScratch()
+
+	diff := newJobFeedDiff()
+
+	allJobReqs, err := fetchAllJobReqs(fromScratch, allCompanyInts, diff)
+	if err != nil {
+		ErrorLog.Printf("JOB FEEDS STOPPED: fetchAllJobReqs err: %v\n", err)
+		return
+	}
+
+	err = findAndSetJobsPublishDates(fromScratch, allJobReqs)
+	if err != nil {
+		ErrorLog.Printf("JOB FEEDS STOPPED: findAndSetJobsPublishDates err: %v\n", err)
+		return
+	}
+
+	diff.Save()
+
+	companyJobsMap := putJobsInMapByCompanyID(allJobReqs)
+
+	cacheCareerJobReqs(companyJobsMap)
+
+	for _, formatter := range jobFeedFormatters {
+		companyInts, found := boardCompanyInts[formatter.IntegrationURL()]
+		if !found {
+			continue
+		}
+
+		InfoLog.Printf("starting %s transformation & upload\n", formatter.IntegrationURL())
+
+		err = formatAndUploadJobFeed(formatter, companyInts, companyJobsMap)
+		if err != nil {
+			ErrorLog.Printf("%s FEED STOPPED: %v\n", strings.ToUpper(formatter.IntegrationURL()), err)
+		}
+	}
+
+	InfoLog.Printf("jobsite uploads finished\n")
+}
+
+// Renders with the build date of what was last uploaded first, if that comes out byte-identical
+// nothing changed for this board and the upload is skipped
+func formatAndUploadJobFeed(formatter JobFeedFormatter, companyInts []CompanyIntegration, companyJobsMap map[int64][]JobReqJoin) error {
+	companyJobsMap = validJobFeedJobs(formatter, companyInts, companyJobsMap)
+
+	uploads, err := getJobFeedUploads(formatter.IntegrationURL())
+	if err != nil {
+		ErrorLog.Println("formatAndUploadJobFeed getJobFeedUploads err: ", err)
+	}
+
+	previousBuildDate, hasPrevious := jobFeedPreviousBuildDate(uploads)
+	if hasPrevious {
+		feedFiles, err := formatter.Format(companyInts, companyJobsMap, previousBuildDate)
+		if err != nil {
+			return errors.New("Format err: " + err.Error())
+		}
+
+		if jobFeedFilesUnchanged(feedFiles, uploads) {
+			InfoLog.Printf("%s feed unchanged, skipping upload\n", formatter.IntegrationURL())
+			return nil
+		}
+	}
+
+	buildDate := time.Now()
+	feedFiles, err := formatter.Format(companyInts, companyJobsMap, buildDate)
+	if err != nil {
+		return errors.New("Format err: " + err.Error())
+	}
+
+	for _, feedFile := range feedFiles {
+		err = uploadJobFeed(feedFile, INDEED_FEED_BUCKET_NAME)
+		if err != nil {
+			ErrorLog.Printf("%s FEED UPLOAD FAILED (%s): %v\n", strings.ToUpper(formatter.IntegrationURL()), feedFile.FileName, err)
+			continue
+		}
+
+		recordJobFeedUpload(formatter.IntegrationURL(), feedFile, buildDate, uploads)
+	}
+
+	return nil
+}
+
+func uploadJobFeed(feedFile JobFeedFile, gcpBucketName string) error {
+	fileName := jobFeedEnvFileName(feedFile.FileName)
+
+	absPath := fmt.Sprintf("/etc/opintegrations/jobfiles/%s", fileName)
+	if !env.Production {
+		absPath, _ = filepath.Abs(fmt.Sprintf("./opintegrations/jobfiles/%s", fileName))
+	}
+
+	jobFile, err := os.Create(absPath)
+	if err != nil {
+		return errors.New(fmt.Sprintf("err creating file: %v\n", err))
+	}
+	defer jobFile.Close()
+
+	_, err = jobFile.Write(feedFile.Body)
+	if err != nil {
+		return errors.New(fmt.Sprintf("err writing file: %v\n", err))
+	}
+
+	jobFileOpen, err := os.Open(absPath)
+	if err != nil {
+		return errors.New(fmt.Sprintf("err OPENING file: %v\n", err))
+	}
+	defer jobFileOpen.Close()
+
+	err = uploadFileGCM(gcpBucketName, fileName, jobFileOpen)
+	if err != nil {
+		return errors.New(fmt.Sprintf("err uploadFile: %v\n", err))
+	}
+
+	return nil
+}
+
+// allclients.xml -> allclients-test.xml outside of production
+func jobFeedEnvFileName(fileName string) string {
+	if env.Production {
+		return fileName
+	}
+
+	ext := filepath.Ext(fileName)
+	return strings.TrimSuffix(fileName, ext) + "-test" + ext
+}
+
+func encodeJobFeedXML(jobFeedXMLStruct interface{}) ([]byte, error) {
+	buf := bytes.NewBufferString(xml.Header)
+
+	enc := xml.NewEncoder(buf)
+	enc.Indent("  ", "    ")
+	if err := enc.Encode(jobFeedXMLStruct); err != nil {
+		return nil, errors.New(fmt.Sprintf("Encode error: %v\n", err))
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (jobReq *JobReqJoin) FeedPublishDate() time.Time {
+	pubDate, err := time.Parse("01/02/2006", jobReq.PublishDateInfo.PublishDate)
+	if err != nil {
+		ErrorLog.Printf("err parsing pubDate (%s) from OP: %+v", jobReq.PublishDateInfo.PublishDate, err)
+		pubDate = time.Now()
+	}
+	return pubDate
+}
+
+// Boards dedupe on this, it changes when a job is republished
+func (jobReq *JobReqJoin) FeedReferenceID(pubDate time.Time) string {
+	return fmt.Sprintf("%d%s", jobReq.JobReqAPIDetail.ID, pubDate.Format("010206"))
+}
+
+func (jobReq *JobReqJoin) FeedJobURL(sourceTrackID string) string {
+	return fmt.Sprintf("https://secure.onehcm.com/ta/%s.jobs?ShowJob=%s&TrackId=%s", jobReq.CompanyShortName, strconv.Itoa(jobReq.JobReqAPIDetail.ID), sourceTrackID)
+}
+
+// "" when OP has no pay for the job, or no period to say it's per, which no board takes
+func (jobReq *JobReqJoin) FeedPayRange() (string, string) {
+	payFrom, payTo := "", ""
+	if jobReq.FeedPayFrequency() == "" {
+		return payFrom, payTo
+	}
+	if jobReq.JobReqAPIDetail.BasePayFrom != 0 {
+		payFrom = strconv.FormatFloat(jobReq.JobReqAPIDetail.BasePayFrom, 'f', 2, 64)
+	}
+	if jobReq.JobReqAPIDetail.BasePayTo != 0 {
+		payTo = strconv.FormatFloat(jobReq.JobReqAPIDetail.BasePayTo, 'f', 2, 64)
+	}
+	return payFrom, payTo
+}
+
+// "$15.00 - $18.00 per hour", "" when OP has no pay for the job
+func (jobReq *JobReqJoin) FeedPayText() string {
+	payText := ""
+	payFrom, payTo := jobReq.FeedPayRange()
+	if payFrom != "" && payTo != "" && payFrom != payTo {
+		payText = "$" + payFrom + " - $" + payTo
+	} else if payFrom != "" {
+		payText = "$" + payFrom
+	} else if payTo != "" {
+		payText = "$" + payTo
+	}
+
+	if payText != "" {
+		payText = payText + " per " + strings.ToLower(jobReq.FeedPayFrequency())
+	}
+
+	return payText
+}
+
+// OP's pay frequency, "" when it isn't one we know
+func (jobReq *JobReqJoin) FeedPayFrequency() string {
+	for _, frequency := range opPayFrequencies {
+		if jobReq.JobReqAPIDetail.BasePayFrequency == frequency {
+			return frequency
+		}
+	}
+	return ""
+}
+
+// Country is not always filled in by OP, all our clients are US
+func (jobReq *JobReqJoin) FeedCountry() string {
+	if jobReq.JobReqAPIDetail.Location.Country == "" {
+		return "US"
+	}
+	return jobReq.JobReqAPIDetail.Location.Country
+}
+
+func companyIntsJobReqs(companyInts []CompanyIntegration, companyJobsMap map[int64][]JobReqJoin) []JobReqJoin {
+	jobReqs := []JobReqJoin{}
+	for _, companyInt := range companyInts {
+		companyJobReqs, found := companyJobsMap[companyInt.CompanyID]
+		if !found {
+			continue
+		}
+		jobReqs = append(jobReqs, companyJobReqs...)
+	}
+	return jobReqs
+}
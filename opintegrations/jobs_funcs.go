@@ -49,7 +49,7 @@ type CurrentJobReq struct {
 	PublishDate string `db:"publish_date" json:"publish_date"`
 }
 
-func fetchAllJobReqs(fromScratch bool, companyIntegrations []CompanyIntegration) ([]JobReqJoin, error) {
+func fetchAllJobReqs(fromScratch bool, companyIntegrations []CompanyIntegration, diff *JobFeedDiff) ([]JobReqJoin, error) {
 	allJoinedJobReqs := []JobReqJoin{}
 	fetchedCompanies := make(map[int64]bool)
 
@@ -65,69 +65,114 @@ func fetchAllJobReqs(fromScratch bool, companyIntegrations []CompanyIntegration)
 
 		company, _ := lookupCompanyByID(companyInt.CompanyID)
 
-		opCxn := chooseOPAPICxn(company.OPID)
+		companyJobReqs, err := fetchCompanyJobReqs(fromScratch, company, diff)
+		if err != nil {
+			ErrorLog.Println(err)
+			continue
+		}
 
-		jobsProd, _ := getCompanyProductByURL(company.ID, "jobs")
-		emailStr, _ := jobsProd.Settings["contact_email"].(string)
+		allJoinedJobReqs = append(allJoinedJobReqs, companyJobReqs...)
 
-		jrj := JobReqJoin{
-			CompanyName:      company.Name,
-			CompanyShortName: company.ShortName,
-			ContactEmail:     emailStr,
-			CompanyID:        company.ID,
-			CompanyOPID:      company.OPID,
-		}
+		successfulJobs += len(companyJobReqs)
+		successfulCompanies++
+	}
+
+	InfoLog.Printf("done fetching - successful company fetches: %v, jobs: %v\n", successfulCompanies, successfulJobs)
+
+	return allJoinedJobReqs, nil
+}
 
-		// NOTE: retries needed because OP API sometimes fails for no reason
-		jobReqBasics, err := fetchCompanyJobsWithRetries(1, opCxn, company.ShortName)
+// Only jobs whose listing changed, or whose stored detail is too old, are fetched from OP again
+func fetchCompanyJobReqs(fromScratch bool, company Company, diff *JobFeedDiff) ([]JobReqJoin, error) {
+	joinedJobReqs := []JobReqJoin{}
+
+	opCxn := chooseOPAPICxn(company.OPID)
+
+	jobsProd, _ := getCompanyProductByURL(company.ID, "jobs")
+	emailStr, _ := jobsProd.Settings["contact_email"].(string)
+
+	jrj := JobReqJoin{
+		CompanyName:      company.Name,
+		CompanyShortName: company.ShortName,
+		ContactEmail:     emailStr,
+		CompanyID:        company.ID,
+		CompanyOPID:      company.OPID,
+	}
+
+	// NOTE: retries needed because OP API sometimes fails for no reason
+	jobReqBasics, err := fetchCompanyJobsWithRetries(1, opCxn, company.ShortName)
+	if err != nil {
+		return joinedJobReqs, errors.New(fmt.Sprintf("err fetchCompanyJobsWithRetries. company: %s, err: %v", company.ShortName, err))
+	}
+
+	// NOTE: needed because the API endpoint does not give date created,
+	// but indeed requires it
+	opIDtoDateCreatedMap := make(map[string]string)
+	if fromScratch {
+		jobReqsFromReport, err := fetchCompanyJobsFromReport(opCxn, company.ShortName)
 		if err != nil {
-			ErrorLog.Printf("err fetchCompanyJobsWithRetries. company: %s, err: %v\n", company.ShortName, err)
-			continue
+			return joinedJobReqs, errors.New(fmt.Sprintf("err fetchCompanyJobsFromReport company jobs. company: %s, err: %v", company.ShortName, err))
 		}
 
-		// NOTE: needed because the API endpoint does not give date created,
-		// but indeed requires it
-		opIDtoDateCreatedMap := make(map[string]string)
-		if fromScratch {
-			jobReqsFromReport, err := fetchCompanyJobsFromReport(opCxn, company.ShortName)
-			if err != nil {
-				ErrorLog.Printf("err fetchCompanyJobsFromReport company jobs. company: %s, err: %v\n", company.ShortName, err)
-				continue
-			}
+		opIDtoDateCreatedMap = generateJobIDtoDateCreatedMap(jobReqsFromReport)
+	}
 
-			opIDtoDateCreatedMap = generateJobIDtoDateCreatedMap(jobReqsFromReport)
-		}
+	snapshots, err := getCompanyJobReqSnapshots(company.ID)
+	if err != nil {
+		ErrorLog.Printf("err getCompanyJobReqSnapshots, refetching everything. company: %s, err: %v\n", company.ShortName, err)
+	}
+
+	now := time.Now()
+	fetchedDetails := 0
+	for _, jobReq := range jobReqBasics {
+		snapshot, hasSnapshot := snapshots[int64(jobReq.ID)]
+		delete(snapshots, int64(jobReq.ID))
+
+		basicHash := hashJobReqBasic(jobReq)
 
-		for _, jobReq := range jobReqBasics {
+		jobReqDetail, reused := snapshot.ReusableDetail(basicHash, now)
+		if !reused {
 			// NOTE: retries needed because OP API sometimes fails for no reason
-			jobReqDetail, err := fetchJobDetailWithRetries(1, opCxn, company.ShortName, strconv.Itoa(jobReq.ID))
+			jobReqDetail, err = fetchJobDetailWithRetries(1, opCxn, company.ShortName, strconv.Itoa(jobReq.ID))
 			if err != nil {
 				ErrorLog.Printf("err fetching job detail. company: %s, jobreqid: %v, err: %v\n", company.ShortName, strconv.Itoa(jobReq.ID), err)
 				continue
 			}
+			fetchedDetails++
 
-			if fromScratch {
-				dateCreated, ok := opIDtoDateCreatedMap[strconv.Itoa(jobReq.ID)]
-				if ok {
-					jrj.DateCreatedOPFormat = dateCreated
+			if diff != nil {
+				if hasSnapshot {
+					saveJobReqSnapshot(&snapshot, company.ID, basicHash, jobReqDetail, diff)
+				} else {
+					saveJobReqSnapshot(nil, company.ID, basicHash, jobReqDetail, diff)
 				}
 			}
+		}
 
-			jrj.JobReqAPIDetail = jobReqDetail
-			jrj.JobReqAPIBasic = jobReq
-			allJoinedJobReqs = append(allJoinedJobReqs, jrj)
+		if fromScratch {
+			dateCreated, ok := opIDtoDateCreatedMap[strconv.Itoa(jobReq.ID)]
+			if ok {
+				jrj.DateCreatedOPFormat = dateCreated
+			}
+		}
 
-			jrj.DateCreatedOPFormat = ""
+		jrj.JobReqAPIDetail = jobReqDetail
+		jrj.JobReqAPIBasic = jobReq
+		joinedJobReqs = append(joinedJobReqs, jrj)
 
-			successfulJobs++
-		}
+		jrj.DateCreatedOPFormat = ""
+	}
 
-		successfulCompanies++
+	// anything left was in the last run but OP no longer lists it
+	if diff != nil {
+		for _, snapshot := range snapshots {
+			removeJobReqSnapshot(snapshot, diff)
+		}
 	}
 
-	InfoLog.Printf("done fetching - successful company fetches: %v, jobs: %v\n", successfulCompanies, successfulJobs)
+	InfoLog.Printf("%s job details fetched: %d of %d\n", company.ShortName, fetchedDetails, len(jobReqBasics))
 
-	return allJoinedJobReqs, nil
+	return joinedJobReqs, nil
 }
 
 func findAndSetJobsPublishDates(fromScratch bool, jobs []JobReqJoin) error {
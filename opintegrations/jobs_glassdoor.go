@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type GlassdoorXMLSource struct {
+	XMLName       xml.Name `xml:"source"`
+	Publisher     string   `xml:"publisher"`
+	PublisherURL  string   `xml:"publisherurl"`
+	LastBuildDate string   `xml:"lastbuilddate"`
+	Jobs          []GlassdoorXMLJob
+}
+
+type GlassdoorXMLJob struct {
+	XMLName         xml.Name       `xml:"job"`
+	Title           GlassdoorCDATA `xml:"title"`
+	Date            GlassdoorCDATA `xml:"date"`
+	ReferenceNumber GlassdoorCDATA `xml:"referencenumber"`
+	URL             GlassdoorCDATA `xml:"url"`
+	Company         GlassdoorCDATA `xml:"company"`
+	City            GlassdoorCDATA `xml:"city"`
+	State           GlassdoorCDATA `xml:"state"`
+	Country         GlassdoorCDATA `xml:"country"`
+	PostalCode      GlassdoorCDATA `xml:"postalcode"`
+	Description     GlassdoorCDATA `xml:"description"`
+	JobType         GlassdoorCDATA `xml:"jobtype"`
+	Category        GlassdoorCDATA `xml:"category"`
+	SalaryMin       GlassdoorCDATA `xml:"salarymin"`
+	SalaryMax       GlassdoorCDATA `xml:"salarymax"`
+	SalaryPeriod    GlassdoorCDATA `xml:"salaryperiod"`
+}
+
+type GlassdoorCDATA struct {
+	Text string `xml:",cdata"`
+}
+
+// Glassdoor takes the same shape of feed as Indeed, without Indeed Apply or sponsorship
+type GlassdoorFeedFormatter struct{}
+
+func (f *GlassdoorFeedFormatter) IntegrationURL() string {
+	return GLASSDOOR_INTEGRATION_URL
+}
+
+func (f *GlassdoorFeedFormatter) Format(companyInts []CompanyIntegration, companyJobsMap map[int64][]JobReqJoin, buildDate time.Time) ([]JobFeedFile, error) {
+	source := GlassdoorXMLSource{
+		Publisher:     "OnePoint HCM",
+		PublisherURL:  "https://onepointhcm.com",
+		LastBuildDate: buildDate.Format(JOB_FEED_DATE_FORMAT),
+	}
+
+	for _, jobReq := range companyIntsJobReqs(companyInts, companyJobsMap) {
+		pubDate := jobReq.FeedPublishDate()
+		payFrom, payTo := jobReq.FeedPayRange()
+
+		salaryPeriod := ""
+		if payFrom != "" || payTo != "" {
+			salaryPeriod = strings.ToLower(jobReq.JobReqAPIDetail.BasePayFrequency)
+		}
+
+		gJob := GlassdoorXMLJob{
+			Title:           GlassdoorCDATA{Text: jobReq.JobReqAPIDetail.JobTitle},
+			Date:            GlassdoorCDATA{Text: pubDate.Format(JOB_FEED_DATE_FORMAT)},
+			ReferenceNumber: GlassdoorCDATA{Text: jobReq.FeedReferenceID(pubDate)},
+			URL:             GlassdoorCDATA{Text: jobReq.FeedJobURL("Glassdoor")},
+			Company:         GlassdoorCDATA{Text: jobReq.CompanyName},
+			City:            GlassdoorCDATA{Text: jobReq.JobReqAPIDetail.Location.City},
+			State:           GlassdoorCDATA{Text: jobReq.JobReqAPIDetail.Location.State},
+			Country:         GlassdoorCDATA{Text: jobReq.FeedCountry()},
+			PostalCode:      GlassdoorCDATA{Text: jobReq.JobReqAPIDetail.Location.Zip},
+			Description:     GlassdoorCDATA{Text: addApplyLinkToDescription(jobReq.JobReqAPIDetail.JobDescription, jobReq.CompanyShortName, fmt.Sprintf("%d", jobReq.JobReqAPIDetail.ID), "Glassdoor")},
+			JobType:         GlassdoorCDATA{Text: zipRecruiterJobTypeMap(jobReq.JobReqAPIDetail.EmployeeType.Name)},
+			Category:        GlassdoorCDATA{Text: strings.Join(jobReq.JobReqAPIDetail.JobCategories, ", ")},
+			SalaryMin:       GlassdoorCDATA{Text: payFrom},
+			SalaryMax:       GlassdoorCDATA{Text: payTo},
+			SalaryPeriod:    GlassdoorCDATA{Text: salaryPeriod},
+		}
+
+		source.Jobs = append(source.Jobs, gJob)
+	}
+
+	body, err := encodeJobFeedXML(&source)
+	if err != nil {
+		return nil, err
+	}
+
+	return []JobFeedFile{{FileName: "glassdoor.xml", Body: body}}, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// see https://developers.google.com/search/docs/appearance/structured-data/job-posting
+
+type GoogleJobPosting struct {
+	Context            string                   `json:"@context"`
+	Type               string                   `json:"@type"`
+	Title              string                   `json:"title"`
+	Description        string                   `json:"description"`
+	DatePosted         string                   `json:"datePosted"`
+	URL                string                   `json:"url"`
+	EmploymentType     string                   `json:"employmentType,omitempty"`
+	Identifier         GoogleJobIdentifier      `json:"identifier"`
+	HiringOrganization GoogleJobOrganization    `json:"hiringOrganization"`
+	JobLocation        GoogleJobPlace           `json:"jobLocation"`
+	BaseSalary         *GoogleJobMonetaryAmount `json:"baseSalary,omitempty"`
+}
+
+type GoogleJobIdentifier struct {
+	Type  string `json:"@type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type GoogleJobOrganization struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+type GoogleJobPlace struct {
+	Type    string `json:"@type"`
+	Address struct {
+		Type            string `json:"@type"`
+		AddressLocality string `json:"addressLocality"`
+		AddressRegion   string `json:"addressRegion"`
+		PostalCode      string `json:"postalCode"`
+		AddressCountry  string `json:"addressCountry"`
+	} `json:"address"`
+}
+
+type GoogleJobMonetaryAmount struct {
+	Type     string `json:"@type"`
+	Currency string `json:"currency"`
+	Value    struct {
+		Type     string  `json:"@type"`
+		MinValue float64 `json:"minValue,omitempty"`
+		MaxValue float64 `json:"maxValue,omitempty"`
+		UnitText string  `json:"unitText"`
+	} `json:"value"`
+}
+
+type GoogleJobsSitemap struct {
+	XMLName xml.Name               `xml:"urlset"`
+	XMLNS   string                 `xml:"xmlns,attr"`
+	URLs    []GoogleJobsSitemapURL `xml:"url"`
+}
+
+type GoogleJobsSitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// Google crawls for jobs rather than taking a feed, so this publishes the JobPosting
+// JSON-LD for every job along with a sitemap pointing the crawler at each job's careers
+// page, which is where the same JobPosting markup is
+type GoogleJobsFeedFormatter struct{}
+
+func (f *GoogleJobsFeedFormatter) IntegrationURL() string {
+	return GOOGLEJOBS_INTEGRATION_URL
+}
+
+func (f *GoogleJobsFeedFormatter) Format(companyInts []CompanyIntegration, companyJobsMap map[int64][]JobReqJoin, buildDate time.Time) ([]JobFeedFile, error) {
+	postings := []GoogleJobPosting{}
+	sitemap := GoogleJobsSitemap{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+
+	for _, jobReq := range companyIntsJobReqs(companyInts, companyJobsMap) {
+		posting := jobReq.ToGoogleJobPosting("Google")
+		posting.URL = careersJobURL(jobReq.CompanyShortName, jobReq.JobReqAPIDetail.ID)
+		postings = append(postings, posting)
+
+		sitemap.URLs = append(sitemap.URLs, GoogleJobsSitemapURL{Loc: posting.URL, LastMod: posting.DatePosted})
+	}
+
+	postingsBody, err := json.MarshalIndent(postings, "", "  ")
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("json encode error: %v\n", err))
+	}
+
+	sitemapBody, err := encodeJobFeedXML(&sitemap)
+	if err != nil {
+		return nil, err
+	}
+
+	return []JobFeedFile{
+		{FileName: "googlejobs.json", Body: postingsBody},
+		{FileName: "googlejobs-sitemap.xml", Body: sitemapBody},
+	}, nil
+}
+
+func (jobReq *JobReqJoin) ToGoogleJobPosting(sourceTrackID string) GoogleJobPosting {
+	pubDate := jobReq.FeedPublishDate()
+
+	posting := GoogleJobPosting{
+		Context:        "https://schema.org/",
+		Type:           "JobPosting",
+		Title:          jobReq.JobReqAPIDetail.JobTitle,
+		Description:    jobReq.JobReqAPIDetail.JobDescription,
+		DatePosted:     pubDate.Format("2006-01-02"),
+		URL:            jobReq.FeedJobURL(sourceTrackID),
+		EmploymentType: googleJobsEmploymentType(jobReq.JobReqAPIDetail.EmployeeType.Name),
+		Identifier:     GoogleJobIdentifier{Type: "PropertyValue", Name: jobReq.CompanyName, Value: jobReq.FeedReferenceID(pubDate)},
+		HiringOrganization: GoogleJobOrganization{
+			Type: "Organization",
+			Name: jobReq.CompanyName,
+		},
+	}
+
+	posting.JobLocation.Type = "Place"
+	posting.JobLocation.Address.Type = "PostalAddress"
+	posting.JobLocation.Address.AddressLocality = jobReq.JobReqAPIDetail.Location.City
+	posting.JobLocation.Address.AddressRegion = jobReq.JobReqAPIDetail.Location.State
+	posting.JobLocation.Address.PostalCode = jobReq.JobReqAPIDetail.Location.Zip
+	posting.JobLocation.Address.AddressCountry = jobReq.FeedCountry()
+
+	unitText := ""
+	switch jobReq.JobReqAPIDetail.BasePayFrequency {
+	case "YEAR", "MONTH", "WEEK", "HOUR":
+		unitText = jobReq.JobReqAPIDetail.BasePayFrequency
+	}
+
+	if unitText != "" && (jobReq.JobReqAPIDetail.BasePayFrom != 0 || jobReq.JobReqAPIDetail.BasePayTo != 0) {
+		salary := &GoogleJobMonetaryAmount{Type: "MonetaryAmount", Currency: "USD"}
+		salary.Value.Type = "QuantitativeValue"
+		salary.Value.MinValue = jobReq.JobReqAPIDetail.BasePayFrom
+		salary.Value.MaxValue = jobReq.JobReqAPIDetail.BasePayTo
+		salary.Value.UnitText = unitText
+		posting.BaseSalary = salary
+	}
+
+	return posting
+}
+
+// Google TYPES: FULL_TIME, PART_TIME, CONTRACTOR, TEMPORARY, OTHER
+func googleJobsEmploymentType(opJobType string) string {
+	switch zipRecruiterJobTypeMap(opJobType) {
+	case "Full-Time":
+		return "FULL_TIME"
+	case "Part-Time":
+		return "PART_TIME"
+	case "Contractor":
+		return "CONTRACTOR"
+	case "Temporary":
+		return "TEMPORARY"
+	}
+	return ""
+}
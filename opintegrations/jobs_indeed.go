@@ -1,12 +1,8 @@
 package main
 
 import (
-	"encoding/xml"
-	"errors"
 	"fmt"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -39,153 +35,65 @@ func checkCompanyBlockedJobsFeeds(companyID int64) bool {
 	return false
 }
 
-func runIndeedFeed() {
-	indeedCompanyIntegrations, err := getCompanyIntegrationsUsingIntegrationURL(INDEED_INTEGRATION_URL)
-	if err != nil {
-		ErrorLog.Printf("err getting INDEED companyIntegrations: %v\n", err)
-		return
-	}
-
-	indeedEnabledCompanyIntegrations := []CompanyIntegration{}
-	for _, ci := range indeedCompanyIntegrations {
-		if !checkCompanyBlockedJobsFeeds(ci.CompanyID) && checkIntegrationEnabled(ci) {
-			indeedEnabledCompanyIntegrations = append(indeedEnabledCompanyIntegrations, ci)
-		}
-	}
-
-	zipRecruiterCompanyIntegrations, err := getCompanyIntegrationsUsingIntegrationURL(ZIPRECRUITER_INTEGRATION_URL)
-	if err != nil {
-		ErrorLog.Printf("err getting ZIPRECRUITER companyIntegrations: %v\n", err)
-		return
-	}
-
-	zipRecruiterEnabledCompanyIntegrations := []CompanyIntegration{}
-	for _, ci := range zipRecruiterCompanyIntegrations {
-		if !checkCompanyBlockedJobsFeeds(ci.CompanyID) && checkIntegrationEnabled(ci) {
-			zipRecruiterEnabledCompanyIntegrations = append(zipRecruiterEnabledCompanyIntegrations, ci)
-		}
-	}
-
-	InfoLog.Printf("starting job feed fetch - indeed: %d, ziprecruiter: %d\n", len(indeedEnabledCompanyIntegrations), len(zipRecruiterEnabledCompanyIntegrations))
-
-	// NOTE: if this is initial run, we need to fetch date created which requires
-	//       pulling an extra report per company
-	fromScratch, err := isStartingFromScratch()
-
-	allJobReqs, err := fetchAllJobReqs(fromScratch, append(indeedEnabledCompanyIntegrations, zipRecruiterEnabledCompanyIntegrations...))
-	if err != nil {
-		ErrorLog.Printf("INDEED FEED STOPPED: fetchAllJobReqs err: %v\n", err)
-		return
-	}
-
-	err = findAndSetJobsPublishDates(fromScratch, allJobReqs)
-	if err != nil {
-		ErrorLog.Printf("INDEED FEED STOPPED: findAndSetJobsPublishDates err: %v\n", err)
-		return
-	}
-
-	companyJobsMap := putJobsInMapByCompanyID(allJobReqs)
-
-	InfoLog.Printf("starting indeed transformation & upload\n")
-
-	indeedReadyStruct, err := jobReqDetailToIndeedFormat(indeedEnabledCompanyIntegrations, companyJobsMap)
-	if err != nil {
-		ErrorLog.Printf("INDEED FEED STOPPED: jobReqDetailToIndeedFormat err: %v\n", err)
-		return
-	}
-
-	indeedFileName := "allclients.xml"
-	if !env.Production {
-		indeedFileName = "allclients-test.xml"
-	}
-
-	err = uploadJobFeed(indeedReadyStruct, indeedFileName, INDEED_FEED_BUCKET_NAME)
-	if err != nil {
-		ErrorLog.Printf("INDEED FEED UPLOAD FAILED: %v\n", err)
-	}
-
-	InfoLog.Printf("starting ziprecruiter ORGANIC transformation & upload\n")
+type IndeedFeedFormatter struct{}
 
-	zrReadyStruct, err := jobReqDetailToZiprecruiterFormat(false, zipRecruiterEnabledCompanyIntegrations, companyJobsMap)
-	if err != nil {
-		ErrorLog.Printf("ZIPRECRUITER FEED STOPPED: jobReqDetailToZiprecruiterFormat err: %v\n", err)
-		return
-	}
-
-	zrFileName := "ziprecruiter-organic.xml"
-	if !env.Production {
-		zrFileName = "ziprecruiter-organic-test.xml"
-	}
+func (f *IndeedFeedFormatter) IntegrationURL() string {
+	return INDEED_INTEGRATION_URL
+}
 
-	err = uploadJobFeed(zrReadyStruct, zrFileName, INDEED_FEED_BUCKET_NAME)
+func (f *IndeedFeedFormatter) Format(companyInts []CompanyIntegration, companyJobsMap map[int64][]JobReqJoin, buildDate time.Time) ([]JobFeedFile, error) {
+	indeedReadyStruct, err := jobReqDetailToIndeedFormat(companyInts, companyJobsMap, buildDate)
 	if err != nil {
-		ErrorLog.Printf("ZIPRECRUITER FEED UPLOAD FAILED: %v\n", err)
+		return nil, err
 	}
 
-	InfoLog.Printf("starting ziprecruiter SPONSORED transformation & upload\n")
-
-	zrSponsoredReadyStruct, err := jobReqDetailToZiprecruiterFormat(true, zipRecruiterEnabledCompanyIntegrations, companyJobsMap)
+	body, err := encodeJobFeedXML(&indeedReadyStruct)
 	if err != nil {
-		ErrorLog.Printf("ZIPRECRUITER SPONSORED FEED STOPPED: jobReqDetailToZiprecruiterFormat err: %v\n", err)
-		return
+		return nil, err
 	}
 
-	zrSponsoredFileName := "ziprecruiter-sponsored.xml"
-	if !env.Production {
-		zrSponsoredFileName = "ziprecruiter-sponsored-test.xml"
-	}
+	return []JobFeedFile{{FileName: "allclients.xml", Body: body}}, nil
+}
 
-	err = uploadJobFeed(zrSponsoredReadyStruct, zrSponsoredFileName, INDEED_FEED_BUCKET_NAME)
-	if err != nil {
-		ErrorLog.Printf("ZIPRECRUITER SPONSORED FEED UPLOAD FAILED: %v\n", err)
-	}
+// Organic and sponsored jobs go to ZipRecruiter in separate files
+type ZiprecruiterFeedFormatter struct{}
 
-	InfoLog.Printf("jobsite uploads finished\n")
+func (f *ZiprecruiterFeedFormatter) IntegrationURL() string {
+	return ZIPRECRUITER_INTEGRATION_URL
 }
 
-func uploadJobFeed(jobFeedXMLStruct interface{}, fileName, gcpBucketName string) error {
-	absPath := fmt.Sprintf("/etc/opintegrations/jobfiles/%s", fileName)
-	if !env.Production {
-		absPath, _ = filepath.Abs(fmt.Sprintf("./opintegrations/jobfiles/%s", fileName))
-	}
-
-	jobFile, err := os.Create(absPath)
+func (f *ZiprecruiterFeedFormatter) Format(companyInts []CompanyIntegration, companyJobsMap map[int64][]JobReqJoin, buildDate time.Time) ([]JobFeedFile, error) {
+	zrReadyStruct, err := jobReqDetailToZiprecruiterFormat(false, companyInts, companyJobsMap, buildDate)
 	if err != nil {
-		return errors.New(fmt.Sprintf("err creating file: %v\n", err))
+		return nil, err
 	}
-	defer jobFile.Close()
 
-	headerBytes := []byte(xml.Header)
-	_, err = jobFile.Write(headerBytes)
+	organicBody, err := encodeJobFeedXML(&zrReadyStruct)
 	if err != nil {
-		ErrorLog.Printf("header write error: %v\n", err)
+		return nil, err
 	}
 
-	enc := xml.NewEncoder(jobFile)
-	enc.Indent("  ", "    ")
-	if err := enc.Encode(&jobFeedXMLStruct); err != nil {
-		return errors.New(fmt.Sprintf("Encode error: %v\n", err))
-	}
-
-	jobFileOpen, err := os.Open(absPath)
+	zrSponsoredReadyStruct, err := jobReqDetailToZiprecruiterFormat(true, companyInts, companyJobsMap, buildDate)
 	if err != nil {
-		return errors.New(fmt.Sprintf("err OPENING file: %v\n", err))
+		return nil, err
 	}
-	defer jobFileOpen.Close()
 
-	err = uploadFileGCM(gcpBucketName, fileName, jobFileOpen)
+	sponsoredBody, err := encodeJobFeedXML(&zrSponsoredReadyStruct)
 	if err != nil {
-		return errors.New(fmt.Sprintf("err uploadFile: %v\n", err))
+		return nil, err
 	}
 
-	return nil
+	return []JobFeedFile{
+		{FileName: "ziprecruiter-organic.xml", Body: organicBody},
+		{FileName: "ziprecruiter-sponsored.xml", Body: sponsoredBody},
+	}, nil
 }
 
-func jobReqDetailToZiprecruiterFormat(sponsoredFeed bool, companyInts []CompanyIntegration, companyJobsMap map[int64][]JobReqJoin) (ZRXMLSource, error) {
+func jobReqDetailToZiprecruiterFormat(sponsoredFeed bool, companyInts []CompanyIntegration, companyJobsMap map[int64][]JobReqJoin, buildDate time.Time) (ZRXMLSource, error) {
 	source := ZRXMLSource{
 		Publisher:     "OnePoint HCM",
 		PublisherURL:  "https://onepointhcm.com",
-		LastBuildDate: time.Now().Format("Mon, 2 Jan 2006 15:04:05 MST"),
+		LastBuildDate: buildDate.Format("Mon, 2 Jan 2006 15:04:05 MST"),
 	}
 
 	zrJobs := []ZRXMLJob{}
@@ -208,40 +116,7 @@ func jobReqDetailToZiprecruiterFormat(sponsoredFeed bool, companyInts []CompanyI
 			// OnePoint API does not send two letter so for now hard code
 			country := "US"
 
-			// entry Entry Level (0-2 years)
-			// mid Mid Level (3-6 years)
-			// senior Senior Level (7+ years)
-			experience := ""
-			if jobReq.JobReqAPIDetail.MinExperience != 0 {
-				if jobReq.JobReqAPIDetail.MaxExperience != 0 {
-					// both
-					if jobReq.JobReqAPIDetail.MinExperience <= 2 {
-						experience = "entry"
-					} else if jobReq.JobReqAPIDetail.MinExperience <= 6 {
-						experience = "mid"
-					} else {
-						experience = "senior"
-					}
-				} else {
-					// only min
-					if jobReq.JobReqAPIDetail.MinExperience <= 2 {
-						experience = "entry"
-					} else if jobReq.JobReqAPIDetail.MinExperience <= 6 {
-						experience = "mid"
-					} else {
-						experience = "senior"
-					}
-				}
-			} else if jobReq.JobReqAPIDetail.MaxExperience != 0 {
-				// only max
-				if jobReq.JobReqAPIDetail.MaxExperience <= 2 {
-					experience = "entry"
-				} else if jobReq.JobReqAPIDetail.MaxExperience <= 6 {
-					experience = "mid"
-				} else {
-					experience = "senior"
-				}
-			}
+			experience := zipRecruiterExperienceLevel(jobReq.JobReqAPIDetail.MinExperience, jobReq.JobReqAPIDetail.MaxExperience)
 
 			// Onepoint Values: "", "NONE", "HIGH_SCHOOL", "TWO_YEAR_DEGREE", "FOUR_YEAR_DEGREE", "MASTER", "DOCTORATE"
 			// ZR Values: "ged", "assoc", "undergrad", "grad"
@@ -271,11 +146,8 @@ func jobReqDetailToZiprecruiterFormat(sponsoredFeed bool, companyInts []CompanyI
 			}
 
 			compFrom, compTo := "", ""
-			if jobReq.JobReqAPIDetail.BasePayFrom != 0 {
-				compFrom = strconv.FormatFloat(jobReq.JobReqAPIDetail.BasePayFrom, 'f', 2, 64)
-			}
-			if jobReq.JobReqAPIDetail.BasePayTo != 0 {
-				compTo = strconv.FormatFloat(jobReq.JobReqAPIDetail.BasePayTo, 'f', 2, 64)
+			if compInterval != "" {
+				compFrom, compTo = jobReq.FeedPayRange()
 			}
 
 			// If present, with any content other than 0, adds the label "Plus Commission"
@@ -336,11 +208,11 @@ func jobReqDetailToZiprecruiterFormat(sponsoredFeed bool, companyInts []CompanyI
 	return source, nil
 }
 
-func jobReqDetailToIndeedFormat(companyInts []CompanyIntegration, companyJobsMap map[int64][]JobReqJoin) (IndeedXMLSource, error) {
+func jobReqDetailToIndeedFormat(companyInts []CompanyIntegration, companyJobsMap map[int64][]JobReqJoin, buildDate time.Time) (IndeedXMLSource, error) {
 	source := IndeedXMLSource{
 		Publisher:     "OnePoint HCM",
 		PublisherURL:  "https://onepointhcm.com",
-		LastBuildDate: time.Now().Format("Mon, 2 Jan 2006 15:04:05 MST"),
+		LastBuildDate: buildDate.Format("Mon, 2 Jan 2006 15:04:05 MST"),
 	}
 
 	iJobs := []IndeedXMLJob{}
@@ -357,13 +229,7 @@ func jobReqDetailToIndeedFormat(companyInts []CompanyIntegration, companyJobsMap
 				pubDate = time.Now()
 			}
 
-			payFrom, payTo := "", ""
-			if jobReq.JobReqAPIDetail.BasePayFrom != 0 {
-				payFrom = strconv.FormatFloat(jobReq.JobReqAPIDetail.BasePayFrom, 'f', 2, 64)
-			}
-			if jobReq.JobReqAPIDetail.BasePayTo != 0 {
-				payTo = strconv.FormatFloat(jobReq.JobReqAPIDetail.BasePayTo, 'f', 2, 64)
-			}
+			payFrom, payTo := jobReq.FeedPayRange()
 
 			salary := ""
 			if payFrom != "" {
@@ -503,6 +369,26 @@ func putJobsInMapByCompanyID(jobReqs []JobReqJoin) map[int64][]JobReqJoin {
 	return companyJobsMap
 }
 
+// entry Entry Level (0-2 years)
+// mid Mid Level (3-6 years)
+// senior Senior Level (7+ years)
+// uses the minimum when OP has one, otherwise the maximum
+func zipRecruiterExperienceLevel(minExperience, maxExperience int) string {
+	years := minExperience
+	if years == 0 {
+		years = maxExperience
+	}
+
+	if years == 0 {
+		return ""
+	} else if years <= 2 {
+		return "entry"
+	} else if years <= 6 {
+		return "mid"
+	}
+	return "senior"
+}
+
 // ZR has strict types - OP can define own type names
 // ZR TYPES: Full-Time, Part-Time, Contractor, Temporary, Other
 func zipRecruiterJobTypeMap(opJobType string) string {
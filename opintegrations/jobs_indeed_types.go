@@ -180,6 +180,8 @@ type IndeedJobAppPost struct {
 			} `json:"file"`
 		} `json:"resume"`
 	} `json:"applicant"`
+
+	parsedResume *ParsedResume
 }
 
 type IndeedTitle struct {
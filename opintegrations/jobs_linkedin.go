@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+// see https://learn.microsoft.com/en-us/linkedin/talent/job-postings/xml-feeds-development-guide
+
+type LinkedInXMLSource struct {
+	XMLName          xml.Name `xml:"source"`
+	LastBuildDate    string   `xml:"lastBuildDate"`
+	PublisherURL     string   `xml:"publisherUrl"`
+	Publisher        string   `xml:"publisher"`
+	ExpectedJobCount int      `xml:"expectedJobCount"`
+	Jobs             []LinkedInXMLJob
+}
+
+type LinkedInXMLJob struct {
+	XMLName         xml.Name       `xml:"job"`
+	PartnerJobID    LinkedInCDATA  `xml:"partnerJobId"`
+	Company         LinkedInCDATA  `xml:"company"`
+	Title           LinkedInCDATA  `xml:"title"`
+	Description     LinkedInCDATA  `xml:"description"`
+	ApplyURL        LinkedInCDATA  `xml:"applyUrl"`
+	City            LinkedInCDATA  `xml:"city"`
+	State           LinkedInCDATA  `xml:"state"`
+	Country         LinkedInCDATA  `xml:"country"`
+	PostalCode      LinkedInCDATA  `xml:"postalCode"`
+	JobType         *LinkedInCDATA `xml:"jobtype,omitempty"`
+	ExperienceLevel LinkedInCDATA  `xml:"experienceLevel"`
+	ListDate        LinkedInCDATA  `xml:"listDate"`
+}
+
+type LinkedInCDATA struct {
+	Text string `xml:",cdata"`
+}
+
+// Limited Listings are free and only need to be opted into on LinkedIn's side
+type LinkedInFeedFormatter struct{}
+
+func (f *LinkedInFeedFormatter) IntegrationURL() string {
+	return LINKEDIN_INTEGRATION_URL
+}
+
+func (f *LinkedInFeedFormatter) Format(companyInts []CompanyIntegration, companyJobsMap map[int64][]JobReqJoin, buildDate time.Time) ([]JobFeedFile, error) {
+	source := LinkedInXMLSource{
+		LastBuildDate: buildDate.Format(JOB_FEED_DATE_FORMAT),
+		PublisherURL:  "https://onepointhcm.com",
+		Publisher:     "OnePoint HCM",
+	}
+
+	for _, jobReq := range companyIntsJobReqs(companyInts, companyJobsMap) {
+		pubDate := jobReq.FeedPublishDate()
+
+		lJob := LinkedInXMLJob{
+			PartnerJobID:    LinkedInCDATA{Text: jobReq.FeedReferenceID(pubDate)},
+			Company:         LinkedInCDATA{Text: jobReq.CompanyName},
+			Title:           LinkedInCDATA{Text: jobReq.JobReqAPIDetail.JobTitle},
+			Description:     LinkedInCDATA{Text: jobReq.JobReqAPIDetail.JobDescription},
+			ApplyURL:        LinkedInCDATA{Text: jobReq.FeedJobURL("LinkedIn")},
+			City:            LinkedInCDATA{Text: jobReq.JobReqAPIDetail.Location.City},
+			State:           LinkedInCDATA{Text: jobReq.JobReqAPIDetail.Location.State},
+			Country:         LinkedInCDATA{Text: jobReq.FeedCountry()},
+			PostalCode:      LinkedInCDATA{Text: jobReq.JobReqAPIDetail.Location.Zip},
+			ExperienceLevel: LinkedInCDATA{Text: linkedInExperienceLevel(jobReq.JobReqAPIDetail.MinExperience, jobReq.JobReqAPIDetail.MaxExperience)},
+			ListDate:        LinkedInCDATA{Text: pubDate.Format("2006-01-02")},
+		}
+
+		// a type of the client's own that doesn't map is left out, same as ZipRecruiter
+		if jobType := linkedInJobTypeMap(jobReq.JobReqAPIDetail.EmployeeType.Name); jobType != "" {
+			lJob.JobType = &LinkedInCDATA{Text: jobType}
+		}
+
+		source.Jobs = append(source.Jobs, lJob)
+	}
+
+	// LinkedIn rejects the feed when this doesn't match the number of jobs
+	source.ExpectedJobCount = len(source.Jobs)
+
+	body, err := encodeJobFeedXML(&source)
+	if err != nil {
+		return nil, err
+	}
+
+	return []JobFeedFile{{FileName: "linkedin.xml", Body: body}}, nil
+}
+
+// LinkedIn TYPES: FULL_TIME, PART_TIME, CONTRACT, TEMPORARY, OTHER
+func linkedInJobTypeMap(opJobType string) string {
+	switch zipRecruiterJobTypeMap(opJobType) {
+	case "Full-Time":
+		return "FULL_TIME"
+	case "Part-Time":
+		return "PART_TIME"
+	case "Contractor":
+		return "CONTRACT"
+	case "Temporary":
+		return "TEMPORARY"
+	case "Other":
+		return "OTHER"
+	}
+
+	if strings.Contains(strings.ToLower(opJobType), "contract") {
+		return "CONTRACT"
+	}
+
+	return ""
+}
+
+// Uses the lower bound when OP has one, same as the ZipRecruiter feed
+func linkedInExperienceLevel(minExperience, maxExperience int) string {
+	years := minExperience
+	if years == 0 {
+		years = maxExperience
+	}
+
+	switch {
+	case years == 0:
+		return ""
+	case years <= 2:
+		return "ENTRY_LEVEL"
+	case years <= 6:
+		return "ASSOCIATE"
+	}
+	return "MID_SENIOR_LEVEL"
+}
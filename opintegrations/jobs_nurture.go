@@ -0,0 +1,489 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// A company's follow up emails to board applicants who haven't finished applying on OnePoint
+type NurtureSequence struct {
+	ID        int64        `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID int64        `db:"company_id" json:"company_id"`
+	Steps     NurtureSteps `db:"steps,size:10000" json:"steps"`
+	Updated   int64        `db:"updated" json:"updated"`
+}
+
+type NurtureSteps []NurtureStep
+
+// Delay counts from the previous step, or from the application for the first step.
+// A step that is still due after ExpireHours from the application is skipped instead of sent late.
+type NurtureStep struct {
+	DelayHours  int64    `json:"delay_hours"`
+	ExpireHours int64    `json:"expire_hours"`
+	Template    string   `json:"template"`
+	Subject     string   `json:"subject"`
+	StopWhen    []string `json:"stop_when"`
+}
+
+// Every step email we sent, what the per step conversion stats count from
+type NurtureStepSend struct {
+	ID            int64 `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID     int64 `db:"company_id" json:"company_id"`
+	ApplicationID int64 `db:"application_id" json:"application_id"`
+	StepIndex     int   `db:"step_index" json:"step_index"`
+	Sent          int64 `db:"sent" json:"sent"`
+}
+
+type NurtureUnsubscribe struct {
+	ID            int64  `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID     int64  `db:"company_id" json:"company_id"`
+	Email         string `db:"email" json:"email"`
+	ApplicationID int64  `db:"application_id" json:"application_id"`
+	Created       int64  `db:"created" json:"created"`
+}
+
+type NurtureStats struct {
+	Overall ApplyStats         `json:"overall"`
+	Steps   []NurtureStepStats `json:"steps"`
+	States  map[string]int64   `json:"states"`
+}
+
+type NurtureStepStats struct {
+	Step             int    `json:"step"`
+	Template         string `json:"template"`
+	Sent             int64  `json:"sent"`
+	ConvertedAfter   int64  `json:"converted_after"`
+	PercentConverted string `json:"percent_converted"`
+}
+
+type nurtureStepCount struct {
+	StepIndex int   `db:"step_index"`
+	Count     int64 `db:"count"`
+}
+
+type nurtureStateCount struct {
+	State string `db:"state"`
+	Count int64  `db:"count"`
+}
+
+const (
+	NURTURE_STATE_ACTIVE       = "active"
+	NURTURE_STATE_CONVERTED    = "converted"
+	NURTURE_STATE_UNSUBSCRIBED = "unsubscribed"
+	NURTURE_STATE_JOB_CLOSED   = "job_closed"
+	NURTURE_STATE_COMPLETED    = "completed"
+
+	NURTURE_STOP_APPLIED_ON_OP = "applied_on_op"
+	NURTURE_STOP_UNSUBSCRIBED  = "unsubscribed"
+	NURTURE_STOP_JOB_CLOSED    = "job_closed"
+
+	NURTURE_TEMPLATE_FINISH   = "finish"
+	NURTURE_TEMPLATE_REMINDER = "reminder"
+
+	NURTURE_MAX_STEPS       = 10
+	NURTURE_MAX_DELAY_HOURS = 24 * 60
+	NURTURE_TOKEN_LENGTH    = 32
+	NURTURE_UNSUBSCRIBE_URL = "https://connect.onehcm.com/api/recruitment/nurture/unsubscribe"
+
+	NURTURE_UNSUBSCRIBE_TEMPLATE = "nurture_unsubscribe.html"
+)
+
+var nurtureTemplates = map[string]string{
+	NURTURE_TEMPLATE_FINISH:   JOB_FINISH_APP_EMAIL_TEMPLATE,
+	NURTURE_TEMPLATE_REMINDER: JOB_FINISH_APP_REMINDER_EMAIL_TEMPLATE,
+}
+
+// What every company got before sequences were configurable, one reminder between a day and a week after applying
+var defaultNurtureSteps = NurtureSteps{
+	{
+		DelayHours:  24,
+		ExpireHours: 7 * 24,
+		Template:    NURTURE_TEMPLATE_REMINDER,
+		StopWhen:    []string{NURTURE_STOP_APPLIED_ON_OP, NURTURE_STOP_UNSUBSCRIBED, NURTURE_STOP_JOB_CLOSED},
+	},
+}
+
+func (s NurtureSteps) Value() (driver.Value, error) {
+	j, err := json.Marshal(s)
+	return j, err
+}
+
+func (s *NurtureSteps) Scan(src interface{}) error {
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("Type assertion .([]byte) failed.")
+	}
+
+	return json.Unmarshal(source, s)
+}
+
+func getNurtureSequenceHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	c.JSON(http.StatusOK, lookupNurtureSequence(thisCompany.ID))
+}
+
+func updateNurtureSequenceHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	input := NurtureSequence{}
+	err = c.ShouldBindWith(&input, binding.JSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	err = validateNurtureSteps(input.Steps)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sequence := NurtureSequence{}
+	err = dbmap.SelectOne(&sequence, "SELECT * FROM nurture_sequences WHERE company_id = ?", thisCompany.ID)
+	sequence.CompanyID = thisCompany.ID
+	sequence.Steps = input.Steps
+	sequence.Updated = time.Now().Unix()
+
+	if err != nil {
+		err = dbmap.Insert(&sequence)
+	} else {
+		_, err = dbmap.Update(&sequence)
+	}
+	if err != nil {
+		ErrorLog.Println("updateNurtureSequenceHandler save err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sequence)
+}
+
+func getNurtureStatsHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	stats, err := findNurtureStats(thisCompany.ID)
+	if err != nil {
+		ErrorLog.Println("getNurtureStatsHandler err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+type NurtureUnsubscribePage struct {
+	CompanyName  string
+	Unsubscribed bool
+}
+
+// Linked from the bottom of every nurture email, so it is public and keyed by the application's token.
+// Opening the link only asks, mail scanners follow links and would unsubscribe people on their own.
+func nurtureUnsubscribePageHandler(c *gin.Context) {
+	_, thisCompany, err := lookupNurtureUnsubscribe(c.Param("token"))
+	if err != nil {
+		c.String(http.StatusNotFound, "This unsubscribe link is not valid.")
+		return
+	}
+
+	renderCareersTemplate(c, NURTURE_UNSUBSCRIBE_TEMPLATE, NurtureUnsubscribePage{CompanyName: thisCompany.Name})
+}
+
+// The page's form posts back to the same url
+func nurtureUnsubscribeHandler(c *gin.Context) {
+	thisApp, thisCompany, err := lookupNurtureUnsubscribe(c.Param("token"))
+	if err != nil {
+		c.String(http.StatusNotFound, "This unsubscribe link is not valid.")
+		return
+	}
+
+	err = unsubscribeFromNurture(thisApp)
+	if err != nil {
+		ErrorLog.Println("nurtureUnsubscribeHandler err: ", err)
+		c.String(http.StatusInternalServerError, "We could not unsubscribe you, please try again.")
+		return
+	}
+
+	renderCareersTemplate(c, NURTURE_UNSUBSCRIBE_TEMPLATE, NurtureUnsubscribePage{CompanyName: thisCompany.Name, Unsubscribed: true})
+}
+
+func lookupNurtureUnsubscribe(token string) (JobApplication, Company, error) {
+	thisApp := JobApplication{}
+	if len(token) != NURTURE_TOKEN_LENGTH {
+		return thisApp, Company{}, errors.New("bad token length")
+	}
+
+	err := dbmap.SelectOne(&thisApp, "SELECT * FROM job_applications WHERE nurture_token = ?", token)
+	if err != nil {
+		return thisApp, Company{}, err
+	}
+
+	thisCompany, err := lookupCompanyByID(thisApp.CompanyID)
+	return thisApp, thisCompany, err
+}
+
+func validateNurtureSteps(steps NurtureSteps) error {
+	if len(steps) > NURTURE_MAX_STEPS {
+		return errors.New(fmt.Sprintf("A sequence can have at most %d steps", NURTURE_MAX_STEPS))
+	}
+
+	for index, step := range steps {
+		if step.DelayHours < 0 || step.DelayHours > NURTURE_MAX_DELAY_HOURS {
+			return errors.New(fmt.Sprintf("Step %d delay must be between 0 and %d hours", index+1, NURTURE_MAX_DELAY_HOURS))
+		}
+		if step.ExpireHours < 0 {
+			return errors.New(fmt.Sprintf("Step %d expiration can not be negative", index+1))
+		}
+		if _, exists := nurtureTemplates[step.Template]; !exists {
+			return errors.New(fmt.Sprintf("Step %d template must be %s or %s", index+1, NURTURE_TEMPLATE_FINISH, NURTURE_TEMPLATE_REMINDER))
+		}
+		for _, condition := range step.StopWhen {
+			switch condition {
+			case NURTURE_STOP_APPLIED_ON_OP, NURTURE_STOP_UNSUBSCRIBED, NURTURE_STOP_JOB_CLOSED:
+			default:
+				return errors.New(fmt.Sprintf("Step %d has unknown stop condition: %s", index+1, condition))
+			}
+		}
+	}
+
+	return nil
+}
+
+// Companies that never configured a sequence keep the original single reminder
+func lookupNurtureSequence(companyID int64) NurtureSequence {
+	sequence := NurtureSequence{}
+	err := dbmap.SelectOne(&sequence, "SELECT * FROM nurture_sequences WHERE company_id = ?", companyID)
+	if err != nil {
+		return NurtureSequence{CompanyID: companyID, Steps: defaultNurtureSteps}
+	}
+
+	return sequence
+}
+
+func (step NurtureStep) stopsWhen(condition string) bool {
+	for _, stopCondition := range step.StopWhen {
+		if stopCondition == condition {
+			return true
+		}
+	}
+	return false
+}
+
+// New board applications start at the first step of their company's sequence
+func (app *JobApplication) enrollInNurture(sequence NurtureSequence) {
+	app.NurtureToken = GenRandStr(NURTURE_TOKEN_LENGTH)
+	app.NurtureStep = 0
+
+	if len(sequence.Steps) == 0 {
+		app.NurtureState = NURTURE_STATE_COMPLETED
+		return
+	}
+
+	app.NurtureState = NURTURE_STATE_ACTIVE
+	app.NurtureNextAt = app.AppliedOnMillis/1000 + sequence.Steps[0].DelayHours*3600
+}
+
+// Moves one application forward if its next step is due. Returns true when the application changed and needs saving.
+func (app *JobApplication) advanceNurture(company Company, sequence NurtureSequence, unsubscribed map[string]bool, now time.Time) bool {
+	if app.NurtureState != NURTURE_STATE_ACTIVE || app.NurtureNextAt > now.Unix() {
+		return false
+	}
+
+	if app.NurtureStep >= len(sequence.Steps) {
+		app.NurtureState = NURTURE_STATE_COMPLETED
+		return true
+	}
+
+	step := sequence.Steps[app.NurtureStep]
+
+	// unsubscribes are always honored, listing it on a step only documents it
+	if unsubscribed[strings.ToLower(app.ApplicantEmail)] {
+		app.NurtureState = NURTURE_STATE_UNSUBSCRIBED
+		return true
+	}
+
+	if app.AppliedOnOP != nil && *app.AppliedOnOP && step.stopsWhen(NURTURE_STOP_APPLIED_ON_OP) {
+		app.NurtureState = NURTURE_STATE_CONVERTED
+		return true
+	}
+
+	if step.ExpireHours > 0 && now.Unix() > app.AppliedOnMillis/1000+step.ExpireHours*3600 {
+		InfoLog.Printf("nurture step %d expired, app: %d, email: %s\n", app.NurtureStep, app.ID, app.ApplicantEmail)
+		app.moveToNextNurtureStep(sequence, now)
+		return true
+	}
+
+	if !env.Production {
+		InfoLog.Printf("would be emailing nurture step %d: email: %s, jobid: %s, applied on %d\n", app.NurtureStep, app.ApplicantEmail, app.OPJobID, app.AppliedOnMillis)
+		return false
+	}
+
+	err := sendJobAppNurtureMessage(app, company, nurtureTemplates[step.Template], step.Subject)
+	if err != nil {
+		if err.Error() == JOB_REQ_INACTIVE_ERROR {
+			if step.stopsWhen(NURTURE_STOP_JOB_CLOSED) {
+				app.NurtureState = NURTURE_STATE_JOB_CLOSED
+				return true
+			}
+
+			// the job isn't coming back, so this step can never send
+			InfoLog.Printf("nurture step %d skipped for a closed job, app: %d, email: %s\n", app.NurtureStep, app.ID, app.ApplicantEmail)
+			app.moveToNextNurtureStep(sequence, now)
+			return true
+		}
+
+		// left due so the next run tries again, until the step expires
+		ErrorLog.Printf("err sending nurture step %d email, app: %d, err: %v\n", app.NurtureStep, app.ID, err)
+		return false
+	}
+
+	err = dbmap.Insert(&NurtureStepSend{
+		CompanyID:     app.CompanyID,
+		ApplicationID: app.ID,
+		StepIndex:     app.NurtureStep,
+		Sent:          now.Unix(),
+	})
+	if err != nil {
+		ErrorLog.Println("nurture email sent BUT could not record the send: " + err.Error())
+	}
+
+	InfoLog.Printf("sent nurture step %d email, email: %s\n", app.NurtureStep, app.ApplicantEmail)
+	app.moveToNextNurtureStep(sequence, now)
+
+	return true
+}
+
+func (app *JobApplication) moveToNextNurtureStep(sequence NurtureSequence, now time.Time) {
+	app.NurtureStep++
+	if app.NurtureStep >= len(sequence.Steps) {
+		app.NurtureState = NURTURE_STATE_COMPLETED
+		return
+	}
+
+	app.NurtureNextAt = now.Unix() + sequence.Steps[app.NurtureStep].DelayHours*3600
+}
+
+func findNurtureUnsubscribes(companyID int64) (map[string]bool, error) {
+	unsubscribed := map[string]bool{}
+
+	unsubscribes := []NurtureUnsubscribe{}
+	_, err := dbmap.Select(&unsubscribes, "SELECT * FROM nurture_unsubscribes WHERE company_id = ?", companyID)
+	if err != nil {
+		return unsubscribed, err
+	}
+
+	for _, unsubscribe := range unsubscribes {
+		unsubscribed[unsubscribe.Email] = true
+	}
+
+	return unsubscribed, nil
+}
+
+// Stops every active sequence for this person at this company, not just the application they clicked from
+func unsubscribeFromNurture(thisApp JobApplication) error {
+	email := strings.ToLower(strings.TrimSpace(thisApp.ApplicantEmail))
+
+	count, err := dbmap.SelectInt("SELECT COUNT(*) FROM nurture_unsubscribes WHERE company_id = ? AND email = ?", thisApp.CompanyID, email)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		err = dbmap.Insert(&NurtureUnsubscribe{
+			CompanyID:     thisApp.CompanyID,
+			Email:         email,
+			ApplicationID: thisApp.ID,
+			Created:       time.Now().Unix(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = dbmap.Exec("UPDATE job_applications SET nurture_state = ? WHERE company_id = ? AND LOWER(applicant_email) = ? AND nurture_state = ?",
+		NURTURE_STATE_UNSUBSCRIBED, thisApp.CompanyID, email, NURTURE_STATE_ACTIVE)
+
+	return err
+}
+
+// Conversions are credited to the last step an applicant got before they finished on OnePoint
+func findNurtureStats(companyID int64) (NurtureStats, error) {
+	stats := NurtureStats{Steps: []NurtureStepStats{}, States: map[string]int64{}}
+
+	overall, err := findAppliedStats(companyID)
+	if err != nil {
+		// the OP report can be slow or down, the step counts below are still worth showing
+		ErrorLog.Printf("findNurtureStats findAppliedStats company: %d, err: %v\n", companyID, err)
+	}
+	stats.Overall = overall
+
+	sentCounts := []nurtureStepCount{}
+	_, err = dbmap.Select(&sentCounts, "SELECT step_index, COUNT(*) AS count FROM nurture_step_sends WHERE company_id = ? GROUP BY step_index", companyID)
+	if err != nil {
+		return stats, errors.New(fmt.Sprintf("nurture sent counts err: %v", err))
+	}
+
+	convertedCounts := []nurtureStepCount{}
+	_, err = dbmap.Select(&convertedCounts, `SELECT last_sends.step_index, COUNT(*) AS count FROM
+		(SELECT application_id, MAX(step_index) AS step_index FROM nurture_step_sends WHERE company_id = ? GROUP BY application_id) last_sends
+		JOIN job_applications ON job_applications.id = last_sends.application_id
+		WHERE job_applications.applied_on_op = 1 GROUP BY last_sends.step_index`, companyID)
+	if err != nil {
+		return stats, errors.New(fmt.Sprintf("nurture converted counts err: %v", err))
+	}
+
+	converted := map[int]int64{}
+	for _, count := range convertedCounts {
+		converted[count.StepIndex] = count.Count
+	}
+
+	sequence := lookupNurtureSequence(companyID)
+	for _, count := range sentCounts {
+		stepStats := NurtureStepStats{
+			Step:             count.StepIndex + 1,
+			Sent:             count.Count,
+			ConvertedAfter:   converted[count.StepIndex],
+			PercentConverted: "n/a",
+		}
+		if count.StepIndex < len(sequence.Steps) {
+			stepStats.Template = sequence.Steps[count.StepIndex].Template
+		}
+		if count.Count > 0 {
+			stepStats.PercentConverted = fmt.Sprintf("%.2f%%", (float64(stepStats.ConvertedAfter)/float64(count.Count))*100)
+		}
+
+		stats.Steps = append(stats.Steps, stepStats)
+	}
+
+	stateCounts := []nurtureStateCount{}
+	_, err = dbmap.Select(&stateCounts, "SELECT nurture_state AS state, COUNT(*) AS count FROM job_applications WHERE company_id = ? AND nurture_state != '' GROUP BY nurture_state", companyID)
+	if err != nil {
+		return stats, errors.New(fmt.Sprintf("nurture state counts err: %v", err))
+	}
+
+	for _, count := range stateCounts {
+		stats.States[count.State] = count.Count
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// The parts of HR-XML's StructuredXMLResume we use, Indeed sends it as hrXml and some
+// applicant tracking exports use it as the file. Names match without the namespace.
+type HRXMLStructuredResume struct {
+	ContactInfo struct {
+		PersonName struct {
+			FormattedName string `xml:"FormattedName"`
+			GivenName     string `xml:"GivenName"`
+			FamilyName    string `xml:"FamilyName"`
+		} `xml:"PersonName"`
+		ContactMethods []struct {
+			InternetEmailAddress string `xml:"InternetEmailAddress"`
+			Telephone            struct {
+				FormattedNumber string `xml:"FormattedNumber"`
+			} `xml:"Telephone"`
+			Mobile struct {
+				FormattedNumber string `xml:"FormattedNumber"`
+			} `xml:"Mobile"`
+			PostalAddress struct {
+				Municipality string `xml:"Municipality"`
+				Region       string `xml:"Region"`
+			} `xml:"PostalAddress"`
+		} `xml:"ContactMethod"`
+	} `xml:"ContactInfo"`
+	ExecutiveSummary string `xml:"ExecutiveSummary"`
+	Objective        string `xml:"Objective"`
+	Employers        []struct {
+		EmployerOrgName string `xml:"EmployerOrgName"`
+		Positions       []struct {
+			Title       string       `xml:"Title"`
+			OrgName     string       `xml:"OrgName>OrganizationName"`
+			Description string       `xml:"Description"`
+			StartDate   HRXMLDate    `xml:"StartDate"`
+			EndDate     HRXMLDate    `xml:"EndDate"`
+			OrgInfo     HRXMLOrgInfo `xml:"OrgInfo"`
+			Current     string       `xml:"currentEmployer,attr"`
+		} `xml:"PositionHistory"`
+	} `xml:"EmploymentHistory>EmployerOrg"`
+	Schools []struct {
+		SchoolName string `xml:"School>SchoolName"`
+		Degrees    []struct {
+			DegreeName  string    `xml:"DegreeName"`
+			DegreeMajor string    `xml:"DegreeMajor>Name"`
+			StartDate   HRXMLDate `xml:"DatesOfAttendance>StartDate"`
+			EndDate     HRXMLDate `xml:"DatesOfAttendance>EndDate"`
+			DegreeDate  HRXMLDate `xml:"DegreeDate"`
+		} `xml:"Degree"`
+	} `xml:"EducationHistory>SchoolOrInstitution"`
+	Competencies []struct {
+		Name string `xml:"name,attr"`
+	} `xml:"Qualifications>Competency"`
+	QualificationsSummary string `xml:"Qualifications>QualificationSummary"`
+}
+
+// HR-XML dates come as one of these, StringDate is usually "current" or "present"
+type HRXMLDate struct {
+	AnyDate    string `xml:"AnyDate"`
+	YearMonth  string `xml:"YearMonth"`
+	Year       string `xml:"Year"`
+	StringDate string `xml:"StringDate"`
+}
+
+type HRXMLOrgInfo struct {
+	Municipality string `xml:"PositionLocation>Municipality"`
+	Region       string `xml:"PositionLocation>Region"`
+}
+
+func parseHRXMLResume(data []byte) (ParsedResume, error) {
+	parsed := ParsedResume{Format: RESUME_FORMAT_HRXML}
+
+	structured, err := findHRXMLStructuredResume(data)
+	if err != nil {
+		return parsed, err
+	}
+
+	person := structured.ContactInfo.PersonName
+	parsed.Name = strings.TrimSpace(person.FormattedName)
+	if parsed.Name == "" {
+		parsed.Name = strings.TrimSpace(person.GivenName + " " + person.FamilyName)
+	}
+
+	for _, method := range structured.ContactInfo.ContactMethods {
+		if parsed.Email == "" {
+			parsed.Email = strings.TrimSpace(method.InternetEmailAddress)
+		}
+		if parsed.Phone == "" {
+			parsed.Phone = strings.TrimSpace(method.Mobile.FormattedNumber)
+		}
+		if parsed.Phone == "" {
+			parsed.Phone = strings.TrimSpace(method.Telephone.FormattedNumber)
+		}
+		if parsed.City == "" {
+			parsed.City = strings.TrimSpace(method.PostalAddress.Municipality)
+			parsed.State = strings.TrimSpace(method.PostalAddress.Region)
+		}
+	}
+
+	parsed.Summary = strings.TrimSpace(structured.ExecutiveSummary)
+	if parsed.Summary == "" {
+		parsed.Summary = strings.TrimSpace(structured.Objective)
+	}
+
+	for _, employer := range structured.Employers {
+		for _, position := range employer.Positions {
+			company := strings.TrimSpace(position.OrgName)
+			if company == "" {
+				company = strings.TrimSpace(employer.EmployerOrgName)
+			}
+
+			parsedPosition := ParsedResumePosition{
+				Title:       strings.TrimSpace(position.Title),
+				Company:     company,
+				City:        strings.TrimSpace(position.OrgInfo.Municipality),
+				State:       strings.TrimSpace(position.OrgInfo.Region),
+				Description: strings.TrimSpace(position.Description),
+				From:        position.StartDate.resumeDate(),
+				Current:     position.Current == "true" || position.EndDate.isCurrent(),
+			}
+			if !parsedPosition.Current {
+				parsedPosition.To = position.EndDate.resumeDate()
+			}
+
+			parsed.WorkHistory = append(parsed.WorkHistory, parsedPosition)
+		}
+	}
+
+	for _, school := range structured.Schools {
+		if len(school.Degrees) == 0 {
+			parsed.Education = append(parsed.Education, ParsedResumeSchool{SchoolName: strings.TrimSpace(school.SchoolName)})
+			continue
+		}
+
+		for _, degree := range school.Degrees {
+			to := degree.EndDate.resumeDate()
+			if to == "" {
+				to = degree.DegreeDate.resumeDate()
+			}
+
+			parsed.Education = append(parsed.Education, ParsedResumeSchool{
+				SchoolName: strings.TrimSpace(school.SchoolName),
+				Degree:     strings.TrimSpace(degree.DegreeName),
+				Field:      strings.TrimSpace(degree.DegreeMajor),
+				From:       degree.StartDate.resumeDate(),
+				To:         to,
+			})
+		}
+	}
+
+	skills := []string{}
+	for _, competency := range structured.Competencies {
+		skills = append(skills, competency.Name)
+	}
+	if len(skills) == 0 {
+		skills = splitResumeSkills(structured.QualificationsSummary)
+	}
+	parsed.Skills = uniqueResumeStrings(skills)
+
+	parsed.Parsed = time.Now().Unix()
+
+	return parsed, nil
+}
+
+// StructuredXMLResume sits under Resume, Candidate or a vendor wrapper depending on who sent it
+func findHRXMLStructuredResume(data []byte) (HRXMLStructuredResume, error) {
+	structured := HRXMLStructuredResume{}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return structured, errors.New("no StructuredXMLResume in hr-xml resume")
+		}
+		if err != nil {
+			return structured, err
+		}
+
+		start, isStart := token.(xml.StartElement)
+		if !isStart || start.Name.Local != "StructuredXMLResume" {
+			continue
+		}
+
+		err = decoder.DecodeElement(&structured, &start)
+		return structured, err
+	}
+}
+
+func (d HRXMLDate) isCurrent() bool {
+	value := strings.ToLower(strings.TrimSpace(d.StringDate))
+	return value == "current" || value == "present" || value == "now"
+}
+
+func (d HRXMLDate) resumeDate() string {
+	switch {
+	case d.AnyDate != "":
+		if parsed, err := time.Parse("2006-01-02", strings.TrimSpace(d.AnyDate)); err == nil {
+			return parsed.Format("2006-01-02")
+		}
+	case d.YearMonth != "":
+		parts := strings.Split(strings.TrimSpace(d.YearMonth), "-")
+		if len(parts) == 2 {
+			return resumeMonthDate(parts[0], parts[1])
+		}
+	case d.Year != "":
+		return resumeMonthDate(strings.TrimSpace(d.Year), "")
+	}
+	return ""
+}
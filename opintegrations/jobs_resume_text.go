@@ -0,0 +1,655 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Sections we look for in a plain text resume, by the heading that starts them
+const (
+	RESUME_SECTION_HEADER     = ""
+	RESUME_SECTION_SUMMARY    = "summary"
+	RESUME_SECTION_EXPERIENCE = "experience"
+	RESUME_SECTION_EDUCATION  = "education"
+	RESUME_SECTION_SKILLS     = "skills"
+	RESUME_SECTION_OTHER      = "other"
+)
+
+var (
+	resumeEmailRegexp    = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	resumePhoneRegexp    = regexp.MustCompile(`(?:\+?1[\s.\-]?)?\(?\d{3}\)?[\s.\-]?\d{3}[\s.\-]?\d{4}`)
+	resumeLocationRegexp = regexp.MustCompile(`\b([A-Z][A-Za-z.' ]{1,30}),\s*([A-Z]{2})\b(?:\s+\d{5})?`)
+
+	resumeMonthPattern = `(?:jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?`
+	resumeDatePattern  = `(?:` + resumeMonthPattern + `\s+\d{4}|\d{1,2}/\d{4}|\d{1,2}/\d{2}|\d{4})`
+	resumeDateRange    = regexp.MustCompile(`(?i)(` + resumeDatePattern + `)\s*(?:-|–|—|to|until)\s*(` + resumeDatePattern + `|present|current|now|today)`)
+
+	resumeDegreeRegexp = regexp.MustCompile(`(?i)\b(ph\.?d\.?|doctorate|master(?:'s)?(?: of [a-z ]+)?|m\.?b\.?a\.?|m\.?s\.?|m\.?a\.?|bachelor(?:'s)?(?: of [a-z ]+)?|b\.?s\.?|b\.?a\.?|associate(?:'s)?(?: of [a-z ]+)?|a\.?a\.?s?\.?|high school diploma|g\.?e\.?d\.?|certificate)\b`)
+	resumeSchoolRegexp = regexp.MustCompile(`(?i)\b(university|college|school|institute|academy|polytechnic)\b`)
+
+	resumeSectionHeadings = map[string]string{
+		"summary":                 RESUME_SECTION_SUMMARY,
+		"professional summary":    RESUME_SECTION_SUMMARY,
+		"profile":                 RESUME_SECTION_SUMMARY,
+		"professional profile":    RESUME_SECTION_SUMMARY,
+		"objective":               RESUME_SECTION_SUMMARY,
+		"career objective":        RESUME_SECTION_SUMMARY,
+		"about me":                RESUME_SECTION_SUMMARY,
+		"experience":              RESUME_SECTION_EXPERIENCE,
+		"work experience":         RESUME_SECTION_EXPERIENCE,
+		"professional experience": RESUME_SECTION_EXPERIENCE,
+		"employment":              RESUME_SECTION_EXPERIENCE,
+		"employment history":      RESUME_SECTION_EXPERIENCE,
+		"work history":            RESUME_SECTION_EXPERIENCE,
+		"relevant experience":     RESUME_SECTION_EXPERIENCE,
+		"education":               RESUME_SECTION_EDUCATION,
+		"education and training":  RESUME_SECTION_EDUCATION,
+		"academic background":     RESUME_SECTION_EDUCATION,
+		"skills":                  RESUME_SECTION_SKILLS,
+		"technical skills":        RESUME_SECTION_SKILLS,
+		"key skills":              RESUME_SECTION_SKILLS,
+		"core competencies":       RESUME_SECTION_SKILLS,
+		"skills and abilities":    RESUME_SECTION_SKILLS,
+		"qualifications":          RESUME_SECTION_SKILLS,
+		"certifications":          RESUME_SECTION_OTHER,
+		"references":              RESUME_SECTION_OTHER,
+		"awards":                  RESUME_SECTION_OTHER,
+		"volunteer experience":    RESUME_SECTION_OTHER,
+		"interests":               RESUME_SECTION_OTHER,
+		"languages":               RESUME_SECTION_OTHER,
+	}
+)
+
+// Pulls the text out of a pdf's content streams. Handles the uncompressed and FlateDecode
+// streams word processors write, scanned resumes and custom font encodings come out empty.
+func extractPDFText(pdf []byte) (string, error) {
+	var text strings.Builder
+
+	// compressed streams can inflate to far more than the upload, so all of them share one budget
+	decodedBudget := int64(RESUME_PARSE_MAX_BYTES * 5)
+
+	remaining := pdf
+	for {
+		streamStart := bytes.Index(remaining, []byte("stream"))
+		if streamStart == -1 {
+			break
+		}
+
+		// "endstream" also contains "stream"
+		if streamStart >= 3 && string(remaining[streamStart-3:streamStart]) == "end" {
+			remaining = remaining[streamStart+6:]
+			continue
+		}
+
+		dictStart := bytes.LastIndex(remaining[:streamStart], []byte("<<"))
+		dict := ""
+		if dictStart != -1 {
+			dict = string(remaining[dictStart:streamStart])
+		}
+
+		dataStart := streamStart + 6
+		if dataStart < len(remaining) && remaining[dataStart] == '\r' {
+			dataStart++
+		}
+		if dataStart < len(remaining) && remaining[dataStart] == '\n' {
+			dataStart++
+		}
+
+		dataEnd := bytes.Index(remaining[dataStart:], []byte("endstream"))
+		if dataEnd == -1 {
+			break
+		}
+		data := remaining[dataStart : dataStart+dataEnd]
+		remaining = remaining[dataStart+dataEnd+9:]
+
+		switch {
+		case strings.Contains(dict, "/FlateDecode"):
+			reader, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				continue
+			}
+			decoded, err := ioutil.ReadAll(io.LimitReader(reader, decodedBudget+1))
+			reader.Close()
+			// a truncated stream still has text worth keeping, one with nothing readable doesn't
+			if err != nil && len(decoded) == 0 {
+				continue
+			}
+
+			decodedBudget -= int64(len(decoded))
+			if decodedBudget < 0 {
+				return "", errors.New("pdf content is too large to parse")
+			}
+			data = decoded
+		case strings.Contains(dict, "/Filter"):
+			// images and other encodings don't carry text we can read
+			continue
+		}
+
+		text.WriteString(pdfContentStreamText(data))
+	}
+
+	extracted := strings.TrimSpace(text.String())
+	if extracted == "" {
+		return "", errors.New("no text found in pdf, it may be scanned")
+	}
+
+	return extracted, nil
+}
+
+// Walks a content stream collecting the strings shown between BT and ET
+func pdfContentStreamText(stream []byte) string {
+	var text strings.Builder
+	inText := false
+	pending := []string{}
+	operands := []string{}
+	lastY := ""
+
+	flush := func() {
+		if inText {
+			text.WriteString(strings.Join(pending, ""))
+		}
+		pending = pending[:0]
+	}
+
+	for i := 0; i < len(stream); {
+		ch := stream[i]
+
+		switch {
+		case ch == '%':
+			for i < len(stream) && stream[i] != '\n' && stream[i] != '\r' {
+				i++
+			}
+		case ch == '(':
+			str, next := pdfLiteralString(stream, i)
+			pending = append(pending, str)
+			i = next
+		case ch == '<' && i+1 < len(stream) && stream[i+1] == '<':
+			i += 2
+		case ch == '>' && i+1 < len(stream) && stream[i+1] == '>':
+			i += 2
+		case ch == '<':
+			end := bytes.IndexByte(stream[i:], '>')
+			if end == -1 {
+				i = len(stream)
+				continue
+			}
+			pending = append(pending, pdfHexString(stream[i+1:i+end]))
+			i += end + 1
+		case ch == '/':
+			start := i
+			i++
+			for i < len(stream) && !isPDFWhitespace(stream[i]) && !isPDFDelimiter(stream[i]) {
+				i++
+			}
+			operands = append(operands, string(stream[start:i]))
+		case ch == '[' || ch == ']' || ch == '{' || ch == '}':
+			i++
+		case isPDFWhitespace(ch):
+			i++
+		default:
+			start := i
+			for i < len(stream) && !isPDFWhitespace(stream[i]) && !isPDFDelimiter(stream[i]) {
+				i++
+			}
+			if i == start {
+				i++
+				continue
+			}
+			token := string(stream[start:i])
+
+			if value, err := strconv.ParseFloat(token, 64); err == nil {
+				// a big negative kern inside a TJ array is a space between words
+				if value < -200 && len(pending) > 0 {
+					pending = append(pending, " ")
+				}
+				operands = append(operands, token)
+				continue
+			}
+
+			switch token {
+			case "BT":
+				inText = true
+			case "ET":
+				flush()
+				if inText {
+					text.WriteString("\n")
+				}
+				inText = false
+			case "Tj", "TJ":
+				flush()
+			case "'", "\"":
+				if inText {
+					text.WriteString("\n")
+				}
+				flush()
+			case "T*":
+				flush()
+				if inText {
+					text.WriteString("\n")
+				}
+			case "Td", "TD":
+				flush()
+				if inText && len(operands) >= 2 {
+					if ty, _ := strconv.ParseFloat(operands[len(operands)-1], 64); ty != 0 {
+						text.WriteString("\n")
+					} else {
+						text.WriteString(" ")
+					}
+				}
+			case "Tm":
+				flush()
+				if inText && len(operands) >= 6 {
+					y := operands[len(operands)-1]
+					if lastY != "" && y != lastY {
+						text.WriteString("\n")
+					} else if lastY != "" {
+						text.WriteString(" ")
+					}
+					lastY = y
+				}
+			default:
+				pending = pending[:0]
+			}
+			operands = operands[:0]
+		}
+	}
+
+	return text.String()
+}
+
+func pdfLiteralString(stream []byte, start int) (string, int) {
+	var str []byte
+	depth := 0
+	i := start
+
+	for i < len(stream) {
+		ch := stream[i]
+		switch {
+		case ch == '\\' && i+1 < len(stream):
+			i++
+			escaped := stream[i]
+			switch escaped {
+			case 'n':
+				str = append(str, '\n')
+			case 'r':
+				str = append(str, '\r')
+			case 't':
+				str = append(str, '\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// line continuation
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					octal := 0
+					digits := 0
+					for digits < 3 && i < len(stream) && stream[i] >= '0' && stream[i] <= '7' {
+						octal = octal*8 + int(stream[i]-'0')
+						i++
+						digits++
+					}
+					str = append(str, byte(octal))
+					continue
+				}
+				str = append(str, escaped)
+			}
+		case ch == '(':
+			if depth > 0 {
+				str = append(str, ch)
+			}
+			depth++
+		case ch == ')':
+			depth--
+			if depth == 0 {
+				return pdfDocString(str), i + 1
+			}
+			str = append(str, ch)
+		default:
+			str = append(str, ch)
+		}
+		i++
+	}
+
+	return pdfDocString(str), i
+}
+
+func pdfHexString(hexBytes []byte) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, string(hexBytes))
+	if len(cleaned)%2 == 1 {
+		cleaned += "0"
+	}
+
+	decoded, err := hex.DecodeString(cleaned)
+	if err != nil {
+		return ""
+	}
+
+	// two byte glyph ids need the font's cmap, which we don't read
+	if len(decoded) >= 2 && decoded[0] == 0 {
+		utf16 := []rune{}
+		for i := 0; i+1 < len(decoded); i += 2 {
+			utf16 = append(utf16, rune(int(decoded[i])<<8|int(decoded[i+1])))
+		}
+		return pdfDocString([]byte(string(utf16)))
+	}
+
+	return pdfDocString(decoded)
+}
+
+// PDFDocEncoding is close enough to Latin-1 for resumes, control characters are dropped
+func pdfDocString(raw []byte) string {
+	if isValidUTF8Text(raw) {
+		return string(raw)
+	}
+
+	runes := make([]rune, 0, len(raw))
+	for _, b := range raw {
+		r := rune(b)
+		if r < 32 && r != '\n' && r != '\t' {
+			continue
+		}
+		runes = append(runes, r)
+	}
+	return string(runes)
+}
+
+func isValidUTF8Text(raw []byte) bool {
+	for _, r := range string(raw) {
+		if r == unicode.ReplacementChar || (r < 32 && r != '\n' && r != '\t' && r != '\r') {
+			return false
+		}
+	}
+	return true
+}
+
+func isPDFWhitespace(ch byte) bool {
+	return ch == ' ' || ch == '\n' || ch == '\r' || ch == '\t' || ch == '\f' || ch == 0
+}
+
+func isPDFDelimiter(ch byte) bool {
+	return strings.IndexByte("()<>[]{}/%", ch) != -1
+}
+
+// A docx is a zip, the text is in word/document.xml as w:t runs inside w:p paragraphs
+func extractDOCXText(docx []byte) (string, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(docx), int64(len(docx)))
+	if err != nil {
+		return "", err
+	}
+
+	for _, file := range zipReader.File {
+		if file.Name != "word/document.xml" {
+			continue
+		}
+
+		if file.UncompressedSize64 > RESUME_PARSE_MAX_BYTES*5 {
+			return "", errors.New("docx document is too large")
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+
+		return docxDocumentText(reader)
+	}
+
+	return "", errors.New("docx has no word/document.xml, it may not be a word document")
+}
+
+func docxDocumentText(reader io.Reader) (string, error) {
+	var text strings.Builder
+	decoder := xml.NewDecoder(reader)
+	inText := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return text.String(), err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteString("\t")
+			case "br", "cr":
+				text.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(element)
+			}
+		}
+	}
+
+	return text.String(), nil
+}
+
+// Best effort: contact details from anywhere, the rest by section heading
+func parseResumeText(text string) ParsedResume {
+	parsed := ParsedResume{}
+
+	lines := []string{}
+	for _, line := range strings.Split(strings.Replace(text, "\r", "\n", -1), "\n") {
+		line = strings.TrimSpace(strings.Join(strings.Fields(line), " "))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	parsed.Email = resumeEmailRegexp.FindString(text)
+	parsed.Phone = strings.TrimSpace(resumePhoneRegexp.FindString(text))
+
+	sections := map[string][]string{}
+	section := RESUME_SECTION_HEADER
+	for _, line := range lines {
+		heading := strings.ToLower(strings.TrimRight(line, ":"))
+		if found, isHeading := resumeSectionHeadings[heading]; isHeading {
+			section = found
+			continue
+		}
+		sections[section] = append(sections[section], line)
+	}
+
+	header := sections[RESUME_SECTION_HEADER]
+	for _, line := range header {
+		if parsed.Name == "" && looksLikeResumeName(line) {
+			parsed.Name = line
+		}
+		if parsed.City == "" {
+			if match := resumeLocationRegexp.FindStringSubmatch(line); match != nil {
+				parsed.City, parsed.State = strings.TrimSpace(match[1]), match[2]
+			}
+		}
+	}
+
+	parsed.Summary = strings.Join(sections[RESUME_SECTION_SUMMARY], " ")
+	parsed.WorkHistory = parseResumeExperience(sections[RESUME_SECTION_EXPERIENCE])
+	parsed.Education = parseResumeEducation(sections[RESUME_SECTION_EDUCATION])
+	parsed.Skills = splitResumeSkills(strings.Join(sections[RESUME_SECTION_SKILLS], "\n"))
+
+	return parsed
+}
+
+func looksLikeResumeName(line string) bool {
+	if strings.ContainsAny(line, "@0123456789|,:/") {
+		return false
+	}
+	words := strings.Fields(line)
+	if len(words) < 2 || len(words) > 4 {
+		return false
+	}
+	for _, word := range words {
+		if !unicode.IsUpper([]rune(word)[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Each position starts at a line with a date range. The title and company are on that line or
+// the one before it, everything after is the description.
+func parseResumeExperience(lines []string) []ParsedResumePosition {
+	positions := []ParsedResumePosition{}
+
+	var current *ParsedResumePosition
+	description := []string{}
+
+	finish := func() {
+		if current != nil {
+			current.Description = strings.Join(description, "\n")
+			positions = append(positions, *current)
+		}
+		description = description[:0]
+	}
+
+	for index, line := range lines {
+		match := resumeDateRange.FindStringSubmatchIndex(line)
+		if match == nil {
+			description = append(description, line)
+			continue
+		}
+
+		// the line before the dates was the heading of this position, not the last one's description
+		heading := strings.TrimSpace(line[:match[0]] + " " + line[match[1]:])
+		heading = strings.Trim(heading, " |,-–—")
+		if heading == "" && index > 0 && len(description) > 0 {
+			heading = description[len(description)-1]
+			description = description[:len(description)-1]
+		}
+
+		finish()
+
+		position := ParsedResumePosition{
+			From: resumeTextDate(line[match[2]:match[3]]),
+		}
+		end := strings.ToLower(line[match[4]:match[5]])
+		if end == "present" || end == "current" || end == "now" || end == "today" {
+			position.Current = true
+		} else {
+			position.To = resumeTextDate(line[match[4]:match[5]])
+		}
+
+		position.Title, position.Company = splitResumePositionHeading(heading)
+		if loc := resumeLocationRegexp.FindStringSubmatch(heading); loc != nil {
+			position.City, position.State = strings.TrimSpace(loc[1]), loc[2]
+			position.Company = strings.TrimSpace(strings.Replace(position.Company, loc[0], "", 1))
+			position.Company = strings.Trim(position.Company, " ,|-")
+		}
+
+		current = &position
+	}
+	finish()
+
+	return positions
+}
+
+func splitResumePositionHeading(heading string) (string, string) {
+	for _, separator := range []string{" at ", " | ", " - ", " – ", " — ", ", "} {
+		if parts := strings.SplitN(heading, separator, 2); len(parts) == 2 {
+			return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		}
+	}
+	return heading, ""
+}
+
+func parseResumeEducation(lines []string) []ParsedResumeSchool {
+	schools := []ParsedResumeSchool{}
+
+	var current *ParsedResumeSchool
+	for _, line := range lines {
+		isSchool := resumeSchoolRegexp.MatchString(line)
+		degree := strings.TrimSpace(resumeDegreeRegexp.FindString(line))
+
+		if isSchool && (current == nil || current.SchoolName != "") {
+			if current != nil {
+				schools = append(schools, *current)
+			}
+			current = &ParsedResumeSchool{}
+		}
+		if current == nil && degree != "" {
+			current = &ParsedResumeSchool{}
+		}
+		if current == nil {
+			continue
+		}
+
+		if isSchool && current.SchoolName == "" {
+			current.SchoolName = strings.Trim(resumeDateRange.ReplaceAllString(line, ""), " ,|-–—")
+		}
+		if degree != "" && current.Degree == "" {
+			current.Degree = degree
+			if in := strings.Index(strings.ToLower(line), " in "); in != -1 {
+				current.Field = strings.Trim(resumeDateRange.ReplaceAllString(line[in+4:], ""), " ,|-–—")
+			}
+		}
+		if match := resumeDateRange.FindStringSubmatch(line); match != nil {
+			current.From = resumeTextDate(match[1])
+			current.To = resumeTextDate(match[2])
+		}
+	}
+	if current != nil {
+		schools = append(schools, *current)
+	}
+
+	return schools
+}
+
+// "Jan 2019", "01/2019", "1/19" or "2019" as yyyy-mm-dd
+func resumeTextDate(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	months := []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	for index, month := range months {
+		if strings.HasPrefix(value, month) {
+			fields := strings.Fields(value)
+			return resumeMonthDate(fields[len(fields)-1], strconv.Itoa(index+1))
+		}
+	}
+
+	if parts := strings.Split(value, "/"); len(parts) == 2 {
+		year := parts[1]
+		if len(year) == 2 {
+			year = "20" + year
+			if yearInt, _ := strconv.Atoi(year); yearInt > time.Now().Year()+1 {
+				year = "19" + parts[1]
+			}
+		}
+		return resumeMonthDate(year, parts[0])
+	}
+
+	if len(value) == 4 {
+		return resumeMonthDate(value, "")
+	}
+
+	return ""
+}
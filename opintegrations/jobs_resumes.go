@@ -0,0 +1,407 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"opapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// What we could pull out of a resume. Stored on the JobApplication as json, with the
+// skills and keywords copied onto their own columns so applications can be searched.
+type ParsedResume struct {
+	Format      string                 `json:"format"`
+	Name        string                 `json:"name"`
+	Email       string                 `json:"email"`
+	Phone       string                 `json:"phone"`
+	City        string                 `json:"city"`
+	State       string                 `json:"state"`
+	Summary     string                 `json:"summary"`
+	Skills      []string               `json:"skills"`
+	WorkHistory []ParsedResumePosition `json:"work_history"`
+	Education   []ParsedResumeSchool   `json:"education"`
+	Parsed      int64                  `json:"parsed"`
+}
+
+// From and To are yyyy-mm-dd like OnePoint wants, blank when the resume didn't say
+type ParsedResumePosition struct {
+	Title       string `json:"title"`
+	Company     string `json:"company"`
+	City        string `json:"city"`
+	State       string `json:"state"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Current     bool   `json:"current"`
+	Description string `json:"description"`
+}
+
+type ParsedResumeSchool struct {
+	SchoolName string `json:"school_name"`
+	Degree     string `json:"degree"`
+	Field      string `json:"field"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+}
+
+const (
+	RESUME_FORMAT_PDF         = "pdf"
+	RESUME_FORMAT_DOCX        = "docx"
+	RESUME_FORMAT_HRXML       = "hrxml"
+	RESUME_FORMAT_TEXT        = "text"
+	RESUME_FORMAT_INDEED_JSON = "indeed_json"
+
+	// anything bigger is not a resume, don't spend the request parsing it
+	RESUME_PARSE_MAX_BYTES = 10 * 1024 * 1024
+
+	RESUME_SKILLS_MAX_LENGTH   = 2000
+	RESUME_KEYWORDS_MAX_LENGTH = 5000
+)
+
+func (r ParsedResume) Value() (driver.Value, error) {
+	j, err := json.Marshal(r)
+	return j, err
+}
+
+func (r *ParsedResume) Scan(src interface{}) error {
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("Type assertion .([]byte) failed.")
+	}
+
+	return json.Unmarshal(source, r)
+}
+
+func getApplicationResumeHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	thisApp := JobApplication{}
+	err = dbmap.SelectOne(&thisApp, "SELECT * FROM job_applications WHERE id = ? AND company_id = ?", c.Param("appID"), thisCompany.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not found"})
+		return
+	}
+
+	if thisApp.ParsedResume == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Resume has not been parsed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, thisApp.ParsedResume)
+}
+
+// Works out the format from the file itself since boards aren't reliable about extensions.
+// Runs entirely in process, resumes never leave our servers to be parsed.
+func parseResume(fileData []byte, fileExtension string) (parsed ParsedResume, err error) {
+	if len(fileData) == 0 {
+		return parsed, errors.New("resume is empty")
+	}
+	if len(fileData) > RESUME_PARSE_MAX_BYTES {
+		return parsed, errors.New(fmt.Sprintf("resume is %d bytes, over the parse limit", len(fileData)))
+	}
+
+	// resumes are whatever the applicant uploaded, a malformed one must not take the request down
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("resume parse panic: %v", r))
+		}
+	}()
+
+	extension := strings.ToLower(strings.TrimPrefix(fileExtension, "."))
+
+	switch {
+	case strings.HasPrefix(string(fileData[:minInt(len(fileData), 5)]), "%PDF"):
+		text, err := extractPDFText(fileData)
+		if err != nil {
+			return parsed, err
+		}
+		parsed = parseResumeText(text)
+		parsed.Format = RESUME_FORMAT_PDF
+	case strings.HasPrefix(string(fileData[:minInt(len(fileData), 2)]), "PK"):
+		text, err := extractDOCXText(fileData)
+		if err != nil {
+			return parsed, err
+		}
+		parsed = parseResumeText(text)
+		parsed.Format = RESUME_FORMAT_DOCX
+	case extension == "xml" || strings.HasPrefix(strings.TrimSpace(string(fileData[:minInt(len(fileData), 100)])), "<"):
+		parsed, err = parseHRXMLResume(fileData)
+		if err != nil {
+			return parsed, err
+		}
+	case extension == "txt" || extension == "text" || extension == "":
+		parsed = parseResumeText(string(fileData))
+		parsed.Format = RESUME_FORMAT_TEXT
+	default:
+		return parsed, errors.New(fmt.Sprintf("unsupported resume format %q", extension))
+	}
+
+	parsed.Parsed = time.Now().Unix()
+	return parsed, nil
+}
+
+func parseBase64Resume(resumeBase64 *string, fileExtension string) (ParsedResume, error) {
+	if resumeBase64 == nil || *resumeBase64 == "" {
+		return ParsedResume{}, errors.New("resume is empty")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(*resumeBase64)
+	if err != nil {
+		return ParsedResume{}, err
+	}
+
+	return parseResume(decoded, fileExtension)
+}
+
+// Indeed already gives us a structured resume most of the time, the HR-XML and then the file
+// are only used when it didn't
+func (app *IndeedJobAppPost) ParseResume() (ParsedResume, error) {
+	if app.parsedResume != nil {
+		return *app.parsedResume, nil
+	}
+
+	resumeJSON := app.Applicant.Resume.JSON
+
+	var parsed ParsedResume
+	var err error
+
+	switch {
+	case resumeJSON.Positions.Total > 0 || resumeJSON.Educations.Total > 0:
+		parsed = ParsedResume{
+			Format:  RESUME_FORMAT_INDEED_JSON,
+			Name:    app.Applicant.FullName,
+			Email:   app.Applicant.Email,
+			Phone:   app.Applicant.PhoneNumber,
+			Summary: resumeJSON.Summary,
+			Skills:  splitResumeSkills(resumeJSON.Skills),
+			Parsed:  time.Now().Unix(),
+		}
+		parsed.City, parsed.State = splitResumeLocation(resumeJSON.Location.City)
+
+		for _, position := range resumeJSON.Positions.Values {
+			parsedPosition := ParsedResumePosition{
+				Title:       position.Title,
+				Company:     position.Company,
+				Current:     position.EndCurrent,
+				Description: position.Description,
+				From:        resumeMonthDate(position.StartDateYear, position.StartDateMonth),
+			}
+			if !position.EndCurrent {
+				parsedPosition.To = resumeMonthDate(position.EndDateYear, position.EndDateMonth)
+			}
+			parsedPosition.City, parsedPosition.State = splitResumeLocation(position.Location)
+			parsed.WorkHistory = append(parsed.WorkHistory, parsedPosition)
+		}
+
+		for _, school := range resumeJSON.Educations.Values {
+			parsed.Education = append(parsed.Education, ParsedResumeSchool{
+				SchoolName: school.School,
+				Degree:     school.Degree,
+				Field:      school.Field,
+				From:       school.StartDate,
+				To:         school.EndDate,
+			})
+		}
+	case app.Applicant.Resume.HrXML != "":
+		parsed, err = parseResume([]byte(app.Applicant.Resume.HrXML), "xml")
+	case app.Applicant.Resume.File.Data != "":
+		fileString, fileExtension := app.GetResumeFileAndExtension()
+		parsed, err = parseBase64Resume(fileString, fileExtension)
+	case app.Applicant.Resume.Text != "":
+		parsed, err = parseResume([]byte(app.Applicant.Resume.Text), "txt")
+	default:
+		err = errors.New("indeed application has no resume")
+	}
+
+	if err != nil {
+		return parsed, err
+	}
+
+	app.parsedResume = &parsed
+	return parsed, nil
+}
+
+func (app *ZRJobAppPost) ParseResume() (ParsedResume, error) {
+	if app.parsedResume != nil {
+		return *app.parsedResume, nil
+	}
+
+	fileString, fileExtension := app.GetResumeFileAndExtension()
+	parsed, err := parseBase64Resume(fileString, fileExtension)
+	if err != nil {
+		return parsed, err
+	}
+
+	app.parsedResume = &parsed
+	return parsed, nil
+}
+
+// Keeps the parsed resume and flattens it into the columns search looks at
+func (app *JobApplication) setParsedResume(parsed ParsedResume) {
+	app.ParsedResume = &parsed
+	app.ResumeSkills = truncateResumeField(strings.ToLower(strings.Join(parsed.Skills, ", ")), RESUME_SKILLS_MAX_LENGTH)
+
+	keywords := []string{}
+	for _, position := range parsed.WorkHistory {
+		keywords = append(keywords, position.Title, position.Company)
+	}
+	for _, school := range parsed.Education {
+		keywords = append(keywords, school.SchoolName, school.Degree, school.Field)
+	}
+	keywords = append(keywords, parsed.Skills...)
+
+	app.ResumeKeywords = truncateResumeField(strings.ToLower(strings.Join(uniqueResumeStrings(keywords), " ")), RESUME_KEYWORDS_MAX_LENGTH)
+}
+
+// Only fills what the board didn't already give us, the board's own fields are more reliable than parsing
+func (parsed *ParsedResume) applyToOPApplicant(applicant *opapi.Applicant) {
+	if applicant.Phones == nil && parsed.Phone != "" {
+		applicant.Phones = &opapi.ApplicantPhones{
+			CellPhone:      parsed.Phone,
+			PreferredPhone: "CELL",
+		}
+	}
+
+	if applicant.Address == nil {
+		applicant.Address = &opapi.ApplicantAddress{Country: "USA"}
+	}
+	if applicant.Address.City == "" && applicant.Address.State == "" {
+		applicant.Address.City = parsed.City
+		applicant.Address.State = parsed.State
+	}
+
+	if applicant.WorkExperiences == nil && len(parsed.WorkHistory) > 0 {
+		opPositions := []opapi.ApplicantWorkExperience{}
+		for i, position := range parsed.WorkHistory {
+			opPosition := opapi.ApplicantWorkExperience{
+				Index: i + 1,
+				Company: &opapi.ApplicantCompany{
+					Name:  position.Company,
+					City:  position.City,
+					State: position.State,
+				},
+			}
+
+			title := opapi.ApplicantJobTitle{
+				Index:          0,
+				JobTitle:       position.Title,
+				JobDescription: position.Description,
+				From:           position.From,
+				To:             position.To,
+			}
+			opPosition.JobTitles = &[]opapi.ApplicantJobTitle{title}
+
+			opPositions = append(opPositions, opPosition)
+		}
+		applicant.WorkExperiences = &opPositions
+	}
+
+	if applicant.Education == nil && len(parsed.Education) > 0 {
+		schools := []opapi.ApplicantSchool{}
+		for _, school := range parsed.Education {
+			if school.SchoolName == "" {
+				continue
+			}
+			// Country is required by OP and resumes rarely say
+			schools = append(schools, opapi.ApplicantSchool{SchoolName: school.SchoolName, Country: "USA"})
+		}
+		if len(schools) > 0 {
+			applicant.Education = &opapi.ApplicantEducation{}
+			applicant.Education.Schools = &schools
+		}
+	}
+
+	if applicant.Summary == "" {
+		applicant.Summary = parsed.Summary
+	}
+	if applicant.OtherSkills == "" {
+		applicant.OtherSkills = strings.Join(parsed.Skills, ", ")
+	}
+}
+
+// "Sanger, CA" into its parts
+func splitResumeLocation(location string) (string, string) {
+	parts := strings.Split(location, ",")
+	if len(parts) < 2 {
+		return strings.TrimSpace(location), ""
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+}
+
+// Indeed sends -1 when it doesn't know
+func resumeMonthDate(year, month string) string {
+	if year == "" || year == "-1" {
+		return ""
+	}
+	if month == "" || month == "-1" {
+		month = "01"
+	}
+	if len(month) == 1 {
+		month = "0" + month
+	}
+	return fmt.Sprintf("%s-%s-01", year, month)
+}
+
+func splitResumeSkills(skills string) []string {
+	fields := strings.FieldsFunc(skills, func(r rune) bool {
+		return r == ',' || r == ';' || r == '|' || r == '\n' || r == '•' || r == '·'
+	})
+
+	cleaned := []string{}
+	for _, field := range fields {
+		field = strings.Trim(strings.TrimSpace(field), "-*")
+		field = strings.TrimSpace(field)
+		if field == "" || len(field) > 60 {
+			continue
+		}
+		cleaned = append(cleaned, field)
+	}
+
+	return uniqueResumeStrings(cleaned)
+}
+
+func uniqueResumeStrings(values []string) []string {
+	seen := make(map[string]bool)
+	unique := []string{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		key := strings.ToLower(value)
+		if value == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, value)
+	}
+	return unique
+}
+
+func truncateResumeField(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+
+	// cut on a word so search never sees half a skill
+	cut := strings.LastIndex(value[:max], " ")
+	if cut <= 0 {
+		cut = max
+	}
+	return value[:cut]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
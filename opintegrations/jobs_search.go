@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	APPLICATION_SEARCH_DEFAULT_LIMIT = 25
+	APPLICATION_SEARCH_MAX_LIMIT     = 100
+	APPLICATION_SEARCH_DATE_FORMAT   = "2006-01-02"
+
+	APPLICATION_SEARCH_SORT_APPLIED = "applied_on"
+	APPLICATION_SEARCH_SORT_NAME    = "name"
+)
+
+// Filters from the recruiting dashboard, everything is optional and ANDed together
+type JobApplicationSearch struct {
+	CompanyID   int64
+	Query       string
+	Name        string
+	Email       string
+	Source      string
+	OPJobID     string
+	CandidateID int64
+	Keywords    string
+	AppliedFrom int64
+	AppliedTo   int64
+	Reviewed    *bool
+	AppliedOnOP *bool
+	Sort        string
+	Descending  bool
+	Cursor      *JobApplicationSearchCursor
+	Limit       int
+}
+
+// Keyset position of the last row on a page, opaque to the dashboard
+type JobApplicationSearchCursor struct {
+	SortValue string `json:"v"`
+	ID        int64  `json:"id"`
+}
+
+type JobApplicationSearchResult struct {
+	Applications []JobApplication `json:"applications"`
+	NextCursor   string           `json:"next_cursor"`
+}
+
+func searchJobApplicationsHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	search, err := jobApplicationSearchFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	search.CompanyID = thisCompany.ID
+
+	result, err := searchJobApplications(search)
+	if err != nil {
+		ErrorLog.Printf("searchJobApplicationsHandler company: %s, err: %v\n", thisCompany.ShortName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func jobApplicationSearchFromQuery(c *gin.Context) (JobApplicationSearch, error) {
+	search := JobApplicationSearch{
+		Query:    strings.TrimSpace(c.Query("q")),
+		Name:     strings.TrimSpace(c.Query("name")),
+		Email:    strings.ToLower(strings.TrimSpace(c.Query("email"))),
+		Source:   strings.TrimSpace(c.Query("source")),
+		OPJobID:  strings.TrimSpace(c.Query("job_id")),
+		Keywords: strings.TrimSpace(c.Query("keywords")),
+		Sort:     APPLICATION_SEARCH_SORT_APPLIED,
+		Limit:    APPLICATION_SEARCH_DEFAULT_LIMIT,
+	}
+
+	var err error
+	if candidateParam := c.Query("candidate_id"); candidateParam != "" {
+		search.CandidateID, err = strconv.ParseInt(candidateParam, 10, 64)
+		if err != nil {
+			return search, errors.New("candidate_id must be a number")
+		}
+	}
+
+	if fromParam := c.Query("from"); fromParam != "" {
+		from, err := time.Parse(APPLICATION_SEARCH_DATE_FORMAT, fromParam)
+		if err != nil {
+			return search, errors.New("from must be formatted YYYY-MM-DD")
+		}
+		search.AppliedFrom = from.UnixNano() / int64(time.Millisecond)
+	}
+
+	// to is inclusive of the whole day
+	if toParam := c.Query("to"); toParam != "" {
+		to, err := time.Parse(APPLICATION_SEARCH_DATE_FORMAT, toParam)
+		if err != nil {
+			return search, errors.New("to must be formatted YYYY-MM-DD")
+		}
+		search.AppliedTo = to.AddDate(0, 0, 1).UnixNano() / int64(time.Millisecond)
+	}
+
+	search.Reviewed, err = optionalBoolParam(c, "reviewed")
+	if err != nil {
+		return search, err
+	}
+
+	search.AppliedOnOP, err = optionalBoolParam(c, "applied_on_op")
+	if err != nil {
+		return search, err
+	}
+
+	switch c.Query("sort") {
+	case "", APPLICATION_SEARCH_SORT_APPLIED:
+		search.Sort = APPLICATION_SEARCH_SORT_APPLIED
+		search.Descending = true
+	case APPLICATION_SEARCH_SORT_NAME:
+		search.Sort = APPLICATION_SEARCH_SORT_NAME
+	default:
+		return search, errors.New(fmt.Sprintf("sort must be %s or %s", APPLICATION_SEARCH_SORT_APPLIED, APPLICATION_SEARCH_SORT_NAME))
+	}
+
+	switch c.Query("order") {
+	case "":
+	case "asc":
+		search.Descending = false
+	case "desc":
+		search.Descending = true
+	default:
+		return search, errors.New("order must be asc or desc")
+	}
+
+	if limitParam := c.Query("limit"); limitParam != "" {
+		search.Limit, err = strconv.Atoi(limitParam)
+		if err != nil || search.Limit < 1 {
+			return search, errors.New("limit must be a positive number")
+		}
+		if search.Limit > APPLICATION_SEARCH_MAX_LIMIT {
+			search.Limit = APPLICATION_SEARCH_MAX_LIMIT
+		}
+	}
+
+	if cursorParam := c.Query("cursor"); cursorParam != "" {
+		search.Cursor, err = decodeJobApplicationSearchCursor(cursorParam)
+		if err != nil {
+			return search, errors.New("cursor is invalid")
+		}
+	}
+
+	return search, nil
+}
+
+func optionalBoolParam(c *gin.Context, name string) (*bool, error) {
+	param := c.Query(name)
+	if param == "" {
+		return nil, nil
+	}
+
+	value, err := strconv.ParseBool(param)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s must be true or false", name))
+	}
+
+	return &value, nil
+}
+
+// Keyset pagination on (sort column, id) so pages stay stable while new applications come in
+func searchJobApplications(search JobApplicationSearch) (JobApplicationSearchResult, error) {
+	result := JobApplicationSearchResult{Applications: []JobApplication{}}
+
+	conditions := []string{"company_id = ?"}
+	args := []interface{}{search.CompanyID}
+
+	if booleanQuery := fullTextBooleanQuery(search.Query); booleanQuery != "" {
+		conditions = append(conditions, "MATCH (applicant_name, applicant_email, resume_skills, resume_keywords) AGAINST (? IN BOOLEAN MODE)")
+		args = append(args, booleanQuery)
+	}
+	if booleanQuery := fullTextBooleanQuery(search.Keywords); booleanQuery != "" {
+		conditions = append(conditions, "MATCH (resume_skills, resume_keywords) AGAINST (? IN BOOLEAN MODE)")
+		args = append(args, booleanQuery)
+	}
+	if search.Name != "" {
+		conditions = append(conditions, "applicant_name LIKE ?")
+		args = append(args, "%"+escapeLikePattern(search.Name)+"%")
+	}
+	if search.Email != "" {
+		conditions = append(conditions, "applicant_email LIKE ?")
+		args = append(args, escapeLikePattern(search.Email)+"%")
+	}
+	if search.Source != "" {
+		conditions = append(conditions, "source = ?")
+		args = append(args, search.Source)
+	}
+	if search.OPJobID != "" {
+		conditions = append(conditions, "op_job_id = ?")
+		args = append(args, search.OPJobID)
+	}
+	if search.CandidateID != 0 {
+		conditions = append(conditions, "candidate_id = ?")
+		args = append(args, search.CandidateID)
+	}
+	if search.AppliedFrom != 0 {
+		conditions = append(conditions, "applied_on_millis >= ?")
+		args = append(args, search.AppliedFrom)
+	}
+	if search.AppliedTo != 0 {
+		conditions = append(conditions, "applied_on_millis < ?")
+		args = append(args, search.AppliedTo)
+	}
+	if search.Reviewed != nil {
+		conditions = append(conditions, "user_reviewed = ?")
+		args = append(args, *search.Reviewed)
+	}
+	if search.AppliedOnOP != nil {
+		conditions = append(conditions, "COALESCE(applied_on_op, 0) = ?")
+		args = append(args, *search.AppliedOnOP)
+	}
+
+	sortColumn := "applied_on_millis"
+	if search.Sort == APPLICATION_SEARCH_SORT_NAME {
+		sortColumn = "applicant_name"
+	}
+
+	direction, comparison := "ASC", ">"
+	if search.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if search.Cursor != nil {
+		var sortValue interface{} = search.Cursor.SortValue
+		if search.Sort == APPLICATION_SEARCH_SORT_APPLIED {
+			appliedOn, err := strconv.ParseInt(search.Cursor.SortValue, 10, 64)
+			if err != nil {
+				return result, err
+			}
+			sortValue = appliedOn
+		}
+
+		conditions = append(conditions, fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", sortColumn, comparison, sortColumn, comparison))
+		args = append(args, sortValue, sortValue, search.Cursor.ID)
+	}
+
+	// one extra row tells us whether there is another page
+	query := fmt.Sprintf("SELECT * FROM job_applications WHERE %s ORDER BY %s %s, id %s LIMIT ?",
+		strings.Join(conditions, " AND "), sortColumn, direction, direction)
+	args = append(args, search.Limit+1)
+
+	_, err := dbmap.Select(&result.Applications, query, args...)
+	if err != nil {
+		return result, err
+	}
+
+	if len(result.Applications) > search.Limit {
+		result.Applications = result.Applications[:search.Limit]
+		last := result.Applications[len(result.Applications)-1]
+
+		cursor := JobApplicationSearchCursor{ID: last.ID, SortValue: last.ApplicantName}
+		if search.Sort == APPLICATION_SEARCH_SORT_APPLIED {
+			cursor.SortValue = strconv.FormatInt(last.AppliedOnMillis, 10)
+		}
+		result.NextCursor = cursor.encode()
+	}
+
+	return result, nil
+}
+
+// Every word is required and matched as a prefix, "forkl dri" finds forklift drivers
+func fullTextBooleanQuery(input string) string {
+	terms := []string{}
+	for _, word := range strings.Fields(input) {
+		word = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`+-<>()~*"@`, r) {
+				return -1
+			}
+			return r
+		}, word)
+
+		if word != "" {
+			terms = append(terms, "+"+word+"*")
+		}
+	}
+
+	return strings.Join(terms, " ")
+}
+
+func escapeLikePattern(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+func (cursor JobApplicationSearchCursor) encode() string {
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeJobApplicationSearchCursor(value string) (*JobApplicationSearchCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor := &JobApplicationSearchCursor{}
+	err = json.Unmarshal(decoded, cursor)
+	if err != nil {
+		return nil, err
+	}
+	if cursor.ID == 0 {
+		return nil, errors.New("cursor is missing id")
+	}
+
+	return cursor, nil
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type SMSProvider interface {
+	// returns the provider's id for the message
+	SendSMS(to, body string) (string, error)
+}
+
+// Speaks Twilio's Messages API, BaseURL can point at a local stand-in for testing
+type TwilioSMSProvider struct {
+	BaseURL    string
+	AccountSID string
+	AuthToken  string
+	From       string
+	Client     *http.Client
+}
+
+type twilioMessageResponse struct {
+	SID     string `json:"sid"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+// Which channels a company's finish and reminder messages go out on, and when texts are allowed
+type CompanySMSSettings struct {
+	ID             int64  `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID      int64  `db:"company_id" json:"company_id"`
+	Enabled        bool   `db:"enabled" json:"enabled"`
+	Channel        string `db:"channel,size:10" json:"channel"`
+	QuietStartHour int    `db:"quiet_start_hour" json:"quiet_start_hour"`
+	QuietEndHour   int    `db:"quiet_end_hour" json:"quiet_end_hour"`
+	Timezone       string `db:"timezone,size:50" json:"timezone"`
+	Updated        int64  `db:"updated" json:"updated"`
+}
+
+// Outbox and delivery log in one, texts wait here until they are out of quiet hours
+type SMSMessage struct {
+	ID            int64  `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID     int64  `db:"company_id" json:"company_id"`
+	ApplicationID int64  `db:"application_id" json:"application_id"`
+	To            string `db:"to_number,size:20" json:"to"`
+	Body          string `db:"body,size:1000" json:"body"`
+	Kind          string `db:"kind,size:20" json:"kind"`
+	Status        string `db:"status,size:20" json:"status"`
+	SendAfter     int64  `db:"send_after" json:"send_after"`
+	Attempts      int    `db:"attempts" json:"attempts"`
+	Sent          int64  `db:"sent" json:"sent"`
+	ProviderID    string `db:"provider_id,size:64" json:"provider_id"`
+	Error         string `db:"error,size:500" json:"error"`
+	Created       int64  `db:"created" json:"created"`
+}
+
+// Opt outs are per number, not per company, everyone shares our sending number
+type SMSOptOut struct {
+	ID      int64  `db:"id, primarykey, autoincrement" json:"id"`
+	Phone   string `db:"phone,size:20" json:"phone"`
+	Keyword string `db:"keyword,size:20" json:"keyword"`
+	Created int64  `db:"created" json:"created"`
+}
+
+const (
+	SMS_CHANNEL_EMAIL = "email"
+	SMS_CHANNEL_SMS   = "sms"
+	SMS_CHANNEL_BOTH  = "both"
+
+	SMS_STATUS_QUEUED    = "queued"
+	SMS_STATUS_SENT      = "sent"
+	SMS_STATUS_FAILED    = "failed"
+	SMS_STATUS_OPTED_OUT = "opted_out"
+
+	SMS_KIND_FINISH   = "finish"
+	SMS_KIND_REMINDER = "reminder"
+
+	SMS_DEFAULT_QUIET_START = 21
+	SMS_DEFAULT_QUIET_END   = 8
+	SMS_DEFAULT_TIMEZONE    = "America/Los_Angeles"
+	SMS_MAX_ATTEMPTS        = 3
+	SMS_OUTBOX_BATCH        = 200
+
+	TWILIO_DEFAULT_BASE_URL = "https://api.twilio.com"
+	SMS_INBOUND_URL         = "https://connect.onehcm.com/api/recruitment/sms/inbound"
+)
+
+var smsStopKeywords = []string{"STOP", "STOPALL", "UNSUBSCRIBE", "CANCEL", "END", "QUIT"}
+var smsStartKeywords = []string{"START", "UNSTOP", "YES"}
+
+// Where the applicant most likely is, states that span zones get their most populated one
+var usStateTimezones = map[string]string{
+	"AL": "America/Chicago", "AK": "America/Anchorage", "AZ": "America/Phoenix", "AR": "America/Chicago",
+	"CA": "America/Los_Angeles", "CO": "America/Denver", "CT": "America/New_York", "DE": "America/New_York",
+	"DC": "America/New_York", "FL": "America/New_York", "GA": "America/New_York", "HI": "Pacific/Honolulu",
+	"ID": "America/Boise", "IL": "America/Chicago", "IN": "America/Indiana/Indianapolis", "IA": "America/Chicago",
+	"KS": "America/Chicago", "KY": "America/New_York", "LA": "America/Chicago", "ME": "America/New_York",
+	"MD": "America/New_York", "MA": "America/New_York", "MI": "America/Detroit", "MN": "America/Chicago",
+	"MS": "America/Chicago", "MO": "America/Chicago", "MT": "America/Denver", "NE": "America/Chicago",
+	"NV": "America/Los_Angeles", "NH": "America/New_York", "NJ": "America/New_York", "NM": "America/Denver",
+	"NY": "America/New_York", "NC": "America/New_York", "ND": "America/Chicago", "OH": "America/New_York",
+	"OK": "America/Chicago", "OR": "America/Los_Angeles", "PA": "America/New_York", "RI": "America/New_York",
+	"SC": "America/New_York", "SD": "America/Chicago", "TN": "America/Chicago", "TX": "America/Chicago",
+	"UT": "America/Denver", "VT": "America/New_York", "VA": "America/New_York", "WA": "America/Los_Angeles",
+	"WV": "America/New_York", "WI": "America/Chicago", "WY": "America/Denver", "PR": "America/Puerto_Rico",
+}
+
+func registerSMSRoutes(router *gin.Engine) {
+	router.GET("/api/recruitment/sms/settings", getSMSSettingsHandler)
+	router.POST("/api/recruitment/sms/settings", updateSMSSettingsHandler)
+	router.GET("/api/recruitment/sms/messages", getSMSMessagesHandler)
+	router.POST("/api/recruitment/sms/inbound", verifyInboundWebhook(WEBHOOK_SOURCE_SMS, verifyTwilioWebhook), smsInboundHandler)
+}
+
+func newTwilioSMSProvider() *TwilioSMSProvider {
+	baseURL := passwords.TWILIO_BASE_URL
+	if baseURL == "" {
+		baseURL = TWILIO_DEFAULT_BASE_URL
+	}
+
+	return &TwilioSMSProvider{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		AccountSID: passwords.TWILIO_ACCOUNT_SID,
+		AuthToken:  passwords.TWILIO_AUTH_TOKEN,
+		From:       passwords.TWILIO_FROM_NUMBER,
+		Client:     &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+func (p *TwilioSMSProvider) SendSMS(to, body string) (string, error) {
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("From", p.From)
+	form.Set("Body", body)
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", p.BaseURL, p.AccountSID)
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(p.AccountSID, p.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	message := twilioMessageResponse{}
+	json.Unmarshal(respBody, &message)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", errors.New(fmt.Sprintf("twilio status %d, code %d: %s", resp.StatusCode, message.Code, message.Message))
+	}
+
+	return message.SID, nil
+}
+
+// Outside production we only text when pointed at a stand-in, never real phones
+func currentSMSProvider() SMSProvider {
+	if !env.Production && passwords.TWILIO_BASE_URL == "" {
+		return nil
+	}
+
+	return newTwilioSMSProvider()
+}
+
+func getSMSSettingsHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	c.JSON(http.StatusOK, lookupCompanySMSSettings(thisCompany.ID))
+}
+
+func updateSMSSettingsHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	input := CompanySMSSettings{}
+	err = c.ShouldBindWith(&input, binding.JSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	switch input.Channel {
+	case SMS_CHANNEL_EMAIL, SMS_CHANNEL_SMS, SMS_CHANNEL_BOTH:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("channel must be %s, %s or %s", SMS_CHANNEL_EMAIL, SMS_CHANNEL_SMS, SMS_CHANNEL_BOTH)})
+		return
+	}
+
+	if input.QuietStartHour < 0 || input.QuietStartHour > 23 || input.QuietEndHour < 0 || input.QuietEndHour > 23 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quiet hours must be between 0 and 23"})
+		return
+	}
+
+	if input.Timezone == "" {
+		input.Timezone = SMS_DEFAULT_TIMEZONE
+	}
+	if _, err = time.LoadLocation(input.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown timezone"})
+		return
+	}
+
+	settings := CompanySMSSettings{}
+	err = dbmap.SelectOne(&settings, "SELECT * FROM company_sms_settings WHERE company_id = ?", thisCompany.ID)
+	exists := err == nil
+
+	settings.CompanyID = thisCompany.ID
+	settings.Enabled = input.Enabled
+	settings.Channel = input.Channel
+	settings.QuietStartHour = input.QuietStartHour
+	settings.QuietEndHour = input.QuietEndHour
+	settings.Timezone = input.Timezone
+	settings.Updated = time.Now().Unix()
+
+	if exists {
+		_, err = dbmap.Update(&settings)
+	} else {
+		err = dbmap.Insert(&settings)
+	}
+	if err != nil {
+		ErrorLog.Println("updateSMSSettingsHandler save err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+func getSMSMessagesHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	messages := []SMSMessage{}
+	_, err = dbmap.Select(&messages, "SELECT * FROM sms_messages WHERE company_id = ? ORDER BY id DESC LIMIT 100", thisCompany.ID)
+	if err != nil {
+		ErrorLog.Println("getSMSMessagesHandler select err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, messages)
+}
+
+// Twilio posts every reply to our number here, we only act on opt out and opt back in keywords
+func smsInboundHandler(c *gin.Context) {
+	err := c.Request.ParseForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	phone := smsNumber(c.Request.PostForm.Get("From"))
+	keyword := strings.ToUpper(strings.TrimSpace(c.Request.PostForm.Get("Body")))
+
+	if phone != "" {
+		switch {
+		case smsKeywordIn(keyword, smsStopKeywords):
+			err = optOutSMS(phone, keyword)
+		case smsKeywordIn(keyword, smsStartKeywords):
+			_, err = dbmap.Exec("DELETE FROM sms_opt_outs WHERE phone = ?", phone)
+			InfoLog.Println("sms opt back in: ", phone)
+		}
+		if err != nil {
+			ErrorLog.Println("smsInboundHandler opt out update err: ", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+			return
+		}
+	}
+
+	// Twilio sends the carrier required STOP/START replies itself
+	c.Data(http.StatusOK, "text/xml; charset=utf-8", []byte(`<?xml version="1.0" encoding="UTF-8"?><Response></Response>`))
+}
+
+// https://www.twilio.com/docs/usage/security#validating-requests
+func validTwilioSignature(authToken, requestURL string, params url.Values, signature string) bool {
+	if authToken == "" || signature == "" {
+		return false
+	}
+
+	keys := []string{}
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	signed := requestURL
+	for _, key := range keys {
+		for _, value := range params[key] {
+			signed += key + value
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(signed))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func smsKeywordIn(keyword string, keywords []string) bool {
+	for _, k := range keywords {
+		if keyword == k {
+			return true
+		}
+	}
+	return false
+}
+
+func optOutSMS(phone, keyword string) error {
+	count, err := dbmap.SelectInt("SELECT COUNT(*) FROM sms_opt_outs WHERE phone = ?", phone)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		err = dbmap.Insert(&SMSOptOut{Phone: phone, Keyword: keyword, Created: time.Now().Unix()})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = dbmap.Exec("UPDATE sms_messages SET status = ? WHERE to_number = ? AND status = ?", SMS_STATUS_OPTED_OUT, phone, SMS_STATUS_QUEUED)
+	InfoLog.Println("sms opt out: ", phone)
+
+	return err
+}
+
+func smsOptedOut(phone string) bool {
+	count, err := dbmap.SelectInt("SELECT COUNT(*) FROM sms_opt_outs WHERE phone = ?", phone)
+	if err != nil {
+		// can't tell, so don't text
+		ErrorLog.Println("smsOptedOut lookup err: ", err)
+		return true
+	}
+	return count > 0
+}
+
+// E.164 for US numbers, anything else we don't text
+func smsNumber(phone string) string {
+	digits := normalizeCandidatePhone(phone)
+	if len(digits) != 10 {
+		return ""
+	}
+	return "+1" + digits
+}
+
+// Companies that never turned on SMS stay email only
+func lookupCompanySMSSettings(companyID int64) CompanySMSSettings {
+	settings := CompanySMSSettings{}
+	err := dbmap.SelectOne(&settings, "SELECT * FROM company_sms_settings WHERE company_id = ?", companyID)
+	if err != nil {
+		return CompanySMSSettings{
+			CompanyID:      companyID,
+			Channel:        SMS_CHANNEL_EMAIL,
+			QuietStartHour: SMS_DEFAULT_QUIET_START,
+			QuietEndHour:   SMS_DEFAULT_QUIET_END,
+			Timezone:       SMS_DEFAULT_TIMEZONE,
+		}
+	}
+
+	return settings
+}
+
+func (s CompanySMSSettings) usesSMS() bool {
+	return s.Enabled && (s.Channel == SMS_CHANNEL_SMS || s.Channel == SMS_CHANNEL_BOTH)
+}
+
+func (s CompanySMSSettings) usesEmail() bool {
+	return !s.usesSMS() || s.Channel == SMS_CHANNEL_BOTH
+}
+
+// The applicant's state from their resume when we have it, otherwise the company's timezone
+func (s CompanySMSSettings) applicantLocation(jobApp *JobApplication) *time.Location {
+	if jobApp.ParsedResume != nil {
+		if zone, exists := usStateTimezones[strings.ToUpper(strings.TrimSpace(jobApp.ParsedResume.State))]; exists {
+			if loc, err := time.LoadLocation(zone); err == nil {
+				return loc
+			}
+		}
+	}
+
+	if loc, err := time.LoadLocation(s.Timezone); err == nil {
+		return loc
+	}
+
+	loc, _ := time.LoadLocation(SMS_DEFAULT_TIMEZONE)
+	return loc
+}
+
+// Now if it isn't quiet hours where the applicant is, otherwise when quiet hours end
+func (s CompanySMSSettings) nextSendTime(now time.Time, loc *time.Location) time.Time {
+	if s.QuietStartHour == s.QuietEndHour {
+		return now
+	}
+
+	local := now.In(loc)
+	hour := local.Hour()
+
+	inQuietHours := false
+	if s.QuietStartHour < s.QuietEndHour {
+		inQuietHours = hour >= s.QuietStartHour && hour < s.QuietEndHour
+	} else {
+		inQuietHours = hour >= s.QuietStartHour || hour < s.QuietEndHour
+	}
+
+	if !inQuietHours {
+		return now
+	}
+
+	sendAt := time.Date(local.Year(), local.Month(), local.Day(), s.QuietEndHour, 0, 0, 0, loc)
+	if !sendAt.After(local) {
+		sendAt = sendAt.AddDate(0, 0, 1)
+	}
+
+	return sendAt
+}
+
+func smsBodyForApplication(kind string, company Company, jobTitle, applyURL string) string {
+	if kind == SMS_KIND_REMINDER {
+		return fmt.Sprintf("Reminder from %s: your application for %s isn't finished yet. Finish here: %s Reply STOP to opt out.", company.Name, jobTitle, applyURL)
+	}
+
+	return fmt.Sprintf("%s: thanks for applying for %s! Finish your application here: %s Reply STOP to opt out.", company.Name, jobTitle, applyURL)
+}
+
+// Errors when this applicant can't be texted, so the caller can fall back to email
+func queueJobAppSMS(jobApp *JobApplication, company Company, settings CompanySMSSettings, kind, body string) error {
+	phone := smsNumber(jobApp.ApplicantPhoneNumber)
+	if phone == "" {
+		return errors.New("no textable phone number")
+	}
+
+	if smsOptedOut(phone) {
+		return errors.New("phone number opted out of texts")
+	}
+
+	now := time.Now()
+	message := SMSMessage{
+		CompanyID:     company.ID,
+		ApplicationID: jobApp.ID,
+		To:            phone,
+		Body:          body,
+		Kind:          kind,
+		Status:        SMS_STATUS_QUEUED,
+		SendAfter:     settings.nextSendTime(now, settings.applicantLocation(jobApp)).Unix(),
+		Created:       now.Unix(),
+	}
+
+	err := dbmap.Insert(&message)
+	if err != nil {
+		return err
+	}
+
+	if message.SendAfter <= now.Unix() {
+		go sendQueuedSMS(message)
+	}
+
+	return nil
+}
+
+// Cron picks up texts held for quiet hours and retries failed sends
+func runSMSOutbox() {
+	messages := []SMSMessage{}
+	_, err := dbmap.Select(&messages, "SELECT * FROM sms_messages WHERE status = ? AND send_after <= ? ORDER BY send_after LIMIT ?", SMS_STATUS_QUEUED, time.Now().Unix(), SMS_OUTBOX_BATCH)
+	if err != nil {
+		ErrorLog.Println("runSMSOutbox select err: ", err)
+		return
+	}
+
+	for _, message := range messages {
+		sendQueuedSMS(message)
+	}
+}
+
+func sendQueuedSMS(message SMSMessage) {
+	provider := currentSMSProvider()
+	if provider == nil {
+		InfoLog.Printf("would be texting: to: %s, body: %s\n", message.To, message.Body)
+		return
+	}
+
+	// claim it so the cron and the immediate send don't both text
+	result, err := dbmap.Exec("UPDATE sms_messages SET attempts = attempts + 1 WHERE id = ? AND status = ? AND attempts = ?", message.ID, SMS_STATUS_QUEUED, message.Attempts)
+	if err != nil {
+		ErrorLog.Println("sendQueuedSMS claim err: ", err)
+		return
+	}
+	if claimed, _ := result.RowsAffected(); claimed == 0 {
+		return
+	}
+	message.Attempts++
+
+	if smsOptedOut(message.To) {
+		message.Status = SMS_STATUS_OPTED_OUT
+	} else {
+		providerID, err := provider.SendSMS(message.To, message.Body)
+		if err != nil {
+			ErrorLog.Printf("sendQueuedSMS message: %d, attempt: %d, err: %v\n", message.ID, message.Attempts, err)
+			message.Error = truncateString(err.Error(), 500)
+			if message.Attempts >= SMS_MAX_ATTEMPTS {
+				message.Status = SMS_STATUS_FAILED
+			}
+		} else {
+			message.Status = SMS_STATUS_SENT
+			message.ProviderID = providerID
+			message.Sent = time.Now().Unix()
+			message.Error = ""
+		}
+	}
+
+	_, err = dbmap.Update(&message)
+	if err != nil {
+		ErrorLog.Println("sendQueuedSMS update err: ", err)
+	}
+}
@@ -0,0 +1,637 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// One day of what a board actually charged for a sponsored job, imported from the board's billing export
+type JobSponsorshipSpend struct {
+	ID             int64   `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID      int64   `db:"company_id" json:"company_id"`
+	IntegrationURL string  `db:"integration_url" json:"integration_url"`
+	SponsorshipID  int64   `db:"sponsorship_id" json:"sponsorship_id"`
+	OPJobID        string  `db:"op_job_id" json:"op_job_id"`
+	SpendDate      string  `db:"spend_date,size:10" json:"spend_date"`
+	Amount         float64 `db:"amount" json:"amount"`
+	Clicks         int64   `db:"clicks" json:"clicks"`
+	Imported       int64   `db:"imported" json:"imported"`
+	ImportedBy     *int64  `db:"imported_by" json:"imported_by"`
+}
+
+type SponsorshipSpendImportResult struct {
+	Imported  int                         `json:"imported"`
+	Unmatched []SponsorshipSpendImportRow `json:"unmatched"`
+}
+
+type SponsorshipSpendImportRow struct {
+	Line    int    `json:"line"`
+	OPJobID string `json:"op_job_id"`
+	Date    string `json:"date"`
+	Reason  string `json:"reason"`
+}
+
+type SponsorshipReportRow struct {
+	IntegrationURL     string  `json:"integration_url"`
+	SponsorshipID      int64   `json:"sponsorship_id"`
+	OPJobID            string  `json:"op_job_id"`
+	Status             string  `json:"status"`
+	TimeSubmitted      int64   `json:"time_submitted"`
+	TimeEnd            int64   `json:"time_end"`
+	Budget             float64 `json:"budget"`
+	Spend              float64 `json:"spend"`
+	Clicks             int64   `json:"clicks"`
+	Applications       int64   `json:"applications"`
+	CostPerApplication float64 `json:"cost_per_application"`
+	OverBudget         bool    `json:"over_budget"`
+}
+
+type SponsorshipReport struct {
+	Sponsorships       []SponsorshipReportRow `json:"sponsorships"`
+	TotalBudget        float64                `json:"total_budget"`
+	TotalSpend         float64                `json:"total_spend"`
+	TotalApplications  int64                  `json:"total_applications"`
+	CostPerApplication float64                `json:"cost_per_application"`
+}
+
+type SponsorshipStatusEmailBody struct {
+	CompanyName string
+	BoardName   string
+	JobTitle    string
+	OPJobID     string
+	EndDate     string
+	Budget      string
+	Spend       string
+}
+
+const (
+	SPONSORSHIP_STATUS_REQUESTED      = "requested"
+	SPONSORSHIP_STATUS_ACTIVE         = "active"
+	SPONSORSHIP_STATUS_ENDING_SOON    = "ending_soon"
+	SPONSORSHIP_STATUS_ENDED          = "ended"
+	SPONSORSHIP_STATUS_MANUALLY_ENDED = "manually_ended"
+
+	SPONSORSHIP_ENDING_SOON_WINDOW = 2 * 24 * time.Hour
+	// keeps the first run from emailing about every sponsorship that ended before statuses existed
+	SPONSORSHIP_ENDED_EMAIL_WINDOW = 7 * 24 * time.Hour
+
+	SPONSORSHIP_SPEND_DATE_FORMAT = "2006-01-02"
+)
+
+var sponsorshipSpendDateFormats = []string{"2006-01-02", "01/02/2006", "1/2/2006", "01/02/06", "1/2/06"}
+
+// Where a sponsorship is now. Manually ended follows the manually_ended flag alone so turning it back
+// off picks the sponsorship up again, ended is final, and requested moves to active once the board has
+// been sent a feed built after the sponsorship was submitted.
+func sponsorshipLifecycleStatus(currentStatus string, manuallyEnded *bool, timeSubmitted, timeEnd int64, lastFeedUpload int64, now time.Time) string {
+	if manuallyEnded != nil && *manuallyEnded {
+		return SPONSORSHIP_STATUS_MANUALLY_ENDED
+	}
+
+	if now.Unix() >= timeEnd {
+		return SPONSORSHIP_STATUS_ENDED
+	}
+
+	if (currentStatus == "" || currentStatus == SPONSORSHIP_STATUS_REQUESTED || currentStatus == SPONSORSHIP_STATUS_MANUALLY_ENDED) && lastFeedUpload < timeSubmitted {
+		return SPONSORSHIP_STATUS_REQUESTED
+	}
+
+	if time.Unix(timeEnd, 0).Sub(now) <= SPONSORSHIP_ENDING_SOON_WINDOW {
+		return SPONSORSHIP_STATUS_ENDING_SOON
+	}
+
+	return SPONSORSHIP_STATUS_ACTIVE
+}
+
+func runSponsorshipLifecycle() {
+	InfoLog.Println("starting runSponsorshipLifecycle")
+
+	now := time.Now()
+
+	indeedUploaded, err := lastJobFeedUpload(INDEED_INTEGRATION_URL)
+	if err != nil {
+		ErrorLog.Println("runSponsorshipLifecycle indeed lastJobFeedUpload err: ", err)
+	}
+
+	indeedSponsorships := []IndeedSponsorship{}
+	_, err = dbmap.Select(&indeedSponsorships, "SELECT * FROM indeed_sponsorships WHERE status NOT IN (?, ?) OR ended_email_sent = 0", SPONSORSHIP_STATUS_ENDED, SPONSORSHIP_STATUS_MANUALLY_ENDED)
+	if err != nil {
+		ErrorLog.Println("runSponsorshipLifecycle indeed select err: ", err)
+	}
+
+	for index := range indeedSponsorships {
+		sponsorship := &indeedSponsorships[index]
+		sponsorship.Status = sponsorshipLifecycleStatus(sponsorship.Status, sponsorship.ManuallyEnded, sponsorship.TimeSubmitted, sponsorship.TimeEnd, indeedUploaded, now)
+
+		if sponsorship.Status == SPONSORSHIP_STATUS_ENDING_SOON && sponsorship.EndingSoonEmailSent == 0 {
+			err = sendSponsorshipStatusEmail(sponsorship.CompanyID, INDEED_INTEGRATION_URL, sponsorship.ID, sponsorship.OPJobID, sponsorship.TimeEnd, sponsorship.Budget, sponsorship.UserID, sponsorship.Email)
+			if err != nil {
+				ErrorLog.Println("runSponsorshipLifecycle indeed ending soon email err: ", err)
+			} else {
+				sponsorship.EndingSoonEmailSent = now.Unix()
+			}
+		}
+
+		if sponsorship.Status == SPONSORSHIP_STATUS_ENDED && sponsorship.EndedEmailSent == 0 {
+			if now.Sub(time.Unix(sponsorship.TimeEnd, 0)) <= SPONSORSHIP_ENDED_EMAIL_WINDOW {
+				err = sendSponsorshipStatusEmail(sponsorship.CompanyID, INDEED_INTEGRATION_URL, sponsorship.ID, sponsorship.OPJobID, sponsorship.TimeEnd, sponsorship.Budget, sponsorship.UserID, sponsorship.Email)
+				if err != nil {
+					ErrorLog.Println("runSponsorshipLifecycle indeed ended email err: ", err)
+					continue
+				}
+			}
+			sponsorship.EndedEmailSent = now.Unix()
+		}
+
+		// nobody needs an ended email for a sponsorship they stopped themselves
+		if sponsorship.Status == SPONSORSHIP_STATUS_MANUALLY_ENDED && sponsorship.EndedEmailSent == 0 {
+			sponsorship.EndedEmailSent = now.Unix()
+		}
+
+		_, err = dbmap.Update(sponsorship)
+		if err != nil {
+			ErrorLog.Println("runSponsorshipLifecycle indeed update err: ", err)
+		}
+	}
+
+	zrUploaded, err := lastJobFeedUpload(ZIPRECRUITER_INTEGRATION_URL)
+	if err != nil {
+		ErrorLog.Println("runSponsorshipLifecycle ziprecruiter lastJobFeedUpload err: ", err)
+	}
+
+	zrSponsorships := []ZipRecruiterSponsorship{}
+	_, err = dbmap.Select(&zrSponsorships, "SELECT * FROM ziprecruiter_sponsorships WHERE status NOT IN (?, ?) OR ended_email_sent = 0", SPONSORSHIP_STATUS_ENDED, SPONSORSHIP_STATUS_MANUALLY_ENDED)
+	if err != nil {
+		ErrorLog.Println("runSponsorshipLifecycle ziprecruiter select err: ", err)
+	}
+
+	for index := range zrSponsorships {
+		sponsorship := &zrSponsorships[index]
+		sponsorship.Status = sponsorshipLifecycleStatus(sponsorship.Status, sponsorship.ManuallyEnded, sponsorship.TimeSubmitted, sponsorship.TimeEnd, zrUploaded, now)
+		price := zipRecruiterSponsorshipPrice(sponsorship.Level)
+
+		if sponsorship.Status == SPONSORSHIP_STATUS_ENDING_SOON && sponsorship.EndingSoonEmailSent == 0 {
+			err = sendSponsorshipStatusEmail(sponsorship.CompanyID, ZIPRECRUITER_INTEGRATION_URL, sponsorship.ID, sponsorship.OPJobID, sponsorship.TimeEnd, price, sponsorship.UserID, "")
+			if err != nil {
+				ErrorLog.Println("runSponsorshipLifecycle ziprecruiter ending soon email err: ", err)
+			} else {
+				sponsorship.EndingSoonEmailSent = now.Unix()
+			}
+		}
+
+		if sponsorship.Status == SPONSORSHIP_STATUS_ENDED && sponsorship.EndedEmailSent == 0 {
+			if now.Sub(time.Unix(sponsorship.TimeEnd, 0)) <= SPONSORSHIP_ENDED_EMAIL_WINDOW {
+				err = sendSponsorshipStatusEmail(sponsorship.CompanyID, ZIPRECRUITER_INTEGRATION_URL, sponsorship.ID, sponsorship.OPJobID, sponsorship.TimeEnd, price, sponsorship.UserID, "")
+				if err != nil {
+					ErrorLog.Println("runSponsorshipLifecycle ziprecruiter ended email err: ", err)
+					continue
+				}
+			}
+			sponsorship.EndedEmailSent = now.Unix()
+		}
+
+		if sponsorship.Status == SPONSORSHIP_STATUS_MANUALLY_ENDED && sponsorship.EndedEmailSent == 0 {
+			sponsorship.EndedEmailSent = now.Unix()
+		}
+
+		_, err = dbmap.Update(sponsorship)
+		if err != nil {
+			ErrorLog.Println("runSponsorshipLifecycle ziprecruiter update err: ", err)
+		}
+	}
+
+	InfoLog.Println("finished runSponsorshipLifecycle")
+}
+
+func lastJobFeedUpload(integrationURL string) (int64, error) {
+	return dbmap.SelectInt("SELECT COALESCE(MAX(uploaded), 0) FROM job_feed_uploads WHERE integration_url = ?", integrationURL)
+}
+
+// Goes to whoever asked for the sponsorship, the company admins when we don't know who that was
+func sendSponsorshipStatusEmail(companyID int64, integrationURL string, sponsorshipID int64, opJobID string, timeEnd int64, budget string, userID *int64, contactEmail string) error {
+	company, err := lookupCompanyByID(companyID)
+	if err != nil {
+		return err
+	}
+
+	toAddresses, err := sponsorshipContacts(companyID, userID, contactEmail)
+	if err != nil {
+		return err
+	}
+
+	spend, _, err := sponsorshipSpendTotal(integrationURL, sponsorshipID)
+	if err != nil {
+		return err
+	}
+
+	boardName := jobBoardName(integrationURL)
+	ended := time.Now().Unix() >= timeEnd
+
+	emailBody := SponsorshipStatusEmailBody{
+		CompanyName: company.Name,
+		BoardName:   boardName,
+		JobTitle:    sponsoredJobTitle(companyID, opJobID),
+		OPJobID:     opJobID,
+		EndDate:     time.Unix(timeEnd, 0).UTC().Format("January 2, 2006"),
+		Budget:      budget,
+		Spend:       strconv.FormatFloat(spend, 'f', 2, 64),
+	}
+
+	subject := fmt.Sprintf("Your %s sponsorship ends in 2 days", boardName)
+	templateToUse := JOB_SPONSORSHIP_ENDING_SOON_TEMPLATE
+	if ended {
+		subject = fmt.Sprintf("Your %s sponsorship has ended", boardName)
+		templateToUse = JOB_SPONSORSHIP_ENDED_TEMPLATE
+	}
+
+	emailHeaderInfo := sgEmailFields{
+		Subject: subject,
+		From:    &sgmail.Email{Name: "OnePoint Connect", Address: passwords.NO_REPLY_EMAILER_ADDRESS},
+		To:      toAddresses,
+	}
+
+	return sendNotification(Notification{CompanyID: companyID, Kind: NOTIFICATION_KIND_SPONSORSHIPS, Email: emailHeaderInfo, Template: templateToUse, Data: emailBody})
+}
+
+func sponsorshipContacts(companyID int64, userID *int64, contactEmail string) ([]*sgmail.Email, error) {
+	if contactEmail != "" {
+		return []*sgmail.Email{&sgmail.Email{Address: contactEmail}}, nil
+	}
+
+	if userID != nil {
+		user := User{}
+		err := dbmap.SelectOne(&user, "SELECT * FROM users WHERE id = ?", *userID)
+		if err == nil && user.Email != "" {
+			return []*sgmail.Email{&sgmail.Email{Name: user.FirstName + " " + user.LastName, Address: user.Email}}, nil
+		}
+	}
+
+	admins := []User{}
+	_, err := dbmap.Select(&admins, "SELECT * FROM users WHERE company_id = ? AND is_company_admin = 1 AND email <> ''", companyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(admins) == 0 {
+		return nil, errors.New(fmt.Sprintf("no sponsorship contact or company admins with an email for company %d", companyID))
+	}
+
+	toAddresses := []*sgmail.Email{}
+	for _, admin := range admins {
+		toAddresses = append(toAddresses, &sgmail.Email{Name: admin.FirstName + " " + admin.LastName, Address: admin.Email})
+	}
+
+	return toAddresses, nil
+}
+
+// The job may already be closed in OP, its feed snapshot or last feed change still has the title
+func sponsoredJobTitle(companyID int64, opJobID string) string {
+	qry := `SELECT COALESCE((SELECT title FROM job_req_snapshots WHERE company_id = ? AND op_id = ? LIMIT 1),
+		(SELECT title FROM job_feed_diffs WHERE company_id = ? AND op_job_id = ? ORDER BY id DESC LIMIT 1), '')`
+	title, err := dbmap.SelectStr(qry, companyID, opJobID, companyID, opJobID)
+	if err != nil || title == "" {
+		return fmt.Sprintf("Job %s", opJobID)
+	}
+	return title
+}
+
+func jobBoardName(integrationURL string) string {
+	switch integrationURL {
+	case INDEED_INTEGRATION_URL:
+		return "Indeed"
+	case ZIPRECRUITER_INTEGRATION_URL:
+		return "ZipRecruiter"
+	}
+	return integrationURL
+}
+
+func sponsorshipSpendTotal(integrationURL string, sponsorshipID int64) (float64, int64, error) {
+	totals := struct {
+		Amount float64 `db:"amount"`
+		Clicks int64   `db:"clicks"`
+	}{}
+	err := dbmap.SelectOne(&totals, "SELECT COALESCE(SUM(amount), 0) AS amount, COALESCE(SUM(clicks), 0) AS clicks FROM job_sponsorship_spends WHERE integration_url = ? AND sponsorship_id = ?", integrationURL, sponsorshipID)
+	return totals.Amount, totals.Clicks, err
+}
+
+// Applications the board sent for the job while the sponsorship ran
+func sponsorshipApplicationCount(companyID int64, integrationURL, opJobID string, timeSubmitted, timeEnd int64) (int64, error) {
+	endMillis := timeEnd * 1000
+	if nowMillis := time.Now().Unix() * 1000; nowMillis < endMillis {
+		endMillis = nowMillis
+	}
+
+	qry := `SELECT COUNT(*) FROM job_applications WHERE company_id = ? AND op_job_id = ? AND source = ? AND applied_on_millis >= ? AND applied_on_millis < ?`
+	return dbmap.SelectInt(qry, companyID, opJobID, jobBoardName(integrationURL), timeSubmitted*1000, endMillis)
+}
+
+func getSponsorshipReportHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	report, err := buildSponsorshipReport(thisCompany.ID)
+	if err != nil {
+		ErrorLog.Println("getSponsorshipReportHandler buildSponsorshipReport err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func buildSponsorshipReport(companyID int64) (SponsorshipReport, error) {
+	report := SponsorshipReport{Sponsorships: []SponsorshipReportRow{}}
+
+	indeedSponsorships := []IndeedSponsorship{}
+	_, err := dbmap.Select(&indeedSponsorships, "SELECT * FROM indeed_sponsorships WHERE company_id = ? ORDER BY time_submitted DESC", companyID)
+	if err != nil {
+		return report, err
+	}
+
+	for _, sponsorship := range indeedSponsorships {
+		budget, _ := strconv.ParseFloat(sponsorship.Budget, 64)
+		row := SponsorshipReportRow{
+			IntegrationURL: INDEED_INTEGRATION_URL,
+			SponsorshipID:  sponsorship.ID,
+			OPJobID:        sponsorship.OPJobID,
+			Status:         sponsorship.Status,
+			TimeSubmitted:  sponsorship.TimeSubmitted,
+			TimeEnd:        sponsorship.TimeEnd,
+			Budget:         budget,
+		}
+		report.Sponsorships = append(report.Sponsorships, row)
+	}
+
+	zrSponsorships := []ZipRecruiterSponsorship{}
+	_, err = dbmap.Select(&zrSponsorships, "SELECT * FROM ziprecruiter_sponsorships WHERE company_id = ? ORDER BY time_submitted DESC", companyID)
+	if err != nil {
+		return report, err
+	}
+
+	for _, sponsorship := range zrSponsorships {
+		budget, _ := strconv.ParseFloat(zipRecruiterSponsorshipPrice(sponsorship.Level), 64)
+		row := SponsorshipReportRow{
+			IntegrationURL: ZIPRECRUITER_INTEGRATION_URL,
+			SponsorshipID:  sponsorship.ID,
+			OPJobID:        sponsorship.OPJobID,
+			Status:         sponsorship.Status,
+			TimeSubmitted:  sponsorship.TimeSubmitted,
+			TimeEnd:        sponsorship.TimeEnd,
+			Budget:         budget,
+		}
+		report.Sponsorships = append(report.Sponsorships, row)
+	}
+
+	for index := range report.Sponsorships {
+		row := &report.Sponsorships[index]
+
+		row.Spend, row.Clicks, err = sponsorshipSpendTotal(row.IntegrationURL, row.SponsorshipID)
+		if err != nil {
+			return report, err
+		}
+
+		row.Applications, err = sponsorshipApplicationCount(companyID, row.IntegrationURL, row.OPJobID, row.TimeSubmitted, row.TimeEnd)
+		if err != nil {
+			return report, err
+		}
+
+		if row.Applications > 0 {
+			row.CostPerApplication = row.Spend / float64(row.Applications)
+		}
+		row.OverBudget = row.Budget > 0 && row.Spend > row.Budget
+
+		report.TotalBudget += row.Budget
+		report.TotalSpend += row.Spend
+		report.TotalApplications += row.Applications
+	}
+
+	if report.TotalApplications > 0 {
+		report.CostPerApplication = report.TotalSpend / float64(report.TotalApplications)
+	}
+
+	return report, nil
+}
+
+// Takes a board's spend export as a csv file. Rows are matched to the sponsorship that was
+// running for the job on that day, importing the same day again replaces it.
+func importSponsorshipSpendHandler(c *gin.Context) {
+	err := isAdminUser(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	integrationURL := c.Param("integrationURL")
+	if integrationURL != INDEED_INTEGRATION_URL && integrationURL != ZIPRECRUITER_INTEGRATION_URL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown job board"})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		ErrorLog.Println("importSponsorshipSpendHandler open err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+	defer file.Close()
+
+	var importedBy *int64
+	user, _ := lookupThisUser(c)
+	if user != nil {
+		importedBy = &user.ID
+	}
+
+	result, err := importSponsorshipSpend(integrationURL, file, importedBy)
+	if err != nil {
+		ErrorLog.Println("importSponsorshipSpendHandler importSponsorshipSpend err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	InfoLog.Printf("imported %d %s sponsorship spend rows, %d unmatched\n", result.Imported, integrationURL, len(result.Unmatched))
+
+	c.JSON(http.StatusOK, result)
+}
+
+func importSponsorshipSpend(integrationURL string, reader io.Reader, importedBy *int64) (SponsorshipSpendImportResult, error) {
+	result := SponsorshipSpendImportResult{Unmatched: []SponsorshipSpendImportRow{}}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return result, errors.New("spend file is empty")
+	}
+
+	jobCol, referenceCol, dateCol, amountCol, clicksCol := -1, -1, -1, -1, -1
+	for index, name := range header {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) {
+		case "op_job_id", "job id", "job_id":
+			jobCol = index
+		case "reference number", "referencenumber", "job reference", "reference":
+			referenceCol = index
+		case "date", "day", "spend date":
+			dateCol = index
+		case "amount", "spend", "cost", "charge", "charges":
+			amountCol = index
+		case "clicks", "sponsored clicks":
+			clicksCol = index
+		}
+	}
+
+	if (jobCol == -1 && referenceCol == -1) || dateCol == -1 || amountCol == -1 {
+		return result, errors.New("spend file needs a job id or reference number, date and amount column")
+	}
+
+	now := time.Now().Unix()
+	line := 1
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			result.Unmatched = append(result.Unmatched, SponsorshipSpendImportRow{Line: line, Reason: err.Error()})
+			continue
+		}
+
+		row := SponsorshipSpendImportRow{Line: line}
+
+		if jobCol != -1 && jobCol < len(record) {
+			row.OPJobID = strings.TrimSpace(record[jobCol])
+		}
+		if row.OPJobID == "" && referenceCol != -1 && referenceCol < len(record) {
+			row.OPJobID = opJobIDFromFeedReference(strings.TrimSpace(record[referenceCol]))
+		}
+		if dateCol < len(record) {
+			row.Date = strings.TrimSpace(record[dateCol])
+		}
+
+		if row.OPJobID == "" {
+			row.Reason = "no job id"
+			result.Unmatched = append(result.Unmatched, row)
+			continue
+		}
+
+		spendDate, err := parseSponsorshipSpendDate(row.Date)
+		if err != nil {
+			row.Reason = "date is not a recognized format"
+			result.Unmatched = append(result.Unmatched, row)
+			continue
+		}
+
+		amount, err := parseSponsorshipSpendAmount(record, amountCol)
+		if err != nil {
+			row.Reason = "amount is not a number"
+			result.Unmatched = append(result.Unmatched, row)
+			continue
+		}
+
+		var clicks int64
+		if clicksCol != -1 && clicksCol < len(record) {
+			clicks, _ = strconv.ParseInt(strings.Replace(strings.TrimSpace(record[clicksCol]), ",", "", -1), 10, 64)
+		}
+
+		sponsorshipID, companyID, err := sponsorshipRunningOn(integrationURL, row.OPJobID, spendDate)
+		if err != nil {
+			row.Reason = "no sponsorship was running for this job on this date"
+			result.Unmatched = append(result.Unmatched, row)
+			continue
+		}
+
+		spend := JobSponsorshipSpend{
+			CompanyID:      companyID,
+			IntegrationURL: integrationURL,
+			SponsorshipID:  sponsorshipID,
+			OPJobID:        row.OPJobID,
+			SpendDate:      spendDate.Format(SPONSORSHIP_SPEND_DATE_FORMAT),
+			Amount:         amount,
+			Clicks:         clicks,
+			Imported:       now,
+			ImportedBy:     importedBy,
+		}
+
+		_, err = dbmap.Exec("DELETE FROM job_sponsorship_spends WHERE integration_url = ? AND op_job_id = ? AND spend_date = ?", integrationURL, spend.OPJobID, spend.SpendDate)
+		if err != nil {
+			return result, err
+		}
+
+		err = dbmap.Insert(&spend)
+		if err != nil {
+			return result, err
+		}
+
+		result.Imported++
+	}
+
+	return result, nil
+}
+
+// Feeds send the OP job id with the publish date as MMDDYY on the end, see FeedReferenceID
+func opJobIDFromFeedReference(reference string) string {
+	if len(reference) <= 6 {
+		return ""
+	}
+	return reference[:len(reference)-6]
+}
+
+func parseSponsorshipSpendDate(value string) (time.Time, error) {
+	for _, format := range sponsorshipSpendDateFormats {
+		parsed, err := time.Parse(format, value)
+		if err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, errors.New(fmt.Sprintf("unrecognized spend date %q", value))
+}
+
+func parseSponsorshipSpendAmount(record []string, amountCol int) (float64, error) {
+	if amountCol >= len(record) {
+		return 0, errors.New("missing amount")
+	}
+
+	amount := strings.TrimSpace(record[amountCol])
+	amount = strings.TrimPrefix(amount, "$")
+	amount = strings.Replace(amount, ",", "", -1)
+	return strconv.ParseFloat(amount, 64)
+}
+
+// Spend dates are whole days in UTC, a sponsorship counts for every day it was live on
+func sponsorshipRunningOn(integrationURL, opJobID string, spendDate time.Time) (int64, int64, error) {
+	dayStart := spendDate.Unix()
+	dayEnd := spendDate.AddDate(0, 0, 1).Unix()
+
+	table := "indeed_sponsorships"
+	if integrationURL == ZIPRECRUITER_INTEGRATION_URL {
+		table = "ziprecruiter_sponsorships"
+	}
+
+	match := struct {
+		ID        int64 `db:"id"`
+		CompanyID int64 `db:"company_id"`
+	}{}
+	qry := fmt.Sprintf("SELECT id, company_id FROM %s WHERE op_job_id = ? AND time_submitted < ? AND time_end > ? ORDER BY time_submitted DESC LIMIT 1", table)
+	err := dbmap.SelectOne(&match, qry, opJobID, dayEnd, dayStart)
+	return match.ID, match.CompanyID, err
+}
@@ -24,6 +24,10 @@ type IndeedSponsorship struct {
 	Active        *bool  `db:"-" json:"active"`
 	UserID        *int64 `db:"user_id" json:"user_id"`
 	ContactName   string `db:"contact_name" json:"contact_name"`
+
+	Status              string `db:"status,size:20" json:"status"`
+	EndingSoonEmailSent int64  `db:"ending_soon_email_sent" json:"ending_soon_email_sent"`
+	EndedEmailSent      int64  `db:"ended_email_sent" json:"ended_email_sent"`
 }
 
 type ZipRecruiterSponsorship struct {
@@ -36,6 +40,10 @@ type ZipRecruiterSponsorship struct {
 	Level         string `db:"level" json:"level"`
 	Active        *bool  `db:"-" json:"active"`
 	UserID        *int64 `db:"user_id" json:"user_id"`
+
+	Status              string `db:"status,size:20" json:"status"`
+	EndingSoonEmailSent int64  `db:"ending_soon_email_sent" json:"ending_soon_email_sent"`
+	EndedEmailSent      int64  `db:"ended_email_sent" json:"ended_email_sent"`
 }
 
 type IndeedSponsorshipObject struct {
@@ -108,6 +116,7 @@ func zipSponsorshipPostHandler(c *gin.Context) {
 		ManuallyEnded: &falseBool,
 		TimeSubmitted: time.Now().Unix(),
 		UserID:        submittingUserID,
+		Status:        SPONSORSHIP_STATUS_REQUESTED,
 	}
 
 	err = dbmap.Insert(&newSponsorship)
@@ -137,23 +146,26 @@ func sendNewSponsorshipEmail(company Company, newSponsorship ZipRecruiterSponsor
 		To:      []*mail.Email{&mail.Email{Address: passwords.ADMIN_NOTIFICATION_EMAIL_ADDRESS}},
 	}
 
-	price := "199.00"
-	if newSponsorship.Level == "double" {
-		price = "299.00"
-	}
-
 	emailBody := NewSponsoredJobNotificationBody{
 		CompanyName:      company.Name,
 		CompanyShortName: company.ShortName,
-		Price:            price,
+		Price:            zipRecruiterSponsorshipPrice(newSponsorship.Level),
 	}
 
-	err := sendTemplatedEmailSendGrid(emailHeaderInfo, JOB_SPONSORSHIP_NOTIFICATION_TEMPLATE, emailBody)
+	err := sendNotification(Notification{CompanyID: company.ID, Kind: NOTIFICATION_KIND_NEW_SPONSORSHIP, Email: emailHeaderInfo, Template: JOB_SPONSORSHIP_NOTIFICATION_TEMPLATE, Data: emailBody})
 	if err != nil {
 		ErrorLog.Printf("sendNewSponsorshipEmail emailing err: %v\n", err)
 	}
 }
 
+// ZipRecruiter sponsorships are a flat price per level rather than a budget
+func zipRecruiterSponsorshipPrice(level string) string {
+	if level == "double" {
+		return "299.00"
+	}
+	return "199.00"
+}
+
 func indeedSponsorshipPostHandler(c *gin.Context) {
 	thisCompany, err := lookupCompany(c)
 	if err != nil {
@@ -225,6 +237,7 @@ func indeedSponsorshipPostHandler(c *gin.Context) {
 		CompanyID:     thisCompany.ID,
 		UserID:        submittingUserID,
 		ContactName:   contactName,
+		Status:        SPONSORSHIP_STATUS_REQUESTED,
 	}
 
 	err = dbmap.Insert(&newSponsorship)
@@ -291,7 +304,20 @@ func indeedSponsorshipUpdateHandler(c *gin.Context) {
 	}
 
 	if input.ManuallyEnded != nil {
+		wasManuallyEnded := thisSponsorship.Status == SPONSORSHIP_STATUS_MANUALLY_ENDED
+
+		uploaded, err := lastJobFeedUpload(INDEED_INTEGRATION_URL)
+		if err != nil {
+			ErrorLog.Println("indeedSponsorshipUpdateHandler lastJobFeedUpload err: ", err)
+		}
+
 		thisSponsorship.ManuallyEnded = input.ManuallyEnded
+		thisSponsorship.Status = sponsorshipLifecycleStatus(thisSponsorship.Status, thisSponsorship.ManuallyEnded, thisSponsorship.TimeSubmitted, thisSponsorship.TimeEnd, uploaded, time.Now())
+
+		// started again, so the ended email goes out when it does end
+		if wasManuallyEnded && thisSponsorship.Status != SPONSORSHIP_STATUS_MANUALLY_ENDED && thisSponsorship.Status != SPONSORSHIP_STATUS_ENDED {
+			thisSponsorship.EndedEmailSent = 0
+		}
 	}
 
 	_, err = dbmap.Update(&thisSponsorship)
@@ -13,6 +13,8 @@ type ZRJobAppPost struct {
 	Email     string `json:"email"`
 	Phone     string `json:"phone"`
 	Resume    string `json:"resume"`
+
+	parsedResume *ParsedResume
 }
 
 type ZRXMLSource struct {
@@ -36,12 +38,12 @@ type ZRXMLJob struct {
 	Date                      string        `xml:"date"`
 	Category                  ZRCategory    `xml:"category"`
 	URL                       ZRURL         `xml:"url"`
-	JobType                   string        `xml:"jobtype"`
+	JobType                   string        `xml:"jobtype,omitempty"`
 	Experience                string        `xml:"experience"`
 	Education                 string        `xml:"education"`
-	CompensationInterval      string        `xml:"compensation_interval"`
-	CompensationMin           string        `xml:"compensation_min"`
-	CompensationMax           string        `xml:"compensation_max"`
+	CompensationInterval      string        `xml:"compensation_interval,omitempty"`
+	CompensationMin           string        `xml:"compensation_min,omitempty"`
+	CompensationMax           string        `xml:"compensation_max,omitempty"`
 	CompensationHasCommission string        `xml:"compensation_has_commission"`
 	Sponsored                 *string       `xml:"trafficboost"`
 }
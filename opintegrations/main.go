@@ -39,14 +39,19 @@ func registerRoutes(router *gin.Engine) {
 	registerAuthRoutes(router)
 	registerAdminRoutes(router)
 	registerBgCheckRoutes(router)
+	registerBgCheckAdjudicationRoutes(router)
 	registerCloudPunchRoutes(router)
 	registerCompanyIntegrationRoutes(router)
 	registerCompanyProductRoutes(router)
 	registerCompanyRoutes(router)
 	registerEventRoutes(router)
+	registerExportFeedRoutes(router)
 	registerGoogleHireRoutes(router)
 	registerIntegrationRoutes(router)
 	registerJobsRoutes(router)
+	registerNotificationRoutes(router)
 	registerOauthTokenRoutes(router)
 	registerProductRoutes(router)
+	registerSMSRoutes(router)
+	registerWebClockKioskRoutes(router)
 }
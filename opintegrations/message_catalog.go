@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	LOCALE_ENGLISH = "en"
+	LOCALE_SPANISH = "es"
+	LOCALE_FRENCH  = "fr"
+
+	DEFAULT_LOCALE = LOCALE_ENGLISH
+)
+
+const (
+	MSG_INPUT_WRONG_FORMAT       = "input_wrong_format"
+	MSG_NOT_AUTHORIZED           = "not_authorized"
+	MSG_COMPANY_NOT_FOUND        = "company_not_found"
+	MSG_EMPLOYEE_NOT_FOUND       = "employee_not_found"
+	MSG_ENROLLMENT_NOT_FOUND     = "enrollment_not_found"
+	MSG_INSTALLATION_NOT_FOUND   = "installation_not_found"
+	MSG_ERROR_OCCURRED           = "error_occurred"
+	MSG_UNKNOWN_ERROR_OCCURRED   = "unknown_error_occurred"
+	MSG_PUNCH_FROM_DISALLOWED_IP = "punch_from_disallowed_ip"
+	MSG_PUNCH_SUCCESSFUL         = "punch_successful"
+	MSG_KIOSK_WRONG_PIN          = "kiosk_wrong_pin"
+	MSG_KIOSK_LOCKED             = "kiosk_locked"
+	MSG_BIOMETRIC_CONSENT_NEEDED = "biometric_consent_needed"
+)
+
+// every locale must have every message, DEFAULT_LOCALE is used if one is missing
+var messageCatalog = map[string]map[string]string{
+	LOCALE_ENGLISH: {
+		MSG_INPUT_WRONG_FORMAT:       "Input is wrong format",
+		MSG_NOT_AUTHORIZED:           "Not authorized",
+		MSG_COMPANY_NOT_FOUND:        "Company not found",
+		MSG_EMPLOYEE_NOT_FOUND:       "Employee not found",
+		MSG_ENROLLMENT_NOT_FOUND:     "Enrollment not found",
+		MSG_INSTALLATION_NOT_FOUND:   "Installation does not exist",
+		MSG_ERROR_OCCURRED:           "An error occurred",
+		MSG_UNKNOWN_ERROR_OCCURRED:   "An unknown error occurred",
+		MSG_PUNCH_FROM_DISALLOWED_IP: "Your company prohibits punches from your current public IP Address of %s",
+		MSG_PUNCH_SUCCESSFUL:         "Punch successful",
+		MSG_KIOSK_WRONG_PIN:          "Incorrect PIN",
+		MSG_KIOSK_LOCKED:             "Too many incorrect PINs, try again later or ask your manager to unlock your PIN",
+		MSG_BIOMETRIC_CONSENT_NEEDED: "Biometric consent is required before enrolling",
+	},
+	LOCALE_SPANISH: {
+		MSG_INPUT_WRONG_FORMAT:       "El formato de los datos es incorrecto",
+		MSG_NOT_AUTHORIZED:           "No autorizado",
+		MSG_COMPANY_NOT_FOUND:        "Empresa no encontrada",
+		MSG_EMPLOYEE_NOT_FOUND:       "Empleado no encontrado",
+		MSG_ENROLLMENT_NOT_FOUND:     "Registro no encontrado",
+		MSG_INSTALLATION_NOT_FOUND:   "La instalación no existe",
+		MSG_ERROR_OCCURRED:           "Ocurrió un error",
+		MSG_UNKNOWN_ERROR_OCCURRED:   "Ocurrió un error desconocido",
+		MSG_PUNCH_FROM_DISALLOWED_IP: "Su empresa prohíbe marcar desde su dirección IP pública actual %s",
+		MSG_PUNCH_SUCCESSFUL:         "Marcación exitosa",
+		MSG_KIOSK_WRONG_PIN:          "PIN incorrecto",
+		MSG_KIOSK_LOCKED:             "Demasiados PIN incorrectos, intente más tarde o pida a su gerente que desbloquee su PIN",
+		MSG_BIOMETRIC_CONSENT_NEEDED: "Se requiere el consentimiento biométrico antes de registrarse",
+	},
+	LOCALE_FRENCH: {
+		MSG_INPUT_WRONG_FORMAT:       "Le format des données est incorrect",
+		MSG_NOT_AUTHORIZED:           "Non autorisé",
+		MSG_COMPANY_NOT_FOUND:        "Entreprise introuvable",
+		MSG_EMPLOYEE_NOT_FOUND:       "Employé introuvable",
+		MSG_ENROLLMENT_NOT_FOUND:     "Inscription introuvable",
+		MSG_INSTALLATION_NOT_FOUND:   "L'installation n'existe pas",
+		MSG_ERROR_OCCURRED:           "Une erreur s'est produite",
+		MSG_UNKNOWN_ERROR_OCCURRED:   "Une erreur inconnue s'est produite",
+		MSG_PUNCH_FROM_DISALLOWED_IP: "Votre entreprise interdit les pointages depuis votre adresse IP publique actuelle %s",
+		MSG_PUNCH_SUCCESSFUL:         "Pointage réussi",
+		MSG_KIOSK_WRONG_PIN:          "NIP incorrect",
+		MSG_KIOSK_LOCKED:             "Trop de NIP incorrects, réessayez plus tard ou demandez à votre responsable de débloquer votre NIP",
+		MSG_BIOMETRIC_CONSENT_NEEDED: "Le consentement biométrique est requis avant l'inscription",
+	},
+}
+
+// Looks up the message for the locale, args are applied with fmt.Sprintf
+func localize(locale, messageKey string, args ...interface{}) string {
+	message, found := messageCatalog[locale][messageKey]
+	if !found {
+		message, found = messageCatalog[DEFAULT_LOCALE][messageKey]
+		if !found {
+			ErrorLog.Println("localize missing message key: ", messageKey)
+			return messageKey
+		}
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+
+	return message
+}
+
+// Uses the locale sent in the request if we support it, otherwise the best match from Accept-Language
+func negotiateLocale(c *gin.Context, requestedLocale string) string {
+	if locale, supported := matchSupportedLocale(requestedLocale); supported {
+		return locale
+	}
+
+	type weightedLocale struct {
+		locale string
+		weight float64
+	}
+
+	// Accept-Language looks like "es-MX,es;q=0.9,en;q=0.8"
+	weighted := []weightedLocale{}
+	for _, part := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		if fields[0] == "" {
+			continue
+		}
+
+		weight := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				if err == nil {
+					weight = q
+				}
+			}
+		}
+
+		weighted = append(weighted, weightedLocale{locale: fields[0], weight: weight})
+	}
+
+	sort.SliceStable(weighted, func(i, j int) bool { return weighted[i].weight > weighted[j].weight })
+
+	for _, wl := range weighted {
+		if locale, supported := matchSupportedLocale(wl.locale); supported {
+			return locale
+		}
+	}
+
+	return DEFAULT_LOCALE
+}
+
+// Reduces tags like "es-MX" to the catalog locale "es"
+func matchSupportedLocale(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", false
+	}
+
+	primary := strings.SplitN(strings.Replace(tag, "_", "-", -1), "-", 2)[0]
+	if _, supported := messageCatalog[primary]; supported {
+		return primary, true
+	}
+
+	return "", false
+}
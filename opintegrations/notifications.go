@@ -0,0 +1,802 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	sendgrid "github.com/sendgrid/sendgrid-go"
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// One email from anywhere in the app. Kind is what preferences are keyed on and doubles as the SendGrid category.
+type Notification struct {
+	CompanyID int64
+	Kind      string
+	Email     sgEmailFields
+	Template  string
+	Data      interface{}
+}
+
+// Everything needed to send, or resend, an already rendered email
+type NotificationEnvelope struct {
+	From    *sgmail.Email   `json:"from"`
+	To      []*sgmail.Email `json:"to"`
+	Cc      []*sgmail.Email `json:"cc"`
+	Bcc     []*sgmail.Email `json:"bcc"`
+	Subject string          `json:"subject"`
+	Kind    string          `json:"kind"`
+
+	Attachments []NotificationAttachment `json:"attachments,omitempty"`
+}
+
+// A file to attach, by url or by object in one of our own buckets since the envelope is stored for retries
+type NotificationAttachment struct {
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	URL         string `json:"url,omitempty"`
+	Bucket      string `json:"bucket,omitempty"`
+	Object      string `json:"object,omitempty"`
+}
+
+type EmailProvider interface {
+	Name() string
+	// returns the provider's id for the message when it gives one
+	SendEmail(envelope NotificationEnvelope, html string) (string, error)
+}
+
+type SendGridEmailProvider struct {
+	APIKey string
+}
+
+type SMTPEmailProvider struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+// Writes each email to a file instead of sending it, for running locally
+type FileEmailProvider struct {
+	Dir string
+}
+
+// Provider errors worth trying again, like rate limits, 5xx and timeouts
+type transientNotificationError struct {
+	err error
+}
+
+// Body is only kept while a delivery is waiting on a retry, some of these emails have passwords in them
+type NotificationDelivery struct {
+	ID          int64                `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID   int64                `db:"company_id" json:"company_id"`
+	Kind        string               `db:"kind,size:60" json:"kind"`
+	Template    string               `db:"template,size:100" json:"template"`
+	Recipients  string               `db:"recipients,size:2000" json:"recipients"`
+	Subject     string               `db:"subject,size:500" json:"subject"`
+	Provider    string               `db:"provider,size:20" json:"provider"`
+	Status      string               `db:"status,size:20" json:"status"`
+	Attempts    int                  `db:"attempts" json:"attempts"`
+	NextAttempt int64                `db:"next_attempt" json:"next_attempt"`
+	ProviderID  string               `db:"provider_id,size:100" json:"provider_id"`
+	Error       string               `db:"error,size:1000" json:"error"`
+	Envelope    NotificationEnvelope `db:"envelope,size:5000" json:"-"`
+	Body        string               `db:"body,size:65535" json:"-"`
+	Created     int64                `db:"created" json:"created"`
+	Sent        int64                `db:"sent" json:"sent"`
+}
+
+// UserID 0 is the company wide setting, otherwise it is that user's own
+type NotificationPreference struct {
+	ID        int64  `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID int64  `db:"company_id" json:"company_id"`
+	UserID    int64  `db:"user_id" json:"user_id"`
+	Kind      string `db:"kind,size:60" json:"kind"`
+	Enabled   bool   `db:"enabled" json:"enabled"`
+	Updated   int64  `db:"updated" json:"updated"`
+}
+
+type NotificationPreferenceInput struct {
+	Kind    string `json:"kind"`
+	Enabled bool   `json:"enabled"`
+}
+
+type NotificationPreferencesResponse struct {
+	Kinds   []string                 `json:"kinds"`
+	Company []NotificationPreference `json:"company"`
+	User    []NotificationPreference `json:"user"`
+}
+
+const (
+	NOTIFICATION_KIND_HF_SUMMARY            = "user_provisioning_summary"
+	NOTIFICATION_KIND_AD_HF_SUMMARY         = "active_directory_user_provisioning_summary"
+	NOTIFICATION_KIND_HF_DISCONNECTED       = "user_provisioning_disconnection_alerts"
+	NOTIFICATION_KIND_BGC                   = "background_checks"
+	NOTIFICATION_KIND_BGC_ADVERSE           = "background_check_adverse_action" // not in notificationKinds, these notices are required by law
+	NOTIFICATION_KIND_NEW_SPONSORSHIP       = "new_job_sponsorship"             // not in notificationKinds, it's our own order inbox
+	NOTIFICATION_KIND_SPONSORSHIPS          = "job_sponsorships"
+	NOTIFICATION_KIND_JOB_APPLICATION       = "job_application_notification"
+	NOTIFICATION_KIND_APPLY_INVITE          = "apply-invite"
+	NOTIFICATION_KIND_APPLY_REMINDER        = "apply-reminder"
+	NOTIFICATION_KIND_GH_APPLICANT          = "google_hire_applicant_email"
+	NOTIFICATION_KIND_GH_ADMIN              = "google_hire_admin_alerts"
+	NOTIFICATION_KIND_CP_STALE              = "cloudpunch_stale_alerts"
+	NOTIFICATION_KIND_TEST                  = "test"
+	NOTIFICATION_STATUS_SENT                = "sent"
+	NOTIFICATION_STATUS_RETRYING            = "retrying"
+	NOTIFICATION_STATUS_FAILED              = "failed"
+	NOTIFICATION_STATUS_SUPPRESSED          = "suppressed"
+	NOTIFICATION_PROVIDER_SENDGRID          = "sendgrid"
+	NOTIFICATION_PROVIDER_SMTP              = "smtp"
+	NOTIFICATION_PROVIDER_FILE              = "file"
+	NOTIFICATION_MAX_ATTEMPTS               = 5
+	NOTIFICATION_RETRY_BATCH                = 100
+	NOTIFICATION_RETRY_BASE_DELAY_SECONDS   = 60
+	NOTIFICATION_DELIVERIES_PAGE            = 100
+	NOTIFICATION_SMTP_DEFAULT_PORT          = "587"
+	NOTIFICATION_FILE_DEFAULT_DIR           = "./opintegrations/outbox"
+	NOTIFICATION_SENDGRID_MESSAGE_ID_HEADER = "X-Message-Id"
+	NOTIFICATION_ATTACHMENT_MAX_BYTES       = 10 << 20
+	NOTIFICATION_ATTACHMENT_CACHE_TIME      = 6 * time.Hour
+)
+
+var notificationKinds = []string{
+	NOTIFICATION_KIND_HF_SUMMARY,
+	NOTIFICATION_KIND_AD_HF_SUMMARY,
+	NOTIFICATION_KIND_HF_DISCONNECTED,
+	NOTIFICATION_KIND_BGC,
+	NOTIFICATION_KIND_SPONSORSHIPS,
+	NOTIFICATION_KIND_JOB_APPLICATION,
+	NOTIFICATION_KIND_APPLY_INVITE,
+	NOTIFICATION_KIND_APPLY_REMINDER,
+	NOTIFICATION_KIND_GH_APPLICANT,
+	NOTIFICATION_KIND_GH_ADMIN,
+	NOTIFICATION_KIND_CP_STALE,
+}
+
+func registerNotificationRoutes(router *gin.Engine) {
+	router.GET("/api/notifications/preferences", getNotificationPreferencesHandler)
+	router.POST("/api/notifications/preferences/company", updateCompanyNotificationPreferenceHandler)
+	router.POST("/api/notifications/preferences/me", updateUserNotificationPreferenceHandler)
+	router.GET("/api/notifications/deliveries", getNotificationDeliveriesHandler)
+}
+
+func (e transientNotificationError) Error() string {
+	return e.err.Error()
+}
+
+func isTransientNotificationError(err error) bool {
+	_, transient := err.(transientNotificationError)
+	return transient
+}
+
+func (e NotificationEnvelope) Value() (driver.Value, error) {
+	j, err := json.Marshal(e)
+	return j, err
+}
+
+func (e *NotificationEnvelope) Scan(src interface{}) error {
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("Type assertion .([]byte) failed.")
+	}
+
+	return json.Unmarshal(source, e)
+}
+
+// Picked by config so local runs can write emails to disk or a test SMTP server instead of SendGrid
+func currentEmailProvider() EmailProvider {
+	switch passwords.EMAIL_PROVIDER {
+	case NOTIFICATION_PROVIDER_SMTP:
+		port := passwords.SMTP_PORT
+		if port == "" {
+			port = NOTIFICATION_SMTP_DEFAULT_PORT
+		}
+		return &SMTPEmailProvider{Host: passwords.SMTP_HOST, Port: port, Username: passwords.SMTP_USERNAME, Password: passwords.SMTP_PASSWORD}
+	case NOTIFICATION_PROVIDER_FILE:
+		dir := passwords.EMAIL_FILE_DIR
+		if dir == "" {
+			dir = NOTIFICATION_FILE_DEFAULT_DIR
+		}
+		return &FileEmailProvider{Dir: dir}
+	default:
+		return &SendGridEmailProvider{APIKey: passwords.SG_EMAILER_PASSWORD}
+	}
+}
+
+func (p *SendGridEmailProvider) Name() string {
+	return NOTIFICATION_PROVIDER_SENDGRID
+}
+
+func (p *SendGridEmailProvider) SendEmail(envelope NotificationEnvelope, html string) (string, error) {
+	m := sgmail.NewV3Mail()
+
+	m.SetFrom(envelope.From)
+
+	content := sgmail.NewContent("text/html", html)
+	m.AddContent(content)
+
+	personalization := sgmail.NewPersonalization()
+	personalization.AddTos(envelope.To...)
+	personalization.AddCCs(envelope.Cc...)
+	personalization.AddBCCs(envelope.Bcc...)
+	personalization.Subject = envelope.Subject
+
+	m.AddPersonalizations(personalization)
+
+	if envelope.Kind != "" {
+		m.AddCategories(envelope.Kind)
+	}
+
+	for _, attachment := range envelope.Attachments {
+		content, err := fetchNotificationAttachment(attachment)
+		if err != nil {
+			return "", err
+		}
+
+		sgAttachment := sgmail.NewAttachment()
+		sgAttachment.SetContent(base64.StdEncoding.EncodeToString(content))
+		sgAttachment.SetType(attachment.ContentType)
+		sgAttachment.SetFilename(attachment.FileName)
+		sgAttachment.SetDisposition("attachment")
+		m.AddAttachment(sgAttachment)
+	}
+
+	request := sendgrid.GetRequest(p.APIKey, "/v3/mail/send", "https://api.sendgrid.com")
+	request.Method = "POST"
+	request.Body = sgmail.GetRequestBody(m)
+	response, err := sendgrid.API(request)
+	if err != nil {
+		return "", transientNotificationError{errors.New("err SENDGRID API request: " + err.Error())}
+	}
+
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500 {
+		return "", transientNotificationError{errors.New(fmt.Sprintf("SENDGRID status %d: %s", response.StatusCode, response.Body))}
+	}
+	if response.StatusCode >= 400 {
+		return "", errors.New(fmt.Sprintf("SENDGRID status %d: %s", response.StatusCode, response.Body))
+	}
+
+	messageID := ""
+	if ids := response.Headers[NOTIFICATION_SENDGRID_MESSAGE_ID_HEADER]; len(ids) > 0 {
+		messageID = ids[0]
+	}
+
+	return messageID, nil
+}
+
+func (p *SMTPEmailProvider) Name() string {
+	return NOTIFICATION_PROVIDER_SMTP
+}
+
+func (p *SMTPEmailProvider) SendEmail(envelope NotificationEnvelope, html string) (string, error) {
+	if envelope.From == nil {
+		return "", errors.New("email has no from address")
+	}
+
+	recipients := []string{}
+	for _, list := range [][]*sgmail.Email{envelope.To, envelope.Cc, envelope.Bcc} {
+		for _, address := range list {
+			recipients = append(recipients, address.Address)
+		}
+	}
+
+	var auth smtp.Auth
+	if p.Username != "" {
+		auth = smtp.PlainAuth("", p.Username, p.Password, p.Host)
+	}
+
+	messageID := fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), GenRandStr(8), p.Host)
+	message, err := notificationMIMEMessage(envelope, html, messageID)
+	if err != nil {
+		return "", err
+	}
+
+	err = smtp.SendMail(net.JoinHostPort(p.Host, p.Port), auth, envelope.From.Address, recipients, message)
+	if err != nil {
+		// 4xx replies and connection problems are worth retrying, 5xx replies are not
+		if protoErr, isProtoErr := err.(*textproto.Error); isProtoErr && protoErr.Code >= 500 {
+			return "", err
+		}
+		return "", transientNotificationError{err}
+	}
+
+	return messageID, nil
+}
+
+func (p *FileEmailProvider) Name() string {
+	return NOTIFICATION_PROVIDER_FILE
+}
+
+func (p *FileEmailProvider) SendEmail(envelope NotificationEnvelope, html string) (string, error) {
+	err := os.MkdirAll(p.Dir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	fileName := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), envelope.Kind)
+	messageID := fmt.Sprintf("<%s@localhost>", fileName)
+
+	message, err := notificationMIMEMessage(envelope, html, messageID)
+	if err != nil {
+		return "", err
+	}
+
+	err = ioutil.WriteFile(filepath.Join(p.Dir, fileName), message, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	return fileName, nil
+}
+
+// Bcc is left out of the headers, SMTP gets those addresses as recipients only
+func notificationMIMEMessage(envelope NotificationEnvelope, html, messageID string) ([]byte, error) {
+	var message bytes.Buffer
+
+	message.WriteString("From: " + formatNotificationAddresses([]*sgmail.Email{envelope.From}) + "\r\n")
+	message.WriteString("To: " + formatNotificationAddresses(envelope.To) + "\r\n")
+	if len(envelope.Cc) > 0 {
+		message.WriteString("Cc: " + formatNotificationAddresses(envelope.Cc) + "\r\n")
+	}
+	message.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", envelope.Subject) + "\r\n")
+	message.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	message.WriteString("Message-ID: " + messageID + "\r\n")
+	message.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(envelope.Attachments) == 0 {
+		message.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+		message.WriteString("\r\n")
+		message.WriteString(html)
+		return message.Bytes(), nil
+	}
+
+	var parts bytes.Buffer
+	writer := multipart.NewWriter(&parts)
+	message.WriteString("Content-Type: multipart/mixed; boundary=" + writer.Boundary() + "\r\n")
+	message.WriteString("\r\n")
+
+	htmlPart, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html; charset=UTF-8"}})
+	if err != nil {
+		return nil, err
+	}
+	htmlPart.Write([]byte(html))
+
+	for _, attachment := range envelope.Attachments {
+		content, err := fetchNotificationAttachment(attachment)
+		if err != nil {
+			return nil, err
+		}
+
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName})},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// 76 character lines, as MIME wants
+		encoded := base64.StdEncoding.EncodeToString(content)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	message.Write(parts.Bytes())
+
+	return message.Bytes(), nil
+}
+
+// The same few files go on a lot of emails, so they're cached instead of downloaded for each one.
+// Failing to get one is worth a retry, the file host may just be down.
+func fetchNotificationAttachment(attachment NotificationAttachment) ([]byte, error) {
+	// files in our buckets are particular to one email, so not worth caching
+	if attachment.Object != "" {
+		content, err := bytesFromGCP(attachment.Bucket, attachment.Object)
+		if err != nil {
+			return nil, transientNotificationError{errors.New("attachment read err: " + err.Error())}
+		}
+		return content, nil
+	}
+
+	cacheKey := CACHENAME_EMAIL_ATTACHMENT + attachment.URL
+	if cached, found := cash.Get(cacheKey); found {
+		return cached.([]byte), nil
+	}
+
+	resp, err := http.Get(attachment.URL)
+	if err != nil {
+		return nil, transientNotificationError{errors.New("attachment download err: " + err.Error())}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, transientNotificationError{errors.New(fmt.Sprintf("attachment download status %d: %s", resp.StatusCode, attachment.URL))}
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, NOTIFICATION_ATTACHMENT_MAX_BYTES))
+	if err != nil {
+		return nil, transientNotificationError{errors.New("attachment read err: " + err.Error())}
+	}
+
+	cash.Set(cacheKey, content, NOTIFICATION_ATTACHMENT_CACHE_TIME)
+
+	return content, nil
+}
+
+func formatNotificationAddresses(addresses []*sgmail.Email) string {
+	formatted := []string{}
+	for _, address := range addresses {
+		if address == nil {
+			continue
+		}
+		if address.Name == "" {
+			formatted = append(formatted, address.Address)
+		} else {
+			formatted = append(formatted, fmt.Sprintf("%s <%s>", mime.QEncoding.Encode("utf-8", address.Name), address.Address))
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// The one place emails go out from. Checks preferences, logs the delivery and schedules retries for
+// transient provider errors, a retry scheduled counts as sent to the caller.
+func sendNotification(notification Notification) error {
+	_, err := sendNotificationDelivery(notification)
+	return err
+}
+
+// Same as sendNotification, for callers that need to know whether it went out or is waiting on a retry
+func sendNotificationDelivery(notification Notification) (NotificationDelivery, error) {
+	delivery := NotificationDelivery{
+		CompanyID: notification.CompanyID,
+		Kind:      notification.Kind,
+		Template:  notification.Template,
+		Created:   time.Now().Unix(),
+	}
+
+	temp := templates.Lookup(notification.Template)
+	if temp == nil {
+		return delivery, errors.New("template not found: " + notification.Template)
+	}
+
+	var tpl bytes.Buffer
+	if err := temp.Execute(&tpl, notification.Data); err != nil {
+		return delivery, errors.New("template execute err: " + err.Error())
+	}
+
+	envelope := NotificationEnvelope{
+		From:    notification.Email.From,
+		To:      notification.Email.To,
+		Cc:      notification.Email.Cc,
+		Bcc:     notification.Email.Bcc,
+		Subject: notification.Email.Subject,
+		Kind:    notification.Kind,
+
+		Attachments: notification.Email.Attachments,
+	}
+
+	delivery.Subject = truncateString(envelope.Subject, 500)
+
+	envelope, suppressed := applyNotificationPreferences(notification.CompanyID, envelope)
+	delivery.Envelope = envelope
+	delivery.Recipients = truncateString(notificationRecipients(envelope), 2000)
+
+	if suppressed {
+		delivery.Status = NOTIFICATION_STATUS_SUPPRESSED
+		err := dbmap.Insert(&delivery)
+		if err != nil {
+			ErrorLog.Println("sendNotification insert suppressed delivery err: ", err)
+		}
+		InfoLog.Printf("notification %s for company %d suppressed by preferences\n", notification.Kind, notification.CompanyID)
+		return delivery, nil
+	}
+
+	provider := currentEmailProvider()
+	delivery.Provider = provider.Name()
+
+	err := dbmap.Insert(&delivery)
+	if err != nil {
+		// still send, a missing log row is better than a missing email
+		ErrorLog.Println("sendNotification insert delivery err: ", err)
+	}
+
+	err = attemptNotificationDelivery(provider, &delivery, tpl.String())
+	return delivery, err
+}
+
+func attemptNotificationDelivery(provider EmailProvider, delivery *NotificationDelivery, html string) error {
+	delivery.Attempts++
+
+	providerID, err := provider.SendEmail(delivery.Envelope, html)
+	switch {
+	case err == nil:
+		delivery.Status = NOTIFICATION_STATUS_SENT
+		delivery.ProviderID = truncateString(providerID, 100)
+		delivery.Sent = time.Now().Unix()
+		delivery.Error = ""
+		delivery.Body = ""
+	case isTransientNotificationError(err) && delivery.Attempts < NOTIFICATION_MAX_ATTEMPTS:
+		delivery.Status = NOTIFICATION_STATUS_RETRYING
+		delivery.NextAttempt = time.Now().Unix() + int64(NOTIFICATION_RETRY_BASE_DELAY_SECONDS*(1<<uint(delivery.Attempts-1)))
+		delivery.Error = truncateString(err.Error(), 1000)
+		delivery.Body = html
+	default:
+		delivery.Status = NOTIFICATION_STATUS_FAILED
+		delivery.Error = truncateString(err.Error(), 1000)
+		delivery.Body = ""
+	}
+
+	if delivery.ID != 0 {
+		_, uerr := dbmap.Update(delivery)
+		if uerr != nil {
+			ErrorLog.Println("attemptNotificationDelivery update err: ", uerr)
+		}
+	}
+
+	if delivery.Status == NOTIFICATION_STATUS_RETRYING {
+		// without a saved row the retry cron never sees it, so the caller has to know it didn't go
+		if delivery.ID == 0 {
+			ErrorLog.Printf("notification %s can't be retried, its delivery was never saved, err: %v\n", delivery.Kind, err)
+			return err
+		}
+		ErrorLog.Printf("notification %d %s will retry, attempt %d err: %v\n", delivery.ID, delivery.Kind, delivery.Attempts, err)
+		return nil
+	}
+
+	return err
+}
+
+// Cron resends deliveries that hit a transient provider error
+func runNotificationRetries() {
+	deliveries := []NotificationDelivery{}
+	_, err := dbmap.Select(&deliveries, "SELECT * FROM notification_deliveries WHERE status = ? AND next_attempt <= ? ORDER BY next_attempt LIMIT ?",
+		NOTIFICATION_STATUS_RETRYING, time.Now().Unix(), NOTIFICATION_RETRY_BATCH)
+	if err != nil {
+		ErrorLog.Println("runNotificationRetries select err: ", err)
+		return
+	}
+
+	provider := currentEmailProvider()
+	for index := range deliveries {
+		delivery := &deliveries[index]
+
+		// claim it so two runs don't both send, attemptNotificationDelivery counts the attempt on the row we loaded
+		result, err := dbmap.Exec("UPDATE notification_deliveries SET attempts = attempts + 1 WHERE id = ? AND status = ? AND attempts = ?",
+			delivery.ID, NOTIFICATION_STATUS_RETRYING, delivery.Attempts)
+		if err != nil {
+			ErrorLog.Println("runNotificationRetries claim err: ", err)
+			continue
+		}
+		if claimed, _ := result.RowsAffected(); claimed == 0 {
+			continue
+		}
+
+		delivery.Provider = provider.Name()
+
+		err = attemptNotificationDelivery(provider, delivery, delivery.Body)
+		if err != nil {
+			ErrorLog.Printf("runNotificationRetries delivery %d gave up: %v\n", delivery.ID, err)
+		}
+	}
+}
+
+// Drops recipients who turned this kind off for themselves, suppressed when the company turned it off or nobody is left
+func applyNotificationPreferences(companyID int64, envelope NotificationEnvelope) (NotificationEnvelope, bool) {
+	if companyID == 0 || !notificationKindConfigurable(envelope.Kind) {
+		return envelope, false
+	}
+
+	companyEnabled, err := dbmap.SelectNullInt("SELECT enabled FROM notification_preferences WHERE company_id = ? AND user_id = 0 AND kind = ?", companyID, envelope.Kind)
+	if err != nil {
+		ErrorLog.Println("applyNotificationPreferences company lookup err: ", err)
+		return envelope, false
+	}
+	if companyEnabled.Valid && companyEnabled.Int64 == 0 {
+		return envelope, true
+	}
+
+	optedOut := []NotificationPreference{}
+	_, err = dbmap.Select(&optedOut, "SELECT * FROM notification_preferences WHERE company_id = ? AND user_id != 0 AND kind = ? AND enabled = 0", companyID, envelope.Kind)
+	if err != nil {
+		ErrorLog.Println("applyNotificationPreferences user lookup err: ", err)
+		return envelope, false
+	}
+	if len(optedOut) == 0 {
+		return envelope, false
+	}
+
+	optedOutEmails := map[string]bool{}
+	for _, preference := range optedOut {
+		user := User{}
+		err = dbmap.SelectOne(&user, "SELECT * FROM users WHERE id = ?", preference.UserID)
+		if err == nil && user.Email != "" {
+			optedOutEmails[strings.ToLower(user.Email)] = true
+		}
+	}
+
+	filter := func(addresses []*sgmail.Email) []*sgmail.Email {
+		kept := []*sgmail.Email{}
+		for _, address := range addresses {
+			if !optedOutEmails[strings.ToLower(address.Address)] {
+				kept = append(kept, address)
+			}
+		}
+		return kept
+	}
+
+	envelope.To = filter(envelope.To)
+	envelope.Cc = filter(envelope.Cc)
+	envelope.Bcc = filter(envelope.Bcc)
+
+	return envelope, len(envelope.To)+len(envelope.Cc)+len(envelope.Bcc) == 0
+}
+
+// Kinds left out of notificationKinds go to OnePoint or are required by law, a company can't turn them off
+func notificationKindConfigurable(kind string) bool {
+	for _, configurable := range notificationKinds {
+		if kind == configurable {
+			return true
+		}
+	}
+	return false
+}
+
+func notificationRecipients(envelope NotificationEnvelope) string {
+	addresses := []string{}
+	for _, list := range [][]*sgmail.Email{envelope.To, envelope.Cc, envelope.Bcc} {
+		for _, address := range list {
+			addresses = append(addresses, address.Address)
+		}
+	}
+	return strings.Join(addresses, ",")
+}
+
+func getNotificationPreferencesHandler(c *gin.Context) {
+	user, company, err := lookupUserAndCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	response := NotificationPreferencesResponse{
+		Kinds:   notificationKinds,
+		Company: []NotificationPreference{},
+		User:    []NotificationPreference{},
+	}
+
+	_, err = dbmap.Select(&response.Company, "SELECT * FROM notification_preferences WHERE company_id = ? AND user_id = 0", company.ID)
+	if err == nil {
+		_, err = dbmap.Select(&response.User, "SELECT * FROM notification_preferences WHERE company_id = ? AND user_id = ?", company.ID, user.ID)
+	}
+	if err != nil {
+		ErrorLog.Println("getNotificationPreferencesHandler select err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func updateCompanyNotificationPreferenceHandler(c *gin.Context) {
+	user, company, err := lookupUserAndCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	if !user.IsCompanyAdmin && !user.IsSystemAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	updateNotificationPreference(c, company.ID, 0)
+}
+
+func updateUserNotificationPreferenceHandler(c *gin.Context) {
+	user, company, err := lookupUserAndCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	updateNotificationPreference(c, company.ID, user.ID)
+}
+
+func updateNotificationPreference(c *gin.Context, companyID, userID int64) {
+	input := NotificationPreferenceInput{}
+	err := c.ShouldBindWith(&input, binding.JSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	knownKind := false
+	for _, kind := range notificationKinds {
+		if kind == input.Kind {
+			knownKind = true
+		}
+	}
+	if !knownKind {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown notification kind"})
+		return
+	}
+
+	preference := NotificationPreference{}
+	err = dbmap.SelectOne(&preference, "SELECT * FROM notification_preferences WHERE company_id = ? AND user_id = ? AND kind = ?", companyID, userID, input.Kind)
+	exists := err == nil
+
+	preference.CompanyID = companyID
+	preference.UserID = userID
+	preference.Kind = input.Kind
+	preference.Enabled = input.Enabled
+	preference.Updated = time.Now().Unix()
+
+	if exists {
+		_, err = dbmap.Update(&preference)
+	} else {
+		err = dbmap.Insert(&preference)
+	}
+	if err != nil {
+		ErrorLog.Println("updateNotificationPreference save err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, preference)
+}
+
+func getNotificationDeliveriesHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	conditions := []string{"company_id = ?"}
+	args := []interface{}{thisCompany.ID}
+	if kind := c.Query("kind"); kind != "" {
+		conditions = append(conditions, "kind = ?")
+		args = append(args, kind)
+	}
+	if status := c.Query("status"); status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, status)
+	}
+	args = append(args, NOTIFICATION_DELIVERIES_PAGE)
+
+	deliveries := []NotificationDelivery{}
+	_, err = dbmap.Select(&deliveries, fmt.Sprintf("SELECT * FROM notification_deliveries WHERE %s ORDER BY id DESC LIMIT ?", strings.Join(conditions, " AND ")), args...)
+	if err != nil {
+		ErrorLog.Println("getNotificationDeliveriesHandler select err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
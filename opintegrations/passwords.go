@@ -30,6 +30,22 @@ type Passwords struct {
 	ADMIN_NOTIFICATION_EMAIL_ADDRESS string `json:"admin_notification_email_address"`
 	SG_EMAILER_PASSWORD              string `json:"sg_emailer_password"`
 	ASSURE_HIRE_TOKEN                string `json:"assure_hire_token"`
+	TWILIO_ACCOUNT_SID               string `json:"twilio_account_sid"`
+	TWILIO_AUTH_TOKEN                string `json:"twilio_auth_token"`
+	TWILIO_FROM_NUMBER               string `json:"twilio_from_number"`
+	TWILIO_BASE_URL                  string `json:"twilio_base_url"`
+	EMAIL_PROVIDER                   string `json:"email_provider"`
+	EMAIL_FILE_DIR                   string `json:"email_file_dir"`
+	SMTP_HOST                        string `json:"smtp_host"`
+	SMTP_PORT                        string `json:"smtp_port"`
+	SMTP_USERNAME                    string `json:"smtp_username"`
+	SMTP_PASSWORD                    string `json:"smtp_password"`
+	INDEED_APPLY_SECRET              string `json:"indeed_apply_secret"`
+	ZIPRECRUITER_WEBHOOK_SECRET      string `json:"ziprecruiter_webhook_secret"`
+	PUBSUB_PUSH_AUDIENCE             string `json:"pubsub_push_audience"`
+	PUBSUB_PUSH_SERVICE_ACCOUNT      string `json:"pubsub_push_service_account"`
+	RELIAS_SFTP_USERNAME             string `json:"relias_sftp_username"`
+	RELIAS_SFTP_PASSWORD             string `json:"relias_sftp_password"`
 }
 
 var passwords Passwords
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const SFTP_DIAL_TIMEOUT = 30 * time.Second
+
+// Password and PrivateKey can both be set, the server gets offered the key first
+type SFTPCredentials struct {
+	Username    string
+	Password    string
+	HostAddress string
+	Port        int
+	PrivateKey  string
+	Passphrase  string
+}
+
+// Dials the host as given, hostKeyCallback decides whether to trust the key it presents
+func connectSFTP(creds SFTPCredentials, hostKeyCallback ssh.HostKeyCallback) (*ssh.Client, *sftp.Client, error) {
+	port := creds.Port
+	if port == 0 {
+		port = 22
+	}
+
+	auth, err := sftpAuthMethods(creds)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := &ssh.ClientConfig{
+		User:            creds.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         SFTP_DIAL_TIMEOUT,
+	}
+
+	conn, err := ssh.Dial("tcp", net.JoinHostPort(creds.HostAddress, strconv.Itoa(port)), config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return conn, client, nil
+}
+
+// Trust on first use: with nothing Pinned any key is accepted, after that only the pinned one. Whatever the
+// server presented is kept so the caller can pin it, or hold it for an admin to approve when it didn't match.
+type SFTPHostKeyCheck struct {
+	Pinned    string
+	Presented ssh.PublicKey
+	Mismatch  bool
+}
+
+func (check *SFTPHostKeyCheck) Callback() ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		check.Presented = key
+
+		if check.Pinned == "" {
+			return nil
+		}
+
+		pinnedKey, err := parseHostKey(check.Pinned)
+		if err != nil {
+			return errors.New("pinned host key is not readable: " + err.Error())
+		}
+
+		if !bytes.Equal(pinnedKey.Marshal(), key.Marshal()) {
+			check.Mismatch = true
+			return errors.New(fmt.Sprintf("host key for %s changed, expected %s but got %s", hostname, ssh.FingerprintSHA256(pinnedKey), ssh.FingerprintSHA256(key)))
+		}
+
+		return nil
+	}
+}
+
+// Keys are kept in authorized_keys format, e.g. "ssh-ed25519 AAAA..."
+func parseHostKey(hostKey string) (ssh.PublicKey, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+	return key, err
+}
+
+func formatHostKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func sftpAuthMethods(creds SFTPCredentials) ([]ssh.AuthMethod, error) {
+	auth := []ssh.AuthMethod{}
+
+	if creds.PrivateKey != "" {
+		var signer ssh.Signer
+		var err error
+		if creds.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(creds.PrivateKey), []byte(creds.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(creds.PrivateKey))
+		}
+		if err != nil {
+			return nil, errors.New("could not parse private key: " + err.Error())
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	if creds.Password != "" {
+		auth = append(auth, ssh.Password(creds.Password))
+	}
+
+	if len(auth) == 0 {
+		return nil, errors.New("no password or private key for " + creds.Username)
+	}
+
+	return auth, nil
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"unicode/utf8"
+)
+
+// Cuts a value down to fit a column of max bytes, backing off so a multibyte character isn't split
+func truncateString(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+
+	cut := max
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+	return value[:cut]
+}
@@ -57,7 +57,7 @@ func sendTestEmail() {
 		Source:        "Indeed",
 	}
 
-	err := sendTemplatedEmailSendGrid(emailHeaderInfo, JOB_APPLICATION_EMAIL_TEMPLATE, body)
+	err := sendNotification(Notification{Kind: NOTIFICATION_KIND_TEST, Email: emailHeaderInfo, Template: JOB_APPLICATION_EMAIL_TEMPLATE, Data: body})
 	if err != nil {
 		ErrorLog.Println("email test err: ", err)
 	}
@@ -30,6 +30,8 @@ type WebClockRequest struct {
 	CostCenters *[]WebClockCCArg `json:"cost_centers"`
 
 	IsFinalOut *bool `json:"is_final_out"`
+
+	Locale string `json:"locale"`
 }
 
 type WebClockNameRequest struct {
@@ -37,6 +39,7 @@ type WebClockNameRequest struct {
 	Username         string `json:"username"`
 	Password         string `json:"password"`
 	EmployeeID       string `json:"employee_id"`
+	Locale           string `json:"locale"`
 }
 
 type WebClockCCArg struct {
@@ -48,6 +51,7 @@ type WebClockAttestationRequest struct {
 	Company  *Company                    `json:"company"`
 	Answers  []WebClockAttestationAnswer `json:"answers"`
 	TimeData *opapi.EmployeeTimeEntries  `json:"time_data"`
+	Locale   string                      `json:"locale"`
 }
 
 type ByEndTimeInc []opapi.TimeEntry
@@ -127,6 +131,7 @@ type WebClockCCActionSetting struct {
 type WebClockAttestationSetting struct {
 	Active           bool                               `json:"active"`
 	SpanishAvailable bool                               `json:"spanish_available"`
+	Locales          []string                           `json:"locales"`
 	FirstStepID      *string                            `json:"first_step_id"`
 	LastStepID       *int                               `json:"last_step_id"`
 	StepIDs          []string                           `json:"step_ids"`
@@ -147,6 +152,13 @@ type WebClockAttestationStep struct {
 		NextStep       *string `json:"next_step"`
 		Value          *string `json:"value"`
 	} `json:"outcomes"`
+	// keyed by locale, steps without a translation fall back to DEFAULT_LOCALE
+	Translations map[string]WebClockAttestationStepText `json:"translations"`
+}
+
+type WebClockAttestationStepText struct {
+	Prompt        string            `json:"prompt"`
+	OutcomeLabels map[string]string `json:"outcome_labels"`
 }
 
 const (
@@ -156,22 +168,24 @@ const (
 )
 
 func webClockGetHandler(c *gin.Context) {
+	locale := negotiateLocale(c, c.Query("locale"))
+
 	shortname, _ := c.GetQuery("shortname")
 
 	co, err := lookupCompanyByShortname(shortname)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Company not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_COMPANY_NOT_FOUND)})
 		return
 	}
 
 	coProd, err := getCompanyProductByURL(co.ID, PRODUCT_WEBCLOCK_URL)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Company not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_COMPANY_NOT_FOUND)})
 		return
 	}
 
 	if coProd.Enabled != nil && !*coProd.Enabled {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Company not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_COMPANY_NOT_FOUND)})
 		return
 	}
 
@@ -179,11 +193,21 @@ func webClockGetHandler(c *gin.Context) {
 	ccs, err := getAllCostCentersWithCache(cxn, &co, false)
 	if err != nil {
 		ErrorLog.Println("err looking up companyID: ", co.OPID, " GetAllCompanyCostCenters: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Company not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_COMPANY_NOT_FOUND)})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"company": co, "settings": coProd.Settings, "costCenters": ccs})
+	response := gin.H{"company": co, "settings": coProd.Settings, "costCenters": ccs, "locale": locale}
+
+	webclockSetting := coProd.Settings.ToWebclockSetting()
+	if webclockSetting != nil {
+		response["available_locales"] = webclockSetting.Attestation.AvailableLocales()
+		response["attestation_text"] = webclockSetting.Attestation.LocalizedStepText(locale)
+	} else {
+		response["available_locales"] = []string{DEFAULT_LOCALE}
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 func webClockAttestationPostHandler(c *gin.Context) {
@@ -192,12 +216,14 @@ func webClockAttestationPostHandler(c *gin.Context) {
 	input := &WebClockAttestationRequest{}
 	if err := c.ShouldBindWith(input, binding.JSON); err != nil {
 		ErrorLog.Println("err binding webClockHandler json: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(negotiateLocale(c, ""), MSG_INPUT_WRONG_FORMAT)})
 		return
 	}
 
+	locale := negotiateLocale(c, input.Locale)
+
 	if input.Company == nil || input.TimeData == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_INPUT_WRONG_FORMAT)})
 		return
 	}
 
@@ -210,7 +236,7 @@ func webClockAttestationPostHandler(c *gin.Context) {
 	timeDataTemp, err := getEmployeeTimeEntries(input.Company, nil, empWjustID, 1, true)
 	if err != nil {
 		ErrorLog.Println("err getEmployeeTimeEntries: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 		return
 	}
 
@@ -278,23 +304,23 @@ func webClockAttestationPostHandler(c *gin.Context) {
 	if err != nil {
 		if opError != nil {
 			ErrorLog.Printf(logPrefix, "opError: %+v\n", opError.Errors)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 			return
 		} else {
 			ErrorLog.Printf(logPrefix, "err: %s\n", err.Error())
-			c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 			return
 		}
 	}
 	if len(opListResponse.Items) > 0 {
 		if opListResponse.Items[0].Status == "FAILURE" {
 			ErrorLog.Printf("%s opListResponse: %+v\n", logPrefix, opListResponse)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 			return
 		}
 	} else {
 		ErrorLog.Println(logPrefix, "len(opListResponse.Items) was 0")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 		return
 	}
 
@@ -321,28 +347,30 @@ func webClockNamePostHandler(c *gin.Context) {
 	input := &WebClockNameRequest{}
 	if err := c.ShouldBindWith(input, binding.JSON); err != nil {
 		ErrorLog.Println("err binding webClockHandler json: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(negotiateLocale(c, ""), MSG_INPUT_WRONG_FORMAT)})
 		return
 	}
 
+	locale := negotiateLocale(c, input.Locale)
+
 	logPrefix := fmt.Sprintf("webClock GETNAME [%s %s %s] ", input.CompanyShortname, input.Username, input.EmployeeID)
 
 	co, err := lookupCompanyByShortname(input.CompanyShortname)
 	if err != nil {
 		ErrorLog.Println(logPrefix, "lookupCompanyByShortname err: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Company not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_COMPANY_NOT_FOUND)})
 		return
 	}
 
 	var webclockSetting *WebClockSettings
 	coProd, err := getCompanyProductByURL(co.ID, "webclock")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Company not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_COMPANY_NOT_FOUND)})
 		return
 	}
 
 	if coProd.Enabled != nil && !*coProd.Enabled {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Company not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_COMPANY_NOT_FOUND)})
 		return
 	}
 
@@ -363,7 +391,7 @@ func webClockNamePostHandler(c *gin.Context) {
 
 		if !allowed {
 			ErrorLog.Println(logPrefix, "tried punch from disallowed IP ", clientIP)
-			statement := "Your company prohibits punches from your current public IP Address of " + clientIP
+			statement := localize(locale, MSG_PUNCH_FROM_DISALLOWED_IP, clientIP)
 			c.JSON(http.StatusBadRequest, gin.H{"error": statement})
 			return
 		}
@@ -394,12 +422,12 @@ func webClockNamePostHandler(c *gin.Context) {
 	}
 	if err != nil {
 		ErrorLog.Println(logPrefix, "findEmployeeByUsernameOrEmployeeID err: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Employee not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_EMPLOYEE_NOT_FOUND)})
 		return
 	}
 	if employee == nil {
 		ErrorLog.Println(logPrefix, "findEmployeeByUsernameOrEmployeeID err: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Employee not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_EMPLOYEE_NOT_FOUND)})
 		return
 	}
 
@@ -411,10 +439,12 @@ func webClockPostHandler(c *gin.Context) {
 	input := &WebClockRequest{}
 	if err := c.ShouldBindWith(input, binding.JSON); err != nil {
 		ErrorLog.Println("err binding webClockHandler json: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(negotiateLocale(c, ""), MSG_INPUT_WRONG_FORMAT)})
 		return
 	}
 
+	locale := negotiateLocale(c, input.Locale)
+
 	logPrefix := fmt.Sprintf("webClock [%s %s %s %s] ", input.CompanyShortname, input.Username, input.EmployeeID, input.PunchType)
 
 	switch input.PunchType {
@@ -422,26 +452,26 @@ func webClockPostHandler(c *gin.Context) {
 		break
 	default:
 		ErrorLog.Println(logPrefix, "err wrong punch type: ", input.PunchType)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_INPUT_WRONG_FORMAT)})
 		return
 	}
 
 	co, err := lookupCompanyByShortname(input.CompanyShortname)
 	if err != nil {
 		ErrorLog.Println(logPrefix, "lookupCompanyByShortname err: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Company not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_COMPANY_NOT_FOUND)})
 		return
 	}
 
 	var webclockSetting *WebClockSettings
 	coProd, err := getCompanyProductByURL(co.ID, "webclock")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Company not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_COMPANY_NOT_FOUND)})
 		return
 	}
 
 	if coProd.Enabled != nil && !*coProd.Enabled {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Company not found"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_COMPANY_NOT_FOUND)})
 		return
 	}
 
@@ -462,7 +492,7 @@ func webClockPostHandler(c *gin.Context) {
 
 		if !allowed {
 			ErrorLog.Println(logPrefix, "tried punch from disallowed IP ", clientIP)
-			statement := "Your company prohibits punches from your current public IP Address of " + clientIP
+			statement := localize(locale, MSG_PUNCH_FROM_DISALLOWED_IP, clientIP)
 			c.JSON(http.StatusBadRequest, gin.H{"error": statement})
 			return
 		}
@@ -503,7 +533,7 @@ func webClockPostHandler(c *gin.Context) {
 
 						if !found && webclockSetting.LocationByIP.Required {
 							ErrorLog.Println(logPrefix, "tried punch from disallowed IP ", clientIP)
-							statement := "Your company prohibits punches from your current public IP Address of " + clientIP
+							statement := localize(locale, MSG_PUNCH_FROM_DISALLOWED_IP, clientIP)
 							c.JSON(http.StatusBadRequest, gin.H{"error": statement})
 							return
 						}
@@ -568,7 +598,7 @@ func webClockPostHandler(c *gin.Context) {
 		resp, err, _ := opCxn.SendTimePunchesV1(punch)
 		if err != nil {
 			ErrorLog.Println(logPrefix, "SendTimePunchesV1 err: ", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "An error occurred"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 			return
 		}
 
@@ -579,11 +609,11 @@ func webClockPostHandler(c *gin.Context) {
 				return
 			}
 			ErrorLog.Println(logPrefix, "SendTimePunchesV1 FAILURE but no returned errors")
-			c.JSON(http.StatusBadRequest, gin.H{"error": "An unknown error occurred"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_UNKNOWN_ERROR_OCCURRED)})
 			return
 		}
 
-		response := gin.H{"message": "Punch successful"}
+		response := gin.H{"message": localize(locale, MSG_PUNCH_SUCCESSFUL)}
 
 		var timeData *opapi.EmployeeTimeEntries
 		if input.IsFinalOut != nil {
@@ -618,113 +648,118 @@ func webClockPostHandler(c *gin.Context) {
 		employee, err := findEmployeeByUsernameOrEmployeeID(nil, &input.EmployeeID, &co)
 		if err != nil {
 			ErrorLog.Println(logPrefix, err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Employee not found"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_EMPLOYEE_NOT_FOUND)})
 			return
 		}
 
 		if employee == nil {
 			ErrorLog.Println(logPrefix, "employee not found")
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Employee not found"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_EMPLOYEE_NOT_FOUND)})
 			return
 		}
 
-		// we must use specific timezone, because when looking for time in timesheet they send it in this zone
-		// the problem is, when using v1 time punch, it returns the timestamp from the server
-		// where as v2 does not, so we must use what we sent
+		webClockPunchEmployee(c, &co, input, employee, webclockSetting, locale, logPrefix)
+	}
+}
 
-		// alternative solution is to request the most recent punch from the api
+// Sends a v2 punch for an employee we already identified, used by both webclock and kiosk punches
+func webClockPunchEmployee(c *gin.Context, co *Company, input *WebClockRequest, employee *opapi.OPFullEmployeeRecord, webclockSetting *WebClockSettings, locale, logPrefix string) {
+	// we must use specific timezone, because when looking for time in timesheet they send it in this zone
+	// the problem is, when using v1 time punch, it returns the timestamp from the server
+	// where as v2 does not, so we must use what we sent
 
-		// this is still going to fail if Kronos sends back a different timezone since we compare strings
-		loc, err := time.LoadLocation("America/Los_Angeles")
-		if err != nil {
-			ErrorLog.Println(logPrefix, "timezone error:", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "An error occured"})
-			return
-		}
+	// alternative solution is to request the most recent punch from the api
 
-		timestamp := time.Now().In(loc).Format(timestampFormat)
-		if input.Timestamp != "" {
-			timestamp = input.Timestamp
-		}
-
-		punchType := ""
-		switch input.PunchType {
-		case "punch_in":
-			punchType = "PUNCH_IN"
-		case "punch_out":
-			punchType = "PUNCH_OUT"
-		case "punch":
-			punchType = "PUNCH"
-		case "change_ccs":
-			punchType = "CHANGE_CCS"
-		}
-		punch := opapi.TimePunch{
-			Employee: opapi.TimePunchEmployee{
-				AccountID: employee.ID,
-			},
-			RawType:   punchType,
-			Timestamp: timestamp,
-		}
+	// this is still going to fail if Kronos sends back a different timezone since we compare strings
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		ErrorLog.Println(logPrefix, "timezone error:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
+		return
+	}
 
-		if input.CostCenters != nil {
-			for _, cc := range *input.CostCenters {
-				punch.CostCenters = append(punch.CostCenters, opapi.TimePunchCC{Index: cc.Index, Value: opapi.TimePunchCCID{ID: cc.Value.ID}})
-			}
-		}
+	timestamp := time.Now().In(loc).Format(timestampFormat)
+	if input.Timestamp != "" {
+		timestamp = input.Timestamp
+	}
 
-		req := opapi.TimePunchRequest{Punches: []opapi.TimePunch{punch}}
+	punchType := ""
+	switch input.PunchType {
+	case "punch_in":
+		punchType = "PUNCH_IN"
+	case "punch_out":
+		punchType = "PUNCH_OUT"
+	case "punch":
+		punchType = "PUNCH"
+	case "change_ccs":
+		punchType = "CHANGE_CCS"
+	}
+	punch := opapi.TimePunch{
+		Employee: opapi.TimePunchEmployee{
+			AccountID: employee.ID,
+		},
+		RawType:   punchType,
+		Timestamp: timestamp,
+	}
 
-		cxn := chooseOPAPICxn(co.OPID)
-		_, resp, err, opError := cxn.SendTimePunches(co.OPID, &req)
-		if err != nil {
-			if opError != nil {
-				ErrorLog.Printf("PUNCH ERR | %v / %v calls after | opError: %+v\n", cxn.CallLimit.CurrentCalls, cxn.CallLimit.Threshold, opError.Errors)
-				c.JSON(http.StatusBadRequest, gin.H{"error": opError.String()})
-				return
-			} else {
-				ErrorLog.Printf("PUNCH ERR | %v / %v calls after | INTERNAL err: %s\n", cxn.CallLimit.CurrentCalls, cxn.CallLimit.Threshold, err.Error())
-				c.JSON(http.StatusBadRequest, gin.H{"error": "An error occurred"})
-				return
-			}
+	if input.CostCenters != nil {
+		for _, cc := range *input.CostCenters {
+			punch.CostCenters = append(punch.CostCenters, opapi.TimePunchCC{Index: cc.Index, Value: opapi.TimePunchCCID{ID: cc.Value.ID}})
 		}
+	}
+
+	req := opapi.TimePunchRequest{Punches: []opapi.TimePunch{punch}}
 
-		if len(resp.Items) > 0 && resp.Items[0].Status == "FAILURE" && len(resp.Items[0].Errors) > 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": resp.Items[0].Errors[0].Message})
+	cxn := chooseOPAPICxn(co.OPID)
+	_, resp, err, opError := cxn.SendTimePunches(co.OPID, &req)
+	if err != nil {
+		if opError != nil {
+			ErrorLog.Printf("PUNCH ERR | %v / %v calls after | opError: %+v\n", cxn.CallLimit.CurrentCalls, cxn.CallLimit.Threshold, opError.Errors)
+			c.JSON(http.StatusBadRequest, gin.H{"error": opError.String()})
+			return
+		} else {
+			ErrorLog.Printf("PUNCH ERR | %v / %v calls after | INTERNAL err: %s\n", cxn.CallLimit.CurrentCalls, cxn.CallLimit.Threshold, err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
 			return
 		}
+	}
 
-		InfoLog.Printf("%s SENT PUNCH | %v / %v calls after\n", logPrefix, cxn.CallLimit.CurrentCalls, cxn.CallLimit.Threshold)
+	if len(resp.Items) > 0 && resp.Items[0].Status == "FAILURE" && len(resp.Items[0].Errors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": resp.Items[0].Errors[0].Message})
+		return
+	}
 
-		response := gin.H{"message": "Punch successful"}
+	InfoLog.Printf("%s SENT PUNCH | %v / %v calls after\n", logPrefix, cxn.CallLimit.CurrentCalls, cxn.CallLimit.Threshold)
 
-		var timeData *opapi.EmployeeTimeEntries
-		if input.IsFinalOut != nil {
-			if *input.IsFinalOut == true {
-				if webclockSetting != nil {
-					if webclockSetting.Attestation.Active {
-						timeData, err = getEmployeeTimeEntries(&co, input, employee, 0, false)
-						if err != nil {
-							ErrorLog.Println(logPrefix, "getEmployeeTimeEntries error:", err)
-						} else {
-							response["time_data"] = timeData
-						}
-						// also give the time entries to webPunchPostProcess
+	response := gin.H{"message": localize(locale, MSG_PUNCH_SUCCESSFUL)}
+
+	var timeData *opapi.EmployeeTimeEntries
+	if input.IsFinalOut != nil {
+		if *input.IsFinalOut == true {
+			if webclockSetting != nil {
+				if webclockSetting.Attestation.Active {
+					timeData, err = getEmployeeTimeEntries(co, input, employee, 0, false)
+					if err != nil {
+						ErrorLog.Println(logPrefix, "getEmployeeTimeEntries error:", err)
+					} else {
+						response["time_data"] = timeData
 					}
+					// also give the time entries to webPunchPostProcess
 				}
 			}
 		}
+	}
 
-		if input.Photo != nil && *input.Photo != "" {
-			go webPunchPostProcess(&co, input, punchType, timestamp, employee, timeData)
-		}
+	if input.Photo != nil && *input.Photo != "" {
+		go webPunchPostProcess(co, input, punchType, timestamp, employee, timeData)
+	}
 
-		// deprecated
-		// if webclockSetting.ShowEmployeeName.Active {
-		// 	response["employee_name"] = employee.FirstName + " " + employee.LastName
-		// }
+	// deprecated
+	// if webclockSetting.ShowEmployeeName.Active {
+	// 	response["employee_name"] = employee.FirstName + " " + employee.LastName
+	// }
 
-		c.JSON(http.StatusOK, response)
-	}
+	c.JSON(http.StatusOK, response)
 }
 
 // daysBack: days ago you want start date to be. Useful to get TEs from yesterday and today to ensure you get all
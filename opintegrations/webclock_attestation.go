@@ -0,0 +1,497 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"opapi"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type WebClockAttestationFlowError struct {
+	StepID  string `json:"step_id,omitempty"`
+	Problem string `json:"problem"`
+	Message string `json:"message"`
+}
+
+type WebClockAttestationSimulateRequest struct {
+	// if nil, the company's saved attestation setting is used
+	Attestation *WebClockAttestationSetting `json:"attestation"`
+	TimeData    *opapi.EmployeeTimeEntries  `json:"time_data"`
+	Answers     []WebClockAttestationAnswer `json:"answers"`
+}
+
+type WebClockAttestationSimulatedStep struct {
+	StepID         string  `json:"step_id"`
+	Type           string  `json:"type"`
+	Inferred       bool    `json:"inferred"`
+	InferredResult *bool   `json:"inferred_result,omitempty"`
+	Value          *string `json:"value,omitempty"`
+	NextStep       *string `json:"next_step"`
+}
+
+type WebClockAttestationSimulateResponse struct {
+	Path       []WebClockAttestationSimulatedStep `json:"path"`
+	Completed  bool                               `json:"completed"`
+	WaitingOn  *string                            `json:"waiting_on,omitempty"`
+	StoppedBy  string                             `json:"stopped_by,omitempty"`
+	TotalHours float64                            `json:"total_hours"`
+	Took30     bool                               `json:"took_30"`
+	FlowErrors []WebClockAttestationFlowError     `json:"flow_errors"`
+}
+
+const (
+	ATTESTATIONERR_NO_FIRST_STEP       = "NO_FIRST_STEP"
+	ATTESTATIONERR_UNKNOWN_STEP_ID     = "UNKNOWN_STEP_ID"
+	ATTESTATIONERR_DANGLING_NEXT_STEP  = "DANGLING_NEXT_STEP"
+	ATTESTATIONERR_UNREACHABLE_STEP    = "UNREACHABLE_STEP"
+	ATTESTATIONERR_CYCLE               = "CYCLE"
+	ATTESTATIONERR_NO_TERMINAL_OUTCOME = "NO_TERMINAL_OUTCOME"
+	ATTESTATIONERR_BAD_CONDITION       = "BAD_CONDITION"
+)
+
+func webClockAttestationSimulateHandler(c *gin.Context) {
+	locale := negotiateLocale(c, c.Query("locale"))
+
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
+		return
+	}
+
+	input := &WebClockAttestationSimulateRequest{}
+	if err := c.ShouldBindWith(input, binding.JSON); err != nil {
+		ErrorLog.Println("err binding webClockAttestationSimulateHandler json: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_INPUT_WRONG_FORMAT)})
+		return
+	}
+
+	if input.Attestation == nil {
+		coProd, err := getCompanyProductByURL(thisCompany.ID, PRODUCT_WEBCLOCK_URL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_COMPANY_NOT_FOUND)})
+			return
+		}
+
+		webclockSetting := coProd.Settings.ToWebclockSetting()
+		if webclockSetting == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_ERROR_OCCURRED)})
+			return
+		}
+
+		input.Attestation = &webclockSetting.Attestation
+	}
+
+	timeEntries := []opapi.TimeEntry{}
+	if input.TimeData != nil {
+		timeEntries = input.TimeData.TimeEntries
+	}
+
+	resp := input.Attestation.Simulate(timeEntries, input.Answers)
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Returns every problem found in the flow, empty if the flow is usable
+func (a *WebClockAttestationSetting) Validate() []WebClockAttestationFlowError {
+	flowErrs := []WebClockAttestationFlowError{}
+
+	stepIDs := a.sortedStepIDs()
+
+	for _, stepID := range a.StepIDs {
+		if _, exists := a.Steps[stepID]; !exists {
+			flowErrs = append(flowErrs, WebClockAttestationFlowError{
+				StepID:  stepID,
+				Problem: ATTESTATIONERR_UNKNOWN_STEP_ID,
+				Message: fmt.Sprintf("Step %s is listed in step_ids but is not defined", stepID),
+			})
+		}
+	}
+
+	firstStepValid := false
+	if a.FirstStepID == nil || *a.FirstStepID == "" {
+		flowErrs = append(flowErrs, WebClockAttestationFlowError{
+			Problem: ATTESTATIONERR_NO_FIRST_STEP,
+			Message: "The attestation does not have a first step",
+		})
+	} else if _, exists := a.Steps[*a.FirstStepID]; !exists {
+		flowErrs = append(flowErrs, WebClockAttestationFlowError{
+			StepID:  *a.FirstStepID,
+			Problem: ATTESTATIONERR_NO_FIRST_STEP,
+			Message: fmt.Sprintf("The first step %s is not defined", *a.FirstStepID),
+		})
+	} else {
+		firstStepValid = true
+	}
+
+	for _, stepID := range stepIDs {
+		step := a.Steps[stepID]
+
+		for _, outcome := range step.Outcomes {
+			if outcome.NextStep == nil {
+				continue
+			}
+			if _, exists := a.Steps[*outcome.NextStep]; !exists {
+				flowErrs = append(flowErrs, WebClockAttestationFlowError{
+					StepID:  stepID,
+					Problem: ATTESTATIONERR_DANGLING_NEXT_STEP,
+					Message: fmt.Sprintf("Step %s points to next step %s which is not defined", stepID, *outcome.NextStep),
+				})
+			}
+		}
+
+		_, _, err := step.conditionBounds()
+		if err != nil {
+			flowErrs = append(flowErrs, WebClockAttestationFlowError{
+				StepID:  stepID,
+				Problem: ATTESTATIONERR_BAD_CONDITION,
+				Message: fmt.Sprintf("Step %s has an invalid inferred condition: %s", stepID, err.Error()),
+			})
+		}
+	}
+
+	if firstStepValid {
+		reached := map[string]bool{*a.FirstStepID: true}
+		queue := []string{*a.FirstStepID}
+		for len(queue) > 0 {
+			stepID := queue[0]
+			queue = queue[1:]
+
+			for _, nextID := range a.nextStepIDs(stepID) {
+				if !reached[nextID] {
+					reached[nextID] = true
+					queue = append(queue, nextID)
+				}
+			}
+		}
+
+		for _, stepID := range stepIDs {
+			if !reached[stepID] {
+				flowErrs = append(flowErrs, WebClockAttestationFlowError{
+					StepID:  stepID,
+					Problem: ATTESTATIONERR_UNREACHABLE_STEP,
+					Message: fmt.Sprintf("Step %s can never be reached from the first step", stepID),
+				})
+			}
+		}
+	}
+
+	// 0 = not visited, 1 = on the current path, 2 = done
+	visitState := make(map[string]int)
+	cycleReported := make(map[string]bool)
+	var visit func(stepID string)
+	visit = func(stepID string) {
+		visitState[stepID] = 1
+		for _, nextID := range a.nextStepIDs(stepID) {
+			switch visitState[nextID] {
+			case 0:
+				visit(nextID)
+			case 1:
+				if !cycleReported[nextID] {
+					cycleReported[nextID] = true
+					flowErrs = append(flowErrs, WebClockAttestationFlowError{
+						StepID:  nextID,
+						Problem: ATTESTATIONERR_CYCLE,
+						Message: fmt.Sprintf("Step %s loops back to step %s", stepID, nextID),
+					})
+				}
+			}
+		}
+		visitState[stepID] = 2
+	}
+	for _, stepID := range stepIDs {
+		if visitState[stepID] == 0 {
+			visit(stepID)
+		}
+	}
+
+	// a step can finish if one of its outcomes ends the flow, or leads to a step that can
+	canFinish := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, stepID := range stepIDs {
+			if canFinish[stepID] {
+				continue
+			}
+			for _, outcome := range a.Steps[stepID].Outcomes {
+				if outcome.NextStep == nil || canFinish[*outcome.NextStep] {
+					canFinish[stepID] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	for _, stepID := range stepIDs {
+		if !canFinish[stepID] {
+			flowErrs = append(flowErrs, WebClockAttestationFlowError{
+				StepID:  stepID,
+				Problem: ATTESTATIONERR_NO_TERMINAL_OUTCOME,
+				Message: fmt.Sprintf("No outcome of step %s ever finishes the attestation", stepID),
+			})
+		}
+	}
+
+	return flowErrs
+}
+
+// Walks the flow the same way the webclock would for the given time entries and answers
+func (a *WebClockAttestationSetting) Simulate(timeEntries []opapi.TimeEntry, answers []WebClockAttestationAnswer) WebClockAttestationSimulateResponse {
+	resp := WebClockAttestationSimulateResponse{
+		Path:       []WebClockAttestationSimulatedStep{},
+		FlowErrors: a.Validate(),
+	}
+
+	resp.TotalHours, resp.Took30 = summarizeAttestationTimeEntries(timeEntries)
+
+	answersByStep := make(map[string]WebClockAttestationAnswer)
+	for _, answer := range answers {
+		answersByStep[answer.StepID] = answer
+	}
+
+	if a.FirstStepID == nil {
+		resp.StoppedBy = "The attestation does not have a first step"
+		return resp
+	}
+
+	visited := make(map[string]bool)
+	stepID := *a.FirstStepID
+	for {
+		step, exists := a.Steps[stepID]
+		if !exists {
+			resp.StoppedBy = fmt.Sprintf("Step %s is not defined", stepID)
+			return resp
+		}
+
+		if visited[stepID] {
+			resp.StoppedBy = fmt.Sprintf("Step %s was reached twice", stepID)
+			return resp
+		}
+		visited[stepID] = true
+
+		simStep := WebClockAttestationSimulatedStep{
+			StepID:   stepID,
+			Type:     step.Type,
+			Inferred: step.IsInferred(),
+		}
+
+		var nextStep *string
+		outcomeFound := false
+		if simStep.Inferred {
+			result, err := step.EvaluateCondition(resp.TotalHours, resp.Took30)
+			if err != nil {
+				resp.Path = append(resp.Path, simStep)
+				resp.StoppedBy = fmt.Sprintf("Step %s has an invalid inferred condition: %s", stepID, err.Error())
+				return resp
+			}
+			simStep.InferredResult = &result
+
+			for _, outcome := range step.Outcomes {
+				if outcome.InferredResult != nil && *outcome.InferredResult == result {
+					nextStep = outcome.NextStep
+					outcomeFound = true
+					break
+				}
+			}
+		} else {
+			answer, answered := answersByStep[stepID]
+			if !answered {
+				resp.Path = append(resp.Path, simStep)
+				resp.WaitingOn = &stepID
+				return resp
+			}
+			value := answer.Value
+			simStep.Value = &value
+
+			for _, outcome := range step.Outcomes {
+				if outcome.Value != nil && *outcome.Value == answer.Value {
+					nextStep = outcome.NextStep
+					outcomeFound = true
+					break
+				}
+			}
+		}
+
+		simStep.NextStep = nextStep
+		resp.Path = append(resp.Path, simStep)
+
+		if !outcomeFound {
+			resp.StoppedBy = fmt.Sprintf("No outcome of step %s matches", stepID)
+			return resp
+		}
+
+		if nextStep == nil {
+			resp.Completed = true
+			return resp
+		}
+
+		stepID = *nextStep
+	}
+}
+
+func (a *WebClockAttestationSetting) sortedStepIDs() []string {
+	stepIDs := []string{}
+	for stepID := range a.Steps {
+		stepIDs = append(stepIDs, stepID)
+	}
+	sort.Strings(stepIDs)
+	return stepIDs
+}
+
+// Returns the next steps of stepID that exist in the flow
+func (a *WebClockAttestationSetting) nextStepIDs(stepID string) []string {
+	nextIDs := []string{}
+	for _, outcome := range a.Steps[stepID].Outcomes {
+		if outcome.NextStep == nil {
+			continue
+		}
+		if _, exists := a.Steps[*outcome.NextStep]; exists {
+			nextIDs = append(nextIDs, *outcome.NextStep)
+		}
+	}
+	return nextIDs
+}
+
+func (s WebClockAttestationStep) IsInferred() bool {
+	ic := s.InferredCondition
+	return ic.NotTake30 != nil ||
+		(ic.TotalHoursGte != nil && *ic.TotalHoursGte != "") ||
+		(ic.TotalHoursLte != nil && *ic.TotalHoursLte != "")
+}
+
+// Returns the gte and lte hours of the inferred condition, nil if not set
+func (s WebClockAttestationStep) conditionBounds() (*float64, *float64, error) {
+	var gte, lte *float64
+
+	if s.InferredCondition.TotalHoursGte != nil && *s.InferredCondition.TotalHoursGte != "" {
+		v, err := strconv.ParseFloat(strings.TrimSpace(*s.InferredCondition.TotalHoursGte), 64)
+		if err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("total_hours_gte %q is not a number", *s.InferredCondition.TotalHoursGte))
+		}
+		gte = &v
+	}
+
+	if s.InferredCondition.TotalHoursLte != nil && *s.InferredCondition.TotalHoursLte != "" {
+		v, err := strconv.ParseFloat(strings.TrimSpace(*s.InferredCondition.TotalHoursLte), 64)
+		if err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("total_hours_lte %q is not a number", *s.InferredCondition.TotalHoursLte))
+		}
+		lte = &v
+	}
+
+	return gte, lte, nil
+}
+
+// All conditions that are set must be true for the step to infer true
+func (s WebClockAttestationStep) EvaluateCondition(totalHours float64, took30 bool) (bool, error) {
+	gte, lte, err := s.conditionBounds()
+	if err != nil {
+		return false, err
+	}
+
+	result := true
+	if s.InferredCondition.NotTake30 != nil {
+		result = result && (!took30 == *s.InferredCondition.NotTake30)
+	}
+	if gte != nil {
+		result = result && totalHours >= *gte
+	}
+	if lte != nil {
+		result = result && totalHours <= *lte
+	}
+
+	return result, nil
+}
+
+// Returns total hours worked and whether there was a break of at least 30 minutes between entries
+func summarizeAttestationTimeEntries(timeEntries []opapi.TimeEntry) (float64, bool) {
+	type workedSpan struct {
+		start time.Time
+		end   time.Time
+	}
+
+	spans := []workedSpan{}
+	for _, te := range timeEntries {
+		startStr, endStr := te.StartTime, te.EndTime
+		if startStr == nil || *startStr == "" {
+			startStr = te.CalcStartTime
+		}
+		if endStr == nil || *endStr == "" {
+			endStr = te.CalcEndTime
+		}
+		if startStr == nil || endStr == nil {
+			continue
+		}
+
+		start, err := time.Parse(timestampFormat, *startStr)
+		if err != nil {
+			continue
+		}
+		end, err := time.Parse(timestampFormat, *endStr)
+		if err != nil || end.Before(start) {
+			continue
+		}
+
+		spans = append(spans, workedSpan{start: start, end: end})
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start.Before(spans[j].start) })
+
+	total := time.Duration(0)
+	took30 := false
+	for i, span := range spans {
+		total += span.end.Sub(span.start)
+		if i > 0 && span.start.Sub(spans[i-1].end) >= 30*time.Minute {
+			took30 = true
+		}
+	}
+
+	return total.Hours(), took30
+}
+
+// English is always available, Spanish is included for settings saved with the older spanish_available flag
+func (a *WebClockAttestationSetting) AvailableLocales() []string {
+	locales := []string{DEFAULT_LOCALE}
+	seen := map[string]bool{DEFAULT_LOCALE: true}
+
+	candidates := a.Locales
+	if a.SpanishAvailable {
+		candidates = append([]string{LOCALE_SPANISH}, candidates...)
+	}
+
+	for _, candidate := range candidates {
+		locale, supported := matchSupportedLocale(candidate)
+		if !supported || seen[locale] {
+			continue
+		}
+		seen[locale] = true
+		locales = append(locales, locale)
+	}
+
+	return locales
+}
+
+// Returns each step's text for the locale, keyed by step ID
+func (a *WebClockAttestationSetting) LocalizedStepText(locale string) map[string]WebClockAttestationStepText {
+	texts := map[string]WebClockAttestationStepText{}
+	for stepID, step := range a.Steps {
+		texts[stepID] = step.LocalizedText(locale)
+	}
+
+	return texts
+}
+
+func (s WebClockAttestationStep) LocalizedText(locale string) WebClockAttestationStepText {
+	if text, found := s.Translations[locale]; found && text.Prompt != "" {
+		return text
+	}
+
+	return s.Translations[DEFAULT_LOCALE]
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// A shared tablet registered to a company, punches from it are identified by badge or PIN instead of OP credentials
+type WebClockKioskDevice struct {
+	ID          int64  `db:"id, primarykey, autoincrement" json:"id"`
+	Token       string `db:"token" json:"token"`
+	CompanyID   int64  `db:"company_id" json:"company_id"`
+	DisplayName string `db:"display_name" json:"display_name"`
+	IP          string `db:"ip" json:"ip"`
+	LastUsed    int64  `db:"last_used" json:"last_used"`
+	Created     int64  `db:"created" json:"created"`
+	Revoked     bool   `db:"revoked" json:"revoked"`
+}
+
+type WebClockKioskCredential struct {
+	ID                int64   `db:"id, primarykey, autoincrement" json:"id"`
+	CompanyID         int64   `db:"company_id" json:"company_id"`
+	EmployeeAccountID int64   `db:"employee_account_id" json:"employee_account_id"`
+	BadgeNumber       *string `db:"badge_number" json:"badge_number"`
+	PINHash           string  `db:"pin_hash" json:"-"`
+	FailedAttempts    int     `db:"failed_attempts" json:"failed_attempts"`
+	LockedUntil       int64   `db:"locked_until" json:"locked_until"`
+}
+
+type NewWebClockKioskRequest struct {
+	Name string `json:"name"`
+}
+
+type WebClockKioskCredentialRequest struct {
+	EmployeeAccountID int64  `json:"employee_account_id"`
+	BadgeNumber       string `json:"badge_number"`
+	PIN               string `json:"pin"`
+}
+
+type WebClockKioskPunchRequest struct {
+	WebClockRequest
+
+	KioskToken  string `json:"kiosk_token"`
+	BadgeNumber string `json:"badge_number"`
+	PIN         string `json:"pin"`
+}
+
+const (
+	KIOSK_MAX_FAILED_PINS  = 5
+	KIOSK_LOCKOUT_DURATION = 15 * time.Minute
+	KIOSK_MIN_PIN_LENGTH   = 4
+)
+
+func registerWebClockKioskRoutes(router *gin.Engine) {
+	router.GET("/api/tlm/webclock/kiosks", getWebClockKiosksHandler)
+	router.POST("/api/tlm/webclock/kiosks", newWebClockKioskHandler)
+	router.POST("/api/tlm/webclock/kiosks/:kioskToken/update", updateWebClockKioskHandler)
+	router.POST("/api/tlm/webclock/kiosks/:kioskToken/revoke", revokeWebClockKioskHandler)
+	router.POST("/api/tlm/webclock/kiosks/credentials", setWebClockKioskCredentialHandler)
+	router.POST("/api/tlm/webclock/kiosks/credentials/:accountID/unlock", unlockWebClockKioskCredentialHandler)
+	router.POST("/api/tlm/webclock/kiosk/punch", webClockKioskPunchHandler)
+}
+
+func getWebClockKiosksHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	kiosks, err := getAllCompanyWebClockKiosks(thisCompany)
+	if err != nil {
+		ErrorLog.Println("getAllCompanyWebClockKiosks err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occurred"})
+		return
+	}
+
+	c.JSON(http.StatusOK, kiosks)
+}
+
+func newWebClockKioskHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	input := &NewWebClockKioskRequest{}
+	if err := c.ShouldBindWith(input, binding.JSON); err != nil {
+		ErrorLog.Println("err binding newWebClockKioskHandler json: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	newKiosk, err := newWebClockKiosk(thisCompany, c.GetHeader("X-Real-IP"), input.Name)
+	if err != nil {
+		ErrorLog.Println("newWebClockKiosk err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occurred"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newKiosk)
+}
+
+func updateWebClockKioskHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	input := struct {
+		NewName string `json:"display_name"`
+	}{}
+	if err := c.ShouldBindWith(&input, binding.JSON); err != nil {
+		ErrorLog.Println("err binding updateWebClockKioskHandler json: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	kiosk, err := getWebClockKioskByToken(c.Param("kioskToken"))
+	if err != nil || kiosk.CompanyID != thisCompany.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kiosk does not exist"})
+		return
+	}
+
+	if input.NewName != "" {
+		kiosk.DisplayName = input.NewName
+	}
+
+	_, err = dbmap.Update(kiosk)
+	if err != nil {
+		ErrorLog.Println("updateWebClockKioskHandler update err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occurred"})
+		return
+	}
+
+	c.JSON(http.StatusOK, kiosk)
+}
+
+func revokeWebClockKioskHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	kiosk, err := getWebClockKioskByToken(c.Param("kioskToken"))
+	if err != nil || kiosk.CompanyID != thisCompany.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kiosk does not exist"})
+		return
+	}
+
+	kiosk.Revoked = true
+	_, err = dbmap.Update(kiosk)
+	if err != nil {
+		ErrorLog.Println("revokeWebClockKioskHandler update err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occurred"})
+		return
+	}
+
+	c.JSON(http.StatusOK, kiosk)
+}
+
+// Creates or replaces the badge number and/or PIN an employee uses at kiosks
+func setWebClockKioskCredentialHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	input := &WebClockKioskCredentialRequest{}
+	if err := c.ShouldBindWith(input, binding.JSON); err != nil {
+		ErrorLog.Println("err binding setWebClockKioskCredentialHandler json: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	if input.EmployeeAccountID == 0 || (input.BadgeNumber == "" && input.PIN == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Input is wrong format"})
+		return
+	}
+
+	if input.PIN != "" {
+		if len(input.PIN) < KIOSK_MIN_PIN_LENGTH {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("PIN must be at least %d digits", KIOSK_MIN_PIN_LENGTH)})
+			return
+		}
+		if _, err := strconv.ParseUint(input.PIN, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "PIN must only contain digits"})
+			return
+		}
+	}
+
+	// the account ID comes from the client, OP only finds it in this company
+	cxn := chooseOPAPICxn(thisCompany.OPID)
+	_, err = cxn.GetFullEmployeeInfo(input.EmployeeAccountID, thisCompany.OPID)
+	if err != nil {
+		ErrorLog.Println("setWebClockKioskCredentialHandler GetFullEmployeeInfo err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Employee not found"})
+		return
+	}
+
+	if input.BadgeNumber != "" {
+		existing, err := getWebClockKioskCredentialByBadge(thisCompany.ID, input.BadgeNumber)
+		if err == nil && existing.EmployeeAccountID != input.EmployeeAccountID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Badge number is already assigned"})
+			return
+		}
+	}
+
+	cred, err := getWebClockKioskCredentialByAccountID(thisCompany.ID, input.EmployeeAccountID)
+	isNew := err != nil
+	if isNew {
+		cred = &WebClockKioskCredential{
+			CompanyID:         thisCompany.ID,
+			EmployeeAccountID: input.EmployeeAccountID,
+		}
+	}
+
+	if input.BadgeNumber != "" {
+		cred.BadgeNumber = &input.BadgeNumber
+	}
+
+	if input.PIN != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(input.PIN), bcrypt.DefaultCost)
+		if err != nil {
+			ErrorLog.Println("setWebClockKioskCredentialHandler bcrypt err: ", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "An error occurred"})
+			return
+		}
+		cred.PINHash = string(hash)
+		cred.FailedAttempts = 0
+		cred.LockedUntil = 0
+	}
+
+	if isNew {
+		err = dbmap.Insert(cred)
+	} else {
+		_, err = dbmap.Update(cred)
+	}
+	if err != nil {
+		ErrorLog.Println("setWebClockKioskCredentialHandler save err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occurred"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cred)
+}
+
+func unlockWebClockKioskCredentialHandler(c *gin.Context) {
+	thisCompany, err := lookupCompany(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not authorized"})
+		return
+	}
+
+	accountID, err := strconv.ParseInt(c.Param("accountID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Employee not found"})
+		return
+	}
+
+	cred, err := getWebClockKioskCredentialByAccountID(thisCompany.ID, accountID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Employee not found"})
+		return
+	}
+
+	cred.FailedAttempts = 0
+	cred.LockedUntil = 0
+	_, err = dbmap.Update(cred)
+	if err != nil {
+		ErrorLog.Println("unlockWebClockKioskCredentialHandler update err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An error occurred"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cred)
+}
+
+// Kiosk punches are authorized by the device token, so the webclock IP allow list does not apply
+func webClockKioskPunchHandler(c *gin.Context) {
+	input := &WebClockKioskPunchRequest{}
+	if err := c.ShouldBindWith(input, binding.JSON); err != nil {
+		ErrorLog.Println("err binding webClockKioskPunchHandler json: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(negotiateLocale(c, ""), MSG_INPUT_WRONG_FORMAT)})
+		return
+	}
+
+	locale := negotiateLocale(c, input.Locale)
+
+	logPrefix := fmt.Sprintf("webClock KIOSK [%s %s %s] ", input.KioskToken, input.BadgeNumber, input.PunchType)
+
+	switch input.PunchType {
+	case "punch", "punch_in", "punch_out", "change_ccs":
+		break
+	default:
+		ErrorLog.Println(logPrefix, "err wrong punch type: ", input.PunchType)
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_INPUT_WRONG_FORMAT)})
+		return
+	}
+
+	kiosk, err := getWebClockKioskByToken(input.KioskToken)
+	if err != nil || kiosk.Revoked {
+		ErrorLog.Println(logPrefix, "kiosk not found or revoked")
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_NOT_AUTHORIZED)})
+		return
+	}
+
+	co, err := lookupCompanyByID(kiosk.CompanyID)
+	if err != nil {
+		ErrorLog.Println(logPrefix, "lookupCompanyByID err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_COMPANY_NOT_FOUND)})
+		return
+	}
+
+	coProd, err := getCompanyProductByURL(co.ID, PRODUCT_WEBCLOCK_URL)
+	if err != nil || (coProd.Enabled != nil && !*coProd.Enabled) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_COMPANY_NOT_FOUND)})
+		return
+	}
+
+	var cred *WebClockKioskCredential
+	if input.BadgeNumber != "" {
+		cred, err = getWebClockKioskCredentialByBadge(co.ID, input.BadgeNumber)
+	} else if input.EmployeeID != "" {
+		// PIN login, the employee ID tells us whose PIN to check
+		employee, findErr := findEmployeeByUsernameOrEmployeeID(nil, &input.EmployeeID, &co)
+		if findErr != nil || employee == nil {
+			ErrorLog.Println(logPrefix, "findEmployeeByUsernameOrEmployeeID err: ", findErr)
+			c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_EMPLOYEE_NOT_FOUND)})
+			return
+		}
+		cred, err = getWebClockKioskCredentialByAccountID(co.ID, int64(employee.ID))
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_INPUT_WRONG_FORMAT)})
+		return
+	}
+	if err != nil {
+		ErrorLog.Println(logPrefix, "kiosk credential lookup err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_EMPLOYEE_NOT_FOUND)})
+		return
+	}
+
+	if cred.IsLocked(time.Now()) {
+		ErrorLog.Println(logPrefix, "kiosk credential locked for account ", cred.EmployeeAccountID)
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_KIOSK_LOCKED)})
+		return
+	}
+
+	// a badge alone is enough unless the employee also has a PIN set
+	if cred.PINHash != "" || input.BadgeNumber == "" {
+		if !cred.CheckPIN(input.PIN) {
+			ErrorLog.Println(logPrefix, "wrong PIN for account ", cred.EmployeeAccountID)
+			c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_KIOSK_WRONG_PIN)})
+			return
+		}
+	}
+
+	cxn := chooseOPAPICxn(co.OPID)
+	employee, err := cxn.GetFullEmployeeInfo(cred.EmployeeAccountID, co.OPID)
+	if err != nil {
+		ErrorLog.Println(logPrefix, "GetFullEmployeeInfo err: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": localize(locale, MSG_EMPLOYEE_NOT_FOUND)})
+		return
+	}
+
+	kiosk.IP = c.GetHeader("X-Real-IP")
+	kiosk.LastUsed = time.Now().Unix()
+	dbmap.Update(kiosk)
+
+	// never fall into the v1 username/password path from a kiosk
+	punchRequest := input.WebClockRequest
+	punchRequest.CompanyShortname = co.ShortName
+	punchRequest.Username = ""
+	punchRequest.Password = ""
+
+	webClockPunchEmployee(c, &co, &punchRequest, &employee, coProd.Settings.ToWebclockSetting(), locale, logPrefix)
+}
+
+func newWebClockKiosk(company Company, ipAddress, name string) (*WebClockKioskDevice, error) {
+	newToken, err := generateNewToken()
+	if err != nil {
+		return nil, err
+	}
+
+	nameToUse := name
+	if name == "" {
+		existingKiosks, err := getAllCompanyWebClockKiosks(company)
+		if err != nil {
+			return nil, err
+		}
+
+		nameToUse = fmt.Sprintf("Kiosk #%d", len(existingKiosks)+1)
+	}
+
+	kiosk := &WebClockKioskDevice{
+		Token:       newToken,
+		CompanyID:   company.ID,
+		DisplayName: nameToUse,
+		IP:          ipAddress,
+		Created:     time.Now().Unix(),
+	}
+
+	err = dbmap.Insert(kiosk)
+	if err != nil {
+		return nil, err
+	}
+
+	return kiosk, nil
+}
+
+func getAllCompanyWebClockKiosks(company Company) ([]WebClockKioskDevice, error) {
+	kiosks := []WebClockKioskDevice{}
+	_, err := dbmap.Select(&kiosks, "SELECT * FROM webclock_kiosk_devices WHERE company_id = ?", company.ID)
+	return kiosks, err
+}
+
+func getWebClockKioskByToken(token string) (*WebClockKioskDevice, error) {
+	kiosk := &WebClockKioskDevice{}
+	err := dbmap.SelectOne(kiosk, "SELECT * FROM webclock_kiosk_devices WHERE token = ?", token)
+	return kiosk, err
+}
+
+func getWebClockKioskCredentialByBadge(companyID int64, badgeNumber string) (*WebClockKioskCredential, error) {
+	cred := &WebClockKioskCredential{}
+	err := dbmap.SelectOne(cred, "SELECT * FROM webclock_kiosk_credentials WHERE company_id = ? AND badge_number = ?", companyID, badgeNumber)
+	return cred, err
+}
+
+func getWebClockKioskCredentialByAccountID(companyID, accountID int64) (*WebClockKioskCredential, error) {
+	cred := &WebClockKioskCredential{}
+	err := dbmap.SelectOne(cred, "SELECT * FROM webclock_kiosk_credentials WHERE company_id = ? AND employee_account_id = ?", companyID, accountID)
+	return cred, err
+}
+
+func (cred *WebClockKioskCredential) IsLocked(now time.Time) bool {
+	return cred.LockedUntil > now.Unix()
+}
+
+// Checks the PIN and records the attempt, locking the credential after KIOSK_MAX_FAILED_PINS misses
+func (cred *WebClockKioskCredential) CheckPIN(pin string) bool {
+	if cred.PINHash != "" && pin != "" && bcrypt.CompareHashAndPassword([]byte(cred.PINHash), []byte(pin)) == nil {
+		if cred.FailedAttempts > 0 || cred.LockedUntil > 0 {
+			cred.FailedAttempts = 0
+			cred.LockedUntil = 0
+			dbmap.Update(cred)
+		}
+		return true
+	}
+
+	cred.FailedAttempts++
+	if cred.FailedAttempts >= KIOSK_MAX_FAILED_PINS {
+		cred.LockedUntil = time.Now().Add(KIOSK_LOCKOUT_DURATION).Unix()
+		cred.FailedAttempts = 0
+	}
+	dbmap.Update(cred)
+
+	return false
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"google.golang.org/api/idtoken"
+)
+
+// Every message we accepted, kept long enough to spot a provider or an attacker sending it again
+type WebhookMessage struct {
+	ID        int64  `db:"id, primarykey, autoincrement" json:"id"`
+	Source    string `db:"source,size:50" json:"source"`
+	MessageID string `db:"message_id,size:255" json:"message_id"`
+	Received  int64  `db:"received" json:"received"`
+}
+
+// What a verifier learned about a message, either can be empty when the provider doesn't send it
+type InboundWebhookMessage struct {
+	ID     string
+	SentAt time.Time
+}
+
+// Checks a request really came from the provider, the body is the raw bytes the signature covers
+type InboundWebhookVerifier func(c *gin.Context, body []byte) (InboundWebhookMessage, error)
+
+const (
+	WEBHOOK_SOURCE_BGC        = "background_checks"
+	WEBHOOK_SOURCE_GOOGLEHIRE = "googlehire"
+	WEBHOOK_SOURCE_JOB_APPS   = "job_applications"
+	WEBHOOK_SOURCE_SMS        = "sms"
+
+	// the timestamp is when the event happened and retries keep it, Checkr retries for up to 72 hours. Replays
+	// inside the window are caught by the message id, so retention has to stay longer than this.
+	WEBHOOK_MAX_AGE           = 4 * 24 * time.Hour
+	WEBHOOK_MAX_CLOCK_SKEW    = 2 * time.Minute
+	WEBHOOK_MESSAGE_RETENTION = 7 * 24 * time.Hour
+
+	INDEED_SIGNATURE_HEADER   = "X-Indeed-Signature"
+	TWILIO_SIGNATURE_HEADER   = "X-Twilio-Signature"
+	MYSQL_DUPLICATE_KEY_ERROR = 1062
+)
+
+// Integrations set up before their callback urls carried a token keep posting without one until they've been
+// given the new url. Until then a missing token is let through and logged, a wrong one is still refused.
+var webhookTokenOptionalUntil = time.Date(2026, time.December, 15, 0, 0, 0, 0, time.UTC)
+
+// Wraps an inbound provider callback: rejects anything the verifier doesn't accept, anything too old,
+// and anything we've already seen. The body is put back so the handler can bind it as usual.
+func verifyInboundWebhook(source string, verifier InboundWebhookVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			rejectInboundWebhook(c, source, http.StatusBadRequest, "could not read body: "+err.Error())
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		message, err := verifier(c, body)
+		if err != nil {
+			rejectInboundWebhook(c, source, http.StatusUnauthorized, err.Error())
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		if !message.SentAt.IsZero() {
+			age := time.Since(message.SentAt)
+			if age > WEBHOOK_MAX_AGE || age < -WEBHOOK_MAX_CLOCK_SKEW {
+				rejectInboundWebhook(c, source, http.StatusUnauthorized, fmt.Sprintf("timestamp out of range: %s", message.SentAt.Format(time.RFC3339)))
+				return
+			}
+		}
+
+		if message.ID != "" {
+			seen, err := recordWebhookMessage(source, message.ID)
+			if err != nil {
+				// letting it through beats dropping real messages while the db is struggling
+				ErrorLog.Printf("verifyInboundWebhook %s record message err: %v\n", source, err)
+			}
+			if seen {
+				ErrorLog.Printf("inbound webhook REPLAY dropped - source: %s, message: %s, ip: %s\n", source, message.ID, c.GetHeader("X-Real-IP"))
+				// 200 so a provider retrying something we already handled stops retrying
+				c.AbortWithStatusJSON(http.StatusOK, gin.H{"msg": "Duplicate"})
+				return
+			}
+		}
+
+		c.Next()
+
+		// only a message we took counts as seen, a retry of one we turned away has to get another try
+		if message.ID != "" && (c.Writer.Status() < http.StatusOK || c.Writer.Status() >= http.StatusMultipleChoices) {
+			dbmap.Exec("DELETE FROM webhook_messages WHERE source = ? AND message_id = ?", source, message.ID)
+		}
+	}
+}
+
+func rejectInboundWebhook(c *gin.Context, source string, status int, reason string) {
+	ErrorLog.Printf("inbound webhook REJECTED - source: %s, path: %s, ip: %s, reason: %s\n", source, c.Request.URL.Path, c.GetHeader("X-Real-IP"), reason)
+	c.AbortWithStatusJSON(status, gin.H{"error": "Not authorized"})
+}
+
+// The unique index does the work so two deliveries racing each other can't both get through
+func recordWebhookMessage(source, messageID string) (bool, error) {
+	messageID = truncateString(messageID, 255)
+
+	err := dbmap.Insert(&WebhookMessage{Source: source, MessageID: messageID, Received: time.Now().Unix()})
+	if err == nil {
+		return false, nil
+	}
+
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == MYSQL_DUPLICATE_KEY_ERROR {
+		return true, nil
+	}
+
+	return false, err
+}
+
+func purgeWebhookMessages() {
+	cutoff := time.Now().Add(-WEBHOOK_MESSAGE_RETENTION).Unix()
+	_, err := dbmap.Exec("DELETE FROM webhook_messages WHERE received < ?", cutoff)
+	if err != nil {
+		ErrorLog.Println("purgeWebhookMessages err: ", err)
+	}
+}
+
+// Without a secret configured there's nothing to check against, only allowed off production
+func webhookSecretMissing(name string) error {
+	if env.Production {
+		return errors.New(name + " is not configured")
+	}
+
+	InfoLog.Printf("%s is not configured, would be rejected in production\n", name)
+	return nil
+}
+
+// base64 HMAC-SHA1 of the raw body, keyed with our Indeed Apply API secret
+func verifyIndeedSignature(secret string, body []byte, signature string) error {
+	if secret == "" {
+		return webhookSecretMissing("INDEED_APPLY_SECRET")
+	}
+
+	if signature == "" {
+		return errors.New("missing " + INDEED_SIGNATURE_HEADER)
+	}
+
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(body)
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("invalid " + INDEED_SIGNATURE_HEADER)
+	}
+
+	return nil
+}
+
+// For providers that can only be given a url to post to, a secret token in that url
+func verifySharedSecret(secret, given, name string) error {
+	if given == "" && time.Now().Before(webhookTokenOptionalUntil) {
+		ErrorLog.Printf("inbound webhook for %s has no token, allowed until %s\n", name, webhookTokenOptionalUntil.Format("2006-01-02"))
+		return nil
+	}
+
+	if secret == "" {
+		return webhookSecretMissing(name)
+	}
+
+	if given == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(given)) != 1 {
+		return errors.New("invalid token for " + name)
+	}
+
+	return nil
+}
+
+// Pub/Sub push subscriptions send a Google signed JWT, it has to be for our audience and our push service account
+func verifyPubSubPushJWT(c *gin.Context, body []byte) (InboundWebhookMessage, error) {
+	message := InboundWebhookMessage{}
+
+	if passwords.PUBSUB_PUSH_AUDIENCE == "" {
+		err := webhookSecretMissing("PUBSUB_PUSH_AUDIENCE")
+		if err != nil {
+			return message, err
+		}
+	} else {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			return message, errors.New("missing bearer token")
+		}
+
+		payload, err := idtoken.Validate(context.Background(), token, passwords.PUBSUB_PUSH_AUDIENCE)
+		if err != nil {
+			return message, errors.New("invalid push token: " + err.Error())
+		}
+
+		email, _ := payload.Claims["email"].(string)
+		verified, _ := payload.Claims["email_verified"].(bool)
+		if !verified || (passwords.PUBSUB_PUSH_SERVICE_ACCOUNT != "" && email != passwords.PUBSUB_PUSH_SERVICE_ACCOUNT) {
+			return message, errors.New("push token from unexpected account: " + email)
+		}
+	}
+
+	webhookBody := GoogleHireWebhookBody{}
+	err := json.Unmarshal(body, &webhookBody)
+	if err != nil {
+		return message, errors.New("body is not a push message: " + err.Error())
+	}
+
+	message.ID = webhookBody.Message.MessageID
+	if message.ID == "" {
+		message.ID = webhookBody.Message.MessageIDu
+	}
+
+	// Pub/Sub keeps redelivering with the original publish time, so only the id guards against replays
+	return message, nil
+}
+
+// Indeed signs its applications, ZipRecruiter can only be given a url so it carries a token
+func verifyJobApplicationWebhook(c *gin.Context, body []byte) (InboundWebhookMessage, error) {
+	message := InboundWebhookMessage{}
+
+	switch c.Query("source") {
+	case INDEED_INTEGRATION_URL:
+		err := verifyIndeedSignature(passwords.INDEED_APPLY_SECRET, body, c.GetHeader(INDEED_SIGNATURE_HEADER))
+		if err != nil {
+			return message, err
+		}
+
+		indeedApp := IndeedJobAppPost{}
+		if json.Unmarshal(body, &indeedApp) == nil && indeedApp.ID != "" {
+			message.ID = INDEED_INTEGRATION_URL + ":" + indeedApp.ID
+		}
+	case ZIPRECRUITER_INTEGRATION_URL:
+		err := verifySharedSecret(passwords.ZIPRECRUITER_WEBHOOK_SECRET, c.Query("token"), "ZIPRECRUITER_WEBHOOK_SECRET")
+		if err != nil {
+			return message, err
+		}
+
+		zrApp := ZRJobAppPost{}
+		if json.Unmarshal(body, &zrApp) == nil && zrApp.AppID != "" {
+			message.ID = ZIPRECRUITER_INTEGRATION_URL + ":" + zrApp.AppID
+		}
+	default:
+		return message, errors.New("unknown source: " + c.Query("source"))
+	}
+
+	return message, nil
+}
+
+// Twilio signs the url plus the sorted form params with our auth token
+func verifyTwilioWebhook(c *gin.Context, body []byte) (InboundWebhookMessage, error) {
+	message := InboundWebhookMessage{}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return message, errors.New("body is not a form: " + err.Error())
+	}
+
+	provider := newTwilioSMSProvider()
+	if !validTwilioSignature(provider.AuthToken, SMS_INBOUND_URL, form, c.GetHeader(TWILIO_SIGNATURE_HEADER)) {
+		return message, errors.New("invalid " + TWILIO_SIGNATURE_HEADER)
+	}
+
+	message.ID = form.Get("MessageSid")
+
+	return message, nil
+}